@@ -8,15 +8,17 @@ import (
 
 	"github.com/sinfirst/GophKeeper/internal/client"
 	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
 	"github.com/sinfirst/GophKeeper/internal/models"
 	"github.com/sinfirst/GophKeeper/internal/tui"
 	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
 	config := config.NewConfig()
-	client := client.NewClient(config.Host)
-	t := tui.TUI{Client: client}
+	client := client.NewClient(config.Host, config.VaultDir)
+	t := tui.TUI{Client: client, IdleTimeout: config.IdleLock}
 	tui.StartTUI(t)
 
 }
@@ -33,12 +35,13 @@ func TestFunc(c pb.GophKeeperClient) {
 		fmt.Println(err, "1")
 		fmt.Println("marshal")
 	}
-	id, err := c.StoreData(context.Background(), &pb.StoreRequest{Token: token.Token, Record: &pb.DataRecord{Type: "LOGIN", Data: jsonReq, Meta: "Test login req"}})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.MetadataKey, auth.BearerScheme+" "+token.Token)
+	id, err := c.StoreData(ctx, &pb.StoreRequest{Record: &pb.DataRecord{Type: "LOGIN", Data: jsonReq, Meta: "Test login req"}})
 	if err != nil {
 		fmt.Println(err, "1")
 		fmt.Println("store")
 	}
-	record, err := c.RetrieveData(context.Background(), &pb.RetrieveRequest{Token: token.Token, Id: id.Id})
+	record, err := c.RetrieveData(ctx, &pb.RetrieveRequest{Id: id.Id})
 	if err != nil {
 		fmt.Println(err, "2")
 		fmt.Println("record")
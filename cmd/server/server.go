@@ -1,35 +1,122 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/sinfirst/GophKeeper/internal/app"
-	"github.com/sinfirst/GophKeeper/internal/config"
+	cfg "github.com/sinfirst/GophKeeper/internal/config"
 	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
 	"github.com/sinfirst/GophKeeper/internal/middleware/logging"
 	"github.com/sinfirst/GophKeeper/internal/storage"
+	"github.com/sinfirst/GophKeeper/internal/storage/blob"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
 	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
 	"google.golang.org/grpc"
 )
 
+// purgeInterval как часто сервер удаляет просроченные записи из корзины, брошенные загрузки
+// и blob без ссылок
+const purgeInterval = time.Hour
+
 func main() {
-	config := config.NewConfig()
+	config := cfg.NewConfig()
 	logger := logging.NewLogger()
-	stg := storage.NewPGDB(config, logger)
-	handlers := handlers.NewHandler(stg, config)
-	err := storage.InitMigrations(config, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// server [флаги] migrate up|down|status|redo управляет схемой БД и завершается
+	if args := flag.Args(); len(args) > 0 {
+		if len(args) != 2 || args[0] != "migrate" {
+			logger.Fatalf("usage: server [flags] migrate %s", strings.Join(storage.MigrateCommands, "|"))
+		}
+		if err := storage.Migrate(ctx, config, args[1], logger); err != nil {
+			logger.Fatalw("can't run migrations", err)
+		}
+		return
+	}
+
+	var keys *envelope.Keyring
+	if config.MasterKeyFile != "" {
+		var err error
+		keys, err = envelope.LoadKeyring(config.MasterKeyFile)
+		if err != nil {
+			logger.Fatalw("can't load master keys", err)
+		}
+	}
+
+	tokenKeys, err := auth.LoadKeyring(config.JWTKeyFile, config.JWTAlgorithm)
 	if err != nil {
-		logger.Fatalw("can't init migrations", err)
+		logger.Fatalw("can't load token signing keys", err)
+	}
+
+	var stg handlers.Storage
+	switch config.DatabaseDriver() {
+	case cfg.DriverSQLite:
+		stg = storage.NewSQLiteDB(config, keys, logger)
+	case cfg.DriverMemory:
+		stg = storage.NewMemoryDB(config)
+	default:
+		stg = storage.NewPGDB(config, keys, logger)
+	}
+
+	var blobs blob.Store
+	if config.BlobStore != "" {
+		var err error
+		blobs, err = blob.New(ctx, config.BlobStore)
+		if err != nil {
+			logger.Fatalw("can't open blob store", err)
+		}
+	}
+
+	handlers := handlers.NewHandler(stg, blobs, keys, tokenKeys, config)
+	if !config.SkipMigrations {
+		err := storage.InitMigrations(config, logger)
+		if err != nil {
+			logger.Fatalw("can't init migrations", err)
+		}
+	}
+
+	if config.MigrateBlobs {
+		moved, err := handlers.MoveDataToBlobs(ctx)
+		if err != nil {
+			logger.Fatalw("can't move binary data to blob store", err, "moved", moved)
+		}
+		logger.Infow("Binary data moved to blob store", "records", moved)
+		return
+	}
+
+	if config.RotateKeys {
+		rotated, err := handlers.RotateKeys(ctx)
+		if err != nil {
+			logger.Fatalw("can't rotate data keys", err, "rotated", rotated)
+		}
+		logger.Infow("Data keys rotated", "rows", rotated)
+		return
 	}
+
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(logging.LoggingUnaryInterceptor(logger)),
+		grpc.ChainUnaryInterceptor(
+			logging.LoggingUnaryInterceptor(logger),
+			auth.UnaryInterceptor(handlers.Authenticate, logger),
+		),
+		grpc.ChainStreamInterceptor(
+			logging.LoggingStreamInterceptor(logger),
+			auth.StreamInterceptor(handlers.Authenticate, logger),
+		),
 	)
 
 	pb.RegisterGophKeeperServer(grpcServer, app.NewGophKeeperServer(handlers, logger))
 
+	go app.RunPurger(ctx, handlers, logger, purgeInterval)
+
 	lis, err := net.Listen("tcp", config.Host)
 	if err != nil {
 		logger.Fatalf("failed to listen: %v", err)
@@ -42,7 +129,28 @@ func main() {
 	}()
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		// по SIGHUP перечитываем ключи подписи токенов и мастер-ключи, чтобы новые
+		// ключи стали активными без перезапуска
+		if err := tokenKeys.Reload(); err != nil {
+			logger.Errorw("can't reload token signing keys", err)
+		} else {
+			logger.Infow("Token signing keys reloaded", "primary", tokenKeys.Primary())
+		}
+		if keys == nil {
+			continue
+		}
+		if err := keys.Reload(); err != nil {
+			logger.Errorw("can't reload master keys", err)
+			continue
+		}
+		logger.Infow("Master keys reloaded", "primary", keys.Primary())
+	}
+	cancel()
+	handlers.StopWatching()
 	grpcServer.GracefulStop()
 }
@@ -3,16 +3,20 @@ package app
 import (
 	"context"
 	"errors"
-	"fmt"
+	"io"
+	"math"
 
 	"github.com/sinfirst/GophKeeper/internal/config"
 	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
 	"github.com/sinfirst/GophKeeper/internal/models"
 	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type GophKeeperServer struct {
@@ -29,48 +33,59 @@ func (s *GophKeeperServer) GetVersion(ctx context.Context, req *emptypb.Empty) (
 	return &pb.GetVersionResponse{Ver: &pb.Version{Version: config.VersionBuild.Version, Date: config.VersionBuild.Date}}, status.Error(codes.OK, "OK")
 }
 func (s *GophKeeperServer) Register(ctx context.Context, req *pb.AuthRequest) (*pb.AuthResponse, error) {
-	token, err := s.handlers.Register(ctx, req.Username, req.Password)
+	kdf, err := fromKDFParams(req.Kdf)
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
-	return &pb.AuthResponse{Token: token}, status.Error(codes.OK, "OK")
+	token, refresh, err := s.handlers.Register(ctx, req.Username, req.Password, kdf)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.AuthResponse{Token: token, RefreshToken: refresh}, status.Error(codes.OK, "OK")
 
 }
 
 func (s *GophKeeperServer) Login(ctx context.Context, req *pb.AuthRequest) (*pb.AuthResponse, error) {
-	token, err := s.handlers.Login(ctx, req.Username, req.Password)
+	token, refresh, err := s.handlers.Login(ctx, req.Username, req.Password)
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
-	return &pb.AuthResponse{Token: token}, status.Error(codes.OK, "OK")
+	return &pb.AuthResponse{Token: token, RefreshToken: refresh}, status.Error(codes.OK, "OK")
 }
 
 func (s *GophKeeperServer) StoreData(ctx context.Context, req *pb.StoreRequest) (*pb.StoreResponse, error) {
-	id, err := s.handlers.StoreData(ctx, req.Token, models.Record{TypeRecord: req.Record.Type, Data: req.Record.Data, Meta: req.Record.Meta})
+	id, err := s.handlers.StoreData(ctx, models.Record{TypeRecord: req.Record.Type, Data: req.Record.Data, Meta: req.Record.Meta})
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
 
-	return &pb.StoreResponse{Id: int64(id)}, status.Error(codes.OK, "OK")
+	return &pb.StoreResponse{Id: id}, status.Error(codes.OK, "OK")
 }
 
 func (s *GophKeeperServer) RetrieveData(ctx context.Context, req *pb.RetrieveRequest) (*pb.RetrieveResponse, error) {
-	record, err := s.handlers.RetrieveData(ctx, req.Token, int(req.Id))
+	record, err := s.handlers.RetrieveData(ctx, req.Id)
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
 
-	return &pb.RetrieveResponse{Record: &pb.DataRecord{Type: record.TypeRecord, Data: record.Data, Meta: record.Meta}}, status.Error(codes.OK, "OK")
+	return &pb.RetrieveResponse{Record: &pb.DataRecord{Id: record.Id, Type: record.TypeRecord, Data: record.Data, Meta: record.Meta, Version: int64(record.Version)}}, status.Error(codes.OK, "OK")
 }
-func (s *GophKeeperServer) UpdateData(ctx context.Context, req *pb.UpdateResponse) (*emptypb.Empty, error) {
-	err := s.handlers.UpdateData(ctx, req.Token, req.Meta, int(req.Id), req.Data)
+func (s *GophKeeperServer) UpdateData(ctx context.Context, req *pb.UpdateResponse) (*pb.UpdateResult, error) {
+	version, err := s.handlers.UpdateData(ctx, req.Meta, req.Id, req.Data, int(req.Version))
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
-	return nil, status.Error(codes.OK, "OK")
+	return &pb.UpdateResult{Version: int64(version)}, status.Error(codes.OK, "OK")
 }
 func (s *GophKeeperServer) ListData(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
-	records, err := s.handlers.ListData(ctx, req.Token)
+	records, next, err := s.handlers.ListData(ctx, models.ListFilter{
+		Limit:        int(req.PageSize),
+		Cursor:       req.Cursor,
+		Type:         req.Type,
+		Meta:         req.Meta,
+		NewestFirst:  req.Order == pb.SortOrder_NEWEST_FIRST,
+		MetadataOnly: req.MetadataOnly,
+	})
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
@@ -81,36 +96,419 @@ func (s *GophKeeperServer) ListData(ctx context.Context, req *pb.ListRequest) (*
 	var resp []*pb.DataRecord
 	for _, i := range records {
 		resp = append(resp, &pb.DataRecord{
-			Id:   int64(i.Id),
-			Type: i.TypeRecord,
-			Data: i.Data,
-			Meta: i.Meta,
+			Id:        i.Id,
+			Type:      i.TypeRecord,
+			Data:      i.Data,
+			Meta:      i.Meta,
+			Version:   int64(i.Version),
+			CreatedAt: timestamppb.New(i.CreatedAt),
+			UpdatedAt: timestamppb.New(i.UpdatedAt),
+			Size:      i.Size,
 		})
 	}
-	return &pb.ListResponse{Records: resp}, status.Error(codes.OK, "OK")
+	return &pb.ListResponse{Records: resp, NextCursor: next}, status.Error(codes.OK, "OK")
 
 }
 func (s *GophKeeperServer) DeleteData(ctx context.Context, req *pb.DeleteRequest) (*emptypb.Empty, error) {
-	err := s.handlers.DeleteData(ctx, req.Token, int(req.Id))
+	err := s.handlers.DeleteData(ctx, req.Id, int(req.Version))
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return nil, status.Error(codes.OK, "OK")
+
+}
+
+func (s *GophKeeperServer) ListTrash(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	records, err := s.handlers.ListTrash(ctx)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+
+	var resp []*pb.DataRecord
+	for _, i := range records {
+		resp = append(resp, &pb.DataRecord{
+			Id:        i.Id,
+			Type:      i.TypeRecord,
+			Meta:      i.Meta,
+			DeletedAt: timestamppb.New(i.DeletedAt),
+			Version:   int64(i.Version),
+			Size:      i.Size,
+		})
+	}
+	return &pb.ListResponse{Records: resp}, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) RestoreData(ctx context.Context, req *pb.TrashRequest) (*emptypb.Empty, error) {
+	err := s.handlers.RestoreData(ctx, req.Id)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return nil, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) PurgeData(ctx context.Context, req *pb.TrashRequest) (*emptypb.Empty, error) {
+	err := s.handlers.PurgeData(ctx, req.Id)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return nil, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) CreateUpload(ctx context.Context, req *pb.CreateUploadRequest) (*pb.UploadResponse, error) {
+	upload, err := s.handlers.CreateUpload(ctx, req.Meta, req.Size, req.Checksum)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.UploadResponse{UploadId: upload.ID, Size: upload.Size, Received: upload.Received}, status.Error(codes.OK, "OK")
+}
+
+// UploadBinary принимает части загрузки. Id загрузки берется из первой части.
+// Если после закрытия потока получены все данные, создается BINARY запись
+func (s *GophKeeperServer) UploadBinary(stream pb.GophKeeper_UploadBinaryServer) error {
+	ctx := stream.Context()
+
+	var uploadID string
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if uploadID == "" {
+			uploadID = req.UploadId
+		}
+		_, err = s.handlers.UploadChunk(ctx, uploadID, req.Offset, req.Data)
+		if err = s.errorHandler(err); err != nil {
+			return err
+		}
+	}
+	// без частей неизвестно, какую загрузку завершать
+	if uploadID == "" {
+		return s.errorHandler(models.ErrInvalidArgument)
+	}
+
+	upload, err := s.handlers.GetUpload(ctx, uploadID)
+	if err = s.errorHandler(err); err != nil {
+		return err
+	}
+	resp := &pb.UploadResponse{UploadId: upload.ID, Size: upload.Size, Received: upload.Received}
+	if upload.Received < upload.Size {
+		return stream.SendAndClose(resp)
+	}
+
+	resp.Id, err = s.handlers.CompleteUpload(ctx, uploadID)
+	if err = s.errorHandler(err); err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *GophKeeperServer) GetUploadStatus(ctx context.Context, req *pb.UploadStatusRequest) (*pb.UploadResponse, error) {
+	upload, err := s.handlers.GetUpload(ctx, req.UploadId)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.UploadResponse{UploadId: upload.ID, Size: upload.Size, Received: upload.Received}, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) DownloadBinary(req *pb.DownloadRequest, stream pb.GophKeeper_DownloadBinaryServer) error {
+	err := s.handlers.DownloadData(stream.Context(), req.Id, req.Offset, func(chunk models.Chunk) error {
+		return stream.Send(&pb.DataChunk{Offset: chunk.Offset, Data: chunk.Data, Size: chunk.Size, Checksum: chunk.Checksum})
+	})
+	return s.errorHandler(err)
+}
+
+func (s *GophKeeperServer) ListRevisions(ctx context.Context, req *pb.RevisionsRequest) (*pb.RevisionsResponse, error) {
+	revisions, err := s.handlers.ListRevisions(ctx, req.Id)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+
+	var resp []*pb.Revision
+	for _, i := range revisions {
+		resp = append(resp, &pb.Revision{
+			Revision:  int64(i.Revision),
+			Meta:      i.Meta,
+			CreatedAt: timestamppb.New(i.CreatedAt),
+			Current:   i.Current,
+		})
+	}
+	return &pb.RevisionsResponse{Revisions: resp}, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) GetRevision(ctx context.Context, req *pb.RevisionRequest) (*pb.RetrieveResponse, error) {
+	record, err := s.handlers.GetRevision(ctx, req.Id, int(req.Revision))
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+
+	return &pb.RetrieveResponse{Record: &pb.DataRecord{Id: record.Id, Type: record.TypeRecord, Data: record.Data, Meta: record.Meta, Version: int64(record.Version)}}, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) RestoreRevision(ctx context.Context, req *pb.RevisionRequest) (*emptypb.Empty, error) {
+	err := s.handlers.RestoreRevision(ctx, req.Id, int(req.Revision))
 	if err = s.errorHandler(err); err != nil {
 		return nil, err
 	}
 	return nil, status.Error(codes.OK, "OK")
+}
+
+func (s *GophKeeperServer) GetUsage(ctx context.Context, req *pb.UsageRequest) (*pb.UsageResponse, error) {
+	usage, err := s.handlers.GetUsage(ctx)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
 
+	return &pb.UsageResponse{
+		UsedBytes:     usage.Bytes,
+		Records:       usage.Records,
+		QuotaBytes:    usage.Quota.Bytes,
+		QuotaRecords:  usage.Quota.Records,
+		MaxRecordSize: usage.Quota.MaxRecordSize,
+	}, status.Error(codes.OK, "OK")
+}
+
+// GetKDFParams возвращает соль и параметры, с которыми клиент выводит ключ
+// входа из мастер-пароля
+func (s *GophKeeperServer) GetKDFParams(ctx context.Context, req *pb.KDFRequest) (*pb.KDFParams, error) {
+	kdf, err := s.handlers.GetKDFParams(ctx, req.Username)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.KDFParams{
+		Salt:    kdf.Salt,
+		Time:    kdf.Time,
+		Memory:  kdf.Memory,
+		Threads: uint32(kdf.Threads),
+	}, status.Error(codes.OK, "OK")
+}
+
+// MigrateAccount переводит аккаунт, созданный до сквозного шифрования, на
+// ключ входа из мастер-пароля
+func (s *GophKeeperServer) MigrateAccount(ctx context.Context, req *pb.MigrateRequest) (*emptypb.Empty, error) {
+	kdf, err := fromKDFParams(req.Kdf)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	err = s.handlers.MigrateAccount(ctx, req.Username, req.Password, req.NewPassword, kdf)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, status.Error(codes.OK, "OK")
+}
+
+// GetVaultKey возвращает зашифрованный ключ записей пользователя
+func (s *GophKeeperServer) GetVaultKey(ctx context.Context, req *pb.VaultKeyRequest) (*pb.VaultKey, error) {
+	key, err := s.handlers.GetVaultKey(ctx)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.VaultKey{WrappedKey: key}, status.Error(codes.OK, "OK")
+}
+
+// SetVaultKey сохраняет зашифрованный ключ записей пользователя
+func (s *GophKeeperServer) SetVaultKey(ctx context.Context, req *pb.SetVaultKeyRequest) (*emptypb.Empty, error) {
+	err := s.handlers.SetVaultKey(ctx, req.GetKey().GetWrappedKey())
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, status.Error(codes.OK, "OK")
+}
+
+// ChangePassword меняет пароль пользователя и возвращает новый токен
+func (s *GophKeeperServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.AuthResponse, error) {
+	kdf, err := fromKDFParams(req.Kdf)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	token, err := s.handlers.ChangePassword(ctx, req.OldPassword, req.NewPassword, kdf, req.GetKey().GetWrappedKey())
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.AuthResponse{Token: token}, status.Error(codes.OK, "OK")
+}
+
+// RefreshToken обменивает refresh-токен на новую пару токенов
+func (s *GophKeeperServer) RefreshToken(ctx context.Context, req *pb.RefreshRequest) (*pb.AuthResponse, error) {
+	token, refresh, err := s.handlers.RefreshToken(ctx, req.RefreshToken)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.AuthResponse{Token: token, RefreshToken: refresh}, status.Error(codes.OK, "OK")
+}
+
+// Logout завершает сессию пользователя
+func (s *GophKeeperServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*emptypb.Empty, error) {
+	err := s.handlers.Logout(ctx)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, status.Error(codes.OK, "OK")
+}
+
+// LoginTOTP завершает вход кодом второго фактора
+func (s *GophKeeperServer) LoginTOTP(ctx context.Context, req *pb.LoginTOTPRequest) (*pb.AuthResponse, error) {
+	token, refresh, err := s.handlers.LoginTOTP(ctx, req.Ticket, req.Code)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.AuthResponse{Token: token, RefreshToken: refresh}, status.Error(codes.OK, "OK")
+}
+
+// GetTOTPStatus сообщает, включен ли второй фактор
+func (s *GophKeeperServer) GetTOTPStatus(ctx context.Context, req *pb.TOTPStatusRequest) (*pb.TOTPStatusResponse, error) {
+	enabled, left, err := s.handlers.GetTOTPStatus(ctx)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.TOTPStatusResponse{Enabled: enabled, RecoveryLeft: int32(left)}, status.Error(codes.OK, "OK")
+}
+
+// EnrollTOTP создает секрет второго фактора, который нужно подтвердить кодом
+func (s *GophKeeperServer) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	secret, uri, err := s.handlers.EnrollTOTP(ctx)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.EnrollTOTPResponse{Secret: secret, Uri: uri}, status.Error(codes.OK, "OK")
+}
+
+// ConfirmTOTP включает второй фактор и возвращает коды восстановления
+func (s *GophKeeperServer) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	recovery, err := s.handlers.ConfirmTOTP(ctx, req.Code)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &pb.ConfirmTOTPResponse{RecoveryCodes: recovery}, status.Error(codes.OK, "OK")
+}
+
+// DisableTOTP отключает второй фактор
+func (s *GophKeeperServer) DisableTOTP(ctx context.Context, req *pb.DisableTOTPRequest) (*emptypb.Empty, error) {
+	err := s.handlers.DisableTOTP(ctx, req.Code)
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, status.Error(codes.OK, "OK")
+}
+
+// GetPublicKeys возвращает открытые ключи, которыми другие сервисы могут
+// проверить токены GophKeeper
+func (s *GophKeeperServer) GetPublicKeys(ctx context.Context, req *pb.PublicKeysRequest) (*pb.PublicKeysResponse, error) {
+	keys, active, err := s.handlers.PublicKeys()
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+
+	resp := &pb.PublicKeysResponse{ActiveKid: active}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, &pb.PublicKey{Kid: key.ID, Algorithm: key.Algorithm, PublicKey: key.Key})
+	}
+	return resp, status.Error(codes.OK, "OK")
+}
+
+// GetChanges возвращает изменения записей пользователя после ревизии since_revision
+func (s *GophKeeperServer) GetChanges(ctx context.Context, req *pb.ChangesRequest) (*pb.ChangesResponse, error) {
+	changes, revision, more, err := s.handlers.GetChanges(ctx, req.SinceRevision, int(req.Limit))
+	if err = s.errorHandler(err); err != nil {
+		return nil, err
+	}
+
+	return &pb.ChangesResponse{Changes: toRecordChanges(changes), Revision: revision, HasMore: more}, status.Error(codes.OK, "OK")
+}
+
+// WatchChanges отправляет клиенту изменения записей по мере их появления
+func (s *GophKeeperServer) WatchChanges(req *pb.WatchRequest, stream pb.GophKeeper_WatchChangesServer) error {
+	err := s.handlers.WatchChanges(stream.Context(), req.SinceRevision, func(changes []models.Change, revision int64) error {
+		return stream.Send(&pb.ChangesResponse{Changes: toRecordChanges(changes), Revision: revision})
+	})
+	return s.errorHandler(err)
+}
+
+func toRecordChanges(changes []models.Change) []*pb.RecordChange {
+	var resp []*pb.RecordChange
+	for _, c := range changes {
+		change := &pb.RecordChange{
+			Revision: c.Revision,
+			Deleted:  c.Deleted,
+			Type:     pb.ChangeType(pb.ChangeType_value[c.Kind()]),
+			Record:   &pb.DataRecord{Id: c.Record.Id},
+		}
+		if !c.Deleted {
+			change.Record = &pb.DataRecord{
+				Id:        c.Record.Id,
+				Type:      c.Record.TypeRecord,
+				Data:      c.Record.Data,
+				Meta:      c.Record.Meta,
+				Version:   int64(c.Record.Version),
+				CreatedAt: timestamppb.New(c.Record.CreatedAt),
+				UpdatedAt: timestamppb.New(c.Record.UpdatedAt),
+				Size:      c.Record.Size,
+			}
+		}
+		resp = append(resp, change)
+	}
+	return resp
+}
+
+// fromKDFParams переводит параметры Argon2id из запроса в модель
+func fromKDFParams(kdf *pb.KDFParams) (models.KDFParams, error) {
+	if kdf == nil || kdf.Threads > math.MaxUint8 {
+		return models.KDFParams{}, models.ErrInvalidArgument
+	}
+	return models.KDFParams{
+		Salt:    kdf.Salt,
+		Time:    kdf.Time,
+		Memory:  kdf.Memory,
+		Threads: uint8(kdf.Threads),
+	}, nil
 }
 
 func (s *GophKeeperServer) errorHandler(err error) error {
-	if errors.Is(err, fmt.Errorf("unauthenticated")) {
+	var second *models.SecondFactorError
+	if errors.As(err, &second) {
+		return s.secondFactorStatus(second.Ticket)
+	} else if errors.Is(err, models.ErrUnauthenticated) {
 		return status.Error(codes.Unauthenticated, "unauthenticated")
-	} else if errors.Is(err, fmt.Errorf("conflict")) {
+	} else if errors.Is(err, models.ErrConflict) {
 		return status.Error(codes.AlreadyExists, "conflict")
-	} else if errors.Is(err, fmt.Errorf("access denied")) {
+	} else if errors.Is(err, models.ErrAccessDenied) {
 		return status.Error(codes.PermissionDenied, "access denied")
-	} else if errors.Is(err, fmt.Errorf("not found")) {
+	} else if errors.Is(err, models.ErrNotFound) {
 		return status.Error(codes.NotFound, "not found")
+	} else if errors.Is(err, models.ErrInvalidArgument) {
+		return status.Error(codes.InvalidArgument, "invalid argument")
+	} else if errors.Is(err, models.ErrInvalidOffset) {
+		return status.Error(codes.FailedPrecondition, "invalid offset")
+	} else if errors.Is(err, models.ErrChecksum) {
+		return status.Error(codes.DataLoss, "checksum mismatch")
+	} else if errors.Is(err, models.ErrVersionMismatch) {
+		return status.Error(codes.Aborted, "version mismatch")
+	} else if errors.Is(err, models.ErrQuotaExceeded) {
+		return status.Error(codes.ResourceExhausted, "quota exceeded")
+	} else if errors.Is(err, models.ErrLegacyAccount) {
+		return status.Error(codes.FailedPrecondition, "legacy account")
+	} else if errors.Is(err, models.ErrTooManyAttempts) {
+		return status.Error(codes.ResourceExhausted, "too many attempts")
 	} else if err != nil {
 		s.logger.Errorf("err: %v", err)
 		return status.Error(codes.Internal, "Server problem")
 	}
 	return nil
 }
+
+// secondFactorStatus отказ Login, по которому клиент запрашивает код второго
+// фактора. Билет для LoginTOTP передается в ErrorInfo
+func (s *GophKeeperServer) secondFactorStatus(ticket string) error {
+	st, err := status.New(codes.FailedPrecondition, "second factor required").WithDetails(&errdetails.ErrorInfo{
+		Reason:   auth.SecondFactorReason,
+		Metadata: map[string]string{auth.TicketKey: ticket},
+	})
+	if err != nil {
+		s.logger.Errorf("err: %v", err)
+		return status.Error(codes.Internal, "Server problem")
+	}
+	return st.Err()
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+)
+
+// testKeys создает ключ подписи токенов во временном каталоге теста
+func testKeys(t *testing.T) *auth.Keyring {
+	t.Helper()
+	keys, err := auth.LoadKeyring(filepath.Join(t.TempDir(), "jwt.pem"), auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return keys
+}
+
+func newTestServer(t *testing.T) *GophKeeperServer {
+	t.Helper()
+	h := handlers.NewHandler(storage.NewMemoryDB(config.Config{}), nil, nil, testKeys(t), config.Config{})
+	return NewGophKeeperServer(h, *zap.NewNop().Sugar()).(*GophKeeperServer)
+}
+
+// authorize возвращает контекст запросов от имени сессии токена, как его
+// заполняет интерцептор авторизации
+func authorize(t *testing.T, s *GophKeeperServer, token string) context.Context {
+	t.Helper()
+	identity, err := s.handlers.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return auth.NewContext(context.Background(), identity)
+}
+
+func TestErrorHandler(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{nil, codes.OK},
+		{models.ErrUnauthenticated, codes.Unauthenticated},
+		{models.ErrConflict, codes.AlreadyExists},
+		{models.ErrAccessDenied, codes.PermissionDenied},
+		{models.ErrNotFound, codes.NotFound},
+		{fmt.Errorf("retrieve: %w", models.ErrNotFound), codes.NotFound},
+		{models.ErrQuotaExceeded, codes.ResourceExhausted},
+		{models.ErrVersionMismatch, codes.Aborted},
+		{models.ErrLegacyAccount, codes.FailedPrecondition},
+		{errors.New("database is down"), codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := status.Code(s.errorHandler(tt.err)); got != tt.want {
+			t.Errorf("errorHandler(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	kdf := &pb.KDFParams{Salt: []byte("0123456789abcdef"), Time: 3, Memory: 64 * 1024, Threads: 4}
+	tokens, err := s.Register(ctx, &pb.AuthRequest{Username: "user", Password: "password", Kdf: kdf})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	user := authorize(t, s, tokens.Token)
+	if _, err := s.Register(ctx, &pb.AuthRequest{Username: "user", Password: "password", Kdf: kdf}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Register of existing user = %v; want AlreadyExists", err)
+	}
+	if _, err := s.Register(ctx, &pb.AuthRequest{Username: "other", Password: "password"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Register without KDF params = %v; want InvalidArgument", err)
+	}
+	if got, err := s.GetKDFParams(ctx, &pb.KDFRequest{Username: "user"}); err != nil || string(got.Salt) != string(kdf.Salt) || got.Threads != kdf.Threads {
+		t.Errorf("GetKDFParams = %v, %v; want registered params", got, err)
+	}
+	if _, err := s.Login(ctx, &pb.AuthRequest{Username: "user", Password: "wrong"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Login with wrong password = %v; want Unauthenticated", err)
+	}
+	if _, err := s.ListData(user, &pb.ListRequest{}); status.Code(err) != codes.NotFound {
+		t.Errorf("ListData without records = %v; want NotFound", err)
+	}
+
+	stored, err := s.StoreData(user, &pb.StoreRequest{Record: &pb.DataRecord{Type: models.Text, Data: []byte("data"), Meta: "meta"}})
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	resp, err := s.RetrieveData(user, &pb.RetrieveRequest{Id: stored.Id})
+	if err != nil || resp.Record.Id != stored.Id || string(resp.Record.Data) != "data" || resp.Record.Meta != "meta" {
+		t.Fatalf("RetrieveData = %v, %v; want stored record", resp, err)
+	}
+	if _, err := s.RetrieveData(ctx, &pb.RetrieveRequest{Id: stored.Id}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("RetrieveData without a session = %v; want Unauthenticated", err)
+	}
+
+	updated, err := s.UpdateData(user, &pb.UpdateResponse{Id: stored.Id, Data: []byte("new"), Version: resp.Record.Version})
+	if err != nil || updated.Version != resp.Record.Version+1 {
+		t.Fatalf("UpdateData = %v, %v; want next version", updated, err)
+	}
+	stale := &pb.UpdateResponse{Id: stored.Id, Data: []byte("stale"), Version: resp.Record.Version}
+	if _, err := s.UpdateData(user, stale); status.Code(err) != codes.Aborted {
+		t.Errorf("UpdateData with stale version = %v; want Aborted", err)
+	}
+	if _, err := s.DeleteData(user, &pb.DeleteRequest{Id: stored.Id, Version: resp.Record.Version}); status.Code(err) != codes.Aborted {
+		t.Errorf("DeleteData with stale version = %v; want Aborted", err)
+	}
+}
+
+// emptyUploadStream поток загрузки, в котором нет ни одной части
+type emptyUploadStream struct {
+	pb.GophKeeper_UploadBinaryServer
+}
+
+func (emptyUploadStream) Context() context.Context {
+	return context.Background()
+}
+
+func (emptyUploadStream) Recv() (*pb.UploadChunk, error) {
+	return nil, io.EOF
+}
+
+func TestUploadBinaryEmptyStream(t *testing.T) {
+	if err := newTestServer(t).UploadBinary(emptyUploadStream{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UploadBinary of empty stream = %v; want InvalidArgument", err)
+	}
+}
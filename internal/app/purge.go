@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"go.uber.org/zap"
+)
+
+// RunPurger периодически окончательно удаляет просроченные записи из корзины,
+// брошенные незавершенные загрузки, сессии с истекшим сроком и blob, на которые больше нет ссылок
+func RunPurger(ctx context.Context, handlers handlers.Handler, logger zap.SugaredLogger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := handlers.PurgeExpiredTrash(ctx)
+		if err != nil {
+			logger.Errorw("Problem with purging trash: ", err)
+		} else if purged > 0 {
+			logger.Infow("Trash purged", "records", purged)
+		}
+
+		purged, err = handlers.PurgeStaleUploads(ctx)
+		if err != nil {
+			logger.Errorw("Problem with purging uploads: ", err)
+		} else if purged > 0 {
+			logger.Infow("Stale uploads purged", "uploads", purged)
+		}
+
+		purged, err = handlers.PurgeExpiredSessions(ctx)
+		if err != nil {
+			logger.Errorw("Problem with purging sessions: ", err)
+		} else if purged > 0 {
+			logger.Infow("Expired sessions purged", "sessions", purged)
+		}
+
+		purged, err = handlers.PurgeOrphanBlobs(ctx)
+		if err != nil {
+			logger.Errorw("Problem with purging blobs: ", err)
+		} else if purged > 0 {
+			logger.Infow("Orphan blobs purged", "blobs", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,117 +2,431 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/sinfirst/GophKeeper/internal/models"
 	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-// Client представляет gRPC клиент для аутентификации
+// ErrConflict запись на сервере изменилась с тех пор, как клиент ее получил
+var ErrConflict = errors.New("запись изменена на другом устройстве, получите актуальную версию и повторите")
+
+// reconnectBackoff паузы между попытками подключиться к недоступному серверу
+var reconnectBackoff = backoff.Config{BaseDelay: time.Second, Multiplier: 1.6, Jitter: 0.2, MaxDelay: 10 * time.Second}
+
+// Пределы паузы перед повторным подключением к потоку изменений
+const (
+	watchMinBackoff = time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+// Client представляет gRPC клиент для аутентификации. Данные и
+// метаинформация записей шифруются ключом записей пользователя до отправки
+// на сервер. Если задан каталог локальных копий, записи пользователя
+// дублируются в зашифрованный файл, из которого клиент работает без связи с
+// сервером
 type Client struct {
 	conn   *grpc.ClientConn
 	client pb.GophKeeperClient
-	token  string
+	// token и refreshToken читаются параллельными запросами, поэтому доступ к
+	// ним только через tokenMu. refreshToken одноразовый, refreshMu не дает
+	// обменять его дважды
+	token        string
+	refreshToken string
+	tokenMu      sync.RWMutex
+	refreshMu    sync.Mutex
+	cipher       *recordCipher
+	vaultDir     string
+	vault        *Vault
+	offline      bool
+	// логин и пароль нужны только после входа без связи, чтобы войти на сервер позже
+	username string
+	password string
+	// watchers потоки WatchChanges, их останавливают до закрытия клиента
+	watchers    sync.WaitGroup
+	watchMu     sync.Mutex
+	watchCancel []context.CancelFunc
+	// account логин вошедшего пользователя, по нему хранилище разблокируется паролем
+	account string
+	locked  bool
+	// lockedToken и lockedRefresh токены сессии, отложенные на время блокировки
+	lockedToken   string
+	lockedRefresh string
+	// pending вход, который ждет кода второго фактора
+	pending *pendingLogin
 }
 
-// NewClient создает новый gRPC клиент
-func NewClient(serverAddr string) *Client {
+// NewClient создает новый gRPC клиент. Пустой vaultDir отключает локальную копию
+func NewClient(serverAddr, vaultDir string) *Client {
+	c := &Client{vaultDir: vaultDir}
 	conn, err := grpc.NewClient(serverAddr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// без связи клиент работает с локальной копией, поэтому после
+		// восстановления сервера переподключаться нужно быстро, а не через минуты
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: reconnectBackoff, MinConnectTimeout: 5 * time.Second}),
+		grpc.WithPerRPCCredentials(tokenCredentials{client: c}),
+		grpc.WithUnaryInterceptor(c.refreshInterceptor),
 	)
 	if err != nil {
 		log.Fatalf("Can't connect with server: %v", err)
 	}
 
-	client := pb.NewGophKeeperClient(conn)
-
-	return &Client{
-		conn:   conn,
-		client: client,
-	}
+	c.conn, c.client = conn, pb.NewGophKeeperClient(conn)
+	return c
 }
 
-// Register отправляет запрос на регистрацию
+// Register отправляет запрос на регистрацию. Из пароля со случайной солью
+// выводятся ключ входа, который получает сервер, и ключ для ключа записей;
+// сам пароль серверу не отправляется
 func (c *Client) Register(ctx context.Context, username, password string) error {
-	resp, err := c.client.Register(ctx, &pb.AuthRequest{Username: username, Password: password})
+	kdf, err := newKDFParams()
+	if err != nil {
+		return err
+	}
+	keys, err := deriveAccountKeys(password, kdf)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Register(ctx, &pb.AuthRequest{Username: username, Password: keys.auth, Kdf: toKDFParams(kdf)})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.AlreadyExists:
 			return fmt.Errorf("пользователь с таким логином уже существует")
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером")
 		case codes.Internal:
 			return fmt.Errorf("ошибка сервера")
 		}
 	}
-	c.token = resp.Token
-	return nil
+	if err != nil {
+		return err
+	}
+	if err := c.markMigrated(username); err != nil {
+		return err
+	}
+	c.setSession(resp)
+	c.offline = false
+	if err := c.unlock(ctx, keys.vault); err != nil {
+		c.setTokens("", "")
+		return err
+	}
+	c.account, c.locked, c.lockedToken, c.lockedRefresh = username, false, "", ""
+	return c.openVault(username, password)
 }
 
+// Login выполняет вход. Если сервер недоступен, а локальная копия есть, вход
+// выполняется по ней, и клиент работает без связи до ее восстановления.
+// После входа на сервер локальную копию нужно обновить через Sync. Для
+// аккаунта, созданного до сквозного шифрования, возвращается ErrLegacyAccount.
+// Если у пользователя включена двухфакторная аутентификация, возвращается
+// ErrSecondFactor, и вход завершает LoginTOTP
 func (c *Client) Login(ctx context.Context, username, password string) error {
-	resp, err := c.client.Login(ctx, &pb.AuthRequest{Username: username, Password: password})
+	c.pending = nil
+	resp, keys, err := c.login(ctx, username, password)
+	if ticket, ok := secondFactorTicket(err); ok {
+		c.pending = &pendingLogin{username: username, password: password, keys: keys, ticket: ticket}
+		return ErrSecondFactor
+	}
+	if status.Code(err) == codes.Unavailable {
+		return c.loginOffline(username, password)
+	}
+	if err != nil {
+		return err
+	}
+	return c.startSession(ctx, resp, username, password, keys)
+}
+
+// startSession запоминает сессию после входа на сервер и открывает ключ
+// записей и локальную копию
+func (c *Client) startSession(ctx context.Context, resp *pb.AuthResponse, username, password string, keys accountKeys) error {
+	c.setSession(resp)
+	c.offline = false
+	c.username, c.password = "", ""
+	if err := c.unlock(ctx, keys.vault); err != nil {
+		c.setTokens("", "")
+		return err
+	}
+	c.account, c.locked, c.lockedToken, c.lockedRefresh = username, false, "", ""
+	return c.openVault(username, password)
+}
+
+// StoreData сохраняет новую запись. Без связи с сервером запись сохраняется в
+// локальную копию и отправляется при восстановлении связи
+func (c *Client) StoreData(ctx context.Context, typeRecord, meta string, data []byte) (string, error) {
+	if c.useVault(ctx) {
+		return c.vault.storeLocal(typeRecord, meta, data)
+	}
+	id, err := c.storeData(ctx, typeRecord, meta, data)
+	if c.lostConnection(err) {
+		return c.vault.storeLocal(typeRecord, meta, data)
+	}
+	if err != nil || c.vault == nil {
+		return id, err
+	}
+	now := time.Now()
+	return id, c.vault.put(models.Record{Id: id, TypeRecord: typeRecord, Version: 1, Data: data, Meta: meta, CreatedAt: now, UpdatedAt: now})
+}
+
+func (c *Client) storeData(ctx context.Context, typeRecord, meta string, data []byte) (string, error) {
+	meta, data, err := c.cipher.sealRecord(meta, data)
+	if err != nil {
+		return "", err
+	}
+	record := &pb.DataRecord{Type: typeRecord, Data: data, Meta: meta}
+	resp, err := c.client.StoreData(ctx, &pb.StoreRequest{Record: record})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.Unauthenticated:
-			return fmt.Errorf("неверный пароль")
+			return "", fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.ResourceExhausted:
+			return "", fmt.Errorf("превышена квота хранилища")
+		case codes.Internal:
+			return "", fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return resp.Id, nil
+}
+
+// RetrieveData возвращает запись с сервера и обновляет ее в локальной копии.
+// Без связи с сервером запись читается из локальной копии
+func (c *Client) RetrieveData(ctx context.Context, id string) (models.Record, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.Record{}, fmt.Errorf("некорректный id")
+	}
+	if c.useVault(ctx) {
+		return c.vault.get(id)
+	}
+	record, err := c.retrieveData(ctx, id)
+	if c.lostConnection(err) {
+		return c.vault.get(id)
+	}
+	if err != nil || c.vault == nil {
+		return record, err
+	}
+	return record, c.vault.put(record)
+}
+
+func (c *Client) retrieveData(ctx context.Context, id string) (models.Record, error) {
+	resp, err := c.client.RetrieveData(ctx, &pb.RetrieveRequest{Id: id})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return models.Record{}, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return models.Record{}, fmt.Errorf("в доступе отказано")
 		case codes.NotFound:
-			return fmt.Errorf("пользователь с таким логином не найден")
+			return models.Record{}, fmt.Errorf("данные с таким id не найдены")
 		case codes.Internal:
-			return fmt.Errorf("ошибка сервера")
+			return models.Record{}, fmt.Errorf("ошибка сервера")
 		}
 	}
-	c.token = resp.Token
-	return nil
+	if err != nil {
+		return models.Record{}, err
+	}
+	return c.cipher.openRecord(models.Record{Id: resp.Record.Id, TypeRecord: resp.Record.Type, Version: int(resp.Record.Version), Data: resp.Record.Data, Meta: resp.Record.Meta})
 }
 
-func (c *Client) StoreData(ctx context.Context, typeRecord, meta string, data []byte) (int, error) {
-	record := &pb.DataRecord{Type: typeRecord, Data: data, Meta: meta}
-	resp, err := c.client.StoreData(ctx, &pb.StoreRequest{Token: c.token, Record: record})
+// UpdateData сохраняет новые данные записи, если на сервере она все еще в
+// версии version, и возвращает номер новой версии. Если запись успела
+// измениться на другом устройстве, изменения сливаются по полям, а при
+// конфликте возвращается ErrConflict. Без связи с сервером изменение
+// сохраняется в локальную копию, а версия не меняется
+func (c *Client) UpdateData(ctx context.Context, id, meta string, data []byte, version int) (int, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return 0, fmt.Errorf("некорректный id")
+	}
+	if c.useVault(ctx) {
+		return c.vault.updateLocal(id, meta, data, version)
+	}
+	newVersion, err := c.updateData(ctx, id, meta, data, version)
+	if c.lostConnection(err) {
+		return c.vault.updateLocal(id, meta, data, version)
+	}
+	if errors.Is(err, ErrConflict) && c.vault != nil {
+		return c.mergeUpdate(ctx, id, meta, data, version)
+	}
+	if err != nil || c.vault == nil {
+		return newVersion, err
+	}
+	return newVersion, c.vault.setContent(id, meta, data, newVersion)
+}
+
+// mergeUpdate сливает изменение записи с версией на сервере. Общей версией
+// служит копия записи в локальной копии, если она все еще в версии version
+func (c *Client) mergeUpdate(ctx context.Context, id, meta string, data []byte, version int) (int, error) {
+	base, err := c.vault.get(id)
+	if err != nil || base.Version != version {
+		return 0, ErrConflict
+	}
+	local := base
+	local.Meta, local.Data = meta, data
+	merged, conflict, err := c.merge(ctx, base, local)
+	if err != nil || conflict != nil {
+		return 0, ErrConflict
+	}
+	return merged.Version, c.vault.put(merged)
+}
+
+func (c *Client) updateData(ctx context.Context, id, meta string, data []byte, version int) (int, error) {
+	meta, data, err := c.cipher.sealRecord(meta, data)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.UpdateData(ctx, &pb.UpdateResponse{Id: id, Meta: meta, Data: data, Version: int64(version)})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.Unauthenticated:
 			return 0, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return 0, fmt.Errorf("в доступе отказано")
+		case codes.NotFound:
+			return 0, fmt.Errorf("данные с таким id не найдены")
+		case codes.Aborted:
+			return 0, ErrConflict
+		case codes.InvalidArgument:
+			return 0, fmt.Errorf("не указана версия записи")
+		case codes.ResourceExhausted:
+			return 0, fmt.Errorf("превышена квота хранилища")
 		case codes.Internal:
 			return 0, fmt.Errorf("ошибка сервера")
 		}
 	}
-	return int(resp.Id), nil
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Version), nil
 }
 
-func (c *Client) RetrieveData(ctx context.Context, id string) (models.Record, error) {
-	intID, err := strconv.ParseInt(id, 10, 64)
-	if err != nil {
-		return models.Record{}, fmt.Errorf("введите число")
+// ListData возвращает страницу записей по фильтру и курсор следующей страницы,
+// пустой на последней странице. Без связи с сервером список строится по
+// локальной копии, курсоры сервера и локальной копии не взаимозаменяемы
+func (c *Client) ListData(ctx context.Context, filter models.ListFilter) ([]models.Record, string, error) {
+	if c.useVault(ctx) {
+		return c.vault.list(filter)
+	}
+	records, next, err := c.listData(ctx, filter)
+	if c.lostConnection(err) {
+		return c.vault.list(filter)
+	}
+	return records, next, err
+}
+
+// listData возвращает страницу записей с сервера. Сервер хранит
+// метаинформацию зашифрованной, поэтому поиск по ней выполняется здесь после
+// расшифровки: страницы, в которых ничего не нашлось, пропускаются
+func (c *Client) listData(ctx context.Context, filter models.ListFilter) ([]models.Record, string, error) {
+	if c.cipher == nil || filter.Meta == "" {
+		return c.listPage(ctx, filter)
+	}
+	search := strings.ToLower(filter.Meta)
+	filter.Meta = ""
+	for {
+		page, next, err := c.listPage(ctx, filter)
+		if err != nil {
+			return nil, "", err
+		}
+		var records []models.Record
+		for _, record := range page {
+			if strings.Contains(strings.ToLower(record.Meta), search) {
+				records = append(records, record)
+			}
+		}
+		if len(records) > 0 || next == "" {
+			return records, next, nil
+		}
+		filter.Cursor = next
 	}
+}
+
+func (c *Client) listPage(ctx context.Context, filter models.ListFilter) ([]models.Record, string, error) {
+	var records []models.Record
 
-	resp, err := c.client.RetrieveData(ctx, &pb.RetrieveRequest{Token: c.token, Id: intID})
+	order := pb.SortOrder_OLDEST_FIRST
+	if filter.NewestFirst {
+		order = pb.SortOrder_NEWEST_FIRST
+	}
+	resp, err := c.client.ListData(ctx, &pb.ListRequest{
+		PageSize:     int32(filter.Limit),
+		Cursor:       filter.Cursor,
+		Type:         filter.Type,
+		Meta:         filter.Meta,
+		Order:        order,
+		MetadataOnly: filter.MetadataOnly,
+	})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.Unauthenticated:
-			return models.Record{}, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+			return nil, "", fmt.Errorf("войдите в аккаунт перед выполнением запроса")
 		case codes.PermissionDenied:
-			return models.Record{}, fmt.Errorf("в доступе отказано")
+			return nil, "", fmt.Errorf("в доступе отказано")
 		case codes.NotFound:
-			return models.Record{}, fmt.Errorf("данные с таким id не найдены")
+			return nil, "", fmt.Errorf("данные не найдены")
+		case codes.InvalidArgument:
+			return nil, "", fmt.Errorf("неверные параметры выборки, начните просмотр списка заново")
 		case codes.Internal:
-			return models.Record{}, fmt.Errorf("ошибка сервера")
+			return nil, "", fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	for _, i := range resp.Records {
+		record, err := c.cipher.openRecord(models.Record{
+			Id:         i.Id,
+			TypeRecord: i.Type,
+			Version:    int(i.Version),
+			Data:       i.Data,
+			Meta:       i.Meta,
+			Size:       i.Size,
+			CreatedAt:  i.CreatedAt.AsTime(),
+			UpdatedAt:  i.UpdatedAt.AsTime(),
+		})
+		if err != nil {
+			return nil, "", err
 		}
+		records = append(records, record)
 	}
-	return models.Record{Id: int(resp.Record.Id), TypeRecord: resp.Record.Type, Data: resp.Record.Data, Meta: resp.Record.Meta}, nil
+	return records, resp.NextCursor, nil
 }
 
-func (c *Client) UpdateData(ctx context.Context, id, meta string, data []byte) error {
-	intID, err := strconv.ParseInt(id, 10, 64)
-	if err != nil {
-		return fmt.Errorf("введите число")
+// DeleteData перемещает запись в корзину, если на сервере она все еще в версии
+// version. Без связи с сервером запись удаляется из локальной копии, а на
+// сервере при восстановлении связи
+func (c *Client) DeleteData(ctx context.Context, id string, version int) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("некорректный id")
+	}
+	if c.useVault(ctx) {
+		return c.vault.deleteLocal(id, version)
+	}
+	err := c.deleteData(ctx, id, version)
+	if c.lostConnection(err) {
+		return c.vault.deleteLocal(id, version)
+	}
+	if err != nil || c.vault == nil {
+		return err
 	}
+	return c.vault.remove(id)
+}
 
-	_, err = c.client.UpdateData(ctx, &pb.UpdateResponse{Token: c.token, Id: intID, Meta: meta, Data: data})
+func (c *Client) deleteData(ctx context.Context, id string, version int) error {
+	_, err := c.client.DeleteData(ctx, &pb.DeleteRequest{Id: id, Version: int64(version)})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.Unauthenticated:
@@ -121,47 +435,182 @@ func (c *Client) UpdateData(ctx context.Context, id, meta string, data []byte) e
 			return fmt.Errorf("в доступе отказано")
 		case codes.NotFound:
 			return fmt.Errorf("данные с таким id не найдены")
+		case codes.Aborted:
+			return ErrConflict
+		case codes.InvalidArgument:
+			return fmt.Errorf("не указана версия записи")
 		case codes.Internal:
 			return fmt.Errorf("ошибка сервера")
 		}
 	}
-	return nil
+	return err
+}
+
+func (c *Client) GetVersion(ctx context.Context) (models.VersionBuild, error) {
+	resp, err := c.client.GetVersion(ctx, &emptypb.Empty{})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Internal:
+			return models.VersionBuild{}, fmt.Errorf("ошибка сервера")
+		}
+	}
+	return models.VersionBuild{Version: resp.Ver.Version, Date: resp.Ver.Date}, nil
 }
 
-func (c *Client) ListData(ctx context.Context) ([]models.Record, error) {
+// ListTrash возвращает записи, находящиеся в корзине, без их данных
+func (c *Client) ListTrash(ctx context.Context) ([]models.Record, error) {
 	var records []models.Record
 
-	resp, err := c.client.ListData(ctx, &pb.ListRequest{Token: c.token})
+	resp, err := c.client.ListTrash(ctx, &pb.ListRequest{})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.Unauthenticated:
 			return nil, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
-		case codes.PermissionDenied:
-			return nil, fmt.Errorf("в доступе отказано")
-		case codes.NotFound:
-			return nil, fmt.Errorf("данные с таким id не найдены")
 		case codes.Internal:
 			return nil, fmt.Errorf("ошибка сервера")
 		}
 	}
 	for _, i := range resp.Records {
-		records = append(records, models.Record{
-			Id:         int(i.Id),
+		record, err := c.cipher.openRecord(models.Record{
+			Id:         i.Id,
 			TypeRecord: i.Type,
-			Data:       i.Data,
+			Version:    int(i.Version),
 			Meta:       i.Meta,
+			Size:       i.Size,
+			DeletedAt:  i.DeletedAt.AsTime(),
 		})
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
 	}
 	return records, nil
 }
 
-func (c *Client) DeleteData(ctx context.Context, id string) error {
-	intID, err := strconv.ParseInt(id, 10, 64)
+// RestoreData возвращает запись из корзины
+func (c *Client) RestoreData(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("некорректный id")
+	}
+
+	_, err := c.client.RestoreData(ctx, &pb.TrashRequest{Id: id})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return fmt.Errorf("в доступе отказано")
+		case codes.NotFound:
+			return fmt.Errorf("в корзине нет данных с таким id")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil || c.vault == nil {
+		return err
+	}
+	// восстановленная запись попадет в локальную копию с изменениями сервера
+	_, err = c.pull(ctx)
+	return err
+}
+
+// PurgeData окончательно удаляет запись из корзины
+func (c *Client) PurgeData(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("некорректный id")
+	}
+
+	_, err := c.client.PurgeData(ctx, &pb.TrashRequest{Id: id})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return fmt.Errorf("в доступе отказано")
+		case codes.NotFound:
+			return fmt.Errorf("в корзине нет данных с таким id")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	return nil
+}
+
+// ListRevisions возвращает список версий записи
+func (c *Client) ListRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	var revisions []models.Revision
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("некорректный id")
+	}
+
+	resp, err := c.client.ListRevisions(ctx, &pb.RevisionsRequest{Id: id})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return nil, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return nil, fmt.Errorf("в доступе отказано")
+		case codes.NotFound:
+			return nil, fmt.Errorf("данные с таким id не найдены")
+		case codes.Internal:
+			return nil, fmt.Errorf("ошибка сервера")
+		}
+	}
+	for _, i := range resp.Revisions {
+		meta, err := c.cipher.openMeta(i.Meta)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, models.Revision{
+			Revision:  int(i.Revision),
+			Meta:      meta,
+			CreatedAt: i.CreatedAt.AsTime(),
+			Current:   i.Current,
+		})
+	}
+	return revisions, nil
+}
+
+// GetRevision возвращает содержимое записи в указанной версии
+func (c *Client) GetRevision(ctx context.Context, id, revision string) (models.Record, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.Record{}, fmt.Errorf("некорректный id")
+	}
+	intRevision, err := strconv.ParseInt(revision, 10, 64)
+	if err != nil {
+		return models.Record{}, fmt.Errorf("введите число")
+	}
+
+	resp, err := c.client.GetRevision(ctx, &pb.RevisionRequest{Id: id, Revision: intRevision})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return models.Record{}, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return models.Record{}, fmt.Errorf("в доступе отказано")
+		case codes.NotFound:
+			return models.Record{}, fmt.Errorf("версия не найдена")
+		case codes.Internal:
+			return models.Record{}, fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return models.Record{}, err
+	}
+	return c.cipher.openRecord(models.Record{Id: resp.Record.Id, TypeRecord: resp.Record.Type, Version: int(resp.Record.Version), Data: resp.Record.Data, Meta: resp.Record.Meta})
+}
+
+// RestoreRevision делает указанную версию записи текущей
+func (c *Client) RestoreRevision(ctx context.Context, id, revision string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("некорректный id")
+	}
+	intRevision, err := strconv.ParseInt(revision, 10, 64)
 	if err != nil {
 		return fmt.Errorf("введите число")
 	}
 
-	_, err = c.client.DeleteData(ctx, &pb.DeleteRequest{Token: c.token, Id: intID})
+	_, err = c.client.RestoreRevision(ctx, &pb.RevisionRequest{Id: id, Revision: intRevision})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
 		case codes.Unauthenticated:
@@ -169,27 +618,222 @@ func (c *Client) DeleteData(ctx context.Context, id string) error {
 		case codes.PermissionDenied:
 			return fmt.Errorf("в доступе отказано")
 		case codes.NotFound:
-			return fmt.Errorf("данные с таким id не найдены")
+			return fmt.Errorf("версия не найдена")
+		case codes.ResourceExhausted:
+			return fmt.Errorf("превышена квота хранилища")
 		case codes.Internal:
 			return fmt.Errorf("ошибка сервера")
 		}
 	}
-	return nil
+	if err != nil || c.vault == nil {
+		return err
+	}
+	_, err = c.pull(ctx)
+	return err
 }
 
-func (c *Client) GetVersion(ctx context.Context) (models.VersionBuild, error) {
-	resp, err := c.client.GetVersion(ctx, &emptypb.Empty{})
+// GetUsage возвращает занятое место в хранилище и квоту пользователя
+func (c *Client) GetUsage(ctx context.Context) (models.Usage, error) {
+	resp, err := c.client.GetUsage(ctx, &pb.UsageRequest{})
 	if status, ok := status.FromError(err); ok {
 		switch status.Code() {
+		case codes.Unauthenticated, codes.NotFound:
+			return models.Usage{}, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
 		case codes.Internal:
-			return models.VersionBuild{}, fmt.Errorf("ошибка сервера")
+			return models.Usage{}, fmt.Errorf("ошибка сервера")
 		}
 	}
-	return models.VersionBuild{Version: resp.Ver.Version, Date: resp.Ver.Date}, nil
+	if err != nil {
+		return models.Usage{}, err
+	}
+	return models.Usage{
+		Bytes:   resp.UsedBytes,
+		Records: resp.Records,
+		Quota: models.Quota{
+			Bytes:         resp.QuotaBytes,
+			Records:       resp.QuotaRecords,
+			MaxRecordSize: resp.MaxRecordSize,
+		},
+	}, nil
+}
+
+// GetChanges возвращает изменения записей после ревизии since, ревизию для
+// следующего запроса и признак того, что на сервере остались еще изменения
+func (c *Client) GetChanges(ctx context.Context, since int64) ([]models.Change, int64, bool, error) {
+	resp, err := c.client.GetChanges(ctx, &pb.ChangesRequest{SinceRevision: since})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return nil, 0, false, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.InvalidArgument:
+			return nil, 0, false, fmt.Errorf("неверный номер ревизии")
+		case codes.Internal:
+			return nil, 0, false, fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	changes := fromRecordChanges(resp.Changes)
+	for i := range changes {
+		if changes[i].Deleted {
+			continue
+		}
+		if changes[i].Record, err = c.cipher.openRecord(changes[i].Record); err != nil {
+			return nil, 0, false, err
+		}
+	}
+	return changes, resp.Revision, resp.HasMore, nil
+}
+
+// WatchChanges подписывается на изменения записей после ревизии since
+// (отрицательное значение означает текущую ревизию) и возвращает канал с ними.
+// При обрыве соединения подписка восстанавливается с последней полученной
+// ревизии. Канал закрывается после отмены ctx или завершения сессии
+func (c *Client) WatchChanges(ctx context.Context, since int64) (<-chan models.Change, error) {
+	ctx, cancel := c.watchContext(ctx)
+	token := c.accessToken()
+	stream, revision, err := c.watch(ctx, since)
+	if c.refreshed(ctx, token, err) {
+		stream, revision, err = c.watch(ctx, since)
+	}
+	if err != nil {
+		cancel()
+	}
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return nil, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.Internal:
+			return nil, fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// ключ записей стирается при блокировке только после остановки потока
+	cipher := c.cipher
+	changes := make(chan models.Change)
+	c.watchers.Add(1)
+	go func() {
+		defer c.watchers.Done()
+		defer cancel()
+		defer close(changes)
+
+		backoff := watchMinBackoff
+		for {
+			for {
+				resp, err := stream.Recv()
+				if err != nil {
+					break
+				}
+				backoff = watchMinBackoff
+				for _, change := range fromRecordChanges(resp.Changes) {
+					if !change.Deleted {
+						record, err := cipher.openRecord(change.Record)
+						if err != nil {
+							// содержимое, которое не удалось расшифровать, не показываем
+							record = change.Record
+							record.Data, record.Meta = nil, ""
+						}
+						change.Record = record
+					}
+					select {
+					case changes <- change:
+					case <-ctx.Done():
+						return
+					}
+				}
+				revision = resp.Revision
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, watchMaxBackoff)
+
+				token := c.accessToken()
+				stream, revision, err = c.watch(ctx, revision)
+				if c.refreshed(ctx, token, err) {
+					// access-токен истек, переподключаемся с новым
+					stream, revision, err = c.watch(ctx, revision)
+				}
+				if status.Code(err) == codes.Unauthenticated {
+					return
+				}
+				if err == nil {
+					break
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// watchContext возвращает контекст потока WatchChanges, который отменяется
+// и stopWatchers
+func (c *Client) watchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.watchMu.Lock()
+	c.watchCancel = append(c.watchCancel, cancel)
+	c.watchMu.Unlock()
+	return ctx, cancel
+}
+
+// stopWatchers останавливает потоки WatchChanges и дожидается их завершения
+func (c *Client) stopWatchers() {
+	c.watchMu.Lock()
+	for _, cancel := range c.watchCancel {
+		cancel()
+	}
+	c.watchCancel = nil
+	c.watchMu.Unlock()
+	c.watchers.Wait()
+}
+
+// watch открывает поток изменений и дожидается от сервера ревизии, с которой
+// начато наблюдение
+func (c *Client) watch(ctx context.Context, since int64) (pb.GophKeeper_WatchChangesClient, int64, error) {
+	stream, err := c.client.WatchChanges(ctx, &pb.WatchRequest{SinceRevision: since})
+	if err != nil {
+		return nil, since, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, since, err
+	}
+	return stream, resp.Revision, nil
+}
+
+func fromRecordChanges(resp []*pb.RecordChange) []models.Change {
+	var changes []models.Change
+	for _, i := range resp {
+		change := models.Change{Revision: i.Revision, Deleted: i.Deleted, Record: models.Record{Id: i.Record.GetId()}}
+		if !i.Deleted {
+			change.Record = models.Record{
+				Id:         i.Record.Id,
+				TypeRecord: i.Record.Type,
+				Version:    int(i.Record.Version),
+				Data:       i.Record.Data,
+				Meta:       i.Record.Meta,
+				Size:       i.Record.Size,
+				CreatedAt:  i.Record.CreatedAt.AsTime(),
+				UpdatedAt:  i.Record.UpdatedAt.AsTime(),
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
 }
 
-// Close закрывает соединение
+// Close останавливает потоки WatchChanges и закрывает соединение
 func (c *Client) Close() error {
+	c.stopWatchers()
 	if c.conn != nil {
 		return c.conn.Close()
 	}
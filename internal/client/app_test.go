@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/sinfirst/GophKeeper/internal/app"
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+)
+
+// testKeys создает ключ подписи токенов во временном каталоге теста
+func testKeys(t *testing.T) *auth.Keyring {
+	t.Helper()
+	keys, err := auth.LoadKeyring(filepath.Join(t.TempDir(), "jwt.pem"), auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return keys
+}
+
+// newTestServer запускает сервер с хранилищем в памяти и возвращает его адрес
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	return serve(t, storage.NewMemoryDB(config.Config{}))
+}
+
+// serve запускает сервер с хранилищем db и возвращает его адрес
+func serve(t *testing.T, db handlers.Storage) string {
+	t.Helper()
+	h := handlers.NewHandler(db, nil, nil, testKeys(t), config.Config{})
+	logger := *zap.NewNop().Sugar()
+	return serveGRPC(t, app.NewGophKeeperServer(h, logger),
+		grpc.UnaryInterceptor(auth.UnaryInterceptor(h.Authenticate, logger)),
+		grpc.StreamInterceptor(auth.StreamInterceptor(h.Authenticate, logger)),
+	)
+}
+
+// serveGRPC запускает gRPC сервер с реализацией server и возвращает его адрес
+func serveGRPC(t *testing.T, server pb.GophKeeperServer, opts ...grpc.ServerOption) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterGophKeeperServer(srv, server)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// newTestClient подключается к серверу и входит в аккаунт username,
+// регистрируя его при register
+func newTestClient(t *testing.T, addr, username string, register bool) *Client {
+	t.Helper()
+	c := NewClient(addr, "")
+	t.Cleanup(func() { c.Close() })
+	ctx := context.Background()
+	var err error
+	if register {
+		err = c.Register(ctx, username, "password")
+	} else {
+		err = c.Login(ctx, username, "password")
+	}
+	if err != nil {
+		t.Fatalf("auth %s: %v", username, err)
+	}
+	return c
+}
+
+// nextChange ждет изменение из потока WatchChanges
+func nextChange(t *testing.T, changes <-chan models.Change) models.Change {
+	t.Helper()
+	select {
+	case change, ok := <-changes:
+		if !ok {
+			t.Fatalf("changes closed; want a change")
+		}
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no change within timeout")
+	}
+	return models.Change{}
+}
+
+func TestWatchChangesStopsOnClose(t *testing.T) {
+	ctx := context.Background()
+	addr := newTestServer(t)
+	watcher := newTestClient(t, addr, "user", true)
+	writer := newTestClient(t, addr, "user", false)
+
+	changes, err := watcher.WatchChanges(ctx, -1)
+	if err != nil {
+		t.Fatalf("WatchChanges: %v", err)
+	}
+	id, err := writer.StoreData(ctx, models.Text, "meta", []byte("data"))
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	if change := nextChange(t, changes); change.Record.Id != id {
+		t.Fatalf("change = %+v; want record %s", change, id)
+	}
+
+	// Close дожидается остановки потока, поэтому канал уже закрыт и новые
+	// изменения в него не попадут
+	watcher.Close()
+	if _, err := writer.StoreData(ctx, models.Text, "meta", []byte("more")); err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	select {
+	case change, ok := <-changes:
+		if ok {
+			t.Fatalf("change %+v after Close; want closed channel", change)
+		}
+	default:
+		t.Fatalf("changes still open after Close")
+	}
+}
@@ -0,0 +1,438 @@
+package client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры Argon2id, с которыми регистрируется новый аккаунт. Соль и
+// параметры хранятся на сервере, поэтому их можно усилить, не ломая уже
+// созданные аккаунты
+const (
+	keyKDFTime    = 3
+	keyKDFMemory  = 64 * 1024
+	keyKDFThreads = 4
+	keySize       = 32
+	keySaltSize   = 16
+)
+
+// Пределы параметров, полученных с сервера. Нижние не дают серверу ослабить
+// вывод ключа, верхние не дают ему заставить клиент расходовать память без меры
+const (
+	minKDFTime   = 2
+	maxKDFTime   = 16
+	minKDFMemory = 19 * 1024
+	maxKDFMemory = 1024 * 1024
+)
+
+// Признаки зашифрованных клиентом данных. Данные без признака считаются
+// сохраненными до включения шифрования и возвращаются как есть
+var (
+	sealedData   = []byte("GKE1")
+	sealedStream = []byte("GKF1")
+)
+
+const sealedMeta = "gke1:"
+
+// streamSaltSize размер соли ключа файла в начале зашифрованного потока
+const streamSaltSize = 16
+
+var (
+	errVaultKey  = errors.New("не удалось расшифровать ключ записей, проверьте пароль")
+	errKDFParams = errors.New("сервер вернул недопустимые параметры ключа из пароля")
+)
+
+// newKDFParams создает параметры Argon2id со случайной солью для нового аккаунта
+func newKDFParams() (models.KDFParams, error) {
+	kdf := models.KDFParams{Salt: make([]byte, keySaltSize), Time: keyKDFTime, Memory: keyKDFMemory, Threads: keyKDFThreads}
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return models.KDFParams{}, err
+	}
+	return kdf, nil
+}
+
+// checkKDFParams проверяет параметры, полученные с сервера
+func checkKDFParams(kdf models.KDFParams) error {
+	if len(kdf.Salt) < keySaltSize || kdf.Threads == 0 ||
+		kdf.Time < minKDFTime || kdf.Time > maxKDFTime ||
+		kdf.Memory < minKDFMemory || kdf.Memory > maxKDFMemory {
+		return errKDFParams
+	}
+	return nil
+}
+
+// accountKeys ключи, выведенные из мастер-пароля: auth отправляется серверу
+// вместо пароля при входе, vault оборачивает ключ записей и серверу не
+// передается. По одному ключу нельзя получить другой
+type accountKeys struct {
+	auth  string
+	vault []byte
+}
+
+// deriveKey выводит ключ из пароля через Argon2id
+func deriveKey(password string, salt []byte, time, memory uint32, threads uint8) []byte {
+	return argon2.IDKey([]byte(password), salt, time, memory, threads, keySize)
+}
+
+// deriveAccountKeys выводит ключи аккаунта из мастер-пароля через Argon2id с
+// солью и параметрами аккаунта
+func deriveAccountKeys(password string, kdf models.KDFParams) (accountKeys, error) {
+	master := deriveKey(password, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads)
+	auth, err := hkdf.Key(sha256.New, master, nil, "gophkeeper auth", keySize)
+	if err != nil {
+		return accountKeys{}, err
+	}
+	vault, err := hkdf.Key(sha256.New, master, nil, "gophkeeper vault key", keySize)
+	if err != nil {
+		return accountKeys{}, err
+	}
+	return accountKeys{auth: base64.RawStdEncoding.EncodeToString(auth), vault: vault}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newVaultKey создает случайный ключ записей и оборачивает его ключом wrapKey
+func newVaultKey(wrapKey []byte) (wrapped, raw []byte, err error) {
+	raw = make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err = wrapVaultKey(raw, wrapKey)
+	return wrapped, raw, err
+}
+
+// wrapVaultKey шифрует ключ записей ключом wrapKey
+func wrapVaultKey(raw, wrapKey []byte) ([]byte, error) {
+	aead, err := newAEAD(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, raw, []byte("vault key")), nil
+}
+
+// unwrapVaultKey расшифровывает ключ записей ключом wrapKey
+func unwrapVaultKey(wrapped, wrapKey []byte) ([]byte, error) {
+	aead, err := newAEAD(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errVaultKey
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	raw, err := aead.Open(nil, nonce, sealed, []byte("vault key"))
+	if err != nil {
+		return nil, errVaultKey
+	}
+	return raw, nil
+}
+
+// recordCipher шифрует данные и метаинформацию записей ключом записей
+// пользователя. Сервер получает только результат
+type recordCipher struct {
+	key  []byte
+	aead cipher.AEAD
+}
+
+func newRecordCipher(key []byte) (*recordCipher, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &recordCipher{key: key, aead: aead}, nil
+}
+
+// seal шифрует plain, связывая результат с назначением purpose, чтобы данные
+// и метаинформацию нельзя было подменить друг другом
+func (r *recordCipher) seal(plain []byte, purpose string) ([]byte, error) {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return r.aead.Seal(nonce, nonce, plain, []byte(purpose)), nil
+}
+
+func (r *recordCipher) open(sealed []byte, purpose string) ([]byte, error) {
+	if len(sealed) < r.aead.NonceSize() {
+		return nil, fmt.Errorf("не удалось расшифровать запись")
+	}
+	plain, err := r.aead.Open(nil, sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():], []byte(purpose))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось расшифровать запись")
+	}
+	return plain, nil
+}
+
+func (r *recordCipher) sealData(data []byte) ([]byte, error) {
+	sealed, err := r.seal(data, "data")
+	if err != nil {
+		return nil, err
+	}
+	return append(bytes.Clone(sealedData), sealed...), nil
+}
+
+func (r *recordCipher) sealMeta(meta string) (string, error) {
+	sealed, err := r.seal([]byte(meta), "meta")
+	if err != nil {
+		return "", err
+	}
+	return sealedMeta + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openData расшифровывает данные записи, сохраненные как одним куском, так и
+// потоком при загрузке файла
+func (r *recordCipher) openData(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, sealedData):
+		return r.open(data[len(sealedData):], "data")
+	case bytes.HasPrefix(data, sealedStream):
+		var plain bytes.Buffer
+		err := r.openStream(&plain, bytes.NewReader(data), int64(len(data)))
+		return plain.Bytes(), err
+	}
+	return data, nil
+}
+
+func (r *recordCipher) openMeta(meta string) (string, error) {
+	if r == nil || !strings.HasPrefix(meta, sealedMeta) {
+		return meta, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(meta[len(sealedMeta):])
+	if err != nil {
+		return "", fmt.Errorf("не удалось расшифровать запись")
+	}
+	plain, err := r.open(sealed, "meta")
+	return string(plain), err
+}
+
+// sealRecord шифрует метаинформацию и данные записи. Без ключа (вход без
+// связи с сервером) они возвращаются как есть
+func (r *recordCipher) sealRecord(meta string, data []byte) (string, []byte, error) {
+	if r == nil {
+		return meta, data, nil
+	}
+	meta, err := r.sealMeta(meta)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err = r.sealData(data)
+	return meta, data, err
+}
+
+// openRecord расшифровывает метаинформацию и данные записи
+func (r *recordCipher) openRecord(record models.Record) (models.Record, error) {
+	if r == nil {
+		return record, nil
+	}
+	var err error
+	if record.Meta, err = r.openMeta(record.Meta); err != nil {
+		return models.Record{}, err
+	}
+	if record.Data, err = r.openData(record.Data); err != nil {
+		return models.Record{}, err
+	}
+	return record, nil
+}
+
+// sealed сообщает, что данные и метаинформация записи уже зашифрованы
+func sealed(record models.Record) bool {
+	return strings.HasPrefix(record.Meta, sealedMeta) &&
+		(bytes.HasPrefix(record.Data, sealedData) || bytes.HasPrefix(record.Data, sealedStream))
+}
+
+// Файлы шифруются потоком частей по chunkSize байт, каждая часть отдельно.
+// Ключ файла выводится из ключа записей и соли в начале потока, номер части и
+// признак последней входят в nonce, поэтому части нельзя переставить или
+// отрезать. Соль зависит от содержимого файла, чтобы прерванную загрузку
+// можно было продолжить из другого процесса с теми же зашифрованными данными.
+//
+// streamSize размер зашифрованного потока для файла размером size
+func (r *recordCipher) streamSize(size int64) int64 {
+	chunks := max((size+chunkSize-1)/chunkSize, 1)
+	return int64(len(sealedStream)+streamSaltSize) + size + chunks*int64(r.aead.Overhead())
+}
+
+// streamAEAD шифр частей файла с солью salt
+func (r *recordCipher) streamAEAD(salt []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, r.key, salt, "gophkeeper file", keySize)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+// streamNonce nonce части index; у последней части выставлен отдельный признак
+func streamNonce(size int, index int64, last bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// sealStream возвращает поток с зашифрованным содержимым file размером size
+func (r *recordCipher) sealStream(file io.ReadSeeker, size int64) (io.Reader, error) {
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(digest.Sum(nil))
+	salt := mac.Sum(nil)[:streamSaltSize]
+
+	aead, err := r.streamAEAD(salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(bytes.Clone(sealedStream), salt...)
+	return &sealReader{src: file, aead: aead, out: header, chunks: max((size+chunkSize-1)/chunkSize, 1), buf: make([]byte, chunkSize)}, nil
+}
+
+// sealReader шифрует содержимое src по частям по мере чтения
+type sealReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	out    []byte
+	index  int64
+	chunks int64
+	buf    []byte
+}
+
+func (s *sealReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.index == s.chunks {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(s.src, s.buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		last := s.index == s.chunks-1
+		s.out = s.aead.Seal(s.out[:0], streamNonce(s.aead.NonceSize(), s.index, last), s.buf[:n], nil)
+		s.index++
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// openStream расшифровывает поток src размером size в dst
+func (r *recordCipher) openStream(dst io.Writer, src io.Reader, size int64) error {
+	header := make([]byte, len(sealedStream)+streamSaltSize)
+	if _, err := io.ReadFull(src, header); err != nil || !bytes.HasPrefix(header, sealedStream) {
+		return fmt.Errorf("не удалось расшифровать файл")
+	}
+	aead, err := r.streamAEAD(header[len(sealedStream):])
+	if err != nil {
+		return err
+	}
+
+	left := size - int64(len(header))
+	if left <= 0 {
+		return fmt.Errorf("не удалось расшифровать файл")
+	}
+	buf := make([]byte, chunkSize+aead.Overhead())
+	for index := int64(0); left > 0; index++ {
+		n := min(left, int64(len(buf)))
+		if _, err := io.ReadFull(src, buf[:n]); err != nil {
+			return err
+		}
+		left -= n
+		plain, err := aead.Open(buf[:0], streamNonce(aead.NonceSize(), index, left == 0), buf[:n], nil)
+		if err != nil {
+			return fmt.Errorf("не удалось расшифровать файл")
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openFile расшифровывает скачанный файл src в dst. Файл, сохраненный без
+// шифрования или без ключа, просто переименовывается
+func (r *recordCipher) openFile(src, dst string) error {
+	if r == nil {
+		return os.Rename(src, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, len(sealedStream))
+	n, _ := io.ReadFull(in, prefix)
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var write func(out io.Writer) error
+	switch {
+	case bytes.Equal(prefix[:n], sealedStream):
+		write = func(out io.Writer) error { return r.openStream(out, in, info.Size()) }
+	case bytes.Equal(prefix[:n], sealedData):
+		write = func(out io.Writer) error {
+			data, err := io.ReadAll(in)
+			if err != nil {
+				return err
+			}
+			plain, err := r.openData(data)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(plain)
+			return err
+		}
+	default:
+		in.Close()
+		return os.Rename(src, dst)
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
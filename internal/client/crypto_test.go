@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// testKDFParams параметры с минимальной допустимой стоимостью, чтобы тесты
+// не тратили время на Argon2id
+func testKDFParams(salt string) models.KDFParams {
+	return models.KDFParams{Salt: []byte(salt), Time: minKDFTime, Memory: minKDFMemory, Threads: 1}
+}
+
+func TestDeriveAccountKeys(t *testing.T) {
+	kdf := testKDFParams("0123456789abcdef")
+	keys, err := deriveAccountKeys("password", kdf)
+	if err != nil {
+		t.Fatalf("deriveAccountKeys: %v", err)
+	}
+	if keys.auth == "password" || bytes.Equal([]byte(keys.auth), keys.vault) {
+		t.Fatalf("auth key %q must differ from the password and the vault key", keys.auth)
+	}
+
+	again, err := deriveAccountKeys("password", kdf)
+	if err != nil || again.auth != keys.auth || !bytes.Equal(again.vault, keys.vault) {
+		t.Fatalf("deriveAccountKeys with the stored salt = %+v, %v; want the same keys", again, err)
+	}
+	// соль случайная для каждого аккаунта, поэтому один пароль дает разные ключи
+	other, err := deriveAccountKeys("password", testKDFParams("fedcba9876543210"))
+	if err != nil || other.auth == keys.auth || bytes.Equal(other.vault, keys.vault) {
+		t.Fatalf("deriveAccountKeys with another salt = %+v, %v; want different keys", other, err)
+	}
+	if wrong, _ := deriveAccountKeys("wrong", kdf); wrong.auth == keys.auth {
+		t.Fatalf("deriveAccountKeys with a wrong password gave the same auth key")
+	}
+}
+
+func TestNewKDFParams(t *testing.T) {
+	a, err := newKDFParams()
+	if err != nil {
+		t.Fatalf("newKDFParams: %v", err)
+	}
+	b, err := newKDFParams()
+	if err != nil {
+		t.Fatalf("newKDFParams: %v", err)
+	}
+	if err := checkKDFParams(a); err != nil {
+		t.Errorf("checkKDFParams(newKDFParams()) = %v; want nil", err)
+	}
+	if bytes.Equal(a.Salt, b.Salt) {
+		t.Errorf("newKDFParams returned the same salt twice")
+	}
+}
+
+func TestCheckKDFParams(t *testing.T) {
+	valid := testKDFParams("0123456789abcdef")
+	tests := []struct {
+		name   string
+		change func(kdf *models.KDFParams)
+		ok     bool
+	}{
+		{"minimal cost", func(kdf *models.KDFParams) {}, true},
+		{"short salt", func(kdf *models.KDFParams) { kdf.Salt = kdf.Salt[:8] }, false},
+		{"no salt", func(kdf *models.KDFParams) { kdf.Salt = nil }, false},
+		{"time too low", func(kdf *models.KDFParams) { kdf.Time = 1 }, false},
+		{"memory too low", func(kdf *models.KDFParams) { kdf.Memory = 1024 }, false},
+		{"memory too high", func(kdf *models.KDFParams) { kdf.Memory = maxKDFMemory + 1 }, false},
+		{"time too high", func(kdf *models.KDFParams) { kdf.Time = maxKDFTime + 1 }, false},
+		{"no threads", func(kdf *models.KDFParams) { kdf.Threads = 0 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kdf := valid
+			kdf.Salt = bytes.Clone(valid.Salt)
+			tt.change(&kdf)
+			err := checkKDFParams(kdf)
+			if tt.ok && err != nil {
+				t.Errorf("checkKDFParams = %v; want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, errKDFParams) {
+				t.Errorf("checkKDFParams = %v; want errKDFParams", err)
+			}
+		})
+	}
+}
+
+func TestWrapVaultKey(t *testing.T) {
+	keys, err := deriveAccountKeys("password", testKDFParams("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("deriveAccountKeys: %v", err)
+	}
+	wrapped, raw, err := newVaultKey(keys.vault)
+	if err != nil {
+		t.Fatalf("newVaultKey: %v", err)
+	}
+	if bytes.Contains(wrapped, raw) {
+		t.Fatalf("wrapped key contains the raw key")
+	}
+	got, err := unwrapVaultKey(wrapped, keys.vault)
+	if err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("unwrapVaultKey = %x, %v; want %x", got, err, raw)
+	}
+
+	wrong, err := deriveAccountKeys("wrong", testKDFParams("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("deriveAccountKeys: %v", err)
+	}
+	if _, err := unwrapVaultKey(wrapped, wrong.vault); !errors.Is(err, errVaultKey) {
+		t.Errorf("unwrapVaultKey with a wrong password = %v; want errVaultKey", err)
+	}
+	if _, err := unwrapVaultKey(wrapped[:4], keys.vault); !errors.Is(err, errVaultKey) {
+		t.Errorf("unwrapVaultKey of a truncated key = %v; want errVaultKey", err)
+	}
+}
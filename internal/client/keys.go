@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrLegacyAccount аккаунт создан до сквозного шифрования, и войти в него
+// можно только после переноса через MigrateAccount
+var ErrLegacyAccount = errors.New("аккаунт создан до сквозного шифрования, перенесите его, чтобы войти")
+
+// errMigrated сервер просит перенести аккаунт, в который с этого устройства
+// уже входили ключом из пароля. Пароль в этом случае серверу не отправляется
+var errMigrated = errors.New("сервер требует перенести уже перенесенный аккаунт, пароль не отправлен")
+
+// login входит на сервер ключом входа, выведенным из пароля с солью и
+// параметрами аккаунта. Сам пароль серверу не отправляется. Ошибка связи
+// возвращается как есть, чтобы можно было войти без связи
+func (c *Client) login(ctx context.Context, username, password string) (*pb.AuthResponse, accountKeys, error) {
+	keys, err := c.deriveKeys(ctx, username, password)
+	if err == nil {
+		var resp *pb.AuthResponse
+		resp, err = c.client.Login(ctx, &pb.AuthRequest{Username: username, Password: keys.auth})
+		if err == nil {
+			if err := c.markMigrated(username); err != nil {
+				return nil, accountKeys{}, err
+			}
+			return resp, keys, nil
+		}
+		if _, ok := secondFactorTicket(err); ok {
+			return nil, keys, err
+		}
+	}
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return nil, accountKeys{}, fmt.Errorf("неверный пароль")
+	case codes.NotFound:
+		return nil, accountKeys{}, fmt.Errorf("пользователь с таким логином не найден")
+	case codes.FailedPrecondition:
+		if c.migrated(username) {
+			return nil, accountKeys{}, errMigrated
+		}
+		return nil, accountKeys{}, ErrLegacyAccount
+	case codes.Internal:
+		return nil, accountKeys{}, fmt.Errorf("ошибка сервера")
+	}
+	return nil, accountKeys{}, err
+}
+
+// deriveKeys получает с сервера соль и параметры аккаунта и выводит из пароля
+// ключи аккаунта. Параметры слабее допустимых не принимаются
+func (c *Client) deriveKeys(ctx context.Context, username, password string) (accountKeys, error) {
+	resp, err := c.client.GetKDFParams(ctx, &pb.KDFRequest{Username: username})
+	if err != nil {
+		return accountKeys{}, err
+	}
+	if resp.Threads > math.MaxUint8 {
+		return accountKeys{}, errKDFParams
+	}
+	kdf := models.KDFParams{Salt: resp.Salt, Time: resp.Time, Memory: resp.Memory, Threads: uint8(resp.Threads)}
+	if err := checkKDFParams(kdf); err != nil {
+		return accountKeys{}, err
+	}
+	return deriveAccountKeys(password, kdf)
+}
+
+// MigrateAccount переносит аккаунт, созданный до сквозного шифрования: сервер
+// в последний раз получает пароль, проверяет его и дальше принимает только
+// ключ входа, выведенный из пароля с новой случайной солью. Перенос
+// выполняется только по явной команде пользователя. Если с этого устройства
+// уже входили ключом, пароль не отправляется, что бы ни отвечал сервер
+func (c *Client) MigrateAccount(ctx context.Context, username, password string) error {
+	if c.migrated(username) {
+		return errMigrated
+	}
+	kdf, err := newKDFParams()
+	if err != nil {
+		return err
+	}
+	keys, err := deriveAccountKeys(password, kdf)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.MigrateAccount(ctx, &pb.MigrateRequest{
+		Username:    username,
+		Password:    password,
+		NewPassword: keys.auth,
+		Kdf:         toKDFParams(kdf),
+	})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("неверный пароль")
+		case codes.NotFound:
+			return fmt.Errorf("пользователь с таким логином не найден")
+		case codes.AlreadyExists:
+			return fmt.Errorf("аккаунт уже перенесен")
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return c.Login(ctx, username, password)
+}
+
+// toKDFParams переводит параметры Argon2id в сообщение для сервера
+func toKDFParams(kdf models.KDFParams) *pb.KDFParams {
+	return &pb.KDFParams{Salt: kdf.Salt, Time: kdf.Time, Memory: kdf.Memory, Threads: uint32(kdf.Threads)}
+}
+
+// accountPath путь к отметке о входе ключом для пользователя username. Имя
+// файла, как и у локальной копии, не раскрывает логин
+func accountPath(dir, username string) string {
+	return filepath.Join(dir, fmt.Sprintf("%x.account", sha256.Sum256([]byte(username))))
+}
+
+// markMigrated запоминает, что с этого устройства в аккаунт входили ключом
+// из пароля. Без каталога локальных копий отметка не сохраняется
+func (c *Client) markMigrated(username string) error {
+	if c.vaultDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.vaultDir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(accountPath(c.vaultDir, username), nil, 0o600)
+}
+
+// migrated сообщает, что с этого устройства в аккаунт уже входили ключом
+func (c *Client) migrated(username string) bool {
+	if c.vaultDir == "" {
+		return false
+	}
+	_, err := os.Stat(accountPath(c.vaultDir, username))
+	return err == nil
+}
+
+// unlock получает с сервера ключ записей пользователя и расшифровывает его
+// ключом wrapKey из пароля. При первом входе ключ создается, а записи,
+// сохраненные до включения шифрования, шифруются им
+func (c *Client) unlock(ctx context.Context, wrapKey []byte) error {
+	err := c.unlockKey(ctx, wrapKey)
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	return err
+}
+
+func (c *Client) unlockKey(ctx context.Context, wrapKey []byte) error {
+	resp, err := c.client.GetVaultKey(ctx, &pb.VaultKeyRequest{})
+	if status.Code(err) == codes.NotFound {
+		return c.createKey(ctx, wrapKey)
+	}
+	if err != nil {
+		return err
+	}
+	raw, err := unwrapVaultKey(resp.WrappedKey, wrapKey)
+	if err != nil {
+		return err
+	}
+	c.cipher, err = newRecordCipher(raw)
+	return err
+}
+
+// createKey создает ключ записей и сохраняет его на сервере. Если ключ успел
+// сохранить другой клиент, используется он
+func (c *Client) createKey(ctx context.Context, wrapKey []byte) error {
+	wrapped, raw, err := newVaultKey(wrapKey)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.SetVaultKey(ctx, &pb.SetVaultKeyRequest{Key: &pb.VaultKey{WrappedKey: wrapped}})
+	if status.Code(err) == codes.AlreadyExists {
+		return c.unlockKey(ctx, wrapKey)
+	}
+	if err != nil {
+		return err
+	}
+	if c.cipher, err = newRecordCipher(raw); err != nil {
+		return err
+	}
+	return c.sealExisting(ctx)
+}
+
+// sealExisting шифрует записи, сохраненные на сервере до включения
+// шифрования. Запись, которую не удалось перезаписать (например, ее изменили
+// с другого устройства), остается как есть и читается без расшифровки
+func (c *Client) sealExisting(ctx context.Context) error {
+	cursor := ""
+	for {
+		resp, err := c.client.ListData(ctx, &pb.ListRequest{Cursor: cursor})
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, i := range resp.Records {
+			record := models.Record{Data: i.Data, Meta: i.Meta}
+			if sealed(record) {
+				continue
+			}
+			meta, data, err := c.cipher.sealRecord(i.Meta, i.Data)
+			if err != nil {
+				return err
+			}
+			_, err = c.client.UpdateData(ctx, &pb.UpdateResponse{Id: i.Id, Meta: meta, Data: data, Version: i.Version})
+			if status.Code(err) == codes.Unavailable || status.Code(err) == codes.Unauthenticated {
+				return err
+			}
+		}
+		if resp.NextCursor == "" {
+			return nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// ChangePassword меняет пароль аккаунта, он же мастер-пароль. Из нового
+// пароля с новой солью выводятся ключ входа и ключ для ключа записей. Ключ
+// записей остается прежним: сервер получает его обернутым новым ключом вместе
+// с новым ключом входа одним запросом, поэтому записи перешифровывать не нужно.
+// Локальная копия сначала перешифровывается новым паролем в отдельный файл и
+// заменяется им после ответа сервера; если ответ не дошел, копия подхватит
+// этот файл при входе с новым паролем. Остальные сессии пользователя
+// завершаются
+func (c *Client) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	if c.locked {
+		return fmt.Errorf("хранилище заблокировано, разблокируйте его паролем")
+	}
+	if newPassword == "" {
+		return fmt.Errorf("новый пароль не может быть пустым")
+	}
+	if c.useVault(ctx) {
+		return fmt.Errorf("нет связи с сервером")
+	}
+
+	current, err := c.deriveKeys(ctx, c.account, oldPassword)
+	if status.Code(err) == codes.Unavailable {
+		return fmt.Errorf("нет связи с сервером")
+	}
+	if err != nil {
+		return err
+	}
+	kdf, err := newKDFParams()
+	if err != nil {
+		return err
+	}
+	keys, err := deriveAccountKeys(newPassword, kdf)
+	if err != nil {
+		return err
+	}
+	req := &pb.ChangePasswordRequest{OldPassword: current.auth, NewPassword: keys.auth, Kdf: toKDFParams(kdf)}
+	if c.cipher != nil {
+		wrapped, err := wrapVaultKey(c.cipher.key, keys.vault)
+		if err != nil {
+			return err
+		}
+		req.Key = &pb.VaultKey{WrappedKey: wrapped}
+	}
+	if c.vault != nil {
+		if err := c.vault.stageRekey(newPassword); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.client.ChangePassword(ctx, req)
+	if err != nil && c.vault != nil && status.Code(err) != codes.Unavailable {
+		c.vault.dropRekey()
+	}
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return fmt.Errorf("неверный текущий пароль")
+		case codes.InvalidArgument:
+			return fmt.Errorf("новый пароль не может быть пустым")
+		case codes.AlreadyExists:
+			return fmt.Errorf("пароль изменен на другом устройстве, войдите заново")
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером, пароль мог не смениться: попробуйте войти с новым паролем")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	c.setAccessToken(resp.Token)
+	if c.vault != nil {
+		return c.vault.commitRekey()
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+)
+
+// authServer сервер, который отвечает на запросы входа заданными ошибками и
+// запоминает все присланные ему пароли
+type authServer struct {
+	pb.UnimplementedGophKeeperServer
+	kdf    *pb.KDFParams
+	kdfErr error
+
+	mu        sync.Mutex
+	passwords []string
+}
+
+func (s *authServer) GetKDFParams(ctx context.Context, req *pb.KDFRequest) (*pb.KDFParams, error) {
+	return s.kdf, s.kdfErr
+}
+
+func (s *authServer) Login(ctx context.Context, req *pb.AuthRequest) (*pb.AuthResponse, error) {
+	s.received(req.Password)
+	return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+}
+
+func (s *authServer) MigrateAccount(ctx context.Context, req *pb.MigrateRequest) (*emptypb.Empty, error) {
+	s.received(req.Password, req.NewPassword)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *authServer) received(passwords ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwords = append(s.passwords, passwords...)
+}
+
+func (s *authServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.passwords)
+}
+
+func TestLoginNeverSendsPassword(t *testing.T) {
+	kdf := testKDFParams("0123456789abcdef")
+	tests := []struct {
+		name   string
+		server *authServer
+		marked bool
+		err    error
+		// login сервер получает ключ входа, но не сам пароль
+		login bool
+	}{
+		{
+			name:   "wrong password",
+			server: &authServer{kdf: toKDFParams(kdf)},
+			login:  true,
+		},
+		{
+			name:   "weak params",
+			server: &authServer{kdf: toKDFParams(models.KDFParams{Salt: kdf.Salt, Time: 1, Memory: 1024, Threads: 1})},
+			err:    errKDFParams,
+		},
+		{
+			name:   "legacy account",
+			server: &authServer{kdfErr: status.Error(codes.FailedPrecondition, "legacy account")},
+			err:    ErrLegacyAccount,
+		},
+		{
+			name:   "legacy reply for a migrated account",
+			server: &authServer{kdfErr: status.Error(codes.FailedPrecondition, "legacy account")},
+			marked: true,
+			err:    errMigrated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(serveGRPC(t, tt.server), t.TempDir())
+			t.Cleanup(func() { c.Close() })
+			if tt.marked {
+				if err := c.markMigrated("user"); err != nil {
+					t.Fatalf("markMigrated: %v", err)
+				}
+			}
+
+			err := c.Login(context.Background(), "user", "master")
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("Login = %v; want %v", err, tt.err)
+			}
+			if tt.err == nil && err == nil {
+				t.Fatalf("Login succeeded against a server that rejects every key")
+			}
+			sent := tt.server.sent()
+			if slices.Contains(sent, "master") {
+				t.Fatalf("server received the master password")
+			}
+			want := 0
+			if tt.login {
+				want = 1
+			}
+			if len(sent) != want {
+				t.Fatalf("server received %d passwords; want %d and no retry", len(sent), want)
+			}
+		})
+	}
+}
+
+func TestMigrateAccount(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewMemoryDB(config.Config{})
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	// аккаунт, созданный до сквозного шифрования
+	if err := db.AddUserToDB(ctx, "legacy", string(hash), models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+	addr := serve(t, db)
+
+	dir := t.TempDir()
+	c := NewClient(addr, dir)
+	t.Cleanup(func() { c.Close() })
+	if err := c.Login(ctx, "legacy", "password"); !errors.Is(err, ErrLegacyAccount) {
+		t.Fatalf("Login of a legacy account = %v; want ErrLegacyAccount", err)
+	}
+	if err := c.MigrateAccount(ctx, "legacy", "wrong"); err == nil {
+		t.Fatalf("MigrateAccount with a wrong password succeeded")
+	}
+	if err := c.MigrateAccount(ctx, "legacy", "password"); err != nil {
+		t.Fatalf("MigrateAccount: %v", err)
+	}
+	if _, err := os.Stat(accountPath(dir, "legacy")); err != nil {
+		t.Errorf("no migration mark after MigrateAccount: %v", err)
+	}
+	id, err := c.StoreData(ctx, models.Text, "meta", []byte("data"))
+	if err != nil {
+		t.Fatalf("StoreData after MigrateAccount: %v", err)
+	}
+
+	// сервер больше не принимает пароль, а другое устройство входит ключом
+	raw := pb.NewGophKeeperClient(c.conn)
+	if _, err := raw.Login(ctx, &pb.AuthRequest{Username: "legacy", Password: "password"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Login with the master password after migration = %v; want Unauthenticated", err)
+	}
+	other := newTestClient(t, addr, "legacy", false)
+	if record, err := other.RetrieveData(ctx, id); err != nil || string(record.Data) != "data" {
+		t.Errorf("RetrieveData on another device = %+v, %v; want the stored record", record, err)
+	}
+	if err := c.MigrateAccount(ctx, "legacy", "password"); !errors.Is(err, errMigrated) {
+		t.Errorf("second MigrateAccount = %v; want errMigrated", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	addr := newTestServer(t)
+	c := newTestClient(t, addr, "user", true)
+	other := newTestClient(t, addr, "user", false)
+	id, err := c.StoreData(ctx, models.Text, "meta", []byte("data"))
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+
+	if err := c.ChangePassword(ctx, "wrong", "new"); err == nil {
+		t.Fatalf("ChangePassword with a wrong password succeeded")
+	}
+	if err := c.ChangePassword(ctx, "password", "new"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if record, err := c.RetrieveData(ctx, id); err != nil || string(record.Data) != "data" {
+		t.Errorf("RetrieveData after ChangePassword = %+v, %v; want the stored record", record, err)
+	}
+	if _, err := other.RetrieveData(ctx, id); err == nil {
+		t.Errorf("RetrieveData in another session succeeded; want the session revoked")
+	}
+
+	fresh := NewClient(addr, "")
+	t.Cleanup(func() { fresh.Close() })
+	if err := fresh.Login(ctx, "user", "password"); err == nil {
+		t.Errorf("Login with the old password succeeded")
+	}
+	if err := fresh.Login(ctx, "user", "new"); err != nil {
+		t.Fatalf("Login with the new password: %v", err)
+	}
+	if record, err := fresh.RetrieveData(ctx, id); err != nil || string(record.Data) != "data" {
+		t.Errorf("RetrieveData with the new password = %+v, %v; want the record decrypted", record, err)
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Locked сообщает, что хранилище заблокировано и для работы нужен пароль
+func (c *Client) Locked() bool {
+	return c.locked
+}
+
+// Lock блокирует хранилище: ключ записей и расшифрованные записи локальной
+// копии стираются из памяти, а запросы отклоняются до Unlock. Сессия на
+// сервере не завершается, поэтому для разблокировки достаточно пароля
+func (c *Client) Lock() {
+	if c.account == "" || c.locked {
+		return
+	}
+	c.wipe()
+	c.stash()
+	c.locked = true
+}
+
+// stash откладывает токены сессии до разблокировки
+func (c *Client) stash() {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.lockedToken, c.lockedRefresh = c.sessionTokens()
+	c.setTokens("", "")
+}
+
+// wipe стирает из памяти ключ записей, расшифрованные записи и пароль.
+// Потоки WatchChanges, которые расшифровывают изменения, останавливаются
+// раньше
+func (c *Client) wipe() {
+	c.stopWatchers()
+	if c.cipher != nil {
+		clear(c.cipher.key)
+		c.cipher = nil
+	}
+	if c.vault != nil {
+		c.vault.wipe()
+		c.vault = nil
+	}
+	c.password = ""
+}
+
+// Unlock снимает блокировку, если пароль подходит к ключу записей. Без связи
+// с сервером пароль проверяется по локальной копии. Если сессия на сервере
+// успела завершиться, выполняется вход с тем же логином
+func (c *Client) Unlock(ctx context.Context, password string) error {
+	if !c.locked {
+		return nil
+	}
+	if c.lockedToken == "" {
+		// вход был выполнен без связи с сервером
+		return c.Login(ctx, c.account, password)
+	}
+
+	// за время блокировки access-токен мог истечь, тогда его обновит
+	// refresh-токен
+	c.setTokens(c.lockedToken, c.lockedRefresh)
+	keys, err := c.deriveKeys(ctx, c.account, password)
+	if err == nil {
+		err = c.unlockKey(ctx, keys.vault)
+	}
+	switch {
+	case err == nil:
+		if err := c.openVault(c.account, password); err != nil {
+			return err
+		}
+	case errors.Is(err, errVaultKey):
+		// токены могли обновиться, отложенными остаются новые
+		c.stash()
+		return fmt.Errorf("неверный пароль")
+	case status.Code(err) == codes.Unavailable:
+		token, refresh := c.sessionTokens()
+		if err := c.loginOffline(c.account, password); err != nil {
+			c.stash()
+			return err
+		}
+		c.setTokens(token, refresh)
+	default:
+		c.setTokens("", "")
+		return c.Login(ctx, c.account, password)
+	}
+	c.locked, c.lockedToken, c.lockedRefresh = false, "", ""
+	return nil
+}
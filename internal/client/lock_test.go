@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+func TestLockUnlock(t *testing.T) {
+	ctx := context.Background()
+	addr := newTestServer(t)
+	newTestClient(t, addr, "user", true)
+	c := newVaultClient(t, addr, "user")
+	id, err := c.StoreData(ctx, models.Text, "meta", []byte("data"))
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+
+	c.Lock()
+	if !c.Locked() || c.cipher != nil || c.vault != nil || c.accessToken() != "" {
+		t.Fatalf("Lock left the record key, the vault or the token in memory")
+	}
+	if err := c.Unlock(ctx, "wrong"); err == nil || !c.Locked() {
+		t.Fatalf("Unlock with a wrong password = %v, locked %t; want an error and still locked", err, c.Locked())
+	}
+	if err := c.Unlock(ctx, "password"); err != nil || c.Locked() {
+		t.Fatalf("Unlock = %v, locked %t; want unlocked", err, c.Locked())
+	}
+	if record, err := c.RetrieveData(ctx, id); err != nil || string(record.Data) != "data" {
+		t.Errorf("RetrieveData after Unlock = %+v, %v; want the stored record", record, err)
+	}
+}
+
+func TestWatchChangesStopsOnLock(t *testing.T) {
+	ctx := context.Background()
+	addr := newTestServer(t)
+	writer := newTestClient(t, addr, "user", true)
+	watcher := newVaultClient(t, addr, "user")
+
+	changes, err := watcher.WatchChanges(ctx, -1)
+	if err != nil {
+		t.Fatalf("WatchChanges: %v", err)
+	}
+	if _, err := writer.StoreData(ctx, models.Text, "meta", []byte("data")); err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	nextChange(t, changes)
+
+	// Lock стирает ключ записей только после остановки потока, поэтому
+	// расшифрованные изменения после блокировки не приходят
+	watcher.Lock()
+	if _, err := writer.StoreData(ctx, models.Text, "meta", []byte("more")); err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	select {
+	case change, ok := <-changes:
+		if ok {
+			t.Fatalf("change %+v after Lock; want closed channel", change)
+		}
+	default:
+		t.Fatalf("changes still open after Lock")
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// Поля записей, по которым сливаются изменения
+const (
+	FieldMeta     string = "meta"
+	FieldData     string = "data"
+	FieldLogin    string = "login"
+	FieldPassword string = "password"
+	FieldNumber   string = "number"
+	FieldDate     string = "date"
+	FieldCVV      string = "cvv"
+)
+
+// errNoBase у изменения нет общей с сервером версии, слить его нельзя
+var errNoBase = errors.New("нет общей версии записи")
+
+// RecordFields возвращает поля записи в порядке показа. Данные LOGIN и CARD
+// раскладываются на поля JSON, данные остальных типов считаются одним полем
+func RecordFields(record models.Record) ([]string, map[string]string, error) {
+	fields := map[string]string{FieldMeta: record.Meta}
+	switch record.TypeRecord {
+	case models.Login:
+		var login models.LoginJSON
+		if err := json.Unmarshal(record.Data, &login); err != nil {
+			return nil, nil, fmt.Errorf("не удалось разобрать данные записи %s: %w", record.Id, err)
+		}
+		fields[FieldLogin], fields[FieldPassword] = login.Login, login.Password
+		return []string{FieldLogin, FieldPassword, FieldMeta}, fields, nil
+	case models.Card:
+		var card models.CardJSON
+		if err := json.Unmarshal(record.Data, &card); err != nil {
+			return nil, nil, fmt.Errorf("не удалось разобрать данные записи %s: %w", record.Id, err)
+		}
+		fields[FieldNumber], fields[FieldDate], fields[FieldCVV] = card.Number, card.Date, card.CVV
+		return []string{FieldNumber, FieldDate, FieldCVV, FieldMeta}, fields, nil
+	}
+	fields[FieldData] = string(record.Data)
+	return []string{FieldData, FieldMeta}, fields, nil
+}
+
+// withFields возвращает копию записи с данными и метаинформацией из fields
+func withFields(record models.Record, fields map[string]string) (models.Record, error) {
+	var err error
+	record.Meta = fields[FieldMeta]
+	switch record.TypeRecord {
+	case models.Login:
+		record.Data, err = json.Marshal(models.LoginJSON{Login: fields[FieldLogin], Password: fields[FieldPassword]})
+	case models.Card:
+		record.Data, err = json.Marshal(models.CardJSON{Number: fields[FieldNumber], Date: fields[FieldDate], CVV: fields[FieldCVV]})
+	default:
+		record.Data = []byte(fields[FieldData])
+	}
+	return record, err
+}
+
+// mergeRecords сливает локальные и серверные изменения записи относительно
+// общей версии base. Поле, измененное только с одной стороны, берется оттуда;
+// поля, измененные по-разному с обеих сторон, возвращаются как конфликтующие,
+// а в результате для них остается серверное значение. Версия результата
+// серверная
+func mergeRecords(base, local, remote models.Record) (models.Record, []string, error) {
+	if base.Version == 0 {
+		return models.Record{}, nil, errNoBase
+	}
+	order, baseFields, err := RecordFields(base)
+	if err != nil {
+		return models.Record{}, nil, err
+	}
+	_, localFields, err := RecordFields(local)
+	if err != nil {
+		return models.Record{}, nil, err
+	}
+	_, remoteFields, err := RecordFields(remote)
+	if err != nil {
+		return models.Record{}, nil, err
+	}
+
+	var conflicts []string
+	merged := make(map[string]string, len(order))
+	for _, field := range order {
+		b, l, r := baseFields[field], localFields[field], remoteFields[field]
+		switch {
+		case l == r, l == b:
+			merged[field] = r
+		case r == b:
+			merged[field] = l
+		default:
+			merged[field] = r
+			conflicts = append(conflicts, field)
+		}
+	}
+
+	record, err := withFields(remote, merged)
+	return record, conflicts, err
+}
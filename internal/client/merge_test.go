@@ -0,0 +1,87 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// loginRecord запись LOGIN с данными из login и password
+func loginRecord(t *testing.T, version int, login, password, meta string) models.Record {
+	t.Helper()
+	data, err := json.Marshal(models.LoginJSON{Login: login, Password: password})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return models.Record{Id: "id", TypeRecord: models.Login, Version: version, Data: data, Meta: meta}
+}
+
+func TestMergeRecords(t *testing.T) {
+	base := loginRecord(t, 1, "user", "old", "meta")
+	tests := []struct {
+		name      string
+		base      models.Record
+		local     models.Record
+		remote    models.Record
+		want      models.Record
+		conflicts []string
+		err       error
+	}{
+		{
+			name:   "disjoint fields",
+			base:   base,
+			local:  loginRecord(t, 1, "user", "local", "meta"),
+			remote: loginRecord(t, 2, "admin", "old", "remote meta"),
+			want:   loginRecord(t, 2, "admin", "local", "remote meta"),
+		},
+		{
+			name:   "same change on both sides",
+			base:   base,
+			local:  loginRecord(t, 1, "user", "new", "meta"),
+			remote: loginRecord(t, 2, "user", "new", "meta"),
+			want:   loginRecord(t, 2, "user", "new", "meta"),
+		},
+		{
+			name:      "same field edited differently",
+			base:      base,
+			local:     loginRecord(t, 1, "user", "local", "local meta"),
+			remote:    loginRecord(t, 2, "admin", "remote", "meta"),
+			want:      loginRecord(t, 2, "admin", "remote", "local meta"),
+			conflicts: []string{FieldPassword},
+		},
+		{
+			name:      "text data is one field",
+			base:      models.Record{Id: "id", TypeRecord: models.Text, Version: 1, Data: []byte("base")},
+			local:     models.Record{Id: "id", TypeRecord: models.Text, Version: 1, Data: []byte("local")},
+			remote:    models.Record{Id: "id", TypeRecord: models.Text, Version: 2, Data: []byte("remote")},
+			want:      models.Record{Id: "id", TypeRecord: models.Text, Version: 2, Data: []byte("remote")},
+			conflicts: []string{FieldData},
+		},
+		{
+			name:   "no common version",
+			local:  loginRecord(t, 0, "user", "local", "meta"),
+			remote: loginRecord(t, 2, "user", "remote", "meta"),
+			err:    errNoBase,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts, err := mergeRecords(tt.base, tt.local, tt.remote)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("mergeRecords error = %v; want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %v; want %v", conflicts, tt.conflicts)
+			}
+			if got.Version != tt.want.Version || got.Meta != tt.want.Meta || string(got.Data) != string(tt.want.Data) {
+				t.Errorf("mergeRecords = %+v (data %s); want %+v (data %s)", got, got.Data, tt.want, tt.want.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Offline сообщает, что сервер недоступен и клиент работает с локальной копией
+func (c *Client) Offline() bool {
+	return c.offline
+}
+
+// Pending количество изменений, ожидающих отправки на сервер
+func (c *Client) Pending() int {
+	if c.vault == nil {
+		return 0
+	}
+	return c.vault.pendingCount()
+}
+
+// Conflicts возвращает локальные изменения, которые не удалось применить на сервере
+func (c *Client) Conflicts() []Conflict {
+	if c.vault == nil {
+		return nil
+	}
+	return c.vault.conflicts()
+}
+
+// openVault открывает локальную копию пользователя после входа на сервер.
+// Копия, которую не удалось расшифровать (например, пароль сменили на другом
+// устройстве), откладывается в файл .bak, и создается новая
+func (c *Client) openVault(username, password string) error {
+	if c.vaultDir == "" {
+		return nil
+	}
+	path := vaultPath(c.vaultDir, username)
+	vault, err := openVault(path, username, password)
+	if errors.Is(err, errVaultPassword) {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return fmt.Errorf("не удалось открыть локальную копию: %w", err)
+		}
+	}
+	if err != nil {
+		vault, err = createVault(path, username, password)
+		if err != nil {
+			return fmt.Errorf("не удалось создать локальную копию: %w", err)
+		}
+	}
+	c.vault = vault
+	return nil
+}
+
+// loginOffline открывает локальную копию, когда сервер недоступен. Логин и
+// пароль запоминаются, чтобы войти на сервер при восстановлении связи
+func (c *Client) loginOffline(username, password string) error {
+	if c.vaultDir == "" {
+		return fmt.Errorf("нет связи с сервером")
+	}
+	vault, err := openVault(vaultPath(c.vaultDir, username), username, password)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("нет связи с сервером, а локальной копии для этого пользователя нет")
+	}
+	if errors.Is(err, errVaultPassword) {
+		return fmt.Errorf("неверный пароль")
+	}
+	if err != nil {
+		return err
+	}
+	c.vault, c.offline = vault, true
+	c.username, c.password = username, password
+	c.account, c.locked, c.lockedToken, c.lockedRefresh = username, false, "", ""
+	return nil
+}
+
+// useVault сообщает, что запрос нужно выполнить с локальной копией: клиент
+// работает без связи и восстановить ее не удалось
+func (c *Client) useVault(ctx context.Context) bool {
+	return c.vault != nil && c.offline && !c.reconnect(ctx)
+}
+
+// lostConnection проверяет, что запрос не дошел до сервера, и в этом случае
+// переключает клиент на работу с локальной копией
+func (c *Client) lostConnection(err error) bool {
+	if c.vault == nil || status.Code(err) != codes.Unavailable {
+		return false
+	}
+	c.offline = true
+	return true
+}
+
+// reconnect пробует восстановить связь с сервером: входит, если вход был
+// выполнен без связи, и отправляет накопленные изменения
+func (c *Client) reconnect(ctx context.Context) bool {
+	var keys accountKeys
+	if c.accessToken() == "" {
+		resp, login, err := c.login(ctx, c.username, c.password)
+		if err != nil {
+			return false
+		}
+		c.setSession(resp)
+		keys = login
+	}
+	// ключ записей нужен до отправки изменений, а после входа без связи или
+	// разблокировки без связи его еще нет
+	if c.cipher == nil {
+		if keys.vault == nil {
+			var err error
+			if keys, err = c.deriveKeys(ctx, c.username, c.password); err != nil {
+				return false
+			}
+		}
+		if err := c.unlockKey(ctx, keys.vault); err != nil {
+			return false
+		}
+	}
+	c.offline = false
+	if _, err := c.Sync(ctx); err != nil {
+		return false
+	}
+	c.username, c.password = "", ""
+	return true
+}
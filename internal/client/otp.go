@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// Виды одноразовых паролей и параметры по умолчанию из формата otpauth://
+const (
+	OTPTypeTOTP string = "totp"
+	OTPTypeHOTP string = "hotp"
+
+	defaultOTPDigits = 6
+	defaultOTPPeriod = 30
+)
+
+// otpAlgorithms алгоритмы HMAC, которые поддерживают приложения-аутентификаторы
+var otpAlgorithms = map[string]otp.Algorithm{
+	"SHA1":   otp.AlgorithmSHA1,
+	"SHA256": otp.AlgorithmSHA256,
+	"SHA512": otp.AlgorithmSHA512,
+}
+
+// ParseOTP разбирает ссылку otpauth:// или секрет в base32. Для секрета без
+// ссылки берутся параметры totp по умолчанию: SHA1, 6 цифр, 30 секунд
+func ParseOTP(input string) (models.OTPJSON, error) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(strings.ToLower(input), "otpauth://") {
+		entry := models.OTPJSON{Type: OTPTypeTOTP, Secret: input, Algorithm: "SHA1", Digits: defaultOTPDigits, Period: defaultOTPPeriod}
+		return normalizeOTP(entry)
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return models.OTPJSON{}, fmt.Errorf("некорректная ссылка otpauth://")
+	}
+	query := u.Query()
+	entry := models.OTPJSON{
+		Type:      strings.ToLower(u.Host),
+		Secret:    query.Get("secret"),
+		Algorithm: query.Get("algorithm"),
+		Digits:    defaultOTPDigits,
+	}
+	if entry.Algorithm == "" {
+		entry.Algorithm = "SHA1"
+	}
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		entry.Issuer, entry.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		entry.Account = strings.TrimSpace(label)
+	}
+	if issuer := query.Get("issuer"); issuer != "" {
+		entry.Issuer = issuer
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if entry.Digits, err = strconv.Atoi(digits); err != nil {
+			return models.OTPJSON{}, fmt.Errorf("некорректное число цифр кода: %s", digits)
+		}
+	}
+
+	switch entry.Type {
+	case OTPTypeTOTP:
+		entry.Period = defaultOTPPeriod
+		if period := query.Get("period"); period != "" {
+			if entry.Period, err = strconv.Atoi(period); err != nil {
+				return models.OTPJSON{}, fmt.Errorf("некорректный период кода: %s", period)
+			}
+		}
+	case OTPTypeHOTP:
+		counter := query.Get("counter")
+		if counter == "" {
+			return models.OTPJSON{}, fmt.Errorf("в ссылке hotp нет счетчика")
+		}
+		if entry.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return models.OTPJSON{}, fmt.Errorf("некорректный счетчик кода: %s", counter)
+		}
+	}
+	return normalizeOTP(entry)
+}
+
+// normalizeOTP проверяет параметры одноразовых паролей и приводит секрет к
+// верхнему регистру без пробелов и выравнивания
+func normalizeOTP(entry models.OTPJSON) (models.OTPJSON, error) {
+	entry.Secret = strings.TrimRight(strings.ToUpper(strings.Join(strings.Fields(entry.Secret), "")), "=")
+	entry.Algorithm = strings.ToUpper(entry.Algorithm)
+
+	if entry.Type != OTPTypeTOTP && entry.Type != OTPTypeHOTP {
+		return models.OTPJSON{}, fmt.Errorf("неизвестный вид одноразовых паролей: %s", entry.Type)
+	}
+	if entry.Secret == "" {
+		return models.OTPJSON{}, fmt.Errorf("не указан секрет")
+	}
+	if _, ok := otpAlgorithms[entry.Algorithm]; !ok {
+		return models.OTPJSON{}, fmt.Errorf("алгоритм %s не поддерживается, допустимы SHA1, SHA256 и SHA512", entry.Algorithm)
+	}
+	if entry.Digits < 6 || entry.Digits > 8 {
+		return models.OTPJSON{}, fmt.Errorf("код должен состоять из 6-8 цифр")
+	}
+	if entry.Type == OTPTypeTOTP && entry.Period <= 0 {
+		return models.OTPJSON{}, fmt.Errorf("период кода должен быть больше нуля")
+	}
+	if entry.Type == OTPTypeHOTP {
+		entry.Period = 0
+	}
+	if _, _, err := OTPCode(entry, time.Now()); err != nil {
+		return models.OTPJSON{}, err
+	}
+	return entry, nil
+}
+
+// OTPCode возвращает код одноразового пароля. Для totp это код на момент now
+// и время, которое он еще действует, для hotp код текущего значения счетчика
+func OTPCode(entry models.OTPJSON, now time.Time) (string, time.Duration, error) {
+	algorithm, ok := otpAlgorithms[entry.Algorithm]
+	if !ok {
+		return "", 0, fmt.Errorf("алгоритм %s не поддерживается", entry.Algorithm)
+	}
+	var (
+		code string
+		left time.Duration
+		err  error
+	)
+	switch entry.Type {
+	case OTPTypeTOTP:
+		if entry.Period <= 0 {
+			return "", 0, fmt.Errorf("период кода должен быть больше нуля")
+		}
+		code, err = totp.GenerateCodeCustom(entry.Secret, now, totp.ValidateOpts{
+			Period:    uint(entry.Period),
+			Digits:    otp.Digits(entry.Digits),
+			Algorithm: algorithm,
+		})
+		// UnixNano переполняется после 2262 года, поэтому остаток считается в секундах
+		elapsed := time.Duration(now.Unix()%int64(entry.Period))*time.Second + time.Duration(now.Nanosecond())
+		left = time.Duration(entry.Period)*time.Second - elapsed
+	case OTPTypeHOTP:
+		code, err = hotp.GenerateCodeCustom(entry.Secret, entry.Counter, hotp.ValidateOpts{
+			Digits:    otp.Digits(entry.Digits),
+			Algorithm: algorithm,
+		})
+	default:
+		return "", 0, fmt.Errorf("неизвестный вид одноразовых паролей: %s", entry.Type)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("секрет должен быть в base32")
+	}
+	return code, left, nil
+}
+
+// NextHOTP возвращает код hotp текущего значения счетчика и сохраняет запись
+// с увеличенным счетчиком, чтобы код не выдавался повторно
+func (c *Client) NextHOTP(ctx context.Context, record models.Record) (string, error) {
+	var entry models.OTPJSON
+	if err := json.Unmarshal(record.Data, &entry); err != nil {
+		return "", fmt.Errorf("не удалось разобрать данные записи %s: %w", record.Id, err)
+	}
+	if entry.Type != OTPTypeHOTP {
+		return "", fmt.Errorf("запись %s не содержит счетчика hotp", record.Id)
+	}
+	code, _, err := OTPCode(entry, time.Now())
+	if err != nil {
+		return "", err
+	}
+	entry.Counter++
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.UpdateData(ctx, record.Id, record.Meta, data, record.Version); err != nil {
+		return "", err
+	}
+	return code, nil
+}
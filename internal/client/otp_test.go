@@ -0,0 +1,108 @@
+package client
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+func b32(secret string) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(secret))
+}
+
+func TestOTPCodeTOTP(t *testing.T) {
+	// примеры из RFC 6238, приложение B
+	tests := []struct {
+		algorithm string
+		secret    string
+		at        int64
+		want      string
+	}{
+		{"SHA1", "12345678901234567890", 59, "94287082"},
+		{"SHA256", "12345678901234567890123456789012", 59, "46119246"},
+		{"SHA512", "1234567890123456789012345678901234567890123456789012345678901234", 59, "90693936"},
+		{"SHA1", "12345678901234567890", 1111111109, "07081804"},
+		{"SHA256", "12345678901234567890123456789012", 20000000000, "77737706"},
+	}
+	for _, tt := range tests {
+		entry := models.OTPJSON{Type: OTPTypeTOTP, Secret: b32(tt.secret), Algorithm: tt.algorithm, Digits: 8, Period: 30}
+		code, left, err := OTPCode(entry, time.Unix(tt.at, 0))
+		if err != nil || code != tt.want {
+			t.Errorf("OTPCode(%s at %d) = %q, %v; want %q", tt.algorithm, tt.at, code, err, tt.want)
+		}
+		wantLeft := time.Duration(30-tt.at%30) * time.Second
+		if left != wantLeft {
+			t.Errorf("OTPCode(%s at %d) left = %v, want %v", tt.algorithm, tt.at, left, wantLeft)
+		}
+	}
+}
+
+func TestOTPCodeHOTP(t *testing.T) {
+	// примеры из RFC 4226, приложение D
+	entry := models.OTPJSON{Type: OTPTypeHOTP, Secret: b32("12345678901234567890"), Algorithm: "SHA1", Digits: 6}
+	for counter, want := range []string{"755224", "287082", "359152", "969429"} {
+		entry.Counter = uint64(counter)
+		code, _, err := OTPCode(entry, time.Now())
+		if err != nil || code != want {
+			t.Errorf("OTPCode(counter %d) = %q, %v; want %q", counter, code, err, want)
+		}
+	}
+}
+
+func TestParseOTP(t *testing.T) {
+	secret := b32("12345678901234567890")
+	tests := []struct {
+		input string
+		want  models.OTPJSON
+	}{
+		{
+			input: secret,
+			want:  models.OTPJSON{Type: OTPTypeTOTP, Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			input: "  gezd gnbv gy3t qojq gezd gnbv gy3t qojq  ",
+			want:  models.OTPJSON{Type: OTPTypeTOTP, Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			input: "otpauth://totp/ACME%20Co:john@example.com?secret=" + secret + "&issuer=ACME%20Co&algorithm=SHA256&digits=8&period=60",
+			want:  models.OTPJSON{Type: OTPTypeTOTP, Secret: secret, Issuer: "ACME Co", Account: "john@example.com", Algorithm: "SHA256", Digits: 8, Period: 60},
+		},
+		{
+			input: "otpauth://totp/Label:alice?secret=" + secret + "&issuer=Other",
+			want:  models.OTPJSON{Type: OTPTypeTOTP, Secret: secret, Issuer: "Other", Account: "alice", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			input: "OTPAUTH://HOTP/bob?secret=" + secret + "&counter=7&period=30",
+			want:  models.OTPJSON{Type: OTPTypeHOTP, Secret: secret, Account: "bob", Algorithm: "SHA1", Digits: 6, Counter: 7},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseOTP(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseOTP(%q) = %+v, %v; want %+v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseOTPErrors(t *testing.T) {
+	secret := b32("12345678901234567890")
+	inputs := []string{
+		"",
+		"not base32!",
+		"otpauth://totp/alice",
+		"otpauth://steam/alice?secret=" + secret,
+		"otpauth://hotp/alice?secret=" + secret,
+		"otpauth://hotp/alice?secret=" + secret + "&counter=-1",
+		"otpauth://totp/alice?secret=" + secret + "&algorithm=MD5",
+		"otpauth://totp/alice?secret=" + secret + "&digits=5",
+		"otpauth://totp/alice?secret=" + secret + "&digits=x",
+		"otpauth://totp/alice?secret=" + secret + "&period=0",
+	}
+	for _, input := range inputs {
+		if got, err := ParseOTP(input); err == nil {
+			t.Errorf("ParseOTP(%q) = %+v; want error", input, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNoSession обновить токен нечем: вход не выполнен или сессия завершена
+var errNoSession = errors.New("no session")
+
+// publicMethods методы, которые вызываются без access-токена, поэтому их
+// отказ не означает, что токен истек
+var publicMethods = map[string]bool{
+	pb.GophKeeper_Register_FullMethodName:       true,
+	pb.GophKeeper_Login_FullMethodName:          true,
+	pb.GophKeeper_LoginTOTP_FullMethodName:      true,
+	pb.GophKeeper_RefreshToken_FullMethodName:   true,
+	pb.GophKeeper_GetKDFParams_FullMethodName:   true,
+	pb.GophKeeper_MigrateAccount_FullMethodName: true,
+}
+
+// tokenCredentials передает access-токен клиента в метаданных каждого запроса
+type tokenCredentials struct {
+	client *Client
+}
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token := t.client.accessToken()
+	if token == "" {
+		return nil, nil
+	}
+	return map[string]string{auth.MetadataKey: auth.BearerScheme + " " + token}, nil
+}
+
+// RequireTransportSecurity клиент подключается к серверу без TLS
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// refreshInterceptor повторяет запрос с новым access-токеном, если сервер
+// отклонил прежний
+func (c *Client) refreshInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	stale := c.accessToken()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if publicMethods[method] || stale == "" || !c.refreshed(ctx, stale, err) {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// refresh обменивает refresh-токен на новую пару токенов, если access-токен
+// все еще stale. Refresh-токен одноразовый, поэтому параллельные запросы
+// обменивают его по очереди, а остальные получают уже новый токен
+func (c *Client) refresh(ctx context.Context, stale string) (string, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	token, refreshToken := c.sessionTokens()
+	if token != "" && token != stale {
+		return token, nil
+	}
+	if refreshToken == "" {
+		return "", errNoSession
+	}
+	resp, err := c.client.RefreshToken(ctx, &pb.RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			// сессия завершена, повторять бесполезно
+			c.setTokens(token, "")
+		}
+		return "", err
+	}
+	c.setTokens(resp.Token, resp.RefreshToken)
+	return resp.Token, nil
+}
+
+// refreshed обновляет токен, если запрос с токеном stale отклонен из-за него,
+// и сообщает, что запрос можно повторить
+func (c *Client) refreshed(ctx context.Context, stale string, err error) bool {
+	if status.Code(err) != codes.Unauthenticated {
+		return false
+	}
+	_, err = c.refresh(ctx, stale)
+	return err == nil
+}
+
+// setSession запоминает токены сессии после входа
+func (c *Client) setSession(resp *pb.AuthResponse) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.setTokens(resp.Token, resp.RefreshToken)
+}
+
+// setAccessToken заменяет access-токен, refresh-токен сессии остается прежним
+func (c *Client) setAccessToken(token string) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	_, refresh := c.sessionTokens()
+	c.setTokens(token, refresh)
+}
+
+// accessToken возвращает текущий access-токен
+func (c *Client) accessToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.token
+}
+
+// sessionTokens возвращает access- и refresh-токены сессии
+func (c *Client) sessionTokens() (string, string) {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.token, c.refreshToken
+}
+
+// setTokens заменяет токены сессии. Обмен refresh-токена дополнительно
+// сериализуется refreshMu
+func (c *Client) setTokens(token, refresh string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.token, c.refreshToken = token, refresh
+}
+
+// Logout завершает сессию на сервере и стирает из памяти токены, ключ записей
+// и расшифрованные записи. Файл локальной копии остается на диске. Если
+// сервер недоступен, клиент все равно выходит, а сессия на сервере
+// завершится, когда истечет срок refresh-токена
+func (c *Client) Logout(ctx context.Context) error {
+	if c.account == "" {
+		return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+	}
+	if c.locked {
+		c.setTokens(c.lockedToken, c.lockedRefresh)
+	}
+
+	var err error
+	if c.accessToken() != "" {
+		_, err = c.client.Logout(ctx, &pb.LogoutRequest{})
+	}
+	c.wipe()
+	c.setTokens("", "")
+	c.lockedToken, c.lockedRefresh = "", ""
+	c.account, c.username, c.locked, c.offline = "", "", false, false
+
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			// сессия уже завершена
+			return nil
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером, сессия на сервере завершится по истечении срока")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	return err
+}
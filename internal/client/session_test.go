@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+func TestWatchChangesStopsOnLogout(t *testing.T) {
+	ctx := context.Background()
+	addr := newTestServer(t)
+	writer := newTestClient(t, addr, "user", true)
+	watcher := newVaultClient(t, addr, "user")
+
+	changes, err := watcher.WatchChanges(ctx, -1)
+	if err != nil {
+		t.Fatalf("WatchChanges: %v", err)
+	}
+	if _, err := writer.StoreData(ctx, models.Text, "meta", []byte("data")); err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	nextChange(t, changes)
+
+	if err := watcher.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := writer.StoreData(ctx, models.Text, "meta", []byte("more")); err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	select {
+	case change, ok := <-changes:
+		if ok {
+			t.Fatalf("change %+v after Logout; want closed channel", change)
+		}
+	default:
+		t.Fatalf("changes still open after Logout")
+	}
+	if token, refresh := watcher.sessionTokens(); token != "" || refresh != "" || watcher.cipher != nil {
+		t.Errorf("Logout left the tokens or the record key in memory")
+	}
+	if _, err := watcher.StoreData(ctx, models.Text, "meta", []byte("data")); err == nil {
+		t.Errorf("StoreData after Logout succeeded; want an error")
+	}
+}
@@ -0,0 +1,335 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mergeRetries сколько раз клиент сливает изменения заново, если запись на
+// сервере успела измениться еще раз, пока он сливал прошлые
+const mergeRetries = 3
+
+// conflictCopySuffix добавляется к заметке записи, сохраненной из конфликта отдельно
+const conflictCopySuffix = " (конфликтная копия)"
+
+// SyncResult итог синхронизации локальной копии с сервером. Merged сколько
+// отправленных изменений пришлось слить с изменениями с другого устройства
+type SyncResult struct {
+	Pushed    int
+	Merged    int
+	Pulled    int
+	Conflicts []Conflict
+}
+
+// Resolution способ разрешения конфликта
+type Resolution int
+
+const (
+	// KeepRemote отбрасывает локальное изменение
+	KeepRemote Resolution = iota
+	// KeepLocal записывает локальную версию поверх серверной, для удаления удаляет запись на сервере
+	KeepLocal
+	// KeepBoth оставляет серверную версию и сохраняет локальную отдельной записью
+	KeepBoth
+)
+
+// Sync отправляет на сервер изменения, сделанные без связи, и обновляет
+// локальную копию изменениями с сервера. Если запись успела измениться на
+// другом устройстве, изменения сливаются по полям; изменение, которое слить
+// не удалось, попадает в конфликты
+func (c *Client) Sync(ctx context.Context) (SyncResult, error) {
+	var result SyncResult
+	if c.vault == nil {
+		return result, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+	}
+
+	for {
+		op, ok := c.vault.nextPending()
+		if !ok {
+			break
+		}
+		merged, conflict, err := c.push(ctx, op)
+		if err != nil {
+			c.lostConnection(err)
+			return result, err
+		}
+		if conflict != nil {
+			stored, err := c.vault.conflictPending(*conflict)
+			if err != nil {
+				return result, err
+			}
+			result.Conflicts = append(result.Conflicts, stored)
+			continue
+		}
+		result.Pushed++
+		if merged {
+			result.Merged++
+		}
+	}
+
+	pulled, err := c.pull(ctx)
+	result.Pulled = pulled
+	if err != nil {
+		c.lostConnection(err)
+	}
+	return result, err
+}
+
+// push отправляет изменение на сервер и возвращает признак того, что его
+// пришлось слить с серверной версией. Если применить изменение нельзя,
+// возвращается конфликт, а ошибка только для сбоев, после которых отправку
+// нужно повторить
+func (c *Client) push(ctx context.Context, op PendingOp) (bool, *Conflict, error) {
+	meta, data, err := c.cipher.sealRecord(op.Record.Meta, op.Record.Data)
+	if err != nil {
+		return false, nil, err
+	}
+	switch op.Op {
+	case OpCreate:
+		resp, err := c.client.StoreData(ctx, &pb.StoreRequest{Record: &pb.DataRecord{Type: op.Record.TypeRecord, Data: data, Meta: meta}})
+		if err != nil {
+			conflict, err := rejected(err)
+			return false, conflict, err
+		}
+		record := op.Record
+		record.Id, record.Version = resp.Id, 1
+		return false, nil, c.vault.donePending(record)
+
+	case OpUpdate:
+		resp, err := c.client.UpdateData(ctx, &pb.UpdateResponse{Id: op.Record.Id, Meta: meta, Data: data, Version: int64(op.BaseVersion)})
+		if err == nil {
+			record := op.Record
+			record.Version = int(resp.Version)
+			return false, nil, c.vault.donePending(record)
+		}
+		if status.Code(err) != codes.Aborted {
+			conflict, err := rejected(err)
+			return false, conflict, err
+		}
+		record, conflict, err := c.merge(ctx, op.Base, op.Record)
+		if err != nil || conflict != nil {
+			return false, conflict, err
+		}
+		return true, nil, c.vault.donePending(record)
+
+	default:
+		_, err := c.client.DeleteData(ctx, &pb.DeleteRequest{Id: op.Record.Id, Version: int64(op.BaseVersion)})
+		if err == nil || status.Code(err) == codes.NotFound {
+			return false, nil, c.vault.donePending(models.Record{})
+		}
+		if status.Code(err) != codes.Aborted {
+			conflict, err := rejected(err)
+			return false, conflict, err
+		}
+		// удаление не сливается: изменения с другого устройства пропали бы незаметно
+		remote, err := c.remote(ctx, op.Record.Id)
+		if err != nil {
+			conflict, err := rejected(err)
+			return false, conflict, err
+		}
+		return false, &Conflict{Remote: remote, Reason: "запись изменена на другом устройстве"}, nil
+	}
+}
+
+// merge сливает локальную версию записи local, сделанную из base, с текущей
+// версией на сервере и сохраняет результат на сервере. Если поля изменены
+// по-разному с обеих сторон, возвращается конфликт
+func (c *Client) merge(ctx context.Context, base, local models.Record) (models.Record, *Conflict, error) {
+	for range mergeRetries {
+		remote, err := c.remote(ctx, local.Id)
+		if err != nil {
+			conflict, err := rejected(err)
+			return models.Record{}, conflict, err
+		}
+		merged, fields, err := mergeRecords(base, local, remote)
+		if err != nil {
+			return models.Record{}, &Conflict{Remote: remote, Reason: "запись изменена на другом устройстве"}, nil
+		}
+		if len(fields) > 0 {
+			return models.Record{}, &Conflict{Remote: remote, Fields: fields, Reason: "запись изменена на другом устройстве"}, nil
+		}
+
+		meta, data, err := c.cipher.sealRecord(merged.Meta, merged.Data)
+		if err != nil {
+			return models.Record{}, nil, err
+		}
+		resp, err := c.client.UpdateData(ctx, &pb.UpdateResponse{Id: merged.Id, Meta: meta, Data: data, Version: int64(remote.Version)})
+		if status.Code(err) == codes.Aborted {
+			continue
+		}
+		if err != nil {
+			conflict, err := rejected(err)
+			return models.Record{}, conflict, err
+		}
+		merged.Version = int(resp.Version)
+		merged.CreatedAt, merged.UpdatedAt = local.CreatedAt, time.Now()
+		merged.Size = int64(len(merged.Data))
+		return merged, nil, nil
+	}
+	return models.Record{}, nil, ErrConflict
+}
+
+// remote возвращает текущую версию записи на сервере
+func (c *Client) remote(ctx context.Context, id string) (models.Record, error) {
+	resp, err := c.client.RetrieveData(ctx, &pb.RetrieveRequest{Id: id})
+	if err != nil {
+		return models.Record{}, err
+	}
+	return c.cipher.openRecord(models.Record{Id: resp.Record.Id, TypeRecord: resp.Record.Type, Version: int(resp.Record.Version), Data: resp.Record.Data, Meta: resp.Record.Meta})
+}
+
+// rejected превращает отказ сервера в конфликт. Сбои, после которых запрос
+// нужно повторить, возвращаются ошибкой
+func rejected(err error) (*Conflict, error) {
+	switch status.Code(err) {
+	case codes.Aborted:
+		return &Conflict{Reason: "запись изменена на другом устройстве"}, nil
+	case codes.NotFound:
+		return &Conflict{Reason: "запись удалена на другом устройстве"}, nil
+	case codes.PermissionDenied:
+		return &Conflict{Reason: "в доступе отказано"}, nil
+	case codes.ResourceExhausted:
+		return &Conflict{Reason: "превышена квота хранилища"}, nil
+	case codes.InvalidArgument:
+		return &Conflict{Reason: "сервер отклонил изменение"}, nil
+	case codes.Unauthenticated:
+		return nil, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+	case codes.Internal:
+		return nil, fmt.Errorf("ошибка сервера")
+	}
+	return nil, err
+}
+
+// pull применяет к локальной копии изменения с сервера после ее ревизии
+func (c *Client) pull(ctx context.Context) (int, error) {
+	pulled := 0
+	since := c.vault.revision()
+	for {
+		changes, revision, more, err := c.GetChanges(ctx, since)
+		if err != nil {
+			return pulled, err
+		}
+		if err := c.vault.applyChanges(changes, revision); err != nil {
+			return pulled, err
+		}
+		pulled += len(changes)
+		since = revision
+		if !more {
+			return pulled, nil
+		}
+	}
+}
+
+// ResolveConflict разрешает конфликт целиком: оставляет серверную версию,
+// записывает локальную поверх нее (удаленная на сервере запись создается
+// заново) или сохраняет локальную версию отдельной записью
+func (c *Client) ResolveConflict(ctx context.Context, id string, resolution Resolution) error {
+	conflict, err := c.conflict(ctx, id, resolution != KeepRemote)
+	if err != nil {
+		return err
+	}
+
+	record := conflict.Record
+	switch {
+	case resolution == KeepRemote:
+		return c.vault.dropConflict(id)
+	case resolution == KeepBoth && conflict.Op == OpDelete:
+		return fmt.Errorf("удаленную запись нельзя сохранить отдельно")
+	case resolution == KeepBoth:
+		_, err = c.storeData(ctx, record.TypeRecord, record.Meta+conflictCopySuffix, record.Data)
+	case conflict.Op == OpCreate:
+		_, err = c.storeData(ctx, record.TypeRecord, record.Meta, record.Data)
+	default:
+		var current models.Record
+		current, err = c.remote(ctx, record.Id)
+		switch {
+		case status.Code(err) == codes.NotFound && conflict.Op == OpUpdate:
+			_, err = c.storeData(ctx, record.TypeRecord, record.Meta, record.Data)
+		case status.Code(err) == codes.NotFound:
+			err = nil
+		case err != nil:
+		case conflict.Op == OpUpdate:
+			_, err = c.updateData(ctx, record.Id, record.Meta, record.Data, current.Version)
+		default:
+			err = c.deleteData(ctx, record.Id, current.Version)
+		}
+	}
+	return c.resolved(ctx, id, err)
+}
+
+// ResolveFields разрешает конфликт изменения записи по полям: для полей из
+// useLocal берется локальное значение, для остальных конфликтующих серверное.
+// Поля, измененные только с одной стороны, сливаются как при синхронизации
+func (c *Client) ResolveFields(ctx context.Context, id string, useLocal map[string]bool) error {
+	conflict, err := c.conflict(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	if conflict.Op != OpUpdate || conflict.Remote.Id == "" {
+		return fmt.Errorf("для этого конфликта выбор по полям недоступен")
+	}
+
+	current, err := c.remote(ctx, conflict.Record.Id)
+	if err != nil {
+		c.lostConnection(err)
+		return fmt.Errorf("не удалось получить запись с сервера: %w", err)
+	}
+	merged, fields, err := mergeRecords(conflict.Base, conflict.Record, current)
+	if err != nil {
+		return err
+	}
+	_, local, err := RecordFields(conflict.Record)
+	if err != nil {
+		return err
+	}
+	_, values, err := RecordFields(merged)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if useLocal[field] {
+			values[field] = local[field]
+		}
+	}
+	if merged, err = withFields(merged, values); err != nil {
+		return err
+	}
+
+	_, err = c.updateData(ctx, merged.Id, merged.Meta, merged.Data, current.Version)
+	return c.resolved(ctx, id, err)
+}
+
+// conflict возвращает конфликт по id. Если разрешение требует сервера, а
+// связи нет, возвращается ошибка
+func (c *Client) conflict(ctx context.Context, id string, online bool) (Conflict, error) {
+	if c.vault == nil {
+		return Conflict{}, fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+	}
+	conflict, ok := c.vault.conflict(id)
+	if !ok {
+		return Conflict{}, fmt.Errorf("конфликт не найден")
+	}
+	if online && c.useVault(ctx) {
+		return Conflict{}, fmt.Errorf("нет связи с сервером")
+	}
+	return conflict, nil
+}
+
+// resolved удаляет разрешенный конфликт и обновляет локальную копию
+func (c *Client) resolved(ctx context.Context, id string, err error) error {
+	if err != nil {
+		c.lostConnection(err)
+		return err
+	}
+	if err := c.vault.dropConflict(id); err != nil {
+		return err
+	}
+	_, err = c.pull(ctx)
+	return err
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// newVaultClient входит в аккаунт username клиентом с локальной копией
+func newVaultClient(t *testing.T, addr, username string) *Client {
+	t.Helper()
+	c := NewClient(addr, t.TempDir())
+	t.Cleanup(func() { c.Close() })
+	if err := c.Login(context.Background(), username, "password"); err != nil {
+		t.Fatalf("Login %s: %v", username, err)
+	}
+	return c
+}
+
+// loginData данные записи LOGIN
+func loginData(t *testing.T, login, password string) []byte {
+	t.Helper()
+	data, err := json.Marshal(models.LoginJSON{Login: login, Password: password})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return data
+}
+
+func TestSyncConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		// queue изменение, сделанное локально без связи
+		queue func(t *testing.T, v *Vault, id string)
+		// change изменение той же записи на другом устройстве
+		change func(t *testing.T, c *Client, id string)
+		check  func(t *testing.T, result SyncResult, local, remote *Client, id string)
+	}{
+		{
+			name: "disjoint fields merge",
+			queue: func(t *testing.T, v *Vault, id string) {
+				if _, err := v.updateLocal(id, "meta", loginData(t, "user", "local"), 1); err != nil {
+					t.Fatalf("updateLocal: %v", err)
+				}
+			},
+			change: func(t *testing.T, c *Client, id string) {
+				if _, err := c.UpdateData(context.Background(), id, "meta", loginData(t, "admin", "old"), 1); err != nil {
+					t.Fatalf("UpdateData: %v", err)
+				}
+			},
+			check: func(t *testing.T, result SyncResult, local, remote *Client, id string) {
+				if result.Pushed != 1 || result.Merged != 1 || len(result.Conflicts) != 0 {
+					t.Fatalf("Sync = %+v; want one merged change", result)
+				}
+				record, err := remote.RetrieveData(context.Background(), id)
+				if err != nil || record.Version != 3 || string(record.Data) != string(loginData(t, "admin", "local")) {
+					t.Fatalf("server record = %+v (data %s), %v; want merged version 3", record, record.Data, err)
+				}
+				if stored, err := local.vault.get(id); err != nil || stored.Version != 3 || string(stored.Data) != string(record.Data) {
+					t.Errorf("vault record = %+v, %v; want the merged record", stored, err)
+				}
+			},
+		},
+		{
+			name: "same field edited on both sides",
+			queue: func(t *testing.T, v *Vault, id string) {
+				if _, err := v.updateLocal(id, "meta", loginData(t, "user", "local"), 1); err != nil {
+					t.Fatalf("updateLocal: %v", err)
+				}
+			},
+			change: func(t *testing.T, c *Client, id string) {
+				if _, err := c.UpdateData(context.Background(), id, "meta", loginData(t, "user", "remote"), 1); err != nil {
+					t.Fatalf("UpdateData: %v", err)
+				}
+			},
+			check: func(t *testing.T, result SyncResult, local, remote *Client, id string) {
+				if result.Pushed != 0 || len(result.Conflicts) != 1 {
+					t.Fatalf("Sync = %+v; want one conflict", result)
+				}
+				conflict := result.Conflicts[0]
+				if conflict.Op != OpUpdate || !slices.Equal(conflict.Fields, []string{FieldPassword}) || conflict.Remote.Version != 2 {
+					t.Errorf("conflict = %+v; want password conflict against version 2", conflict)
+				}
+				record, err := remote.RetrieveData(context.Background(), id)
+				if err != nil || record.Version != 2 || string(record.Data) != string(loginData(t, "user", "remote")) {
+					t.Errorf("server record = %+v, %v; want remote version untouched", record, err)
+				}
+			},
+		},
+		{
+			name: "delete against edit",
+			queue: func(t *testing.T, v *Vault, id string) {
+				if err := v.deleteLocal(id, 1); err != nil {
+					t.Fatalf("deleteLocal: %v", err)
+				}
+			},
+			change: func(t *testing.T, c *Client, id string) {
+				if _, err := c.UpdateData(context.Background(), id, "edited", loginData(t, "user", "old"), 1); err != nil {
+					t.Fatalf("UpdateData: %v", err)
+				}
+			},
+			check: func(t *testing.T, result SyncResult, local, remote *Client, id string) {
+				if len(result.Conflicts) != 1 || result.Conflicts[0].Op != OpDelete || result.Conflicts[0].Remote.Meta != "edited" {
+					t.Fatalf("Sync = %+v; want delete conflict with the edited record", result)
+				}
+				if _, err := remote.RetrieveData(context.Background(), id); err != nil {
+					t.Errorf("RetrieveData = %v; want the edited record kept", err)
+				}
+				if stored, err := local.vault.get(id); err != nil || stored.Meta != "edited" {
+					t.Errorf("vault record = %+v, %v; want the edited record pulled back", stored, err)
+				}
+			},
+		},
+		{
+			name: "tombstone against queued write",
+			queue: func(t *testing.T, v *Vault, id string) {
+				if _, err := v.updateLocal(id, "meta", loginData(t, "user", "local"), 1); err != nil {
+					t.Fatalf("updateLocal: %v", err)
+				}
+			},
+			change: func(t *testing.T, c *Client, id string) {
+				if err := c.DeleteData(context.Background(), id, 1); err != nil {
+					t.Fatalf("DeleteData: %v", err)
+				}
+			},
+			check: func(t *testing.T, result SyncResult, local, remote *Client, id string) {
+				if len(result.Conflicts) != 1 || !strings.Contains(result.Conflicts[0].Reason, "удалена") {
+					t.Fatalf("Sync = %+v; want conflict for the deleted record", result)
+				}
+				if got := result.Conflicts[0].Record; string(got.Data) != string(loginData(t, "user", "local")) {
+					t.Errorf("conflict record data = %s; want the local change kept", got.Data)
+				}
+				if _, err := local.vault.get(id); !errors.Is(err, errVaultNotFound) {
+					t.Errorf("vault get = %v; want the tombstone applied", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			addr := newTestServer(t)
+			remote := newTestClient(t, addr, "user", true)
+			local := newVaultClient(t, addr, "user")
+
+			id, err := local.StoreData(ctx, models.Login, "meta", loginData(t, "user", "old"))
+			if err != nil {
+				t.Fatalf("StoreData: %v", err)
+			}
+			tt.queue(t, local.vault, id)
+			tt.change(t, remote, id)
+
+			result, err := local.Sync(ctx)
+			if err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			if local.Pending() != 0 {
+				t.Errorf("Pending after Sync = %d; want 0", local.Pending())
+			}
+			tt.check(t, result, local, remote, id)
+		})
+	}
+}
+
+func TestSyncReplaysQueuedWrites(t *testing.T) {
+	ctx := context.Background()
+	addr := newTestServer(t)
+	remote := newTestClient(t, addr, "user", true)
+	local := newVaultClient(t, addr, "user")
+
+	var ids []string
+	for range 2 {
+		id, err := local.StoreData(ctx, models.Login, "meta", loginData(t, "user", "old"))
+		if err != nil {
+			t.Fatalf("StoreData: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	// без связи: первое изменение столкнется с правкой того же поля, второе
+	// с правкой другого поля, третье создает запись
+	if _, err := local.vault.updateLocal(ids[0], "meta", loginData(t, "user", "local"), 1); err != nil {
+		t.Fatalf("updateLocal: %v", err)
+	}
+	if _, err := local.vault.updateLocal(ids[1], "meta", loginData(t, "user", "local"), 1); err != nil {
+		t.Fatalf("updateLocal: %v", err)
+	}
+	created, err := local.vault.storeLocal(models.Text, "new", []byte("offline"))
+	if err != nil {
+		t.Fatalf("storeLocal: %v", err)
+	}
+	if _, err := remote.UpdateData(ctx, ids[0], "meta", loginData(t, "user", "remote"), 1); err != nil {
+		t.Fatalf("UpdateData: %v", err)
+	}
+	if _, err := remote.UpdateData(ctx, ids[1], "meta", loginData(t, "admin", "old"), 1); err != nil {
+		t.Fatalf("UpdateData: %v", err)
+	}
+
+	result, err := local.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.Pushed != 2 || result.Merged != 1 || len(result.Conflicts) != 1 || result.Conflicts[0].Record.Id != ids[0] {
+		t.Fatalf("Sync = %+v; want two pushed (one merged) and a conflict on %s", result, ids[0])
+	}
+	if local.Pending() != 0 {
+		t.Errorf("Pending after Sync = %d; want 0", local.Pending())
+	}
+
+	merged, err := remote.RetrieveData(ctx, ids[1])
+	if err != nil || merged.Version != 3 || string(merged.Data) != string(loginData(t, "admin", "local")) {
+		t.Errorf("merged record = %+v (data %s), %v; want both edits in version 3", merged, merged.Data, err)
+	}
+	records, _, err := remote.ListData(ctx, models.ListFilter{Type: models.Text})
+	if err != nil || len(records) != 1 || string(records[0].Data) != "offline" {
+		t.Fatalf("ListData(TEXT) = %+v, %v; want the record created offline", records, err)
+	}
+	if _, err := local.vault.get(created); !errors.Is(err, errVaultNotFound) {
+		t.Errorf("vault still has temporary id %s", created)
+	}
+	if stored, err := local.vault.get(records[0].Id); err != nil || stored.Version != 1 {
+		t.Errorf("vault record = %+v, %v; want the created record under its server id", stored, err)
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrSecondFactor пароль принят, для входа нужен код второго фактора
+var ErrSecondFactor = errors.New("введите код из приложения-аутентификатора или код восстановления")
+
+// pendingLogin вход, который ждет кода второго фактора. Ключи аккаунта нужны,
+// чтобы после входа открыть ключ записей, а пароль — локальную копию
+type pendingLogin struct {
+	username string
+	password string
+	keys     accountKeys
+	ticket   string
+}
+
+// secondFactorTicket достает из отказа Login билет второго шага входа
+func secondFactorTicket(err error) (string, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.FailedPrecondition {
+		return "", false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == auth.SecondFactorReason {
+			return info.Metadata[auth.TicketKey], true
+		}
+	}
+	return "", false
+}
+
+// LoginTOTP завершает вход, начатый Login, кодом из приложения-аутентификатора
+// или кодом восстановления
+func (c *Client) LoginTOTP(ctx context.Context, code string) error {
+	if c.pending == nil {
+		return fmt.Errorf("сначала введите логин и пароль")
+	}
+	pending := c.pending
+	resp, err := c.client.LoginTOTP(ctx, &pb.LoginTOTPRequest{Ticket: pending.ticket, Code: code})
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("неверный код или время на ввод истекло")
+		case codes.ResourceExhausted:
+			return fmt.Errorf("слишком много неверных кодов, попробуйте позже")
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	c.pending = nil
+	return c.startSession(ctx, resp, pending.username, pending.password, pending.keys)
+}
+
+// CancelLogin забывает вход, который ждет кода второго фактора
+func (c *Client) CancelLogin() {
+	c.pending = nil
+}
+
+// TOTPStatus сообщает, включена ли двухфакторная аутентификация, и сколько
+// кодов восстановления осталось
+func (c *Client) TOTPStatus(ctx context.Context) (bool, int, error) {
+	if err := c.checkOnline(ctx); err != nil {
+		return false, 0, err
+	}
+	resp, err := c.client.GetTOTPStatus(ctx, &pb.TOTPStatusRequest{})
+	if err = totpError(err); err != nil {
+		return false, 0, err
+	}
+	return resp.Enabled, int(resp.RecoveryLeft), nil
+}
+
+// EnrollTOTP создает секрет второго фактора и возвращает его вместе со
+// ссылкой otpauth:// для приложения-аутентификатора. Двухфакторная
+// аутентификация включается только после ConfirmTOTP
+func (c *Client) EnrollTOTP(ctx context.Context) (string, string, error) {
+	if err := c.checkOnline(ctx); err != nil {
+		return "", "", err
+	}
+	resp, err := c.client.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	if err = totpError(err); err != nil {
+		return "", "", err
+	}
+	return resp.Secret, resp.Uri, nil
+}
+
+// ConfirmTOTP включает двухфакторную аутентификацию первым кодом из
+// приложения-аутентификатора и возвращает одноразовые коды восстановления
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	if err := c.checkOnline(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: code})
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("сначала получите секрет для приложения-аутентификатора")
+	}
+	if err = totpError(err); err != nil {
+		return nil, err
+	}
+	return resp.RecoveryCodes, nil
+}
+
+// DisableTOTP отключает двухфакторную аутентификацию. code код из
+// приложения-аутентификатора или код восстановления
+func (c *Client) DisableTOTP(ctx context.Context, code string) error {
+	if err := c.checkOnline(ctx); err != nil {
+		return err
+	}
+	_, err := c.client.DisableTOTP(ctx, &pb.DisableTOTPRequest{Code: code})
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("двухфакторная аутентификация не включена")
+	}
+	return totpError(err)
+}
+
+// checkOnline проверяет, что двухфакторную аутентификацию можно настроить:
+// хранилище разблокировано и есть связь с сервером
+func (c *Client) checkOnline(ctx context.Context) error {
+	if c.locked {
+		return fmt.Errorf("хранилище заблокировано, разблокируйте его паролем")
+	}
+	if c.useVault(ctx) {
+		return fmt.Errorf("нет связи с сервером")
+	}
+	return nil
+}
+
+// totpError переводит ошибки запросов настройки второго фактора в сообщения
+// для пользователя
+func totpError(err error) error {
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.InvalidArgument:
+			return fmt.Errorf("неверный код")
+		case codes.AlreadyExists:
+			return fmt.Errorf("двухфакторная аутентификация уже включена")
+		case codes.ResourceExhausted:
+			return fmt.Errorf("слишком много неверных кодов, попробуйте позже")
+		case codes.Unavailable:
+			return fmt.Errorf("нет связи с сервером")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		}
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// chunkSize размер части при потоковой передаче файлов
+	chunkSize = 512 << 10
+	// transferRetries сколько раз клиент пытается продолжить прерванную передачу
+	transferRetries = 3
+)
+
+var errTransferInterrupted = status.Error(codes.Unavailable, "transfer interrupted")
+
+// UploadFile загружает файл как BINARY запись потоком частей. Файл шифруется
+// по частям во время отправки, контрольная сумма считается по зашифрованным
+// данным, которые получает сервер
+func (c *Client) UploadFile(ctx context.Context, path, meta string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть файл: %w", err)
+	}
+	defer file.Close()
+
+	src, size, err := c.uploadSource(file)
+	if err != nil {
+		return "", fmt.Errorf("не удалось прочитать файл: %w", err)
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, src); err != nil {
+		return "", fmt.Errorf("не удалось прочитать файл: %w", err)
+	}
+	if c.cipher != nil {
+		if meta, err = c.cipher.sealMeta(meta); err != nil {
+			return "", err
+		}
+	}
+
+	resp, err := c.client.CreateUpload(ctx, &pb.CreateUploadRequest{Meta: meta, Size: size, Checksum: digest.Sum(nil)})
+	if err != nil {
+		return "", transferError(err, "")
+	}
+	return c.ResumeUpload(ctx, resp.UploadId, path)
+}
+
+// ResumeUpload продолжает загрузку файла с того места, на котором ее принял сервер
+func (c *Client) ResumeUpload(ctx context.Context, uploadID, path string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("некорректный id загрузки")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть файл: %w", err)
+	}
+	defer file.Close()
+
+	for attempt := 0; attempt < transferRetries; attempt++ {
+		var (
+			id  string
+			src io.Reader
+		)
+		// зашифрованный поток каждый раз строится заново с начала файла
+		if src, _, err = c.uploadSource(file); err != nil {
+			return "", fmt.Errorf("не удалось прочитать файл: %w", err)
+		}
+		token := c.accessToken()
+		id, err = c.uploadFrom(ctx, uploadID, src)
+		if err == nil {
+			return id, nil
+		}
+		if !retryable(err) && !c.refreshed(ctx, token, err) {
+			break
+		}
+	}
+	return "", transferError(err, uploadID)
+}
+
+// uploadSource возвращает с начала файла данные, которые отправляются на
+// сервер, и их размер
+func (c *Client) uploadSource(file *os.File) (io.Reader, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.cipher == nil {
+		return file, info.Size(), nil
+	}
+	src, err := c.cipher.sealStream(file, info.Size())
+	return src, c.cipher.streamSize(info.Size()), err
+}
+
+func (c *Client) uploadFrom(ctx context.Context, uploadID string, src io.Reader) (string, error) {
+	state, err := c.client.GetUploadStatus(ctx, &pb.UploadStatusRequest{UploadId: uploadID})
+	if err != nil {
+		return "", err
+	}
+	// уже принятую сервером часть пропускаем; зашифрованный поток перемотать
+	// нельзя, его приходится прочитать
+	if file, ok := src.(io.Seeker); ok {
+		_, err = file.Seek(state.Received, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, src, state.Received)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := c.client.UploadBinary(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	offset := state.Received
+	buf := make([]byte, chunkSize)
+	for sent := false; !sent || offset < state.Size; sent = true {
+		n, err := io.ReadFull(src, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+
+		chunk := &pb.UploadChunk{Offset: offset, Data: buf[:n]}
+		if !sent {
+			chunk.UploadId = uploadID
+		}
+		if err := stream.Send(chunk); err != nil {
+			_, err = stream.CloseAndRecv()
+			return "", err
+		}
+		offset += int64(n)
+		if n == 0 {
+			break
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	if resp.Id == "" {
+		return "", errTransferInterrupted
+	}
+	return resp.Id, nil
+}
+
+// DownloadFile скачивает данные записи в файл. Недокачанные данные хранятся
+// в файле path.part, повторный вызов продолжает скачивание с его конца.
+// Расшифровывается файл после того, как скачан целиком
+func (c *Client) DownloadFile(ctx context.Context, id, path string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("некорректный id")
+	}
+
+	part := path + ".part"
+	var err error
+	for attempt := 0; attempt < transferRetries; attempt++ {
+		token := c.accessToken()
+		err = c.downloadTo(ctx, id, part)
+		if err == nil {
+			return c.cipher.openFile(part, path)
+		}
+		// access-токен мог истечь во время передачи
+		if !retryable(err) && !c.refreshed(ctx, token, err) {
+			break
+		}
+	}
+	return transferError(err, "")
+}
+
+func (c *Client) downloadTo(ctx context.Context, id, part string) error {
+	file, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	offset, err := io.Copy(digest, file)
+	if err != nil {
+		return err
+	}
+
+	stream, err := c.client.DownloadBinary(ctx, &pb.DownloadRequest{Id: id, Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return errTransferInterrupted
+		}
+		if status.Code(err) == codes.FailedPrecondition {
+			// данные на сервере короче уже скачанной части, начинаем заново
+			return restartDownload(file, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		if chunk.Offset != offset {
+			return restartDownload(file, errTransferInterrupted)
+		}
+		if _, err := file.Write(chunk.Data); err != nil {
+			return err
+		}
+		digest.Write(chunk.Data)
+		offset += int64(len(chunk.Data))
+
+		if chunk.Checksum != nil {
+			if offset != chunk.Size || !bytes.Equal(digest.Sum(nil), chunk.Checksum) {
+				return restartDownload(file, status.Error(codes.DataLoss, "checksum mismatch"))
+			}
+			return nil
+		}
+	}
+}
+
+// restartDownload очищает недокачанный файл, чтобы следующая попытка началась с нуля
+func restartDownload(file *os.File, err error) error {
+	if truncErr := file.Truncate(0); truncErr != nil {
+		return truncErr
+	}
+	return err
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.FailedPrecondition, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+func transferError(err error, uploadID string) error {
+	if status, ok := status.FromError(err); ok {
+		switch status.Code() {
+		case codes.Unauthenticated:
+			return fmt.Errorf("войдите в аккаунт перед выполнением запроса")
+		case codes.PermissionDenied:
+			return fmt.Errorf("в доступе отказано")
+		case codes.NotFound:
+			return fmt.Errorf("данные с таким id не найдены")
+		case codes.InvalidArgument:
+			return fmt.Errorf("некорректные данные для передачи")
+		case codes.DataLoss:
+			return fmt.Errorf("контрольная сумма не совпала, повторите передачу")
+		case codes.ResourceExhausted:
+			return fmt.Errorf("превышена квота хранилища")
+		case codes.Internal:
+			return fmt.Errorf("ошибка сервера")
+		case codes.Unavailable, codes.DeadlineExceeded, codes.FailedPrecondition:
+			if uploadID != "" {
+				return fmt.Errorf("передача прервана, продолжите загрузку позже, id загрузки: %s", uploadID)
+			}
+			return fmt.Errorf("передача прервана, повторите позже")
+		}
+	}
+	return err
+}
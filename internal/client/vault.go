@@ -0,0 +1,605 @@
+package client
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// vaultFormat версия формата файла локального хранилища
+const vaultFormat = 1
+
+// rekeySuffix окончание файла с копией хранилища, перешифрованной новым
+// паролем, пока сервер не подтвердил смену пароля
+const rekeySuffix = ".rekey"
+
+// Параметры Argon2id для ключа локального хранилища
+const (
+	vaultKDFTime    = 1
+	vaultKDFMemory  = 64 * 1024
+	vaultKDFThreads = 4
+	vaultSaltSize   = 16
+)
+
+// Виды изменений, сделанных без связи с сервером
+const (
+	OpCreate string = "CREATE"
+	OpUpdate string = "UPDATE"
+	OpDelete string = "DELETE"
+)
+
+var (
+	errVaultPassword = errors.New("неверный пароль локального хранилища")
+	errVaultNotFound = errors.New("данных с таким id нет в локальной копии")
+)
+
+// PendingOp изменение, сделанное без связи с сервером и ожидающее отправки.
+// Base и BaseVersion запись на сервере, от которой сделано изменение: с ней
+// сравниваются локальная и серверная версии, если запись успела измениться
+type PendingOp struct {
+	Op          string
+	Record      models.Record
+	Base        models.Record
+	BaseVersion int
+}
+
+// Conflict локальное изменение, которое не удалось применить на сервере.
+// Record содержит локальную версию записи (для удаления только id), Remote
+// версию на сервере (пустую, если запись там удалена), Fields поля, которые
+// изменены по-разному локально и на сервере
+type Conflict struct {
+	ID     string
+	Op     string
+	Record models.Record
+	Base   models.Record
+	Remote models.Record
+	Fields []string
+	Reason string
+	At     time.Time
+}
+
+// vaultState содержимое хранилища, которое шифруется целиком
+type vaultState struct {
+	Records   map[string]models.Record
+	Pending   []PendingOp
+	Conflicts []Conflict
+	Revision  int64
+}
+
+// vaultFile файл хранилища: параметры ключа и зашифрованное состояние
+type vaultFile struct {
+	Format  int
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	Salt    []byte
+	Nonce   []byte
+	Data    []byte
+}
+
+// Vault зашифрованная локальная копия записей пользователя. Из нее клиент
+// читает данные без связи с сервером и в нее же складывает изменения до
+// восстановления связи. Файл перезаписывается целиком после каждого изменения
+type Vault struct {
+	mu       sync.Mutex
+	path     string
+	username string
+	header   vaultFile
+	aead     cipher.AEAD
+	state    vaultState
+	// staged ключ из нового пароля до подтверждения смены пароля
+	staged *vaultKey
+}
+
+// vaultKey параметры и ключ, которым шифруется файл хранилища
+type vaultKey struct {
+	header vaultFile
+	aead   cipher.AEAD
+}
+
+// vaultPath путь к файлу хранилища пользователя в каталоге dir. Имя файла не
+// раскрывает логин
+func vaultPath(dir, username string) string {
+	return filepath.Join(dir, fmt.Sprintf("%x.vault", sha256.Sum256([]byte(username))))
+}
+
+// createVault создает пустое хранилище, ключ которого выводится из password
+func createVault(path, username, password string) (*Vault, error) {
+	salt := make([]byte, vaultSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	v := &Vault{
+		path:     path,
+		username: username,
+		header:   vaultFile{Format: vaultFormat, Time: vaultKDFTime, Memory: vaultKDFMemory, Threads: vaultKDFThreads, Salt: salt},
+		state:    vaultState{Records: make(map[string]models.Record)},
+	}
+	if err := v.unlock(password); err != nil {
+		return nil, err
+	}
+	return v, v.save()
+}
+
+// openVault открывает хранилище. Если файла нет, возвращается ошибка
+// os.ErrNotExist, при неверном пароле errVaultPassword. Если смена пароля
+// прервалась после того, как сервер ее принял, хранилище открывается из
+// копии, перешифрованной новым паролем
+func openVault(path, username, password string) (*Vault, error) {
+	v, err := readVault(path, username, password)
+	if !errors.Is(err, errVaultPassword) {
+		return v, err
+	}
+	staged, stagedErr := readVault(path+rekeySuffix, username, password)
+	if stagedErr != nil {
+		return nil, err
+	}
+	if err := os.Rename(path+rekeySuffix, path); err != nil {
+		return nil, fmt.Errorf("не удалось открыть локальную копию: %w", err)
+	}
+	staged.path = path
+	return staged, nil
+}
+
+func readVault(path, username, password string) (*Vault, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{path: path, username: username}
+	if err := json.Unmarshal(raw, &v.header); err != nil {
+		return nil, fmt.Errorf("поврежден файл локального хранилища: %w", err)
+	}
+	if v.header.Format != vaultFormat {
+		return nil, fmt.Errorf("неизвестный формат локального хранилища: %d", v.header.Format)
+	}
+	if err := v.unlock(password); err != nil {
+		return nil, err
+	}
+
+	plain, err := v.aead.Open(nil, v.header.Nonce, v.header.Data, []byte(username))
+	if err != nil {
+		return nil, errVaultPassword
+	}
+	if err := json.Unmarshal(plain, &v.state); err != nil {
+		return nil, fmt.Errorf("поврежден файл локального хранилища: %w", err)
+	}
+	if v.state.Records == nil {
+		v.state.Records = make(map[string]models.Record)
+	}
+	return v, nil
+}
+
+// unlock выводит ключ хранилища из пароля по параметрам из заголовка
+func (v *Vault) unlock(password string) error {
+	var err error
+	v.aead, err = newAEAD(deriveKey(password, v.header.Salt, v.header.Time, v.header.Memory, v.header.Threads))
+	return err
+}
+
+// wipe стирает расшифрованные записи из памяти. После этого хранилище нужно
+// открыть заново
+func (v *Vault) wipe() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, record := range v.state.Records {
+		clear(record.Data)
+	}
+	for _, op := range v.state.Pending {
+		clear(op.Record.Data)
+		clear(op.Base.Data)
+	}
+	for _, conflict := range v.state.Conflicts {
+		clear(conflict.Record.Data)
+		clear(conflict.Base.Data)
+		clear(conflict.Remote.Data)
+	}
+	v.state, v.aead, v.staged = vaultState{}, nil, nil
+}
+
+// stageRekey сохраняет состояние, зашифрованное ключом из нового пароля, в
+// отдельный файл. Хранилище переходит на него в commitRekey, после того как
+// сервер принял новый пароль
+func (v *Vault) stageRekey(password string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	salt := make([]byte, vaultSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key := vaultKey{header: vaultFile{Format: vaultFormat, Time: vaultKDFTime, Memory: vaultKDFMemory, Threads: vaultKDFThreads, Salt: salt}}
+	var err error
+	key.aead, err = newAEAD(deriveKey(password, salt, key.header.Time, key.header.Memory, key.header.Threads))
+	if err != nil {
+		return err
+	}
+	if err := v.write(v.path+rekeySuffix, &key.header, key.aead); err != nil {
+		return err
+	}
+	v.staged = &key
+	return nil
+}
+
+// commitRekey заменяет файл хранилища копией из stageRekey
+func (v *Vault) commitRekey() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.staged == nil {
+		return nil
+	}
+	if err := os.Rename(v.path+rekeySuffix, v.path); err != nil {
+		return fmt.Errorf("не удалось сохранить локальную копию: %w", err)
+	}
+	v.header, v.aead, v.staged = v.staged.header, v.staged.aead, nil
+	return nil
+}
+
+// dropRekey удаляет копию из stageRekey, если сервер отклонил новый пароль
+func (v *Vault) dropRekey() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.staged = nil
+	os.Remove(v.path + rekeySuffix)
+}
+
+// save шифрует состояние и атомарно заменяет файл хранилища
+func (v *Vault) save() error {
+	return v.write(v.path, &v.header, v.aead)
+}
+
+// write шифрует состояние ключом aead и атомарно заменяет файл path
+func (v *Vault) write(path string, header *vaultFile, aead cipher.AEAD) error {
+	plain, err := json.Marshal(v.state)
+	if err != nil {
+		return err
+	}
+	header.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return err
+	}
+	header.Data = aead.Seal(nil, header.Nonce, plain, []byte(v.username))
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("не удалось сохранить локальную копию: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("не удалось сохранить локальную копию: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("не удалось сохранить локальную копию: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("не удалось сохранить локальную копию: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("не удалось сохранить локальную копию: %w", err)
+	}
+	return nil
+}
+
+// pendingIndex номер ожидающего отправки изменения записи или -1
+func (v *Vault) pendingIndex(id string) int {
+	for i, op := range v.state.Pending {
+		if op.Record.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// get возвращает запись из локальной копии
+func (v *Vault) get(id string) (models.Record, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	record, ok := v.state.Records[id]
+	if !ok {
+		return models.Record{}, errVaultNotFound
+	}
+	return record, nil
+}
+
+// put сохраняет запись, полученную с сервера. Записи с неотправленными
+// изменениями не перезаписываются
+func (v *Vault) put(record models.Record) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.pendingIndex(record.Id) >= 0 {
+		return nil
+	}
+	// RetrieveData не возвращает размер и даты, их сохраняем из прошлой копии
+	if old, ok := v.state.Records[record.Id]; ok && record.CreatedAt.IsZero() {
+		record.CreatedAt, record.UpdatedAt = old.CreatedAt, old.UpdatedAt
+	}
+	if record.Size == 0 {
+		record.Size = int64(len(record.Data))
+	}
+	v.state.Records[record.Id] = record
+	return v.save()
+}
+
+// setContent обновляет данные записи после ее успешного изменения на сервере
+func (v *Vault) setContent(id, meta string, data []byte, version int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	record, ok := v.state.Records[id]
+	if !ok {
+		return nil
+	}
+	record.Meta, record.Data, record.Version = meta, data, version
+	record.Size, record.UpdatedAt = int64(len(data)), time.Now()
+	v.state.Records[id] = record
+	return v.save()
+}
+
+// remove удаляет запись из локальной копии
+func (v *Vault) remove(id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.state.Records[id]; !ok {
+		return nil
+	}
+	delete(v.state.Records, id)
+	return v.save()
+}
+
+// list возвращает страницу записей локальной копии по фильтру. Курсор здесь
+// номер первой записи следующей страницы
+func (v *Vault) list(filter models.ListFilter) ([]models.Record, string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	offset := 0
+	if filter.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(filter.Cursor)
+		if err != nil || offset < 0 {
+			return nil, "", fmt.Errorf("неверные параметры выборки, начните просмотр списка заново")
+		}
+	}
+
+	var records []models.Record
+	for _, record := range v.state.Records {
+		if filter.Type != "" && record.TypeRecord != filter.Type {
+			continue
+		}
+		if filter.Meta != "" && !strings.Contains(strings.ToLower(record.Meta), strings.ToLower(filter.Meta)) {
+			continue
+		}
+		if filter.MetadataOnly {
+			record.Data = nil
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.Before(records[j].CreatedAt) != filter.NewestFirst
+		}
+		return records[i].Id < records[j].Id
+	})
+
+	if offset >= len(records) {
+		return nil, "", nil
+	}
+	records = records[offset:]
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		return records[:filter.Limit], strconv.Itoa(offset + filter.Limit), nil
+	}
+	return records, "", nil
+}
+
+// storeLocal сохраняет новую запись без связи с сервером. Запись получает
+// временный id, который заменяется на серверный при отправке
+func (v *Vault) storeLocal(typeRecord, meta string, data []byte) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	record := models.Record{
+		Id:         uuid.NewString(),
+		TypeRecord: typeRecord,
+		Data:       data,
+		Meta:       meta,
+		Size:       int64(len(data)),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	v.state.Records[record.Id] = record
+	v.state.Pending = append(v.state.Pending, PendingOp{Op: OpCreate, Record: record})
+	return record.Id, v.save()
+}
+
+// updateLocal изменяет запись без связи с сервером. Несколько изменений одной
+// записи отправляются на сервер одним
+func (v *Vault) updateLocal(id, meta string, data []byte, version int) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	record, ok := v.state.Records[id]
+	if !ok {
+		return 0, errVaultNotFound
+	}
+	if record.Version != version {
+		return 0, ErrConflict
+	}
+	base := record
+	record.Meta, record.Data = meta, data
+	record.Size, record.UpdatedAt = int64(len(data)), time.Now()
+	v.state.Records[id] = record
+
+	if i := v.pendingIndex(id); i >= 0 {
+		v.state.Pending[i].Record = record
+	} else {
+		v.state.Pending = append(v.state.Pending, PendingOp{Op: OpUpdate, Record: record, Base: base, BaseVersion: base.Version})
+	}
+	return record.Version, v.save()
+}
+
+// deleteLocal удаляет запись без связи с сервером. Запись, которая еще не
+// попала на сервер, удаляется вместе с ожидающим ее созданием
+func (v *Vault) deleteLocal(id string, version int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	record, ok := v.state.Records[id]
+	if !ok {
+		return errVaultNotFound
+	}
+	if record.Version != version {
+		return ErrConflict
+	}
+	delete(v.state.Records, id)
+
+	op := PendingOp{Op: OpDelete, Record: models.Record{Id: id}, Base: record, BaseVersion: record.Version}
+	switch i := v.pendingIndex(id); {
+	case i < 0:
+		v.state.Pending = append(v.state.Pending, op)
+	case v.state.Pending[i].Op == OpCreate:
+		v.state.Pending = append(v.state.Pending[:i], v.state.Pending[i+1:]...)
+	default:
+		op.Base, op.BaseVersion = v.state.Pending[i].Base, v.state.Pending[i].BaseVersion
+		v.state.Pending[i] = op
+	}
+	return v.save()
+}
+
+// nextPending возвращает первое неотправленное изменение
+func (v *Vault) nextPending() (PendingOp, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.state.Pending) == 0 {
+		return PendingOp{}, false
+	}
+	return v.state.Pending[0], true
+}
+
+// pendingCount количество неотправленных изменений
+func (v *Vault) pendingCount() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return len(v.state.Pending)
+}
+
+// donePending отмечает первое изменение отправленным и сохраняет запись в том
+// виде, в каком она теперь на сервере. Для созданной записи временный id
+// заменяется на серверный
+func (v *Vault) donePending(record models.Record) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	op := v.state.Pending[0]
+	v.state.Pending = v.state.Pending[1:]
+	if op.Op != OpDelete {
+		delete(v.state.Records, op.Record.Id)
+		v.state.Records[record.Id] = record
+	}
+	return v.save()
+}
+
+// conflictPending переносит первое изменение в список конфликтов. Серверная
+// версия, поля и причина берутся из conflict
+func (v *Vault) conflictPending(conflict Conflict) (Conflict, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	op := v.state.Pending[0]
+	v.state.Pending = v.state.Pending[1:]
+	if op.Op == OpCreate {
+		// запись так и не попала на сервер, в локальной копии ее тоже не будет
+		delete(v.state.Records, op.Record.Id)
+	}
+	conflict.ID, conflict.Op, conflict.At = uuid.NewString(), op.Op, time.Now()
+	conflict.Record, conflict.Base = op.Record, op.Base
+	v.state.Conflicts = append(v.state.Conflicts, conflict)
+	return conflict, v.save()
+}
+
+// conflicts возвращает неразрешенные конфликты
+func (v *Vault) conflicts() []Conflict {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return append([]Conflict(nil), v.state.Conflicts...)
+}
+
+// conflict возвращает конфликт по id
+func (v *Vault) conflict(id string) (Conflict, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, c := range v.state.Conflicts {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Conflict{}, false
+}
+
+// dropConflict удаляет конфликт из списка
+func (v *Vault) dropConflict(id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for i, c := range v.state.Conflicts {
+		if c.ID == id {
+			v.state.Conflicts = append(v.state.Conflicts[:i], v.state.Conflicts[i+1:]...)
+			return v.save()
+		}
+	}
+	return nil
+}
+
+// revision ревизия сервера, до которой локальная копия актуальна
+func (v *Vault) revision() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.state.Revision
+}
+
+// applyChanges применяет изменения с сервера и запоминает ревизию
+func (v *Vault) applyChanges(changes []models.Change, revision int64) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, change := range changes {
+		if v.pendingIndex(change.Record.Id) >= 0 {
+			continue
+		}
+		if change.Deleted {
+			delete(v.state.Records, change.Record.Id)
+		} else {
+			v.state.Records[change.Record.Id] = change.Record
+		}
+	}
+	v.state.Revision = revision
+	return v.save()
+}
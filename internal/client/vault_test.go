@@ -0,0 +1,169 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := vaultPath(t.TempDir(), "user")
+	v, err := createVault(path, "user", "password")
+	if err != nil {
+		t.Fatalf("createVault: %v", err)
+	}
+	record := models.Record{Id: "id", TypeRecord: models.Text, Version: 2, Data: []byte("secret data"), Meta: "secret meta"}
+	if err := v.put(record); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for _, plain := range []string{"secret data", "secret meta", "user"} {
+		if bytes.Contains(raw, []byte(plain)) {
+			t.Errorf("vault file contains %q in the clear", plain)
+		}
+	}
+	if filepath.Base(path) == "user.vault" {
+		t.Errorf("vault file name %q reveals the username", filepath.Base(path))
+	}
+
+	v, err = openVault(path, "user", "password")
+	if err != nil {
+		t.Fatalf("openVault: %v", err)
+	}
+	got, err := v.get("id")
+	if err != nil || got.Version != 2 || string(got.Data) != "secret data" || got.Meta != "secret meta" {
+		t.Fatalf("get = %+v, %v; want stored record", got, err)
+	}
+	if _, err := v.get("missing"); !errors.Is(err, errVaultNotFound) {
+		t.Errorf("get(missing) = %v; want errVaultNotFound", err)
+	}
+}
+
+func TestVaultFailsClosed(t *testing.T) {
+	path := vaultPath(t.TempDir(), "user")
+	v, err := createVault(path, "user", "password")
+	if err != nil {
+		t.Fatalf("createVault: %v", err)
+	}
+	if err := v.put(models.Record{Id: "id", Data: []byte("data")}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	if _, err := openVault(path, "user", "wrong"); !errors.Is(err, errVaultPassword) {
+		t.Errorf("openVault with wrong password = %v; want errVaultPassword", err)
+	}
+	// логин входит в дополнительные данные шифра, чужой файл не откроется
+	if _, err := openVault(path, "other", "password"); !errors.Is(err, errVaultPassword) {
+		t.Errorf("openVault as another user = %v; want errVaultPassword", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var file vaultFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	file.Data[len(file.Data)/2] ^= 1
+	raw, err = json.Marshal(file)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := openVault(path, "user", "password"); !errors.Is(err, errVaultPassword) {
+		t.Errorf("openVault of tampered file = %v; want errVaultPassword", err)
+	}
+
+	if _, err := openVault(filepath.Join(t.TempDir(), "missing.vault"), "user", "password"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("openVault of missing file = %v; want os.ErrNotExist", err)
+	}
+}
+
+func TestVaultPendingSurvivesReopen(t *testing.T) {
+	path := vaultPath(t.TempDir(), "user")
+	v, err := createVault(path, "user", "password")
+	if err != nil {
+		t.Fatalf("createVault: %v", err)
+	}
+	for _, id := range []string{"updated", "deleted"} {
+		if err := v.put(models.Record{Id: id, TypeRecord: models.Text, Version: 3, Data: []byte(id)}); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+	created, err := v.storeLocal(models.Text, "new", []byte("new data"))
+	if err != nil {
+		t.Fatalf("storeLocal: %v", err)
+	}
+	if _, err := v.updateLocal("updated", "meta", []byte("v1"), 3); err != nil {
+		t.Fatalf("updateLocal: %v", err)
+	}
+	// второе изменение той же записи сливается с первым
+	if _, err := v.updateLocal("updated", "meta", []byte("v2"), 3); err != nil {
+		t.Fatalf("updateLocal: %v", err)
+	}
+	if _, err := v.updateLocal("deleted", "meta", []byte("stale"), 2); !errors.Is(err, ErrConflict) {
+		t.Errorf("updateLocal with stale version = %v; want ErrConflict", err)
+	}
+	if err := v.deleteLocal("deleted", 3); err != nil {
+		t.Fatalf("deleteLocal: %v", err)
+	}
+
+	v, err = openVault(path, "user", "password")
+	if err != nil {
+		t.Fatalf("openVault: %v", err)
+	}
+	want := []PendingOp{
+		{Op: OpCreate, Record: models.Record{Id: created, Data: []byte("new data")}},
+		{Op: OpUpdate, Record: models.Record{Id: "updated", Data: []byte("v2")}, Base: models.Record{Data: []byte("updated")}, BaseVersion: 3},
+		{Op: OpDelete, Record: models.Record{Id: "deleted"}, Base: models.Record{Data: []byte("deleted")}, BaseVersion: 3},
+	}
+	if got := v.pendingCount(); got != len(want) {
+		t.Fatalf("pendingCount after reopen = %d; want %d", got, len(want))
+	}
+	for i, w := range want {
+		op, ok := v.nextPending()
+		if !ok || op.Op != w.Op || op.Record.Id != w.Record.Id || !bytes.Equal(op.Record.Data, w.Record.Data) || op.BaseVersion != w.BaseVersion ||
+			!bytes.Equal(op.Base.Data, w.Base.Data) {
+			t.Fatalf("pending %d = %+v, %t; want %+v", i, op, ok, w)
+		}
+		sent := op.Record
+		sent.Id, sent.Version = "server-"+op.Record.Id, op.BaseVersion+1
+		if err := v.donePending(sent); err != nil {
+			t.Fatalf("donePending: %v", err)
+		}
+	}
+	if _, ok := v.nextPending(); ok {
+		t.Errorf("nextPending after all sent = true; want false")
+	}
+
+	// отправленная запись получает серверный id и версию, и это тоже
+	// переживает повторное открытие
+	v, err = openVault(path, "user", "password")
+	if err != nil {
+		t.Fatalf("openVault: %v", err)
+	}
+	if v.pendingCount() != 0 {
+		t.Errorf("pendingCount = %d; want 0", v.pendingCount())
+	}
+	if got, err := v.get("server-" + created); err != nil || string(got.Data) != "new data" || got.Version != 1 {
+		t.Errorf("get(created) = %+v, %v; want record with server id", got, err)
+	}
+	if _, err := v.get(created); !errors.Is(err, errVaultNotFound) {
+		t.Errorf("get(temporary id) = %v; want errVaultNotFound", err)
+	}
+	if _, err := v.get("deleted"); !errors.Is(err, errVaultNotFound) {
+		t.Errorf("get(deleted) = %v; want errVaultNotFound", err)
+	}
+}
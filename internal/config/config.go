@@ -3,6 +3,9 @@ package config
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env"
@@ -11,8 +14,9 @@ import (
 
 var (
 	TokenSetting models.TokenSettings = models.TokenSettings{
-		TokenExp:  time.Hour * 12,
-		SecretKey: "supersecretkey",
+		TokenExp:   time.Minute * 15,
+		RefreshExp: time.Hour * 24 * 30,
+		TicketExp:  time.Minute * 5,
 	}
 	VersionBuild models.VersionBuild = models.VersionBuild{
 		Version: "0.1 beta",
@@ -20,9 +24,30 @@ var (
 	}
 )
 
+const (
+	DriverPostgres string = "postgres"
+	DriverSQLite   string = "sqlite"
+	DriverMemory   string = "memory"
+)
+
 type Config struct {
-	Host        string `env:"BASE_HOST"`
-	DatabaseDsn string `env:"DATABASE_URI"`
+	Host           string        `env:"BASE_HOST"`
+	DatabaseDsn    string        `env:"DATABASE_URI"`
+	HistoryLimit   int           `env:"HISTORY_LIMIT" envDefault:"10"`
+	TrashRetention time.Duration `env:"TRASH_RETENTION" envDefault:"720h"`
+	UploadTTL      time.Duration `env:"UPLOAD_TTL" envDefault:"24h"`
+	BlobStore      string        `env:"BLOB_STORE"`
+	MasterKeyFile  string        `env:"MASTER_KEY_FILE"`
+	JWTKeyFile     string        `env:"JWT_KEY_FILE" envDefault:"jwt_keys.pem"`
+	JWTAlgorithm   string        `env:"JWT_ALGORITHM" envDefault:"EdDSA"`
+	QuotaBytes     int64         `env:"QUOTA_BYTES"`
+	QuotaRecords   int64         `env:"QUOTA_RECORDS"`
+	MaxRecordSize  int64         `env:"MAX_RECORD_SIZE"`
+	SkipMigrations bool          `env:"SKIP_MIGRATIONS"`
+	VaultDir       string        `env:"VAULT_DIR"`
+	IdleLock       time.Duration `env:"IDLE_LOCK" envDefault:"5m"`
+	MigrateBlobs   bool
+	RotateKeys     bool
 }
 
 func NewConfig() Config {
@@ -38,8 +63,44 @@ func NewConfig() Config {
 	}
 
 	flag.StringVar(&conf.Host, "a", ":3200", "host")
+	flag.IntVar(&conf.HistoryLimit, "history-limit", conf.HistoryLimit, "number of previous revisions kept per record")
+	flag.DurationVar(&conf.TrashRetention, "trash-retention", conf.TrashRetention, "how long deleted records stay in trash")
+	flag.DurationVar(&conf.UploadTTL, "upload-ttl", conf.UploadTTL, "how long unfinished uploads are kept")
+	flag.StringVar(&conf.BlobStore, "blob-store", conf.BlobStore, "blob store dsn for binary data (file:///path or s3://key:secret@host/bucket)")
+	flag.StringVar(&conf.MasterKeyFile, "master-key-file", conf.MasterKeyFile, "file with master keys for encryption at rest, the first key is active")
+	flag.StringVar(&conf.JWTKeyFile, "jwt-key-file", conf.JWTKeyFile, "PEM file with token signing keys, the first key is active; created on first start if missing")
+	flag.StringVar(&conf.JWTAlgorithm, "jwt-algorithm", conf.JWTAlgorithm, "algorithm of the signing key created on first start (EdDSA or RS256)")
+	flag.Int64Var(&conf.QuotaBytes, "quota-bytes", conf.QuotaBytes, "default per-user storage quota in bytes, 0 means unlimited")
+	flag.Int64Var(&conf.QuotaRecords, "quota-records", conf.QuotaRecords, "default per-user record count limit, 0 means unlimited")
+	flag.Int64Var(&conf.MaxRecordSize, "max-record-size", conf.MaxRecordSize, "default max size of one record in bytes, 0 means unlimited")
+	flag.BoolVar(&conf.SkipMigrations, "skip-migrations", conf.SkipMigrations, "don't apply migrations on start, use the migrate subcommand instead")
+	if conf.VaultDir == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			conf.VaultDir = filepath.Join(dir, "gophkeeper")
+		}
+	}
+	flag.StringVar(&conf.VaultDir, "vault-dir", conf.VaultDir, "client directory for encrypted local copies of records, empty disables offline mode")
+	flag.DurationVar(&conf.IdleLock, "idle-lock", conf.IdleLock, "client locks the vault after this long without input, 0 disables")
+	flag.BoolVar(&conf.MigrateBlobs, "migrate-blobs", false, "move binary data from the database to the blob store and exit")
+	flag.BoolVar(&conf.RotateKeys, "rotate-keys", false, "rewrap record and blob data keys with the active master key and exit")
 
 	flag.Parse()
 
 	return conf
 }
+
+// DatabaseDriver определяет бэкенд хранилища по схеме DSN
+func (c Config) DatabaseDriver() string {
+	if strings.HasPrefix(c.DatabaseDsn, "sqlite:") || strings.HasPrefix(c.DatabaseDsn, "sqlite3:") {
+		return DriverSQLite
+	}
+	if strings.HasPrefix(c.DatabaseDsn, "memory:") {
+		return DriverMemory
+	}
+	return DriverPostgres
+}
+
+// Quota ограничения хранилища по умолчанию для пользователей без своих значений
+func (c Config) Quota() models.Quota {
+	return models.Quota{Bytes: c.QuotaBytes, Records: c.QuotaRecords, MaxRecordSize: c.MaxRecordSize}
+}
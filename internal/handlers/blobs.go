@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
+)
+
+// orphanBlobGrace сколько blob без ссылок хранится до удаления. Blob
+// записывается раньше, чем ссылка на него, и не должен пропасть между ними
+const orphanBlobGrace = time.Hour
+
+var (
+	errNoBlobStore   = errors.New("blob store is not configured")
+	errNoBlobKeyring = errors.New("blob is encrypted, but master key is not configured")
+)
+
+// PurgeOrphanBlobs удаляет blob, на которые не ссылаются ни записи, ни их версии
+func (h *Handler) PurgeOrphanBlobs(ctx context.Context) (int, error) {
+	if h.blobs == nil {
+		return 0, nil
+	}
+
+	keys, err := h.storage.GetBlobKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		referenced[key] = true
+	}
+
+	purged := 0
+	before := time.Now().Add(-orphanBlobGrace)
+	err = h.blobs.List(ctx, func(key string, modified time.Time) error {
+		if referenced[key] || modified.After(before) {
+			return nil
+		}
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+		purged++
+		return nil
+	})
+	return purged, err
+}
+
+// MoveDataToBlobs переносит данные BINARY записей и их версий из базы во внешнее хранилище
+func (h *Handler) MoveDataToBlobs(ctx context.Context) (int, error) {
+	if h.blobs == nil {
+		return 0, errNoBlobStore
+	}
+	return h.storage.MoveDataToBlobs(ctx, func(ctx context.Context, data []byte) (models.BlobRef, error) {
+		return h.putBlob(ctx, bytes.NewReader(data), int64(len(data)))
+	})
+}
+
+// storeBlob выносит данные BINARY записи во внешнее хранилище, если оно настроено
+func (h *Handler) storeBlob(ctx context.Context, record *models.Record) error {
+	if h.blobs == nil || record.TypeRecord != models.Binary {
+		return nil
+	}
+
+	ref, err := h.putBlob(ctx, bytes.NewReader(record.Data), int64(len(record.Data)))
+	if err != nil {
+		return err
+	}
+	record.Data, record.Blob = []byte{}, ref
+	return nil
+}
+
+// discardBlob удаляет blob, ссылку на который не удалось сохранить в базе.
+// Ошибка удаления не возвращается: такой blob позже удалит PurgeOrphanBlobs.
+// Запрос клиента к этому моменту может быть отменен, поэтому удаление идет
+// без отмены контекста
+func (h *Handler) discardBlob(ctx context.Context, ref models.BlobRef) {
+	if h.blobs == nil || ref.Key == "" {
+		return
+	}
+	_ = h.blobs.Delete(context.WithoutCancel(ctx), ref.Key)
+}
+
+// putBlob сохраняет size байт из r в новый blob. Если настроены мастер-ключи,
+// blob шифруется новым ключом данных, а его обернутый ключ сохраняется в
+// ссылке. Размер и хеш в ссылке относятся к открытым данным
+func (h *Handler) putBlob(ctx context.Context, r io.Reader, size int64) (models.BlobRef, error) {
+	ref := models.BlobRef{Key: uuid.NewString(), Size: size}
+	digest := sha256.New()
+	r, stored := io.TeeReader(r, digest), size
+	if h.masterKeys != nil {
+		dek, keyID, wrapped, err := h.masterKeys.NewDataKey()
+		if err != nil {
+			return models.BlobRef{}, err
+		}
+		if r, err = envelope.SealReader(dek, r, size); err != nil {
+			return models.BlobRef{}, err
+		}
+		ref.KeyID, ref.DataKey, stored = keyID, wrapped, envelope.SealedSize(size)
+	}
+
+	if err := h.blobs.Put(ctx, ref.Key, r, stored); err != nil {
+		return models.BlobRef{}, err
+	}
+	ref.Hash = digest.Sum(nil)
+	return ref, nil
+}
+
+// getBlob открывает открытые данные blob, начиная с offset. Из зашифрованного
+// blob читаются сегменты, начиная с того, в который попадает offset
+func (h *Handler) getBlob(ctx context.Context, ref models.BlobRef, offset int64) (io.ReadCloser, error) {
+	if ref.KeyID == "" {
+		return h.blobs.Get(ctx, ref.Key, offset)
+	}
+	if h.masterKeys == nil {
+		return nil, errNoBlobKeyring
+	}
+	dek, err := h.masterKeys.Unwrap(ref.KeyID, ref.DataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedFrom, _, first := envelope.SealedRange(offset, 1)
+	rc, err := h.blobs.Get(ctx, ref.Key, sealedFrom)
+	if err != nil {
+		return nil, err
+	}
+	r, err := envelope.OpenReader(dek, rc, first, envelope.SealedSize(ref.Size))
+	if err == nil {
+		_, err = io.CopyN(io.Discard, r, offset-first*envelope.SegmentSize)
+	}
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
+}
+
+// sealBlob сохраняет зашифрованную копию незашифрованного blob и сверяет хеш
+// копии с хешем в ссылке
+func (h *Handler) sealBlob(ctx context.Context, ref models.BlobRef) (models.BlobRef, error) {
+	r, err := h.blobs.Get(ctx, ref.Key, 0)
+	if err != nil {
+		return models.BlobRef{}, err
+	}
+	defer r.Close()
+
+	sealed, err := h.putBlob(ctx, r, ref.Size)
+	if err != nil {
+		return models.BlobRef{}, err
+	}
+	if !bytes.Equal(sealed.Hash, ref.Hash) {
+		if err := h.blobs.Delete(ctx, sealed.Key); err != nil {
+			return models.BlobRef{}, err
+		}
+		return models.BlobRef{}, models.ErrChecksum
+	}
+	return sealed, nil
+}
+
+// loadBlob подставляет в запись данные из внешнего хранилища и сверяет их хеш
+func (h *Handler) loadBlob(ctx context.Context, record *models.Record) error {
+	if record.Blob.Key == "" {
+		return nil
+	}
+	if h.blobs == nil {
+		return errNoBlobStore
+	}
+
+	r, err := h.getBlob(ctx, record.Blob, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	if int64(len(data)) != record.Blob.Size || !bytes.Equal(digest[:], record.Blob.Hash) {
+		return models.ErrChecksum
+	}
+	record.Data = data
+	return nil
+}
+
+func (h *Handler) loadBlobs(ctx context.Context, records []models.Record) error {
+	for i := range records {
+		if err := h.loadBlob(ctx, &records[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadBlob отдает данные из внешнего хранилища частями, начиная с offset.
+// Хеш всех данных уже сохранен в ссылке, поэтому читать начало blob не нужно
+func (h *Handler) downloadBlob(ctx context.Context, ref models.BlobRef, offset int64, send func(models.Chunk) error) error {
+	if h.blobs == nil {
+		return errNoBlobStore
+	}
+
+	r, err := h.getBlob(ctx, ref, offset)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	buf := make([]byte, MaxChunkSize)
+	for pos := offset; ; {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		next := pos + int64(n)
+		last := next >= ref.Size || n == 0
+
+		chunk := models.Chunk{Offset: pos, Data: buf[:n], Size: ref.Size}
+		if last {
+			chunk.Checksum = ref.Hash
+		}
+		if err := send(chunk); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		pos = next
+	}
+}
+
+// uploadReader последовательно читает части завершенной загрузки из хранилища
+type uploadReader struct {
+	ctx     context.Context
+	storage Storage
+	id      string
+	offset  int64
+	size    int64
+	buf     []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		chunk, err := r.storage.ReadUploadChunk(r.ctx, r.id, r.offset)
+		if err != nil {
+			return 0, err
+		}
+		if len(chunk) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.buf = chunk
+		r.offset += int64(len(chunk))
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
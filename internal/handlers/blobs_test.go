@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage"
+	"github.com/sinfirst/GophKeeper/internal/storage/blob"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
+)
+
+var errSaveFailed = errors.New("save failed")
+
+// failingStorage хранилище, которое не сохраняет новые и измененные записи
+type failingStorage struct {
+	Storage
+}
+
+func (failingStorage) StoreDataToDB(context.Context, models.Record, string) (string, error) {
+	return "", errSaveFailed
+}
+
+func (failingStorage) UpdateDataInDB(context.Context, models.Record) error {
+	return errSaveFailed
+}
+
+func TestFailedWriteDiscardsBlob(t *testing.T) {
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	db := storage.NewMemoryDB(config.Config{})
+	h := NewHandler(db, blobs, nil, testKeys(t), config.Config{})
+	ctx := register(t, h, "user")
+	countBlobs := func() int {
+		t.Helper()
+		count := 0
+		err := blobs.List(ctx, func(string, time.Time) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		return count
+	}
+
+	id, err := h.StoreData(ctx, models.Record{TypeRecord: models.Binary, Data: []byte("v1")})
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	h = NewHandler(failingStorage{db}, blobs, nil, nil, config.Config{})
+	if _, err := h.StoreData(ctx, models.Record{TypeRecord: models.Binary, Data: []byte("new")}); !errors.Is(err, errSaveFailed) {
+		t.Fatalf("StoreData = %v; want errSaveFailed", err)
+	}
+	if _, err := h.UpdateData(ctx, "", id, []byte("v2"), 1); !errors.Is(err, errSaveFailed) {
+		t.Fatalf("UpdateData = %v; want errSaveFailed", err)
+	}
+	if count := countBlobs(); count != 1 {
+		t.Fatalf("blob store has %d blobs after failed writes; want 1", count)
+	}
+}
+
+func TestPurgeOrphanBlobs(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := blob.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	db := storage.NewMemoryDB(config.Config{HistoryLimit: 1})
+	h := NewHandler(db, blobs, nil, nil, config.Config{})
+	ctx := context.Background()
+	if err := db.AddUserToDB(ctx, "user", "hash", models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+
+	// три версии записи, в истории остается одна
+	record := models.Record{TypeRecord: models.Binary, Data: []byte("v1")}
+	if err := h.storeBlob(ctx, &record); err != nil {
+		t.Fatalf("storeBlob: %v", err)
+	}
+	id, err := db.StoreDataToDB(ctx, record, "user")
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	for _, data := range []string{"v2", "v3"} {
+		record := models.Record{Id: id, TypeRecord: models.Binary, Data: []byte(data)}
+		if err := h.storeBlob(ctx, &record); err != nil {
+			t.Fatalf("storeBlob: %v", err)
+		}
+		if err := db.UpdateDataInDB(ctx, record); err != nil {
+			t.Fatalf("UpdateDataInDB: %v", err)
+		}
+	}
+
+	if purged, err := h.PurgeOrphanBlobs(ctx); err != nil || purged != 0 {
+		t.Fatalf("PurgeOrphanBlobs of fresh blobs = %d, %v; want 0", purged, err)
+	}
+	old := time.Now().Add(-2 * orphanBlobGrace)
+	err = filepath.Walk(dir, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	if purged, err := h.PurgeOrphanBlobs(ctx); err != nil || purged != 1 {
+		t.Fatalf("PurgeOrphanBlobs = %d, %v; want 1", purged, err)
+	}
+
+	current, err := db.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	if err := h.loadBlob(ctx, &current); err != nil || string(current.Data) != "v3" {
+		t.Fatalf("loadBlob = %q, %v; want v3", current.Data, err)
+	}
+	revision, err := db.RetrieveRevisionFromDB(ctx, id, 2)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB: %v", err)
+	}
+	if err := h.loadBlob(ctx, &revision); err != nil || string(revision.Data) != "v2" {
+		t.Fatalf("loadBlob of revision = %q, %v; want v2", revision.Data, err)
+	}
+}
+
+func TestEncryptedBlobs(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, envelope.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	keyFile := filepath.Join(dir, "master.keys")
+	if err := os.WriteFile(keyFile, []byte("k1:"+base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	masterKeys, err := envelope.LoadKeyring(keyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	blobs, err := blob.NewFileStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	db := storage.NewMemoryDB(config.Config{HistoryLimit: 1})
+	plain := NewHandler(db, blobs, nil, nil, config.Config{})
+	h := NewHandler(db, blobs, masterKeys, nil, config.Config{})
+	ctx := context.Background()
+	if err := db.AddUserToDB(ctx, "user", "hash", models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+
+	for _, size := range []int{0, 1, envelope.SegmentSize, 3*envelope.SegmentSize + 7} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("rand.Read: %v", err)
+		}
+
+		// blob, сохраненный до включения шифрования, шифруется при ротации
+		record := models.Record{TypeRecord: models.Binary, Data: data}
+		if err := plain.storeBlob(ctx, &record); err != nil {
+			t.Fatalf("storeBlob: %v", err)
+		}
+		id, err := db.StoreDataToDB(ctx, record, "user")
+		if err != nil {
+			t.Fatalf("StoreDataToDB: %v", err)
+		}
+		if sealed, err := h.RotateKeys(ctx); err != nil || sealed != 1 {
+			t.Fatalf("RotateKeys = %d, %v; want 1 blob sealed", sealed, err)
+		}
+		stored, err := db.RetrieveDataFromDB(ctx, id)
+		if err != nil || stored.Blob.KeyID != "k1" {
+			t.Fatalf("RetrieveDataFromDB = %+v, %v; want blob sealed with k1", stored.Blob, err)
+		}
+
+		// новый blob шифруется сразу
+		fresh := models.Record{TypeRecord: models.Binary, Data: data}
+		if err := h.storeBlob(ctx, &fresh); err != nil || fresh.Blob.KeyID != "k1" {
+			t.Fatalf("storeBlob = %+v, %v; want blob sealed with k1", fresh.Blob, err)
+		}
+
+		for _, ref := range []models.BlobRef{stored.Blob, fresh.Blob} {
+			r, err := blobs.Get(ctx, ref.Key, 0)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			raw, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if int64(len(raw)) != envelope.SealedSize(int64(size)) || (size >= 64 && bytes.Contains(raw, data[:64])) {
+				t.Fatalf("blob file has %d bytes; want %d encrypted bytes", len(raw), envelope.SealedSize(int64(size)))
+			}
+
+			loaded := models.Record{Blob: ref}
+			if err := h.loadBlob(ctx, &loaded); err != nil || !bytes.Equal(loaded.Data, data) {
+				t.Fatalf("loadBlob = %d bytes, %v; want %d", len(loaded.Data), err, size)
+			}
+			if err := plain.loadBlob(ctx, &loaded); err == nil {
+				t.Fatalf("loadBlob without master keys succeeded, want error")
+			}
+
+			for _, offset := range []int64{0, 1, envelope.SegmentSize - 1, envelope.SegmentSize + 1, int64(size)} {
+				if offset > int64(size) {
+					continue
+				}
+				var got []byte
+				err := h.downloadBlob(ctx, ref, offset, func(chunk models.Chunk) error {
+					got = append(got, chunk.Data...)
+					return nil
+				})
+				if err != nil || !bytes.Equal(got, data[offset:]) {
+					t.Fatalf("downloadBlob(%d bytes, offset %d) = %d bytes, %v; want %d", size, offset, len(got), err, int64(size)-offset)
+				}
+			}
+		}
+	}
+}
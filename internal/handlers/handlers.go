@@ -1,164 +1,767 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"hash"
+	"time"
 
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/sinfirst/GophKeeper/internal/config"
 	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
 	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/blob"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
 )
 
 type Storage interface {
 	CheckUsernameExists(ctx context.Context, username string) (bool, error)
-	AddUserToDB(ctx context.Context, username, password string) error
+	AddUserToDB(ctx context.Context, username, password string, kdf models.KDFParams) error
 	GetUserPassword(ctx context.Context, username string) (string, error)
-	StoreDataToDB(ctx context.Context, record models.Record, username string) (int, error)
-	RetrieveDataFromDB(ctx context.Context, id int) (models.Record, error)
-	GetUserByDataID(ctx context.Context, id int) (string, error)
-	UpdateDataInDB(ctx context.Context, id int, meta string, data []byte) error
-	GetListData(ctx context.Context, username string) ([]models.Record, error)
-	CheckRecordExist(ctx context.Context, id int) (bool, error)
-	DeleteDataFromDB(ctx context.Context, id int) error
+	StoreDataToDB(ctx context.Context, record models.Record, username string) (string, error)
+	RetrieveDataFromDB(ctx context.Context, id string) (models.Record, error)
+	GetUserByDataID(ctx context.Context, id string) (string, error)
+	UpdateDataInDB(ctx context.Context, record models.Record) error
+	GetListData(ctx context.Context, username string, filter models.ListFilter) ([]models.Record, string, error)
+	CheckRecordExist(ctx context.Context, id string) (bool, error)
+	DeleteDataFromDB(ctx context.Context, id string, version int) error
+	GetRevisions(ctx context.Context, id string) ([]models.Revision, error)
+	RetrieveRevisionFromDB(ctx context.Context, id string, revision int) (models.Record, error)
+	GetTrashList(ctx context.Context, username string) ([]models.Record, error)
+	RestoreDataInDB(ctx context.Context, id string) error
+	PurgeDataFromDB(ctx context.Context, id string) error
+	PurgeExpiredTrash(ctx context.Context, before time.Time) (int, error)
+	CreateUpload(ctx context.Context, upload models.Upload) (string, error)
+	GetUpload(ctx context.Context, id string) (models.Upload, error)
+	AppendUploadChunk(ctx context.Context, id string, offset int64, data, hashState []byte) error
+	ReadUploadChunk(ctx context.Context, id string, offset int64) ([]byte, error)
+	CompleteUpload(ctx context.Context, id string, blob models.BlobRef) (string, error)
+	PurgeStaleUploads(ctx context.Context, before time.Time) (int, error)
+	GetBlobRef(ctx context.Context, id string) (models.BlobRef, error)
+	ReadDataChunk(ctx context.Context, id string, offset int64, limit int) ([]byte, error)
+	GetBlobKeys(ctx context.Context) ([]string, error)
+	MoveDataToBlobs(ctx context.Context, put func(ctx context.Context, data []byte) (models.BlobRef, error)) (int, error)
+	SealBlobs(ctx context.Context, seal func(ctx context.Context, ref models.BlobRef) (models.BlobRef, error)) (int, error)
+	RotateKeys(ctx context.Context) (int, error)
+	GetUsage(ctx context.Context, username string) (models.Usage, error)
+	GetChanges(ctx context.Context, username string, since int64, limit int) ([]models.Change, error)
+	GetLastChange(ctx context.Context, username string) (int64, error)
+	GetKDFParams(ctx context.Context, username string) (models.KDFParams, error)
+	MigrateUser(ctx context.Context, username, password string, kdf models.KDFParams) error
+	GetVaultKey(ctx context.Context, username string) ([]byte, error)
+	SetVaultKey(ctx context.Context, username string, key []byte) error
+	ChangePassword(ctx context.Context, username, oldHash, newHash string, kdf models.KDFParams, key []byte, keepSession string) error
+	CreateSession(ctx context.Context, session models.Session) (string, error)
+	GetSession(ctx context.Context, id string) (models.Session, error)
+	RotateSession(ctx context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error
+	DeleteSession(ctx context.Context, id string) error
+	PurgeExpiredSessions(ctx context.Context, before time.Time) (int, error)
+	SetTOTPSecret(ctx context.Context, username, secret string) error
+	GetTOTP(ctx context.Context, username string) (models.TOTP, error)
+	EnableTOTP(ctx context.Context, username string, step int64, recoveryCodes [][]byte) error
+	UseTOTPStep(ctx context.Context, username string, step int64) error
+	UseRecoveryCode(ctx context.Context, username string, hash []byte) error
+	AddTOTPAttempt(ctx context.Context, username string, at, since time.Time) (int, error)
+	DeleteTOTP(ctx context.Context, username string) error
 }
 
+// MaxChunkSize максимальный размер одной части при потоковой передаче данных
+const MaxChunkSize = 1 << 20
+
+// Размер страницы списка записей, если клиент его не указал, и наибольший
+// допустимый размер
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
 type Handler struct {
-	storage Storage
-	config  config.Config
+	storage    Storage
+	blobs      blob.Store
+	masterKeys *envelope.Keyring
+	keys       *auth.Keyring
+	config     config.Config
+	hub        *changeHub
 }
 
-func NewHandler(storage Storage, config config.Config) Handler {
-	handler := Handler{storage: storage, config: config}
+// NewHandler конструктор для Handler. Если blobs равен nil, данные BINARY
+// записей хранятся в самой базе. masterKeys мастер-ключи, которыми шифруются
+// blob, если nil, blob сохраняются как есть. keys ключи подписи токенов
+func NewHandler(storage Storage, blobs blob.Store, masterKeys *envelope.Keyring, keys *auth.Keyring, config config.Config) Handler {
+	handler := Handler{storage: storage, blobs: blobs, masterKeys: masterKeys, keys: keys, config: config, hub: newChangeHub()}
 	return handler
 }
 
-func (h *Handler) Register(ctx context.Context, login, password string) (string, error) {
+// Register создает аккаунт и его первую сессию, возвращает access и refresh
+// токены. password ключ входа, который клиент вывел из мастер-пароля с
+// параметрами kdf; сам мастер-пароль на сервер не попадает
+func (h *Handler) Register(ctx context.Context, login, password string, kdf models.KDFParams) (string, string, error) {
+	if !kdf.Valid() {
+		return "", "", models.ErrInvalidArgument
+	}
+
 	exist, err := h.storage.CheckUsernameExists(ctx, login)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if exist {
-		return "", fmt.Errorf("conflict")
+		return "", "", models.ErrConflict
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", err
-	}
-
-	err = h.storage.AddUserToDB(ctx, login, string(hashedPassword))
-	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	token, err := auth.BuildJWTString(login)
+	err = h.storage.AddUserToDB(ctx, login, string(hashedPassword), kdf)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return token, nil
+	return h.newSession(ctx, login)
 }
 
-func (h *Handler) Login(ctx context.Context, login, password string) (string, error) {
+// Login проверяет пароль и создает новую сессию, возвращает access и refresh
+// токены. Если у пользователя включен второй фактор, сессия не создается, а
+// возвращается SecondFactorError с билетом для LoginTOTP
+func (h *Handler) Login(ctx context.Context, login, password string) (string, string, error) {
 	exist, err := h.storage.CheckUsernameExists(ctx, login)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if !exist {
-		return "", fmt.Errorf("not found")
+		return "", "", models.ErrNotFound
 	}
 
 	passwordFromBD, err := h.storage.GetUserPassword(ctx, login)
 	if err != nil {
-		return "", fmt.Errorf("unauthenticated")
+		return "", "", models.ErrUnauthenticated
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(passwordFromBD), []byte(password))
 	if err != nil {
-		return "", fmt.Errorf("unauthenticated")
+		return "", "", models.ErrUnauthenticated
+	}
+
+	if err := h.secondFactor(ctx, login); err != nil {
+		return "", "", err
 	}
-	token, err := auth.BuildJWTString(login)
+	return h.newSession(ctx, login)
+}
+
+func (h *Handler) StoreData(ctx context.Context, record models.Record) (string, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return "", models.ErrUnauthenticated
+	}
+
+	if err := h.storeBlob(ctx, &record); err != nil {
+		return "", err
+	}
+	id, err := h.storage.StoreDataToDB(ctx, record, username)
 	if err != nil {
+		h.discardBlob(ctx, record.Blob)
 		return "", err
 	}
+	h.hub.notify(username)
+	return id, nil
+}
 
-	return token, nil
+func (h *Handler) RetrieveData(ctx context.Context, id string) (models.Record, error) {
+	_, err := h.checkAccess(ctx, id)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	record, err := h.storage.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		return models.Record{}, err
+	}
+	return record, h.loadBlob(ctx, &record)
 }
 
-func (h *Handler) StoreData(ctx context.Context, token string, record models.Record) (int, error) {
-	username, err := auth.CheckToken(token)
+// UpdateData сохраняет новую версию записи, если ее текущая версия равна
+// version, и возвращает номер новой версии
+func (h *Handler) UpdateData(ctx context.Context, meta, id string, data []byte, version int) (int, error) {
+	username, err := h.checkAccess(ctx, id)
 	if err != nil {
-		return 0, fmt.Errorf("unauthenticated")
+		return 0, err
 	}
-	return h.storage.StoreDataToDB(ctx, record, username)
+
+	if version <= 0 {
+		return 0, models.ErrInvalidArgument
+	}
+
+	exist, err := h.storage.CheckRecordExist(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exist {
+		return 0, models.ErrNotFound
+	}
+
+	record := models.Record{Id: id, Meta: meta, Data: data, Version: version}
+	if h.blobs != nil {
+		current, err := h.storage.RetrieveDataFromDB(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		if current.Version != version {
+			return 0, models.ErrVersionMismatch
+		}
+		record.TypeRecord = current.TypeRecord
+		if err := h.storeBlob(ctx, &record); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := h.storage.UpdateDataInDB(ctx, record); err != nil {
+		h.discardBlob(ctx, record.Blob)
+		return 0, err
+	}
+	h.hub.notify(username)
+	return version + 1, nil
 }
 
-func (h *Handler) RetrieveData(ctx context.Context, token string, id int) (models.Record, error) {
-	_, err := h.checkAccess(ctx, token, id)
+// ListData возвращает страницу записей пользователя и курсор следующей
+// страницы. Размер страницы ограничивается MaxPageSize, при
+// filter.MetadataOnly данные записей не возвращаются
+func (h *Handler) ListData(ctx context.Context, filter models.ListFilter) ([]models.Record, string, error) {
+	username, err := h.user(ctx)
 	if err != nil {
-		return models.Record{}, err
+		return nil, "", models.ErrUnauthenticated
+	}
+	if filter.Limit < 0 {
+		return nil, "", models.ErrInvalidArgument
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultPageSize
 	}
-	return h.storage.RetrieveDataFromDB(ctx, id)
+	filter.Limit = min(filter.Limit, MaxPageSize)
+
+	records, next, err := h.storage.GetListData(ctx, username, filter)
+	if err != nil {
+		return nil, "", err
+	}
+	if filter.MetadataOnly {
+		return records, next, nil
+	}
+	return records, next, h.loadBlobs(ctx, records)
 }
 
-func (h *Handler) UpdateData(ctx context.Context, token, meta string, id int, data []byte) error {
-	_, err := h.checkAccess(ctx, token, id)
+// DeleteData перемещает запись в корзину, если ее текущая версия равна version
+func (h *Handler) DeleteData(ctx context.Context, id string, version int) error {
+	username, err := h.checkAccess(ctx, id)
 	if err != nil {
 		return err
 	}
 
+	if version <= 0 {
+		return models.ErrInvalidArgument
+	}
+
 	exist, err := h.storage.CheckRecordExist(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	if !exist {
-		return fmt.Errorf("not found")
+		return models.ErrNotFound
+	}
+	if err := h.storage.DeleteDataFromDB(ctx, id, version); err != nil {
+		return err
+	}
+	h.hub.notify(username)
+	return nil
+}
+
+// ListTrash возвращает записи в корзине без их данных, как список с
+// MetadataOnly. Данные снова доступны после RestoreData
+func (h *Handler) ListTrash(ctx context.Context) ([]models.Record, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return nil, models.ErrUnauthenticated
 	}
-	return h.storage.UpdateDataInDB(ctx, id, meta, data)
 
+	return h.storage.GetTrashList(ctx, username)
 }
 
-func (h *Handler) ListData(ctx context.Context, token string) ([]models.Record, error) {
-	username, err := auth.CheckToken(token)
+func (h *Handler) RestoreData(ctx context.Context, id string) error {
+	username, err := h.checkAccess(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("unauthenticated")
+		return err
+	}
+	if err := h.storage.RestoreDataInDB(ctx, id); err != nil {
+		return err
 	}
-	return h.storage.GetListData(ctx, username)
+	h.hub.notify(username)
+	return nil
 }
 
-func (h *Handler) DeleteData(ctx context.Context, token string, id int) error {
-	_, err := h.checkAccess(ctx, token, id)
+func (h *Handler) PurgeData(ctx context.Context, id string) error {
+	username, err := h.checkAccess(ctx, id)
 	if err != nil {
 		return err
 	}
+	if err := h.storage.PurgeDataFromDB(ctx, id); err != nil {
+		return err
+	}
+	h.hub.notify(username)
+	return nil
+}
 
-	exist, err := h.storage.CheckRecordExist(ctx, id)
+// PurgeExpiredTrash окончательно удаляет записи, пролежавшие в корзине дольше TrashRetention
+func (h *Handler) PurgeExpiredTrash(ctx context.Context) (int, error) {
+	return h.storage.PurgeExpiredTrash(ctx, time.Now().Add(-h.config.TrashRetention))
+}
+
+// CreateUpload начинает потоковую загрузку бинарных данных
+func (h *Handler) CreateUpload(ctx context.Context, meta string, size int64, checksum []byte) (models.Upload, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return models.Upload{}, models.ErrUnauthenticated
+	}
+
+	if size < 0 || len(checksum) != sha256.Size {
+		return models.Upload{}, models.ErrInvalidArgument
+	}
+
+	// квота окончательно проверяется при завершении загрузки, здесь заранее
+	// отказываем в загрузке, которая заведомо в нее не поместится
+	usage, err := h.storage.GetUsage(ctx, username)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	if !usage.Fits(size + int64(len(meta))) {
+		return models.Upload{}, models.ErrQuotaExceeded
+	}
+
+	upload := models.Upload{Username: username, Meta: meta, Size: size, Checksum: checksum}
+	upload.ID, err = h.storage.CreateUpload(ctx, upload)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	return upload, nil
+}
+
+// GetUpload возвращает состояние загрузки, чтобы клиент мог продолжить ее с нужного места
+func (h *Handler) GetUpload(ctx context.Context, uploadID string) (models.Upload, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return models.Upload{}, models.ErrUnauthenticated
+	}
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return models.Upload{}, models.ErrNotFound
+	}
+
+	upload, err := h.storage.GetUpload(ctx, uploadID)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	if upload.Username != username {
+		return models.Upload{}, models.ErrAccessDenied
+	}
+	return upload, nil
+}
+
+// UploadChunk принимает очередную часть загрузки. Состояние SHA-256 сохраняется
+// вместе с данными, поэтому прерванную загрузку можно продолжить в новом потоке
+func (h *Handler) UploadChunk(ctx context.Context, uploadID string, offset int64, data []byte) (models.Upload, error) {
+	upload, err := h.GetUpload(ctx, uploadID)
+	if err != nil {
+		return models.Upload{}, err
+	}
+
+	if offset != upload.Received {
+		return upload, models.ErrInvalidOffset
+	}
+	if len(data) > MaxChunkSize || upload.Received+int64(len(data)) > upload.Size {
+		return upload, models.ErrInvalidArgument
+	}
+	if len(data) == 0 {
+		return upload, nil
+	}
+
+	digest, err := restoreHash(upload.HashState)
+	if err != nil {
+		return upload, err
+	}
+	digest.Write(data)
+	state, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return upload, err
+	}
+
+	err = h.storage.AppendUploadChunk(ctx, uploadID, offset, data, state)
+	if err != nil {
+		return upload, err
+	}
+
+	upload.Received += int64(len(data))
+	upload.HashState = state
+	return upload, nil
+}
+
+// CompleteUpload сверяет контрольную сумму и создает BINARY запись из загрузки
+func (h *Handler) CompleteUpload(ctx context.Context, uploadID string) (string, error) {
+	upload, err := h.GetUpload(ctx, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	if upload.Received != upload.Size {
+		return "", models.ErrInvalidOffset
+	}
+
+	digest, err := restoreHash(upload.HashState)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(digest.Sum(nil), upload.Checksum) {
+		return "", models.ErrChecksum
+	}
+
+	var ref models.BlobRef
+	if h.blobs != nil {
+		reader := &uploadReader{ctx: ctx, storage: h.storage, id: uploadID, size: upload.Size}
+		ref, err = h.putBlob(ctx, reader, upload.Size)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(ref.Hash, upload.Checksum) {
+			h.discardBlob(ctx, ref)
+			return "", models.ErrChecksum
+		}
+	}
+	id, err := h.storage.CompleteUpload(ctx, uploadID, ref)
+	if err != nil {
+		h.discardBlob(ctx, ref)
+		return "", err
+	}
+	h.hub.notify(upload.Username)
+	return id, nil
+}
+
+// DownloadData отдает данные записи частями, начиная с offset. Контрольная сумма
+// считается по всем данным и передается в последней части
+func (h *Handler) DownloadData(ctx context.Context, id string, offset int64, send func(models.Chunk) error) error {
+	_, err := h.checkAccess(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if !exist {
-		return fmt.Errorf("not found")
+	ref, err := h.storage.GetBlobRef(ctx, id)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > ref.Size {
+		return models.ErrInvalidOffset
+	}
+	if ref.Key != "" {
+		return h.downloadBlob(ctx, ref, offset, send)
+	}
+
+	size := ref.Size
+
+	digest := sha256.New()
+	for pos := int64(0); ; {
+		data, err := h.storage.ReadDataChunk(ctx, id, pos, MaxChunkSize)
+		if err != nil {
+			return err
+		}
+		digest.Write(data)
+
+		next := pos + int64(len(data))
+		last := next >= size || len(data) == 0
+
+		chunk := models.Chunk{Offset: next, Size: size}
+		if next > offset {
+			start := max(offset-pos, 0)
+			chunk.Offset, chunk.Data = pos+start, data[start:]
+		}
+		if last {
+			chunk.Checksum = digest.Sum(nil)
+		}
+
+		if len(chunk.Data) > 0 || last {
+			if err := send(chunk); err != nil {
+				return err
+			}
+		}
+		if last {
+			return nil
+		}
+		pos = next
 	}
-	return h.storage.DeleteDataFromDB(ctx, id)
 }
 
-func (h *Handler) checkAccess(ctx context.Context, token string, id int) (string, error) {
-	username, err := auth.CheckToken(token)
+// PurgeStaleUploads удаляет загрузки, не завершенные за UploadTTL
+func (h *Handler) PurgeStaleUploads(ctx context.Context) (int, error) {
+	return h.storage.PurgeStaleUploads(ctx, time.Now().Add(-h.config.UploadTTL))
+}
+
+// GetUsage возвращает занятое пользователем место и его квоту
+func (h *Handler) GetUsage(ctx context.Context) (models.Usage, error) {
+	username, err := h.user(ctx)
 	if err != nil {
-		return username, fmt.Errorf("unauthenticated")
+		return models.Usage{}, models.ErrUnauthenticated
 	}
+	return h.storage.GetUsage(ctx, username)
+}
 
-	usernameFromBD, err := h.storage.GetUserByDataID(ctx, id)
-	if username != usernameFromBD {
-		return username, fmt.Errorf("access denied")
+// GetKDFParams возвращает параметры, с которыми клиент выводит ключ входа из
+// мастер-пароля. Для аккаунта, созданного до сквозного шифрования,
+// возвращается ErrLegacyAccount: его нужно перевести через MigrateAccount
+func (h *Handler) GetKDFParams(ctx context.Context, username string) (models.KDFParams, error) {
+	kdf, err := h.storage.GetKDFParams(ctx, username)
+	if err != nil {
+		return models.KDFParams{}, err
+	}
+	if !kdf.Valid() {
+		return models.KDFParams{}, models.ErrLegacyAccount
+	}
+	return kdf, nil
+}
+
+// MigrateAccount переводит аккаунт, созданный до сквозного шифрования, на
+// ключ входа: password прежний пароль, newPassword ключ входа, выведенный
+// клиентом с параметрами kdf. Перевести аккаунт можно только один раз, после
+// этого сервер больше не принимает прежний пароль
+func (h *Handler) MigrateAccount(ctx context.Context, login, password, newPassword string, kdf models.KDFParams) error {
+	if !kdf.Valid() || newPassword == "" {
+		return models.ErrInvalidArgument
+	}
+
+	current, err := h.storage.GetKDFParams(ctx, login)
+	if err != nil {
+		return err
+	}
+	if current.Valid() {
+		return models.ErrConflict
+	}
+
+	passwordFromBD, err := h.storage.GetUserPassword(ctx, login)
+	if err != nil {
+		return models.ErrUnauthenticated
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordFromBD), []byte(password)); err != nil {
+		return models.ErrUnauthenticated
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := h.storage.MigrateUser(ctx, login, string(hashedPassword), kdf); err != nil {
+		return err
+	}
+	// сессии, открытые по прежнему паролю, завершены: их потоки изменений закроются
+	h.hub.notify(login)
+	return nil
+}
+
+// GetVaultKey возвращает ключ, которым клиент шифрует записи пользователя,
+// обернутый ключом из мастер-пароля
+func (h *Handler) GetVaultKey(ctx context.Context) ([]byte, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return nil, models.ErrUnauthenticated
+	}
+	return h.storage.GetVaultKey(ctx, username)
+}
+
+// SetVaultKey сохраняет обернутый ключ шифрования записей пользователя. Ключ
+// задается один раз, первым устройством пользователя
+func (h *Handler) SetVaultKey(ctx context.Context, key []byte) error {
+	username, err := h.user(ctx)
+	if err != nil {
+		return models.ErrUnauthenticated
+	}
+	if len(key) == 0 {
+		return models.ErrInvalidArgument
+	}
+	return h.storage.SetVaultKey(ctx, username, key)
+}
+
+// ChangePassword меняет пароль пользователя после проверки текущего и
+// завершает все его сессии, кроме текущей, и возвращает новый access-токен
+// текущей сессии. oldPassword и newPassword ключи входа, выведенные клиентом
+// из старого и нового мастер-пароля, kdf параметры нового ключа. Если у
+// пользователя есть ключ записей, вместе с паролем передается тот же ключ,
+// обернутый ключом из нового пароля, и все это сохраняется одной операцией
+func (h *Handler) ChangePassword(ctx context.Context, oldPassword, newPassword string, kdf models.KDFParams, key []byte) (string, error) {
+	session, err := h.session(ctx)
+	if err != nil {
+		return "", models.ErrUnauthenticated
+	}
+	username := session.Username
+	if newPassword == "" || !kdf.Valid() {
+		return "", models.ErrInvalidArgument
+	}
+
+	oldHash, err := h.storage.GetUserPassword(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(oldHash), []byte(oldPassword)); err != nil {
+		return "", models.ErrAccessDenied
+	}
+	if key == nil {
+		// без нового ключа старый остался бы обернут прежним паролем
+		if _, err := h.storage.GetVaultKey(ctx, username); !errors.Is(err, models.ErrNotFound) {
+			if err != nil {
+				return "", err
+			}
+			return "", models.ErrInvalidArgument
+		}
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
 	}
+	err = h.storage.ChangePassword(ctx, username, oldHash, string(newHash), kdf, key, session.ID)
 	if err != nil {
 		return "", err
 	}
+	// открытые потоки изменений проверят токен заново, и потоки остальных
+	// сессий закроются
+	h.hub.notify(username)
+	return h.keys.BuildJWTString(username, session.ID)
+}
+
+// RotateKeys переоборачивает ключи данных всех записей и blob активным
+// мастер-ключом и шифрует blob, сохраненные без шифрования
+func (h *Handler) RotateKeys(ctx context.Context) (int, error) {
+	rotated, err := h.storage.RotateKeys(ctx)
+	if err != nil || h.blobs == nil || h.masterKeys == nil {
+		return rotated, err
+	}
+	sealed, err := h.storage.SealBlobs(ctx, h.sealBlob)
+	return rotated + sealed, err
+}
+
+func (h *Handler) ListRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	_, err := h.checkAccess(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return h.storage.GetRevisions(ctx, id)
+}
+
+func (h *Handler) GetRevision(ctx context.Context, id string, revision int) (models.Record, error) {
+	_, err := h.checkAccess(ctx, id)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	record, err := h.storage.RetrieveRevisionFromDB(ctx, id, revision)
+	if err != nil {
+		return models.Record{}, err
+	}
+	return record, h.loadBlob(ctx, &record)
+}
+
+// RestoreRevision делает содержимое старой версии новой текущей версией записи
+func (h *Handler) RestoreRevision(ctx context.Context, id string, revision int) error {
+	username, err := h.checkAccess(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	record, err := h.storage.RetrieveRevisionFromDB(ctx, id, revision)
+	if err != nil {
+		return err
+	}
+	// восстановленная версия становится новой текущей, какой бы ни была текущая сейчас
+	record.Version = 0
+	if err := h.storage.UpdateDataInDB(ctx, record); err != nil {
+		return err
+	}
+	h.hub.notify(username)
+	return nil
+}
+
+func (h *Handler) checkAccess(ctx context.Context, id string) (string, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return username, models.ErrUnauthenticated
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return username, models.ErrNotFound
+	}
+
+	usernameFromBD, err := h.storage.GetUserByDataID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if username != usernameFromBD {
+		return username, models.ErrAccessDenied
+	}
 	return username, nil
 }
+
+// restoreHash восстанавливает SHA-256 из сохраненного состояния
+func restoreHash(state []byte) (hash.Hash, error) {
+	digest := sha256.New()
+	if len(state) == 0 {
+		return digest, nil
+	}
+	err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	if err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
+
+// GetChanges возвращает изменения записей пользователя после ревизии since,
+// ревизию, с которой нужно запросить следующую порцию, и признак того, что
+// изменения еще остались
+func (h *Handler) GetChanges(ctx context.Context, since int64, limit int) ([]models.Change, int64, bool, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return nil, 0, false, models.ErrUnauthenticated
+	}
+	if since < 0 || limit < 0 {
+		return nil, 0, false, models.ErrInvalidArgument
+	}
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	return h.changes(ctx, username, since, min(limit, MaxPageSize))
+}
+
+// changes читает до limit изменений пользователя после ревизии since вместе с
+// данными из внешнего хранилища
+func (h *Handler) changes(ctx context.Context, username string, since int64, limit int) ([]models.Change, int64, bool, error) {
+	changes, err := h.storage.GetChanges(ctx, username, since, limit+1)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	more := len(changes) > limit
+	if more {
+		changes = changes[:limit]
+	}
+	if len(changes) > 0 {
+		since = changes[len(changes)-1].Revision
+	}
+
+	for i := range changes {
+		if changes[i].Deleted {
+			continue
+		}
+		if err := h.loadBlob(ctx, &changes[i].Record); err != nil {
+			return nil, 0, false, err
+		}
+	}
+	return changes, since, more, nil
+}
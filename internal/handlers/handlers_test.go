@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage"
+	"github.com/sinfirst/GophKeeper/internal/storage/blob"
+)
+
+// testKeys создает ключ подписи токенов во временном каталоге теста
+func testKeys(t *testing.T) *auth.Keyring {
+	t.Helper()
+	keys, err := auth.LoadKeyring(filepath.Join(t.TempDir(), "jwt.pem"), auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return keys
+}
+
+func newTestHandler(t *testing.T) Handler {
+	t.Helper()
+	return NewHandler(storage.NewMemoryDB(config.Config{}), nil, nil, testKeys(t), config.Config{})
+}
+
+// testKDF параметры, с которыми в тестах регистрируются пользователи
+var testKDF = models.KDFParams{Salt: []byte("0123456789abcdef"), Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// register регистрирует пользователя и возвращает контекст запросов от его
+// имени
+func register(t *testing.T, h Handler, username string) context.Context {
+	t.Helper()
+	token, _, err := h.Register(context.Background(), username, "password", testKDF)
+	if err != nil {
+		t.Fatalf("Register(%s): %v", username, err)
+	}
+	return authorize(t, h, token)
+}
+
+// authorize проверяет access-токен, как интерцептор авторизации, и
+// возвращает контекст запросов от имени его сессии
+func authorize(t *testing.T, h Handler, token string) context.Context {
+	t.Helper()
+	identity, err := h.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return auth.NewContext(context.Background(), identity)
+}
+
+func TestRegisterLogin(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	token, _, err := h.Register(ctx, "user", "password", testKDF)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if identity, err := h.Authenticate(ctx, token); err != nil || identity.Username != "user" {
+		t.Fatalf("Authenticate(Register token) = %q, %v; want user", identity.Username, err)
+	}
+	if _, _, err := h.Register(ctx, "user", "other", testKDF); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("Register of existing user = %v; want ErrConflict", err)
+	}
+	if _, _, err := h.Register(ctx, "nokdf", "password", models.KDFParams{}); !errors.Is(err, models.ErrInvalidArgument) {
+		t.Errorf("Register without KDF params = %v; want ErrInvalidArgument", err)
+	}
+	if kdf, err := h.GetKDFParams(ctx, "user"); err != nil || string(kdf.Salt) != string(testKDF.Salt) {
+		t.Errorf("GetKDFParams = %+v, %v; want registered params", kdf, err)
+	}
+
+	if _, _, err := h.Login(ctx, "user", "wrong"); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Login with wrong password = %v; want ErrUnauthenticated", err)
+	}
+	if _, _, err := h.Login(ctx, "nobody", "password"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Login of unknown user = %v; want ErrNotFound", err)
+	}
+	token, _, err = h.Login(ctx, "user", "password")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if identity, err := h.Authenticate(ctx, token); err != nil || identity.Username != "user" {
+		t.Errorf("Authenticate(Login token) = %q, %v; want user", identity.Username, err)
+	}
+	if _, err := h.Authenticate(ctx, "not a token"); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Authenticate of invalid token = %v; want ErrUnauthenticated", err)
+	}
+}
+
+func TestMigrateAccount(t *testing.T) {
+	db := storage.NewMemoryDB(config.Config{})
+	h := NewHandler(db, nil, nil, testKeys(t), config.Config{})
+	ctx := context.Background()
+	// аккаунт, созданный до сквозного шифрования: пароль без параметров KDF
+	hash, err := bcrypt.GenerateFromPassword([]byte("master"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	if err := db.AddUserToDB(ctx, "legacy", string(hash), models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+
+	if _, err := h.GetKDFParams(ctx, "legacy"); !errors.Is(err, models.ErrLegacyAccount) {
+		t.Fatalf("GetKDFParams of legacy account = %v; want ErrLegacyAccount", err)
+	}
+	if _, err := h.GetKDFParams(ctx, "nobody"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("GetKDFParams of unknown user = %v; want ErrNotFound", err)
+	}
+	token, _, err := h.Login(ctx, "legacy", "master")
+	if err != nil {
+		t.Fatalf("Login before migration: %v", err)
+	}
+	if err := h.MigrateAccount(ctx, "legacy", "wrong", "derived", testKDF); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("MigrateAccount with wrong password = %v; want ErrUnauthenticated", err)
+	}
+	if err := h.MigrateAccount(ctx, "legacy", "master", "derived", models.KDFParams{}); !errors.Is(err, models.ErrInvalidArgument) {
+		t.Errorf("MigrateAccount without KDF params = %v; want ErrInvalidArgument", err)
+	}
+	if err := h.MigrateAccount(ctx, "legacy", "master", "derived", testKDF); err != nil {
+		t.Fatalf("MigrateAccount: %v", err)
+	}
+
+	// после переноса сервер принимает только ключ входа, а выданные по
+	// паролю токены отозваны
+	if _, err := h.Authenticate(ctx, token); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("GetUsage with a token issued before migration = %v; want ErrUnauthenticated", err)
+	}
+	if _, _, err := h.Login(ctx, "legacy", "master"); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Login with the master password after migration = %v; want ErrUnauthenticated", err)
+	}
+	if _, _, err := h.Login(ctx, "legacy", "derived"); err != nil {
+		t.Errorf("Login with the derived key: %v", err)
+	}
+	if err := h.MigrateAccount(ctx, "legacy", "derived", "again", testKDF); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("second MigrateAccount = %v; want ErrConflict", err)
+	}
+	register(t, h, "user")
+	if err := h.MigrateAccount(ctx, "user", "password", "derived", testKDF); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("MigrateAccount of a new account = %v; want ErrConflict", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	current := register(t, h, "user")
+	token, _, err := h.Login(ctx, "user", "password")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	next := models.KDFParams{Salt: []byte("fedcba9876543210"), Time: 3, Memory: 64 * 1024, Threads: 4}
+
+	if _, err := h.ChangePassword(ctx, "password", "new", next, nil); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("ChangePassword without a session = %v; want ErrUnauthenticated", err)
+	}
+	if _, err := h.ChangePassword(current, "wrong", "new", next, nil); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("ChangePassword with a wrong password = %v; want ErrAccessDenied", err)
+	}
+	if _, err := h.ChangePassword(current, "password", "new", models.KDFParams{}, nil); !errors.Is(err, models.ErrInvalidArgument) {
+		t.Errorf("ChangePassword without KDF params = %v; want ErrInvalidArgument", err)
+	}
+	if err := h.SetVaultKey(current, []byte("wrapped")); err != nil {
+		t.Fatalf("SetVaultKey: %v", err)
+	}
+	// ключ записей остался бы обернут ключом из старого пароля
+	if _, err := h.ChangePassword(current, "password", "new", next, nil); !errors.Is(err, models.ErrInvalidArgument) {
+		t.Errorf("ChangePassword without the rewrapped key = %v; want ErrInvalidArgument", err)
+	}
+
+	fresh, err := h.ChangePassword(current, "password", "new", next, []byte("rewrapped"))
+	if err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	// текущая сессия продолжает работать, остальные завершены
+	if _, err := h.GetUsage(current); err != nil {
+		t.Errorf("GetUsage in the current session: %v", err)
+	}
+	if _, err := h.Authenticate(ctx, token); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Authenticate with the other session token = %v; want ErrUnauthenticated", err)
+	}
+	if key, err := h.GetVaultKey(authorize(t, h, fresh)); err != nil || string(key) != "rewrapped" {
+		t.Errorf("GetVaultKey with the new token = %q, %v; want rewrapped", key, err)
+	}
+	if kdf, err := h.GetKDFParams(ctx, "user"); err != nil || string(kdf.Salt) != string(next.Salt) {
+		t.Errorf("GetKDFParams = %+v, %v; want the new params", kdf, err)
+	}
+	if _, _, err := h.Login(ctx, "user", "password"); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Login with the old password = %v; want ErrUnauthenticated", err)
+	}
+	if _, _, err := h.Login(ctx, "user", "new"); err != nil {
+		t.Errorf("Login with the new password: %v", err)
+	}
+}
+
+func TestRecordCRUD(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := register(t, h, "user")
+
+	id, err := h.StoreData(ctx, models.Record{TypeRecord: models.Text, Data: []byte("v1"), Meta: "m1"})
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+	record, err := h.RetrieveData(ctx, id)
+	if err != nil || string(record.Data) != "v1" || record.Meta != "m1" || record.TypeRecord != models.Text || record.Version != 1 {
+		t.Fatalf("RetrieveData = %+v, %v; want stored record in version 1", record, err)
+	}
+
+	version, err := h.UpdateData(ctx, "m2", id, []byte("v2"), record.Version)
+	if err != nil || version != 2 {
+		t.Fatalf("UpdateData = %d, %v; want version 2", version, err)
+	}
+	records, _, err := h.ListData(ctx, models.ListFilter{})
+	if err != nil || len(records) != 1 || string(records[0].Data) != "v2" || records[0].Meta != "m2" {
+		t.Fatalf("ListData = %+v, %v; want one updated record", records, err)
+	}
+
+	if err := h.DeleteData(ctx, id, version); err != nil {
+		t.Fatalf("DeleteData: %v", err)
+	}
+	if _, err := h.RetrieveData(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("RetrieveData after delete = %v; want ErrNotFound", err)
+	}
+	trash, err := h.ListTrash(ctx)
+	if err != nil || len(trash) != 1 || trash[0].Id != id || trash[0].Meta != "m2" || trash[0].Data != nil {
+		t.Fatalf("ListTrash = %+v, %v; want the record without data", trash, err)
+	}
+}
+
+func TestRecordAccessErrors(t *testing.T) {
+	h := newTestHandler(t)
+	owner := register(t, h, "owner")
+	other := register(t, h, "other")
+	id, err := h.StoreData(owner, models.Record{TypeRecord: models.Text, Data: []byte("secret")})
+	if err != nil {
+		t.Fatalf("StoreData: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		id   string
+		want error
+	}{
+		{"no session", context.Background(), id, models.ErrUnauthenticated},
+		{"other user", other, id, models.ErrAccessDenied},
+		{"malformed id", owner, "not-a-uuid", models.ErrNotFound},
+		{"unknown id", owner, uuid.NewString(), models.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := h.RetrieveData(tt.ctx, tt.id); !errors.Is(err, tt.want) {
+			t.Errorf("RetrieveData(%s) = %v; want %v", tt.name, err, tt.want)
+		}
+		if _, err := h.UpdateData(tt.ctx, "meta", tt.id, []byte("data"), 1); !errors.Is(err, tt.want) {
+			t.Errorf("UpdateData(%s) = %v; want %v", tt.name, err, tt.want)
+		}
+		if err := h.DeleteData(tt.ctx, tt.id, 1); !errors.Is(err, tt.want) {
+			t.Errorf("DeleteData(%s) = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := h.StoreData(context.Background(), models.Record{TypeRecord: models.Text}); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("StoreData without a session = %v; want ErrUnauthenticated", err)
+	}
+	if records, _, err := h.ListData(other, models.ListFilter{}); err != nil || len(records) != 0 {
+		t.Errorf("ListData of other user = %+v, %v; want no records", records, err)
+	}
+}
+
+func TestVersionConflicts(t *testing.T) {
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	handlers := map[string]Handler{
+		"inline": newTestHandler(t),
+		"blobs":  NewHandler(storage.NewMemoryDB(config.Config{}), blobs, nil, testKeys(t), config.Config{}),
+	}
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			ctx := register(t, h, "user")
+			id, err := h.StoreData(ctx, models.Record{TypeRecord: models.Binary, Data: []byte("v1")})
+			if err != nil {
+				t.Fatalf("StoreData: %v", err)
+			}
+
+			if _, err := h.UpdateData(ctx, "", id, []byte("v2"), 0); !errors.Is(err, models.ErrInvalidArgument) {
+				t.Errorf("UpdateData without version = %v; want ErrInvalidArgument", err)
+			}
+			if version, err := h.UpdateData(ctx, "", id, []byte("v2"), 1); err != nil || version != 2 {
+				t.Fatalf("UpdateData = %d, %v; want version 2", version, err)
+			}
+			// второй клиент все еще видит версию 1
+			if _, err := h.UpdateData(ctx, "", id, []byte("stale"), 1); !errors.Is(err, models.ErrVersionMismatch) {
+				t.Errorf("UpdateData with stale version = %v; want ErrVersionMismatch", err)
+			}
+			if err := h.DeleteData(ctx, id, 1); !errors.Is(err, models.ErrVersionMismatch) {
+				t.Errorf("DeleteData with stale version = %v; want ErrVersionMismatch", err)
+			}
+			if err := h.DeleteData(ctx, id, 0); !errors.Is(err, models.ErrInvalidArgument) {
+				t.Errorf("DeleteData without version = %v; want ErrInvalidArgument", err)
+			}
+
+			record, err := h.RetrieveData(ctx, id)
+			if err != nil || string(record.Data) != "v2" || record.Version != 2 {
+				t.Fatalf("RetrieveData = %+v, %v; want v2 in version 2", record, err)
+			}
+			if err := h.DeleteData(ctx, id, 2); err != nil {
+				t.Fatalf("DeleteData: %v", err)
+			}
+		})
+	}
+}
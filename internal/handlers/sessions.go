@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/middleware/auth"
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// newSession создает сессию пользователя и возвращает access и refresh токены
+func (h *Handler) newSession(ctx context.Context, username string) (string, string, error) {
+	secret, hash, err := auth.NewRefreshSecret()
+	if err != nil {
+		return "", "", err
+	}
+	session := models.Session{
+		Username:    username,
+		RefreshHash: hash,
+		ExpiresAt:   time.Now().Add(config.TokenSetting.RefreshExp),
+	}
+	id, err := h.storage.CreateSession(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+	access, err := h.keys.BuildJWTString(username, id)
+	if err != nil {
+		return "", "", err
+	}
+	return access, auth.BuildRefreshToken(id, secret), nil
+}
+
+// RefreshToken обменивает refresh-токен на новую пару токенов той же сессии.
+// Refresh-токен одноразовый: повторное предъявление уже замененного токена
+// означает, что его украли, поэтому сессия завершается
+func (h *Handler) RefreshToken(ctx context.Context, refresh string) (string, string, error) {
+	id, secret, err := auth.ParseRefreshToken(refresh)
+	if err != nil {
+		return "", "", models.ErrUnauthenticated
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "", "", models.ErrUnauthenticated
+	}
+
+	session, err := h.storage.GetSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return "", "", models.ErrUnauthenticated
+		}
+		return "", "", err
+	}
+	hash := auth.RefreshHash(secret)
+	if subtle.ConstantTimeCompare(hash, session.RefreshHash) != 1 || !session.ExpiresAt.After(time.Now()) {
+		if err := h.storage.DeleteSession(ctx, id); err != nil {
+			return "", "", err
+		}
+		h.hub.notify(session.Username)
+		return "", "", models.ErrUnauthenticated
+	}
+
+	newSecret, newHash, err := auth.NewRefreshSecret()
+	if err != nil {
+		return "", "", err
+	}
+	err = h.storage.RotateSession(ctx, id, hash, newHash, time.Now().Add(config.TokenSetting.RefreshExp))
+	if err != nil {
+		// токен успели обменять параллельным запросом или сессию завершили
+		if errors.Is(err, models.ErrConflict) || errors.Is(err, models.ErrNotFound) {
+			return "", "", models.ErrUnauthenticated
+		}
+		return "", "", err
+	}
+	access, err := h.keys.BuildJWTString(session.Username, id)
+	if err != nil {
+		return "", "", err
+	}
+	return access, auth.BuildRefreshToken(id, newSecret), nil
+}
+
+// Logout завершает сессию, от имени которой выполнен запрос. Открытые потоки
+// изменений этой сессии закрываются
+func (h *Handler) Logout(ctx context.Context) error {
+	session, err := h.session(ctx)
+	if err != nil {
+		return models.ErrUnauthenticated
+	}
+	if err := h.storage.DeleteSession(ctx, session.ID); err != nil {
+		return err
+	}
+	h.hub.notify(session.Username)
+	return nil
+}
+
+// PurgeExpiredSessions удаляет сессии с истекшим refresh-токеном
+func (h *Handler) PurgeExpiredSessions(ctx context.Context) (int, error) {
+	return h.storage.PurgeExpiredSessions(ctx, time.Now())
+}
+
+// PublicKeys возвращает открытые ключи проверки подписи токенов и id
+// активного ключа
+func (h *Handler) PublicKeys() ([]auth.PublicKey, string, error) {
+	keys, err := h.keys.PublicKeys()
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, h.keys.Primary(), nil
+}
+
+// Authenticate проверяет подпись и срок access-токена и то, что его сессия не
+// завершена. Используется интерцептором авторизации
+func (h *Handler) Authenticate(ctx context.Context, token string) (auth.Identity, error) {
+	claims, err := h.keys.CheckToken(token)
+	if err != nil {
+		return auth.Identity{}, models.ErrUnauthenticated
+	}
+	identity := auth.Identity{Username: claims.Username, Session: claims.Session}
+	if claims.ExpiresAt != nil {
+		identity.ExpiresAt = claims.ExpiresAt.Time
+	}
+	if _, err := h.session(auth.NewContext(ctx, identity)); err != nil {
+		return auth.Identity{}, err
+	}
+	return identity, nil
+}
+
+// session возвращает сессию, от имени которой выполняется запрос, если она не
+// завершена и ее access-токен не истек
+func (h *Handler) session(ctx context.Context) (models.Session, error) {
+	identity, ok := auth.FromContext(ctx)
+	if !ok || !identity.ExpiresAt.After(time.Now()) {
+		return models.Session{}, models.ErrUnauthenticated
+	}
+	if _, err := uuid.Parse(identity.Session); err != nil {
+		return models.Session{}, models.ErrUnauthenticated
+	}
+	session, err := h.storage.GetSession(ctx, identity.Session)
+	if errors.Is(err, models.ErrNotFound) {
+		return models.Session{}, models.ErrUnauthenticated
+	}
+	if err != nil {
+		return models.Session{}, err
+	}
+	if session.Username != identity.Username || !session.ExpiresAt.After(time.Now()) {
+		return models.Session{}, models.ErrUnauthenticated
+	}
+	return session, nil
+}
+
+// user возвращает логин пользователя, от имени которого выполняется запрос
+func (h *Handler) user(ctx context.Context) (string, error) {
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return "", models.ErrUnauthenticated
+	}
+	return identity.Username, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// login входит в аккаунт и возвращает access и refresh токены новой сессии
+func login(t *testing.T, h Handler, username string) (string, string) {
+	t.Helper()
+	access, refresh, err := h.Login(context.Background(), username, "password")
+	if err != nil {
+		t.Fatalf("Login(%s): %v", username, err)
+	}
+	return access, refresh
+}
+
+func TestRefreshToken(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	register(t, h, "user")
+	access, refresh := login(t, h, "user")
+
+	newAccess, newRefresh, err := h.RefreshToken(ctx, refresh)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if newRefresh == refresh {
+		t.Fatalf("RefreshToken returned the same refresh token")
+	}
+	for name, token := range map[string]string{"old": access, "new": newAccess} {
+		if _, err := h.Authenticate(ctx, token); err != nil {
+			t.Errorf("Authenticate with the %s access token: %v", name, err)
+		}
+	}
+
+	for _, bad := range []string{"", "not a token", "00000000-0000-0000-0000-000000000000.secret"} {
+		if _, _, err := h.RefreshToken(ctx, bad); !errors.Is(err, models.ErrUnauthenticated) {
+			t.Errorf("RefreshToken(%q) = %v; want ErrUnauthenticated", bad, err)
+		}
+	}
+
+	next, _, err := h.RefreshToken(ctx, newRefresh)
+	if err != nil {
+		t.Fatalf("RefreshToken with the rotated token: %v", err)
+	}
+	if _, err := h.GetUsage(authorize(t, h, next)); err != nil {
+		t.Errorf("GetUsage after second rotation: %v", err)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	other := register(t, h, "user")
+	access, refresh := login(t, h, "user")
+	rotated, rotatedRefresh, err := h.RefreshToken(ctx, refresh)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// уже замененный refresh-токен предъявил тот, кто его украл: сессия
+	// завершается целиком, и новая пара токенов тоже перестает действовать
+	if _, _, err := h.RefreshToken(ctx, refresh); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Fatalf("RefreshToken with a reused token = %v; want ErrUnauthenticated", err)
+	}
+	for name, token := range map[string]string{"old": access, "rotated": rotated} {
+		if _, err := h.Authenticate(ctx, token); !errors.Is(err, models.ErrUnauthenticated) {
+			t.Errorf("Authenticate with the %s access token after reuse = %v; want ErrUnauthenticated", name, err)
+		}
+	}
+	if _, _, err := h.RefreshToken(ctx, rotatedRefresh); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("RefreshToken with the rotated token after reuse = %v; want ErrUnauthenticated", err)
+	}
+	// остальные сессии пользователя не затронуты
+	if _, err := h.GetUsage(other); err != nil {
+		t.Errorf("GetUsage in another session: %v", err)
+	}
+}
+
+func TestRefreshTokenConcurrent(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	register(t, h, "user")
+	_, refresh := login(t, h, "user")
+
+	const n = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := h.RefreshToken(ctx, refresh); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded > 1 {
+		t.Errorf("refresh token exchanged %d times; want at most once", succeeded)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	other := register(t, h, "user")
+	access, refresh := login(t, h, "user")
+	session := authorize(t, h, access)
+
+	if err := h.Logout(session); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := h.Authenticate(ctx, access); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Authenticate after Logout = %v; want ErrUnauthenticated", err)
+	}
+	if _, _, err := h.RefreshToken(ctx, refresh); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("RefreshToken after Logout = %v; want ErrUnauthenticated", err)
+	}
+	if err := h.Logout(session); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("second Logout = %v; want ErrUnauthenticated", err)
+	}
+	if err := h.Logout(ctx); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("Logout without a session = %v; want ErrUnauthenticated", err)
+	}
+	if _, err := h.GetUsage(other); err != nil {
+		t.Errorf("GetUsage in another session: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// Параметры второго фактора: название сервиса в приложении-аутентификаторе,
+// период кода TOTP, число кодов восстановления и их длина в символах
+const (
+	totpIssuer         = "GophKeeper"
+	totpPeriod         = 30
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// После maxTOTPAttempts неверных кодов подряд следующий код принимается не
+// раньше, чем через totpLockout после последней попытки
+const (
+	maxTOTPAttempts = 5
+	totpLockout     = 5 * time.Minute
+)
+
+// recoveryEncoding алфавит кодов восстановления без похожих друг на друга символов
+var recoveryEncoding = base32.NewEncoding("abcdefghjkmnpqrstuvwxyz023456789").WithPadding(base32.NoPadding)
+
+// GetTOTPStatus возвращает, включен ли второй фактор, и сколько кодов
+// восстановления осталось
+func (h *Handler) GetTOTPStatus(ctx context.Context) (bool, int, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return false, 0, models.ErrUnauthenticated
+	}
+	second, err := h.storage.GetTOTP(ctx, username)
+	if errors.Is(err, models.ErrNotFound) {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return second.Enabled, second.RecoveryLeft, nil
+}
+
+// EnrollTOTP создает секрет TOTP и возвращает его вместе со ссылкой otpauth://
+// для приложения-аутентификатора. Второй фактор включается только после
+// ConfirmTOTP, поэтому повторный вызов заменяет неподтвержденный секрет
+func (h *Handler) EnrollTOTP(ctx context.Context) (string, string, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return "", "", models.ErrUnauthenticated
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: username, Period: totpPeriod})
+	if err != nil {
+		return "", "", err
+	}
+	if err := h.storage.SetTOTPSecret(ctx, username, key.Secret()); err != nil {
+		return "", "", err
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ConfirmTOTP включает второй фактор, если code подходит к секрету из
+// EnrollTOTP, и возвращает одноразовые коды восстановления. Сервер хранит
+// только их хеши, поэтому показать коды повторно нельзя
+func (h *Handler) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	username, err := h.user(ctx)
+	if err != nil {
+		return nil, models.ErrUnauthenticated
+	}
+	second, err := h.storage.GetTOTP(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if second.Enabled {
+		return nil, models.ErrConflict
+	}
+	step, ok := matchTOTP(second.Secret, code, time.Now())
+	if !ok {
+		return nil, models.ErrInvalidArgument
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength*5/8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := recoveryEncoding.EncodeToString(raw)
+		codes[i] = encoded[:recoveryCodeLength/2] + "-" + encoded[recoveryCodeLength/2:]
+		hashes[i] = recoveryHash(encoded)
+	}
+	if err := h.storage.EnableTOTP(ctx, username, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP отключает второй фактор, если code подходит: это код TOTP или
+// код восстановления
+func (h *Handler) DisableTOTP(ctx context.Context, code string) error {
+	username, err := h.user(ctx)
+	if err != nil {
+		return models.ErrUnauthenticated
+	}
+	if err := h.checkSecondFactor(ctx, username, code); err != nil {
+		return err
+	}
+	return h.storage.DeleteTOTP(ctx, username)
+}
+
+// LoginTOTP завершает вход пользователя со вторым фактором: проверяет билет,
+// выданный Login после проверки пароля, и code, и создает сессию
+func (h *Handler) LoginTOTP(ctx context.Context, ticket, code string) (string, string, error) {
+	username, err := h.keys.CheckTicket(ticket)
+	if err != nil {
+		return "", "", models.ErrUnauthenticated
+	}
+	err = h.checkSecondFactor(ctx, username, code)
+	// второй фактор успели отключить, пароль подтвержден билетом
+	if errors.Is(err, models.ErrNotFound) {
+		return h.newSession(ctx, username)
+	}
+	if errors.Is(err, models.ErrInvalidArgument) {
+		return "", "", models.ErrUnauthenticated
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return h.newSession(ctx, username)
+}
+
+// secondFactor возвращает билет второго шага входа, если у пользователя
+// включен второй фактор
+func (h *Handler) secondFactor(ctx context.Context, username string) error {
+	second, err := h.storage.GetTOTP(ctx, username)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !second.Enabled {
+		return nil
+	}
+	ticket, err := h.keys.BuildTicket(username)
+	if err != nil {
+		return err
+	}
+	return &models.SecondFactorError{Ticket: ticket}
+}
+
+// checkSecondFactor принимает код TOTP или код восстановления включенного
+// второго фактора. Код TOTP принимается один раз, код восстановления
+// удаляется. Для неверного кода возвращается ErrInvalidArgument, после
+// maxTOTPAttempts неверных кодов подряд ErrTooManyAttempts, а если второй
+// фактор не включен, ErrNotFound. Попытка учитывается в хранилище до проверки
+// кода, поэтому одновременные запросы не обходят ограничение
+func (h *Handler) checkSecondFactor(ctx context.Context, username, code string) error {
+	second, err := h.storage.GetTOTP(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !second.Enabled {
+		return models.ErrNotFound
+	}
+	now := time.Now()
+	attempts, err := h.storage.AddTOTPAttempt(ctx, username, now, now.Add(-totpLockout))
+	if err != nil {
+		return err
+	}
+	if attempts > maxTOTPAttempts {
+		return models.ErrTooManyAttempts
+	}
+
+	if step, ok := matchTOTP(second.Secret, code, now); ok {
+		err = h.storage.UseTOTPStep(ctx, username, step)
+		if errors.Is(err, models.ErrConflict) {
+			err = models.ErrInvalidArgument
+		}
+	} else {
+		err = h.storage.UseRecoveryCode(ctx, username, recoveryHash(normalizeRecoveryCode(code)))
+		if errors.Is(err, models.ErrNotFound) {
+			err = models.ErrInvalidArgument
+		}
+	}
+	return err
+}
+
+// matchTOTP ищет code среди кодов TOTP соседних с now шагов, чтобы
+// учесть расхождение часов, и возвращает шаг подошедшего кода
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	for _, skew := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCode(secret, at)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeRecoveryCode убирает из кода восстановления разделители и
+// приводит его к нижнему регистру
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// recoveryHash хеш кода восстановления, который хранится на сервере
+func recoveryHash(code string) []byte {
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
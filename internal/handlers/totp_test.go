@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+func TestMatchTOTP(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / totpPeriod
+	code := func(at time.Time) string {
+		t.Helper()
+		c, err := totp.GenerateCode(secret, at)
+		if err != nil {
+			t.Fatalf("GenerateCode: %v", err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(now), step, true},
+		{"previous step", code(now.Add(-totpPeriod * time.Second)), step - 1, true},
+		{"next step with spaces", " " + code(now.Add(totpPeriod*time.Second)) + " ", step + 1, true},
+		{"two steps ahead", code(now.Add(2 * totpPeriod * time.Second)), 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := matchTOTP(secret, tt.code, now)
+		if ok != tt.wantOK || got != tt.wantStep {
+			t.Errorf("matchTOTP(%s) = %d, %v; want %d, %v", tt.name, got, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+	if _, ok := matchTOTP("not base32!", code(now), now); ok {
+		t.Errorf("matchTOTP with invalid secret succeeded")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := map[string]string{
+		"abcde-fghjk":   "abcdefghjk",
+		" ABCDE FGHJK ": "abcdefghjk",
+		"abcdefghjk":    "abcdefghjk",
+	}
+	for code, want := range tests {
+		if got := normalizeRecoveryCode(code); got != want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+// enableTOTP включает пользователю второй фактор и возвращает секрет и коды
+// восстановления
+func enableTOTP(t *testing.T, h Handler, ctx context.Context) (string, []string) {
+	t.Helper()
+	secret, url, err := h.EnrollTOTP(ctx)
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+	if !strings.HasPrefix(url, "otpauth://totp/") || !strings.Contains(url, secret) {
+		t.Fatalf("EnrollTOTP url = %q; want otpauth://totp link with the secret", url)
+	}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	if _, err := h.ConfirmTOTP(ctx, "000000"+code); !errors.Is(err, models.ErrInvalidArgument) {
+		t.Fatalf("ConfirmTOTP with wrong code = %v; want ErrInvalidArgument", err)
+	}
+	recovery, err := h.ConfirmTOTP(ctx, code)
+	if err != nil || len(recovery) != recoveryCodeCount {
+		t.Fatalf("ConfirmTOTP = %d codes, %v; want %d", len(recovery), err, recoveryCodeCount)
+	}
+	return secret, recovery
+}
+
+// loginTicket входит паролем пользователя со вторым фактором и возвращает
+// билет для LoginTOTP
+func loginTicket(t *testing.T, h Handler, username string) string {
+	t.Helper()
+	_, _, err := h.Login(context.Background(), username, "password")
+	var second *models.SecondFactorError
+	if !errors.As(err, &second) {
+		t.Fatalf("Login = %v; want SecondFactorError", err)
+	}
+	return second.Ticket
+}
+
+func TestSecondFactor(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	userCtx := register(t, h, "user")
+	secret, recovery := enableTOTP(t, h, userCtx)
+	if enabled, left, err := h.GetTOTPStatus(userCtx); err != nil || !enabled || left != recoveryCodeCount {
+		t.Fatalf("GetTOTPStatus = %v, %d, %v; want enabled with %d codes", enabled, left, err, recoveryCodeCount)
+	}
+	now := time.Now()
+	codeAt := func(at time.Time) string {
+		t.Helper()
+		c, err := totp.GenerateCode(secret, at)
+		if err != nil {
+			t.Fatalf("GenerateCode: %v", err)
+		}
+		return c
+	}
+
+	// код шага, уже принятого при подтверждении, повторно не принимается
+	if _, _, err := h.LoginTOTP(ctx, loginTicket(t, h, "user"), codeAt(now)); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("LoginTOTP with used code = %v; want ErrUnauthenticated", err)
+	}
+	next := codeAt(now.Add(totpPeriod * time.Second))
+	token, _, err := h.LoginTOTP(ctx, loginTicket(t, h, "user"), next)
+	if err != nil {
+		t.Fatalf("LoginTOTP with next code = %v; want success", err)
+	}
+	if identity, err := h.Authenticate(ctx, token); err != nil || identity.Username != "user" {
+		t.Errorf("Authenticate(LoginTOTP token) = %q, %v; want user", identity.Username, err)
+	}
+	if _, _, err := h.LoginTOTP(ctx, "not a ticket", next); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("LoginTOTP with invalid ticket = %v; want ErrUnauthenticated", err)
+	}
+
+	// код восстановления принимается без учета регистра и разделителей один раз
+	code := strings.ToUpper(strings.ReplaceAll(recovery[0], "-", " "))
+	if _, _, err := h.LoginTOTP(ctx, loginTicket(t, h, "user"), code); err != nil {
+		t.Errorf("LoginTOTP with recovery code = %v; want success", err)
+	}
+	if _, _, err := h.LoginTOTP(ctx, loginTicket(t, h, "user"), recovery[0]); !errors.Is(err, models.ErrUnauthenticated) {
+		t.Errorf("LoginTOTP with used recovery code = %v; want ErrUnauthenticated", err)
+	}
+	if _, left, _ := h.GetTOTPStatus(userCtx); left != recoveryCodeCount-1 {
+		t.Errorf("GetTOTPStatus recovery codes = %d; want %d", left, recoveryCodeCount-1)
+	}
+
+	// после серии неверных кодов не принимается и верный. Первой ошибкой
+	// серии считается повторный код восстановления выше
+	for range maxTOTPAttempts - 1 {
+		if _, _, err := h.LoginTOTP(ctx, loginTicket(t, h, "user"), "000000"); !errors.Is(err, models.ErrUnauthenticated) {
+			t.Fatalf("LoginTOTP with wrong code = %v; want ErrUnauthenticated", err)
+		}
+	}
+	if _, _, err := h.LoginTOTP(ctx, loginTicket(t, h, "user"), recovery[1]); !errors.Is(err, models.ErrTooManyAttempts) {
+		t.Errorf("LoginTOTP after %d failures = %v; want ErrTooManyAttempts", maxTOTPAttempts, err)
+	}
+	if err := h.DisableTOTP(userCtx, recovery[1]); !errors.Is(err, models.ErrTooManyAttempts) {
+		t.Errorf("DisableTOTP during lockout = %v; want ErrTooManyAttempts", err)
+	}
+}
+
+func TestSecondFactorConcurrentGuesses(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	enableTOTP(t, h, register(t, h, "user"))
+	ticket := loginTicket(t, h, "user")
+
+	const n = 4 * maxTOTPAttempts
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	checked := 0
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := h.LoginTOTP(ctx, ticket, "000000")
+			if !errors.Is(err, models.ErrTooManyAttempts) {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if checked > maxTOTPAttempts {
+		t.Errorf("%d concurrent codes checked; want at most %d", checked, maxTOTPAttempts)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// watchPollInterval как часто поток изменений сам проверяет хранилище. Об
+// изменениях через этот сервер подписчики узнают сразу, а проверка нужна для
+// изменений через другие экземпляры сервера и очистки корзины
+const watchPollInterval = 5 * time.Second
+
+// changeHub будит потоки изменений пользователя, когда его записи меняются
+type changeHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{subs: make(map[string]map[chan struct{}]struct{}), done: make(chan struct{})}
+}
+
+// subscribe возвращает канал, в который приходит сигнал после изменений
+// записей пользователя, и функцию отписки
+func (c *changeHub) subscribe(username string) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	c.mu.Lock()
+	if c.subs[username] == nil {
+		c.subs[username] = make(map[chan struct{}]struct{})
+	}
+	c.subs[username][wake] = struct{}{}
+	c.mu.Unlock()
+
+	return wake, func() {
+		c.mu.Lock()
+		delete(c.subs[username], wake)
+		if len(c.subs[username]) == 0 {
+			delete(c.subs, username)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// notify будит подписчиков пользователя. Сигналы не копятся: подписчик,
+// который еще не забрал прошлый, все равно перечитает все изменения
+func (c *changeHub) notify(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for wake := range c.subs[username] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// StopWatching завершает все открытые потоки изменений. Вызывается перед
+// остановкой сервера, иначе он будет ждать их бесконечно
+func (h *Handler) StopWatching() {
+	h.hub.once.Do(func() { close(h.hub.done) })
+}
+
+// WatchChanges отправляет через send изменения записей пользователя после
+// ревизии since по мере их появления. Отрицательный since означает текущую
+// ревизию. Первым отправляется пустой список с ревизией, с которой начато
+// наблюдение, чтобы при переподключении клиент продолжил без пропусков
+func (h *Handler) WatchChanges(ctx context.Context, since int64, send func(changes []models.Change, revision int64) error) error {
+	username, err := h.user(ctx)
+	if err != nil {
+		return models.ErrUnauthenticated
+	}
+
+	// подписываемся до чтения ревизии, чтобы не пропустить изменения между ними
+	wake, unsubscribe := h.hub.subscribe(username)
+	defer unsubscribe()
+
+	// ошибки после отключения клиента ожидаемы и не сообщаются
+	stopped := func(err error) error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	if since < 0 {
+		since, err = h.storage.GetLastChange(ctx, username)
+		if err != nil {
+			return stopped(err)
+		}
+	}
+	if err := send(nil, since); err != nil {
+		return stopped(err)
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		for more := true; more; {
+			var changes []models.Change
+			changes, since, more, err = h.changes(ctx, username, since, DefaultPageSize)
+			if err != nil {
+				return stopped(err)
+			}
+			if len(changes) == 0 {
+				break
+			}
+			if err := send(changes, since); err != nil {
+				return stopped(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.hub.done:
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+		// токен мог истечь, а сессия завершиться выходом или сменой пароля
+		if _, err := h.session(ctx); err != nil {
+			return stopped(models.ErrUnauthenticated)
+		}
+	}
+}
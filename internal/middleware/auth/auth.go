@@ -1,50 +1,111 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/sinfirst/GophKeeper/internal/config"
 )
 
+// refreshSecretSize размер случайной части refresh-токена
+const refreshSecretSize = 32
+
+// ticketAudience назначение билета второго шага входа. Access-токены выдаются
+// без назначения, поэтому билет нельзя использовать вместо них и наоборот
+const ticketAudience = "second-factor"
+
+// Claims содержимое access-токена. Session id сессии, по которому сервер
+// проверяет, что сессия не завершена
 type Claims struct {
 	jwt.RegisteredClaims
 	Username string
+	Session  string
 }
 
-func BuildJWTString(user string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+// BuildJWTString выдает access-токен сессии, подписанный активным ключом
+func (k *Keyring) BuildJWTString(user, session string) (string, error) {
+	return k.sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.TokenSetting.TokenExp)),
 		},
 		Username: user,
+		Session:  session,
 	})
+}
 
-	tokenString, err := token.SignedString([]byte(config.TokenSetting.SecretKey))
-
+// CheckToken проверяет подпись и срок access-токена
+func (k *Keyring) CheckToken(tokenFromReq string) (Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenFromReq, claims, k.verificationKey)
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
 
-	return tokenString, nil
+	if !token.Valid || len(claims.Audience) > 0 {
+		return Claims{}, fmt.Errorf("invalid token")
+	}
+	return *claims, nil
+}
+
+// BuildTicket выдает билет, которым пользователь после проверки пароля
+// подтверждает вход кодом второго фактора
+func (k *Keyring) BuildTicket(user string) (string, error) {
+	return k.sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{ticketAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.TokenSetting.TicketExp)),
+		},
+		Username: user,
+	})
 }
 
-func CheckToken(tokenFromReq string) (string, error) {
+// CheckTicket проверяет билет второго шага входа и возвращает логин
+// пользователя
+func (k *Keyring) CheckTicket(ticket string) (string, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenFromReq, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return []byte(config.TokenSetting.SecretKey), nil
-		})
+	token, err := jwt.ParseWithClaims(ticket, claims, k.verificationKey)
 	if err != nil {
 		return "", err
 	}
 
-	if !token.Valid {
-		return "", err
+	if !token.Valid || !claims.VerifyAudience(ticketAudience, true) || claims.Username == "" {
+		return "", fmt.Errorf("invalid ticket")
 	}
 	return claims.Username, nil
 }
+
+// NewRefreshSecret создает случайную часть refresh-токена и ее хеш, который
+// хранится в сессии
+func NewRefreshSecret() (string, []byte, error) {
+	secret := make([]byte, refreshSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return encoded, RefreshHash(encoded), nil
+}
+
+// RefreshHash хеш случайной части refresh-токена
+func RefreshHash(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// BuildRefreshToken собирает refresh-токен из id сессии и случайной части
+func BuildRefreshToken(session, secret string) string {
+	return session + "." + secret
+}
+
+// ParseRefreshToken разбирает refresh-токен на id сессии и случайную часть
+func ParseRefreshToken(token string) (string, string, error) {
+	session, secret, ok := strings.Cut(token, ".")
+	if !ok || session == "" || secret == "" {
+		return "", "", fmt.Errorf("invalid refresh token")
+	}
+	return session, secret, nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+	pb "github.com/sinfirst/GophKeeper/proto/gophkeeper"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ключ метаданных с токеном доступа и схема его значения
+const (
+	MetadataKey  = "authorization"
+	BearerScheme = "Bearer"
+)
+
+// Причина в ErrorInfo отказа Login, когда нужен код второго фактора, и ключ
+// билета для LoginTOTP в ее метаданных
+const (
+	SecondFactorReason = "SECOND_FACTOR_REQUIRED"
+	TicketKey          = "ticket"
+)
+
+// publicMethods методы, которые вызываются без токена доступа
+var publicMethods = map[string]bool{
+	pb.GophKeeper_Register_FullMethodName:       true,
+	pb.GophKeeper_Login_FullMethodName:          true,
+	pb.GophKeeper_LoginTOTP_FullMethodName:      true,
+	pb.GophKeeper_RefreshToken_FullMethodName:   true,
+	pb.GophKeeper_GetVersion_FullMethodName:     true,
+	pb.GophKeeper_GetKDFParams_FullMethodName:   true,
+	pb.GophKeeper_MigrateAccount_FullMethodName: true,
+	pb.GophKeeper_GetPublicKeys_FullMethodName:  true,
+}
+
+// Identity пользователь и сессия, от имени которых выполняется запрос
+type Identity struct {
+	Username  string
+	Session   string
+	ExpiresAt time.Time
+}
+
+// Authenticator проверяет токен доступа. Для недействительного токена
+// возвращает ErrUnauthenticated
+type Authenticator func(ctx context.Context, token string) (Identity, error)
+
+type identityKey struct{}
+
+// NewContext возвращает контекст с пользователем запроса
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext возвращает пользователя запроса, проверенного интерцептором
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// UnaryInterceptor проверяет токен из метаданных authorization и кладет
+// пользователя в контекст запроса
+func UnaryInterceptor(authenticate Authenticator, logger zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := authorize(ctx, authenticate, logger)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor проверяет токен потокового вызова так же, как UnaryInterceptor
+func StreamInterceptor(authenticate Authenticator, logger zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if publicMethods[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		ctx, err := authorize(ss.Context(), authenticate, logger)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// identityStream поток с контекстом, в котором есть пользователь запроса
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+func authorize(ctx context.Context, authenticate Authenticator, logger zap.SugaredLogger) (context.Context, error) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	identity, err := authenticate(ctx, token)
+	if errors.Is(err, models.ErrUnauthenticated) {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	if err != nil {
+		logger.Errorw("Problem with authentication: ", err)
+		return nil, status.Error(codes.Internal, "Server problem")
+	}
+	return NewContext(ctx, identity), nil
+}
+
+// bearerToken достает токен из метаданных вида authorization: Bearer <token>
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	values := md.Get(MetadataKey)
+	if len(values) != 1 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, BearerScheme) || token == "" {
+		return "", false
+	}
+	return token, true
+}
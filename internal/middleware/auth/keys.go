@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Алгоритмы подписи токенов
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+// Размер создаваемого ключа RSA и минимальный размер ключа RSA в файле
+const (
+	rsaKeyBits    = 3072
+	minRSAKeyBits = 2048
+)
+
+// signingKey ключ подписи токенов. У ключа, оставленного только для проверки
+// токенов, выданных до ротации, private равен nil
+type signingKey struct {
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// PublicKey открытый ключ проверки подписи токенов. Key в DER (PKIX)
+type PublicKey struct {
+	ID        string
+	Algorithm string
+	Key       []byte
+}
+
+// Keyring набор ключей подписи токенов. Первый ключ в файле активный: им
+// подписываются новые токены. Остальные нужны, чтобы принимать токены,
+// выданные до ротации, пока они не истекут.
+//
+// Файл содержит ключи в PEM: закрытые PKCS#8 (PRIVATE KEY) или PKCS#1 (RSA
+// PRIVATE KEY), а кроме первого и открытые PKIX (PUBLIC KEY). Поддерживаются
+// Ed25519 (EdDSA) и RSA (RS256). Id ключа (kid) отпечаток открытого ключа по
+// RFC 7638, поэтому он одинаков на всех серверах с этим ключом.
+type Keyring struct {
+	mu      sync.RWMutex
+	path    string
+	primary string
+	order   []string
+	keys    map[string]signingKey
+}
+
+// LoadKeyring читает ключи подписи токенов из файла. Если файла нет, в нем
+// создается новый ключ алгоритма alg
+func LoadKeyring(path, alg string) (*Keyring, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := generateKeyFile(path, alg); err != nil {
+			return nil, err
+		}
+	}
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload перечитывает файл ключей. Используется при ротации, чтобы сервер
+// начал подписывать токены новым ключом без перезапуска
+func (k *Keyring) Reload() error {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var primary string
+	var order []string
+	keys := make(map[string]signingKey)
+	for number := 1; ; number++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := parseKey(block)
+		if err != nil {
+			return fmt.Errorf("%s: key %d: %w", k.path, number, err)
+		}
+		if primary == "" && key.private == nil {
+			return fmt.Errorf("%s: key %d: active key must be private", k.path, number)
+		}
+		id, err := thumbprint(key.public)
+		if err != nil {
+			return fmt.Errorf("%s: key %d: %w", k.path, number, err)
+		}
+		if _, ok := keys[id]; ok {
+			return fmt.Errorf("%s: key %d: duplicate key %q", k.path, number, id)
+		}
+
+		keys[id] = key
+		order = append(order, id)
+		if primary == "" {
+			primary = id
+		}
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		return fmt.Errorf("%s: unexpected data after PEM blocks", k.path)
+	}
+	if primary == "" {
+		return fmt.Errorf("%s: no signing keys", k.path)
+	}
+
+	k.mu.Lock()
+	k.primary, k.order, k.keys = primary, order, keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Primary возвращает id активного ключа
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+// PublicKeys возвращает открытые ключи всех ключей набора, активный первым
+func (k *Keyring) PublicKeys() ([]PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	result := make([]PublicKey, 0, len(k.order))
+	for _, id := range k.order {
+		key := k.keys[id]
+		der, err := x509.MarshalPKIXPublicKey(key.public)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, PublicKey{ID: id, Algorithm: key.method.Alg(), Key: der})
+	}
+	return result, nil
+}
+
+// sign подписывает claims активным ключом и указывает его id в заголовке kid
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	id, key := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = id
+	return token.SignedString(key.private)
+}
+
+// verificationKey возвращает ключ из заголовка kid токена. Алгоритм токена
+// должен совпадать с алгоритмом ключа
+func (k *Keyring) verificationKey(t *jwt.Token) (interface{}, error) {
+	id, _ := t.Header["kid"].(string)
+	k.mu.RLock()
+	key, ok := k.keys[id]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// parseKey разбирает ключ из блока PEM
+func parseKey(block *pem.Block) (signingKey, error) {
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return signingKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, private: key, public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, public: key}, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return signingKey{}, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return signingKey{method: jwt.SigningMethodRS256, private: key, public: key.Public()}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return signingKey{}, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return signingKey{method: jwt.SigningMethodRS256, public: key}, nil
+	}
+	return signingKey{}, fmt.Errorf("unsupported key type %T, want Ed25519 or RSA", parsed)
+}
+
+// thumbprint отпечаток открытого ключа по RFC 7638: SHA-256 от JWK с
+// обязательными полями в алфавитном порядке
+func thumbprint(public crypto.PublicKey) (string, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	var jwk any
+	switch key := public.(type) {
+	case ed25519.PublicKey:
+		jwk = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{"Ed25519", "OKP", b64(key)}
+	case *rsa.PublicKey:
+		jwk = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{b64(big.NewInt(int64(key.E)).Bytes()), "RSA", b64(key.N.Bytes())}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", public)
+	}
+	encoded, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return b64(sum[:]), nil
+}
+
+// generateKeyFile создает файл с новым закрытым ключом алгоритма alg.
+// Файл доступен только владельцу
+func generateKeyFile(path, alg string) error {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q, want %s or %s", alg, AlgEdDSA, AlgRS256)
+	}
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func decodeB64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("DecodeString(%q): %v", s, err)
+	}
+	return b
+}
+
+func TestThumbprint(t *testing.T) {
+	// примеры из RFC 7638, раздел 3.1, и RFC 8037, приложение A.3
+	rsaN := "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+	tests := []struct {
+		name string
+		key  crypto.PublicKey
+		want string
+	}{
+		{"RSA", &rsa.PublicKey{N: new(big.Int).SetBytes(decodeB64(t, rsaN)), E: 65537}, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		{"Ed25519", ed25519.PublicKey(decodeB64(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")), "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+	}
+	for _, tt := range tests {
+		got, err := thumbprint(tt.key)
+		if err != nil || got != tt.want {
+			t.Errorf("thumbprint(%s) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// pemBlock кодирует закрытый ключ в PKCS#8 или открытый в PKIX
+func pemBlock(t *testing.T, key any) []byte {
+	t.Helper()
+	var block *pem.Block
+	switch key := key.(type) {
+	case crypto.Signer:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+	return pem.EncodeToMemory(block)
+}
+
+func writeFile(t *testing.T, path string, blocks ...[]byte) {
+	t.Helper()
+	var content []byte
+	for _, block := range blocks {
+		content = append(content, block...)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// tokenKid возвращает kid из заголовка токена без проверки подписи
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyringRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "jwt.pem")
+	keys, err := LoadKeyring(path, AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	oldID := keys.Primary()
+	oldToken, err := keys.BuildJWTString("user", "session")
+	if err != nil {
+		t.Fatalf("BuildJWTString: %v", err)
+	}
+	if kid := tokenKid(t, oldToken); kid != oldID {
+		t.Fatalf("token kid = %q, want active key %q", kid, oldID)
+	}
+
+	// новый ключ первым, от старого остается только открытый
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	block, _ := pem.Decode(old)
+	oldKey, err := parseKey(block)
+	if err != nil {
+		t.Fatalf("parseKey: %v", err)
+	}
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	writeFile(t, path, pemBlock(t, newKey), pemBlock(t, oldKey.public))
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if keys.Primary() == oldID {
+		t.Fatalf("Primary after rotation = old key %q", oldID)
+	}
+
+	if claims, err := keys.CheckToken(oldToken); err != nil || claims.Username != "user" || claims.Session != "session" {
+		t.Errorf("CheckToken of token signed before rotation = %+v, %v; want accepted", claims, err)
+	}
+	newToken, err := keys.BuildJWTString("user", "session")
+	if err != nil {
+		t.Fatalf("BuildJWTString: %v", err)
+	}
+	if kid := tokenKid(t, newToken); kid != keys.Primary() {
+		t.Errorf("token kid after rotation = %q, want %q", kid, keys.Primary())
+	}
+
+	public, err := keys.PublicKeys()
+	if err != nil {
+		t.Fatalf("PublicKeys: %v", err)
+	}
+	if len(public) != 2 || public[0].ID != keys.Primary() || public[1].ID != oldID || public[0].Algorithm != AlgEdDSA {
+		t.Errorf("PublicKeys = %+v; want active key first, then old key %q", public, oldID)
+	}
+
+	// после удаления старого ключа выданные им токены не принимаются
+	writeFile(t, path, pemBlock(t, newKey))
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := keys.CheckToken(oldToken); err == nil {
+		t.Errorf("CheckToken of token signed with removed key succeeded, want error")
+	}
+}
+
+func TestTicketAudience(t *testing.T) {
+	keys, err := LoadKeyring(filepath.Join(t.TempDir(), "jwt.pem"), AlgRS256)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	token, err := keys.BuildJWTString("user", "session")
+	if err != nil {
+		t.Fatalf("BuildJWTString: %v", err)
+	}
+	ticket, err := keys.BuildTicket("user")
+	if err != nil {
+		t.Fatalf("BuildTicket: %v", err)
+	}
+
+	if username, err := keys.CheckTicket(ticket); err != nil || username != "user" {
+		t.Errorf("CheckTicket = %q, %v; want user", username, err)
+	}
+	if _, err := keys.CheckTicket(token); err == nil {
+		t.Errorf("CheckTicket accepted access token, want error")
+	}
+	if _, err := keys.CheckToken(ticket); err == nil {
+		t.Errorf("CheckToken accepted ticket, want error")
+	}
+}
+
+func TestCheckTokenRejectsAlgorithmSwitch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	keys, err := LoadKeyring(path, AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	public, err := keys.PublicKeys()
+	if err != nil {
+		t.Fatalf("PublicKeys: %v", err)
+	}
+
+	// токен, подписанный HMAC на открытом ключе, с kid настоящего ключа
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{Username: "admin"})
+	forged.Header["kid"] = public[0].ID
+	signed, err := forged.SignedString(public[0].Key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, err := keys.CheckToken(signed); err == nil {
+		t.Errorf("CheckToken accepted HS256 token, want error")
+	}
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	if _, err := LoadKeyring(filepath.Join(dir, "hs.pem"), "HS256"); err == nil {
+		t.Errorf("LoadKeyring with HS256 succeeded, want error")
+	}
+	tests := map[string][][]byte{
+		"public key first": {pemBlock(t, edKey.Public()), pemBlock(t, edKey)},
+		"duplicate key":    {pemBlock(t, edKey), pemBlock(t, edKey.Public())},
+		"weak RSA key":     {pemBlock(t, weakRSA)},
+		"no keys":          nil,
+		"trailing data":    {pemBlock(t, edKey), []byte("garbage")},
+	}
+	for name, blocks := range tests {
+		path := filepath.Join(dir, "keys.pem")
+		writeFile(t, path, blocks...)
+		if _, err := LoadKeyring(path, AlgEdDSA); err == nil {
+			t.Errorf("LoadKeyring with %s succeeded, want error", name)
+		}
+	}
+}
@@ -54,6 +54,34 @@ func LoggingUnaryInterceptor(logger zap.SugaredLogger) grpc.UnaryServerIntercept
 	}
 }
 
+// LoggingStreamInterceptor возвращает StreamServerInterceptor для логирования потоковых вызовов
+func LoggingStreamInterceptor(logger zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		st, _ := status.FromError(err)
+		responseData := &GrpcResponseData{
+			Status:     st.Message(),
+			StatusCode: int(st.Code()),
+			Duration:   time.Since(start),
+			Method:     info.FullMethod,
+		}
+
+		logger.Infoln(
+			"\n",
+			"-----GRPC STREAM-----\n",
+			"Method:", responseData.Method, "\n",
+			"Status:", responseData.Status, "\n",
+			"Duration:", responseData.Duration, "\n",
+			"Status code:", responseData.StatusCode, "\n",
+		)
+
+		return err
+	}
+}
+
 // NewLogger конструктор для структуры
 func NewLogger() zap.SugaredLogger {
 	logger, err := zap.NewDevelopment()
@@ -1,19 +1,180 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 const (
 	Login  string = "LOGIN"
 	Text   string = "TEXT"
 	Card   string = "CARD"
 	Binary string = "BINARY"
+	OTP    string = "OTP"
+)
+
+// Ошибки уровня хранилища и бизнес-логики, которые gRPC слой переводит в статусы
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrAccessDenied    = errors.New("access denied")
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrInvalidOffset   = errors.New("invalid offset")
+	ErrChecksum        = errors.New("checksum mismatch")
+	ErrQuotaExceeded   = errors.New("quota exceeded")
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrLegacyAccount   = errors.New("account created before end-to-end encryption")
+	ErrTooManyAttempts = errors.New("too many attempts")
 )
 
+// SecondFactorError пароль верный, но у пользователя включена двухфакторная
+// аутентификация. Ticket подтверждает пароль на втором шаге входа
+type SecondFactorError struct {
+	Ticket string
+}
+
+func (e *SecondFactorError) Error() string {
+	return "second factor required"
+}
+
+// Record запись пользователя. Size, CreatedAt и UpdatedAt заполняются только
+// в списке записей, Size учитывается в квоте
 type Record struct {
-	Id         int
+	Id         string
 	TypeRecord string
+	Version    int
 	Data       []byte
 	Meta       string
+	Size       int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  time.Time
+	Blob       BlobRef
+}
+
+// ListFilter параметры выборки страницы записей. Пустые Type и Meta не
+// ограничивают выборку, пустой Cursor означает первую страницу. При
+// MetadataOnly данные записей не читаются, их получают через RetrieveData
+type ListFilter struct {
+	Limit        int
+	Cursor       string
+	Type         string
+	Meta         string
+	NewestFirst  bool
+	MetadataOnly bool
+}
+
+// Change изменение записи в ленте изменений пользователя. Revision номер
+// изменения в счетчике пользователя, он растет при каждом сохранении,
+// изменении, удалении и восстановлении записи. Для записи в корзине или
+// удаленной окончательно Deleted true, а в Record заполнен только Id
+type Change struct {
+	Revision int64
+	Deleted  bool
+	Record   Record
+}
+
+// Виды изменений записи
+const (
+	ChangeCreated string = "CREATED"
+	ChangeUpdated string = "UPDATED"
+	ChangeDeleted string = "DELETED"
+)
+
+// Kind возвращает вид изменения. Запись в первой версии считается созданной
+func (c Change) Kind() string {
+	switch {
+	case c.Deleted:
+		return ChangeDeleted
+	case c.Record.Version == 1:
+		return ChangeCreated
+	}
+	return ChangeUpdated
+}
+
+// BlobRef ссылка на содержимое записи во внешнем хранилище. Пустой Key
+// означает, что данные лежат в самой записи. Size и Hash относятся к открытым
+// данным. Если KeyID не пустой, blob зашифрован ключом данных DataKey,
+// обернутым мастер-ключом KeyID
+type BlobRef struct {
+	Key     string
+	Size    int64
+	Hash    []byte
+	KeyID   string
+	DataKey []byte
+}
+
+// Upload описывает незавершенную потоковую загрузку бинарных данных
+type Upload struct {
+	ID        string
+	Username  string
+	Meta      string
+	Size      int64
+	Received  int64
+	Checksum  []byte
+	HashState []byte
+	CreatedAt time.Time
+}
+
+// Chunk часть данных записи при потоковой передаче. Size передается в каждой
+// части, Checksum (SHA-256 всех данных) только в последней
+type Chunk struct {
+	Offset   int64
+	Data     []byte
+	Size     int64
+	Checksum []byte
+}
+
+// Quota ограничения хранилища пользователя. Нулевое значение поля означает,
+// что ограничения нет
+type Quota struct {
+	Bytes         int64
+	Records       int64
+	MaxRecordSize int64
+}
+
+// KDFParams соль и параметры Argon2id, с которыми клиент выводит из
+// мастер-пароля ключ входа и ключ для ключа записей. Сервер хранит их, чтобы
+// войти можно было с любого устройства. У аккаунтов, созданных до сквозного
+// шифрования, соли нет
+type KDFParams struct {
+	Salt    []byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// Valid сообщает, что параметры заданы полностью
+func (p KDFParams) Valid() bool {
+	return len(p.Salt) > 0 && p.Time > 0 && p.Memory > 0 && p.Threads > 0
+}
+
+// Usage занятое пользователем место и действующие для него ограничения.
+// Учитываются текущие версии записей, включая записи в корзине
+type Usage struct {
+	Bytes   int64
+	Records int64
+	Quota   Quota
+}
+
+// Fits сообщает, поместится ли в квоту новая запись размером size
+func (u Usage) Fits(size int64) bool {
+	if u.Quota.MaxRecordSize > 0 && size > u.Quota.MaxRecordSize {
+		return false
+	}
+	if u.Quota.Records > 0 && u.Records+1 > u.Quota.Records {
+		return false
+	}
+	return u.Quota.Bytes == 0 || u.Bytes+size <= u.Quota.Bytes
+}
+
+// Revision описывает одну сохраненную версию записи
+type Revision struct {
+	Revision  int
+	Meta      string
+	CreatedAt time.Time
+	Current   bool
 }
 
 type LoginJSON struct {
@@ -27,9 +188,52 @@ type CardJSON struct {
 	CVV    string `json:"cvv"`
 }
 
+// OTPJSON секрет одноразовых паролей стороннего сервиса. Type totp или hotp,
+// Secret в base32, Algorithm SHA1, SHA256 или SHA512. Period длительность
+// кода totp в секундах, Counter счетчик следующего кода hotp
+type OTPJSON struct {
+	Type      string `json:"type"`
+	Secret    string `json:"secret"`
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period,omitempty"`
+	Counter   uint64 `json:"counter,omitempty"`
+}
+
+// TokenSettings TokenExp срок access-токена, RefreshExp срок refresh-токена,
+// который продлевается при каждом обновлении, TicketExp срок, за который
+// нужно ввести код второго фактора после пароля
 type TokenSettings struct {
-	TokenExp  time.Duration
-	SecretKey string
+	TokenExp   time.Duration
+	RefreshExp time.Duration
+	TicketExp  time.Duration
+}
+
+// Session сессия пользователя на сервере. Хранится только хеш секрета
+// refresh-токена, который меняется при каждом обновлении
+type Session struct {
+	ID          string
+	Username    string
+	RefreshHash []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// TOTP второй фактор входа пользователя. Пока Enabled false, секрет ждет
+// подтверждения первым кодом. LastStep шаг времени последнего принятого кода,
+// коды этого и более ранних шагов повторно не принимаются. Failures число
+// кодов, введенных после последнего принятого, FailedAt время последнего из
+// них. RecoveryLeft
+// сколько одноразовых кодов восстановления еще не использовано
+type TOTP struct {
+	Secret       string
+	Enabled      bool
+	LastStep     int64
+	Failures     int
+	FailedAt     time.Time
+	RecoveryLeft int
 }
 
 type VersionBuild struct {
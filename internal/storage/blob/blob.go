@@ -0,0 +1,38 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// Store хранилище содержимого BINARY записей вне базы данных
+type Store interface {
+	// Put сохраняет size байт из r под ключом key
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get открывает содержимое blob, начиная с offset
+	Get(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+	// Delete удаляет blob, отсутствие blob ошибкой не считается
+	Delete(ctx context.Context, key string) error
+	// List вызывает fn для каждого сохраненного blob
+	List(ctx context.Context, fn func(key string, modified time.Time) error) error
+}
+
+// New создает хранилище по DSN. Поддерживаются схемы file:///path/to/dir
+// и s3://access:secret@host:port/bucket?secure=false
+func New(ctx context.Context, dsn string) (Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing blob store dsn: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileStore(u.Path)
+	case "s3":
+		return NewS3Store(ctx, u)
+	}
+	return nil, fmt.Errorf("unsupported blob store scheme %q", u.Scheme)
+}
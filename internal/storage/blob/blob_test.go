@@ -0,0 +1,34 @@
+package blob_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/storage/blob"
+	"github.com/sinfirst/GophKeeper/internal/storage/blob/blobtest"
+)
+
+// testS3DSNEnv переменная окружения с DSN отдельного бакета S3 (например,
+// локального MinIO) для проверок S3Store. Без нее проверки S3Store пропускаются
+const testS3DSNEnv = "GOPHKEEPER_TEST_S3_DSN"
+
+func TestFileStore(t *testing.T) {
+	store, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	blobtest.Run(t, store)
+}
+
+func TestS3Store(t *testing.T) {
+	dsn := os.Getenv(testS3DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testS3DSNEnv)
+	}
+	store, err := blob.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	blobtest.Run(t, store)
+}
@@ -0,0 +1,159 @@
+// Package blobtest содержит общий набор проверок поведения,
+// который должна проходить любая реализация blob.Store.
+//
+// Использование в тестах хранилища:
+//
+//	func TestFileStore(t *testing.T) {
+//		store, err := blob.NewFileStore(t.TempDir())
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		blobtest.Run(t, store)
+//	}
+//
+// S3Store проверяется так же, например против локального MinIO.
+package blobtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/blob"
+)
+
+// Run запускает весь набор проверок для хранилища
+func Run(t *testing.T, store blob.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store blob.Store)
+	}{
+		{"PutAndGet", testPutAndGet},
+		{"GetFromOffset", testGetFromOffset},
+		{"Empty", testEmpty},
+		{"Missing", testMissing},
+		{"Delete", testDelete},
+		{"List", testList},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, store)
+		})
+	}
+}
+
+func testPutAndGet(t *testing.T, store blob.Store) {
+	data := bytes.Repeat([]byte("0123456789"), 100_000)
+	key := put(t, store, data)
+
+	if got := get(t, store, key, 0); !bytes.Equal(got, data) {
+		t.Fatalf("Get returned %d bytes; want the %d bytes put", len(got), len(data))
+	}
+}
+
+func testGetFromOffset(t *testing.T, store blob.Store) {
+	key := put(t, store, []byte("0123456789"))
+
+	for _, tt := range []struct {
+		offset int64
+		want   string
+	}{
+		{0, "0123456789"},
+		{4, "456789"},
+		{9, "9"},
+		{10, ""},
+	} {
+		if got := get(t, store, key, tt.offset); string(got) != tt.want {
+			t.Fatalf("Get(%d) = %q; want %q", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func testEmpty(t *testing.T, store blob.Store) {
+	key := put(t, store, []byte{})
+
+	if got := get(t, store, key, 0); len(got) != 0 {
+		t.Fatalf("Get for empty blob = %q; want empty", got)
+	}
+}
+
+func testMissing(t *testing.T, store blob.Store) {
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, uuid.NewString(), 0); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("Get on missing key = %v; want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, uuid.NewString()); err != nil {
+		t.Fatalf("Delete on missing key = %v; want nil", err)
+	}
+}
+
+func testDelete(t *testing.T, store blob.Store) {
+	ctx := context.Background()
+	key := put(t, store, []byte("data"))
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key, 0); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("Get after Delete = %v; want ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, store blob.Store) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+	keys := map[string]bool{put(t, store, []byte("a")): false, put(t, store, []byte("b")): false}
+
+	err := store.List(ctx, func(key string, modified time.Time) error {
+		if _, ok := keys[key]; ok {
+			if modified.Before(start) {
+				t.Errorf("List: %s modified at %v; want after %v", key, modified, start)
+			}
+			keys[key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for key, seen := range keys {
+		if !seen {
+			t.Fatalf("List did not return %s", key)
+		}
+	}
+
+	stop := errors.New("stop")
+	if err := store.List(ctx, func(string, time.Time) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("List with failing callback = %v; want callback error", err)
+	}
+}
+
+func put(t *testing.T, store blob.Store, data []byte) string {
+	t.Helper()
+	key := uuid.NewString()
+	if err := store.Put(context.Background(), key, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	return key
+}
+
+func get(t *testing.T, store blob.Store, key string, offset int64) []byte {
+	t.Helper()
+	r, err := store.Get(context.Background(), key, offset)
+	if err != nil {
+		t.Fatalf("Get(%d): %v", offset, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	return data
+}
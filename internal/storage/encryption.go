@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
+)
+
+var errNoMasterKey = errors.New("record is encrypted, but master key is not configured")
+
+// sealedRecord значения колонок записи после шифрования. Для хранилища без
+// мастер-ключа keyID и dataKey равны nil, а данные сохраняются как есть
+type sealedRecord struct {
+	data    []byte
+	meta    string
+	keyID   any
+	dataKey []byte
+}
+
+// sealRecord шифрует данные и метаинформацию записи новым ключом данных
+func sealRecord(keys *envelope.Keyring, data []byte, meta string) (sealedRecord, error) {
+	if keys == nil {
+		return sealedRecord{data: data, meta: meta}, nil
+	}
+
+	dek, keyID, wrapped, err := keys.NewDataKey()
+	if err != nil {
+		return sealedRecord{}, err
+	}
+	sealedData, err := envelope.Seal(dek, data)
+	if err != nil {
+		return sealedRecord{}, err
+	}
+	sealedMeta, err := envelope.SealString(dek, meta)
+	if err != nil {
+		return sealedRecord{}, err
+	}
+	return sealedRecord{data: sealedData, meta: sealedMeta, keyID: keyID, dataKey: wrapped}, nil
+}
+
+// openDataKey расшифровывает ключ данных строки. Пустой keyID означает, что
+// строка сохранена без шифрования, тогда возвращается nil
+func openDataKey(keys *envelope.Keyring, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID == "" {
+		return nil, nil
+	}
+	if keys == nil {
+		return nil, errNoMasterKey
+	}
+	return keys.Unwrap(keyID, wrapped)
+}
+
+// openRecord расшифровывает данные и метаинформацию записи
+func openRecord(keys *envelope.Keyring, record *models.Record, keyID string, wrapped []byte) error {
+	dek, err := openDataKey(keys, keyID, wrapped)
+	if err != nil || dek == nil {
+		return err
+	}
+
+	record.Data, err = envelope.Open(dek, record.Data)
+	if err != nil {
+		return err
+	}
+	record.Meta, err = envelope.OpenString(dek, record.Meta)
+	return err
+}
+
+// openMeta расшифровывает метаинформацию версии записи
+func openMeta(keys *envelope.Keyring, meta, keyID string, wrapped []byte) (string, error) {
+	dek, err := openDataKey(keys, keyID, wrapped)
+	if err != nil || dek == nil {
+		return meta, err
+	}
+	return envelope.OpenString(dek, meta)
+}
+
+// plainSize возвращает размер открытых данных по размеру колонки user_data
+func plainSize(size int64, keyID string) int64 {
+	if keyID == "" {
+		return size
+	}
+	return envelope.PlainSize(size)
+}
+
+// moveDataOut расшифровывает данные строки перед переносом во внешнее
+// хранилище и возвращает значения колонок, которые остаются в строке: пустые
+// данные и метаинформацию. Зашифрованная строка получает новый ключ данных,
+// чтобы не шифровать прежним ключом с теми же nonce другие данные. У открытой
+// строки данные становятся пустыми, а метаинформация не меняется
+func moveDataOut(keys *envelope.Keyring, data []byte, meta, keyID string, wrapped []byte) ([]byte, sealedRecord, error) {
+	dek, err := openDataKey(keys, keyID, wrapped)
+	if err != nil {
+		return nil, sealedRecord{}, err
+	}
+	if dek == nil {
+		return data, sealedRecord{data: []byte{}, meta: meta}, nil
+	}
+
+	plain, err := envelope.Open(dek, data)
+	if err != nil {
+		return nil, sealedRecord{}, err
+	}
+	plainMeta, err := envelope.OpenString(dek, meta)
+	if err != nil {
+		return nil, sealedRecord{}, err
+	}
+	rest, err := sealRecord(keys, []byte{}, plainMeta)
+	if err != nil {
+		return nil, sealedRecord{}, err
+	}
+	return plain, rest, nil
+}
+
+// openDataRange расшифровывает прочитанный диапазон и вырезает из него
+// открытые байты [offset, offset+limit)
+func openDataRange(keys *envelope.Keyring, chunk []byte, offset int64, limit int, first, total int64, keyID string, wrapped []byte) ([]byte, error) {
+	dek, err := openDataKey(keys, keyID, wrapped)
+	if err != nil || dek == nil {
+		return chunk, err
+	}
+
+	plain, err := envelope.OpenRange(dek, chunk, first, total)
+	if err != nil {
+		return nil, err
+	}
+	skip := min(offset-first*envelope.SegmentSize, int64(len(plain)))
+	end := min(skip+int64(limit), int64(len(plain)))
+	return plain[skip:end], nil
+}
+
+// rewrapKey переоборачивает ключ данных строки активным мастер-ключом
+func rewrapKey(keys *envelope.Keyring, keyID string, wrapped []byte) (string, []byte, error) {
+	dek, err := keys.Unwrap(keyID, wrapped)
+	if err != nil {
+		return "", nil, err
+	}
+	return keys.Wrap(dek)
+}
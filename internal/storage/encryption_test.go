@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+func TestSQLiteRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	plain := newTestSQLite(t, config.Config{HistoryLimit: 1}, nil)
+	if err := plain.AddUserToDB(ctx, "user", "hash", models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+	data := make([]byte, 3*70000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+
+	// запись и ее версия сохранены до включения шифрования
+	id, err := plain.StoreDataToDB(ctx, models.Record{TypeRecord: models.Binary, Data: []byte("v1"), Meta: "v1"}, "user")
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	if err := plain.UpdateDataInDB(ctx, models.Record{Id: id, Data: data, Meta: "v2"}); err != nil {
+		t.Fatalf("UpdateDataInDB: %v", err)
+	}
+
+	keys, path := testKeyring(t, "k1")
+	db := *plain
+	db.keys = keys
+	if rotated, err := db.RotateKeys(ctx); err != nil || rotated != 2 {
+		t.Fatalf("RotateKeys = %d, %v; want 2 rows encrypted", rotated, err)
+	}
+	var raw []byte
+	if err := db.db.QueryRow(`SELECT user_data FROM records WHERE public_id = ?`, id).Scan(&raw); err != nil {
+		t.Fatalf("select user_data: %v", err)
+	}
+	if bytes.Contains(raw, data[:64]) {
+		t.Fatalf("user_data after RotateKeys is not encrypted")
+	}
+
+	// запись с зашифрованным blob и ее версия, ссылающаяся на тот же blob
+	dek, keyID, wrapped, err := keys.NewDataKey()
+	if err != nil {
+		t.Fatalf("NewDataKey: %v", err)
+	}
+	ref := models.BlobRef{Key: "blob", Size: 1, Hash: []byte("hash"), KeyID: keyID, DataKey: wrapped}
+	blobID, err := db.StoreDataToDB(ctx, models.Record{TypeRecord: models.Binary, Data: []byte{}, Meta: "b1", Blob: ref}, "user")
+	if err != nil {
+		t.Fatalf("StoreDataToDB with blob: %v", err)
+	}
+	if err := db.UpdateDataInDB(ctx, models.Record{Id: blobID, Data: []byte{}, Meta: "b2", Blob: ref}); err != nil {
+		t.Fatalf("UpdateDataInDB with blob: %v", err)
+	}
+
+	// новый ключ первым, старый нужен до конца ротации
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if err := os.WriteFile(path, append([]byte(keyLine(t, "k2")), old...), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	// ключи данных четырех строк и ключи blob двух из них
+	if rotated, err := db.RotateKeys(ctx); err != nil || rotated != 6 {
+		t.Fatalf("RotateKeys after new key = %d, %v; want 6", rotated, err)
+	}
+	if rotated, err := db.RotateKeys(ctx); err != nil || rotated != 0 {
+		t.Fatalf("repeated RotateKeys = %d, %v; want 0", rotated, err)
+	}
+
+	// после ротации старый ключ больше не нужен
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if err := os.WriteFile(path, current[:bytes.IndexByte(current, '\n')+1], 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := keys.Reload(); err != nil || keys.Primary() != "k2" {
+		t.Fatalf("Reload = %v, primary %q; want k2 only", err, keys.Primary())
+	}
+
+	old1, err := db.RetrieveRevisionFromDB(ctx, id, 1)
+	if err != nil || string(old1.Data) != "v1" || old1.Meta != "v1" {
+		t.Fatalf("RetrieveRevisionFromDB = %q, %q, %v; want v1", old1.Data, old1.Meta, err)
+	}
+	chunk, err := db.ReadDataChunk(ctx, id, 70000, 100000)
+	if err != nil || !bytes.Equal(chunk, data[70000:170000]) {
+		t.Fatalf("ReadDataChunk = %d bytes, %v; want 100000 bytes from offset 70000", len(chunk), err)
+	}
+	if got, err := db.GetBlobRef(ctx, id); err != nil || got.Size != int64(len(data)) {
+		t.Fatalf("GetBlobRef = %+v, %v; want inline data of %d bytes", got, err, len(data))
+	}
+
+	record, err := db.RetrieveDataFromDB(ctx, blobID)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	revision, err := db.RetrieveRevisionFromDB(ctx, blobID, 1)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB: %v", err)
+	}
+	for _, blob := range []models.BlobRef{record.Blob, revision.Blob} {
+		got, err := keys.Unwrap(blob.KeyID, blob.DataKey)
+		if blob.KeyID != "k2" || err != nil || !bytes.Equal(got, dek) {
+			t.Fatalf("blob key after rotation = %q, %v; want original data key wrapped with k2", blob.KeyID, err)
+		}
+	}
+}
+
+func TestMoveDataOutUsesNewDataKey(t *testing.T) {
+	keys, _ := testKeyring(t, "k1")
+	data := make([]byte, 70000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	sealed, err := sealRecord(keys, data, "meta")
+	if err != nil {
+		t.Fatalf("sealRecord: %v", err)
+	}
+
+	plain, rest, err := moveDataOut(keys, sealed.data, sealed.meta, sealed.keyID.(string), sealed.dataKey)
+	if err != nil || !bytes.Equal(plain, data) {
+		t.Fatalf("moveDataOut = %d bytes, %v; want original data", len(plain), err)
+	}
+	// строка, оставшаяся в базе, шифруется новым ключом данных, иначе ее
+	// сегменты получили бы те же nonce под тем же ключом, что и прежние данные
+	if bytes.Equal(rest.dataKey, sealed.dataKey) {
+		t.Fatalf("moveDataOut kept the previous data key")
+	}
+	record := models.Record{Data: rest.data, Meta: rest.meta}
+	if err := openRecord(keys, &record, rest.keyID.(string), rest.dataKey); err != nil {
+		t.Fatalf("openRecord: %v", err)
+	}
+	if len(record.Data) != 0 || record.Meta != "meta" {
+		t.Fatalf("rest = %q, %q; want empty data and original meta", record.Data, record.Meta)
+	}
+}
@@ -0,0 +1,278 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sizes размеры данных на границах сегментов
+var sizes = []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3*SegmentSize + 7}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	return b
+}
+
+func TestSealOpen(t *testing.T) {
+	dek := randomBytes(t, KeySize)
+	for _, n := range sizes {
+		data := randomBytes(t, n)
+		sealed, err := Seal(dek, data)
+		if err != nil {
+			t.Fatalf("Seal(%d bytes): %v", n, err)
+		}
+		if int64(len(sealed)) != SealedSize(int64(n)) {
+			t.Errorf("len(Seal(%d bytes)) = %d, want SealedSize %d", n, len(sealed), SealedSize(int64(n)))
+		}
+		if got := PlainSize(int64(len(sealed))); got != int64(n) {
+			t.Errorf("PlainSize(%d) = %d, want %d", len(sealed), got, n)
+		}
+		got, err := Open(dek, sealed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Open(Seal(%d bytes)) = %d bytes, %v; want original data", n, len(got), err)
+		}
+	}
+}
+
+func TestOpenRange(t *testing.T) {
+	dek := randomBytes(t, KeySize)
+	for _, n := range sizes {
+		data := randomBytes(t, n)
+		sealed, err := Seal(dek, data)
+		if err != nil {
+			t.Fatalf("Seal(%d bytes): %v", n, err)
+		}
+		total := int64(len(sealed))
+		for _, r := range []struct {
+			offset int64
+			limit  int
+		}{{0, 10}, {5, SegmentSize}, {SegmentSize - 3, 7}, {int64(n), 5}, {int64(n / 2), 1 << 20}} {
+			from, length, first := SealedRange(r.offset, r.limit)
+			chunk := sealed[min(from, total):min(from+length, total)]
+			plain, err := OpenRange(dek, chunk, first, total)
+			if err != nil {
+				t.Fatalf("OpenRange(%d bytes, offset %d): %v", n, r.offset, err)
+			}
+			skip := min(r.offset-first*SegmentSize, int64(len(plain)))
+			got := plain[skip:min(skip+int64(r.limit), int64(len(plain)))]
+			want := data[min(int(r.offset), n):min(int(r.offset)+r.limit, n)]
+			if !bytes.Equal(got, want) {
+				t.Errorf("OpenRange(%d bytes, offset %d, limit %d) = %d bytes, want %d", n, r.offset, r.limit, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestOpenDetectsTampering(t *testing.T) {
+	dek := randomBytes(t, KeySize)
+	sealed, err := Seal(dek, randomBytes(t, 3*SegmentSize))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	flipped := bytes.Clone(sealed)
+	flipped[10] ^= 1
+	swapped := append(append(bytes.Clone(sealed[sealedSize:2*sealedSize]), sealed[:sealedSize]...), sealed[2*sealedSize:]...)
+	tests := map[string][]byte{
+		"flipped bit":      flipped,
+		"truncated":        sealed[:2*sealedSize],
+		"swapped segments": swapped,
+	}
+	for name, data := range tests {
+		if _, err := Open(dek, data); err == nil {
+			t.Errorf("Open with %s succeeded, want error", name)
+		}
+	}
+	if _, err := Open(randomBytes(t, KeySize), sealed); err == nil {
+		t.Errorf("Open with another key succeeded, want error")
+	}
+}
+
+func TestOpenReaderDetectsTampering(t *testing.T) {
+	dek := randomBytes(t, KeySize)
+	sealed, err := Seal(dek, randomBytes(t, 3*SegmentSize+7))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	total := int64(len(sealed))
+
+	swapped := append(append(bytes.Clone(sealed[sealedSize:2*sealedSize]), sealed[:sealedSize]...), sealed[2*sealedSize:]...)
+	tests := map[string][]byte{
+		"last segment dropped":     sealed[:3*sealedSize],
+		"last segment cut":         sealed[:total-3],
+		"middle segment cut":       sealed[:2*sealedSize+10],
+		"swapped segments":         swapped,
+		"last segment moved first": append(bytes.Clone(sealed[3*sealedSize:]), sealed[:3*sealedSize]...),
+		"segment repeated":         append(bytes.Clone(sealed[:sealedSize]), sealed[:total-sealedSize]...),
+	}
+	for name, data := range tests {
+		r, err := OpenReader(dek, bytes.NewReader(data), 0, total)
+		if err != nil {
+			t.Fatalf("OpenReader: %v", err)
+		}
+		if _, err := io.ReadAll(r); err == nil {
+			t.Errorf("OpenReader with %s succeeded, want error", name)
+		}
+	}
+}
+
+// TestDataKeysAreUnique проверяет, что повторное шифрование тех же данных
+// идет новым ключом. Nonce сегмента зависит только от его номера, поэтому
+// пара ключ и nonce не повторяется, только пока ключ данных каждый раз новый
+func TestDataKeysAreUnique(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.keys")
+	line := "k1:" + base64.StdEncoding.EncodeToString(randomBytes(t, KeySize)) + "\n"
+	if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	keys, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	data := randomBytes(t, SegmentSize+1)
+	seen := make(map[string]bool)
+	sealedSeen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		dek, _, wrapped, err := keys.NewDataKey()
+		if err != nil {
+			t.Fatalf("NewDataKey: %v", err)
+		}
+		if seen[string(dek)] || seen[string(wrapped)] {
+			t.Fatalf("NewDataKey returned a repeated key on call %d", i)
+		}
+		seen[string(dek)], seen[string(wrapped)] = true, true
+
+		sealed, err := Seal(dek, data)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		if sealedSeen[string(sealed[:sealedSize])] {
+			t.Fatalf("reseal %d repeated the ciphertext of the first segment", i)
+		}
+		sealedSeen[string(sealed[:sealedSize])] = true
+	}
+}
+
+func TestSealReader(t *testing.T) {
+	dek := randomBytes(t, KeySize)
+	for _, n := range sizes {
+		data := randomBytes(t, n)
+		want, err := Seal(dek, data)
+		if err != nil {
+			t.Fatalf("Seal(%d bytes): %v", n, err)
+		}
+		r, err := SealReader(dek, bytes.NewReader(data), int64(n))
+		if err != nil {
+			t.Fatalf("SealReader: %v", err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("SealReader(%d bytes) = %d bytes, %v; want output of Seal", n, len(got), err)
+		}
+
+		for _, offset := range []int64{0, SegmentSize, int64(n)} {
+			if offset > int64(n) {
+				continue
+			}
+			from, _, first := SealedRange(offset, 1)
+			r, err := OpenReader(dek, bytes.NewReader(want[min(from, int64(len(want))):]), first, int64(len(want)))
+			if err != nil {
+				t.Fatalf("OpenReader: %v", err)
+			}
+			plain, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(plain, data[first*SegmentSize:]) {
+				t.Errorf("OpenReader(%d bytes, segment %d) = %d bytes, %v; want %d", n, first, len(plain), err, n-int(first*SegmentSize))
+			}
+		}
+	}
+
+	r, err := SealReader(dek, bytes.NewReader(make([]byte, SegmentSize)), 2*SegmentSize)
+	if err != nil {
+		t.Fatalf("SealReader: %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("SealReader of short stream = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.keys")
+	old := "old:" + base64.StdEncoding.EncodeToString(randomBytes(t, KeySize)) + "\n"
+	if err := os.WriteFile(path, []byte("# comment\n"+old), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	keys, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	dek, keyID, wrapped, err := keys.NewDataKey()
+	if err != nil || keyID != "old" {
+		t.Fatalf("NewDataKey = %q, %v; want key old", keyID, err)
+	}
+	data := randomBytes(t, SegmentSize+1)
+	sealed, err := Seal(dek, data)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	rotated := "new:" + base64.StdEncoding.EncodeToString(randomBytes(t, KeySize)) + "\n" + old
+	if err := os.WriteFile(path, []byte(rotated), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := keys.Reload(); err != nil || keys.Primary() != "new" {
+		t.Fatalf("Reload = %v, primary %q; want new", err, keys.Primary())
+	}
+	if got, err := keys.Unwrap(keyID, wrapped); err != nil || !bytes.Equal(got, dek) {
+		t.Errorf("Unwrap with old key after rotation = %v; want original data key", err)
+	}
+	if _, err := keys.Unwrap("new", wrapped); err == nil {
+		t.Errorf("Unwrap with another key succeeded, want error")
+	}
+	if _, err := keys.Unwrap("missing", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Unwrap with unknown key = %v, want ErrUnknownKey", err)
+	}
+
+	newID, rewrapped, err := keys.Wrap(dek)
+	if err != nil || newID != "new" {
+		t.Fatalf("Wrap = %q, %v; want key new", newID, err)
+	}
+	got, err := keys.Unwrap(newID, rewrapped)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("Unwrap of rewrapped key = %v; want original data key", err)
+	}
+	if plain, err := Open(got, sealed); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("Open with rewrapped key = %d bytes, %v; want original data", len(plain), err)
+	}
+
+	if err := os.WriteFile(path, []byte(old+old), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := keys.Reload(); err == nil {
+		t.Errorf("Reload with duplicate key id succeeded, want error")
+	}
+	if keys.Primary() != "new" {
+		t.Errorf("Primary after failed Reload = %q, want previous keys kept", keys.Primary())
+	}
+}
+
+func TestSealString(t *testing.T) {
+	dek := randomBytes(t, KeySize)
+	sealed, err := SealString(dek, "meta")
+	if err != nil {
+		t.Fatalf("SealString: %v", err)
+	}
+	if got, err := OpenString(dek, sealed); err != nil || got != "meta" {
+		t.Errorf("OpenString = %q, %v; want meta", got, err)
+	}
+}
@@ -0,0 +1,151 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// KeySize размер мастер-ключа и ключа данных в байтах (AES-256)
+const KeySize = 32
+
+// ErrUnknownKey ключ данных обернут мастер-ключом, которого нет в наборе
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Keyring набор мастер-ключей сервера. Первый ключ в файле активный: им
+// оборачиваются новые ключи данных. Остальные нужны, чтобы открыть ключи
+// данных, обернутые до ротации.
+//
+// Файл содержит по ключу на строке в виде id:base64, пустые строки и
+// строки, начинающиеся с #, пропускаются.
+type Keyring struct {
+	mu      sync.RWMutex
+	path    string
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// LoadKeyring читает набор мастер-ключей из файла
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload перечитывает файл ключей. Используется при ротации, чтобы сервер
+// узнал о новом мастер-ключе без перезапуска
+func (k *Keyring) Reload() error {
+	file, err := os.Open(k.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var primary string
+	keys := make(map[string]cipher.AEAD)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(text, ":")
+		if !ok || id == "" {
+			return fmt.Errorf("%s:%d: want id:base64key", k.path, line)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return fmt.Errorf("%s:%d: key must be %d bytes in base64", k.path, line, KeySize)
+		}
+		if _, ok := keys[id]; ok {
+			return fmt.Errorf("%s:%d: duplicate key id %q", k.path, line, id)
+		}
+
+		keys[id], err = newAEAD(key)
+		if err != nil {
+			return err
+		}
+		if primary == "" {
+			primary = id
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if primary == "" {
+		return fmt.Errorf("%s: no master keys", k.path)
+	}
+
+	k.mu.Lock()
+	k.primary, k.keys = primary, keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Primary возвращает id активного мастер-ключа
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+// NewDataKey создает случайный ключ данных и оборачивает его активным мастер-ключом
+func (k *Keyring) NewDataKey() (dek []byte, keyID string, wrapped []byte, err error) {
+	dek = make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, "", nil, err
+	}
+
+	keyID, wrapped, err = k.Wrap(dek)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return dek, keyID, wrapped, nil
+}
+
+// Wrap шифрует ключ данных активным мастер-ключом
+func (k *Keyring) Wrap(dek []byte) (string, []byte, error) {
+	k.mu.RLock()
+	keyID, kek := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+
+	nonce := make([]byte, kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return keyID, kek.Seal(nonce, nonce, dek, []byte(keyID)), nil
+}
+
+// Unwrap расшифровывает ключ данных мастер-ключом keyID
+func (k *Keyring) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	kek, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	if len(wrapped) < kek.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	nonce, sealed := wrapped[:kek.NonceSize()], wrapped[kek.NonceSize():]
+	return kek.Open(nil, nonce, sealed, []byte(keyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,129 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// Данные шифруются сегментами по SegmentSize байт, у каждого сегмента свой
+// тег. Поэтому любой диапазон записи можно расшифровать, не читая ее целиком.
+// Nonce сегмента строится из его номера и признака последнего сегмента, что
+// защищает от перестановки и обрезки сегментов. Ключ данных новый при каждом
+// шифровании: для каждой версии записи, для строки, данные которой вынесены во
+// внешнее хранилище, и для каждого blob. Поэтому детерминированные nonce
+// безопасны.
+const (
+	SegmentSize = 64 << 10
+	overhead    = 16
+	sealedSize  = SegmentSize + overhead
+)
+
+const (
+	domainSegment uint32 = iota
+	domainLastSegment
+	domainMeta
+)
+
+var errSealed = errors.New("sealed data is corrupted")
+
+// Seal шифрует данные ключом данных dek
+func Seal(dek, data []byte) ([]byte, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := max((len(data)+SegmentSize-1)/SegmentSize, 1)
+	sealed := make([]byte, 0, len(data)+segments*overhead)
+	for i := 0; i < segments; i++ {
+		end := min((i+1)*SegmentSize, len(data))
+		sealed = aead.Seal(sealed, segmentNonce(int64(i), i == segments-1), data[i*SegmentSize:end], nil)
+	}
+	return sealed, nil
+}
+
+// Open расшифровывает данные, зашифрованные Seal
+func Open(dek, sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, errSealed
+	}
+	return OpenRange(dek, sealed, 0, int64(len(sealed)))
+}
+
+// OpenRange расшифровывает часть зашифрованных данных, начинающуюся с сегмента
+// first. total полный размер зашифрованных данных, по нему определяется
+// последний сегмент
+func OpenRange(dek, sealed []byte, first, total int64) ([]byte, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	last := (total+sealedSize-1)/sealedSize - 1
+	data := make([]byte, 0, len(sealed))
+	for i := first; len(sealed) > 0; i++ {
+		n := min(sealedSize, len(sealed))
+		data, err = aead.Open(data, segmentNonce(i, i == last), sealed[:n], nil)
+		if err != nil {
+			return nil, errSealed
+		}
+		sealed = sealed[n:]
+	}
+	return data, nil
+}
+
+// SealedRange возвращает диапазон зашифрованных данных, в котором лежат
+// открытые байты [offset, offset+limit), и номер его первого сегмента
+func SealedRange(offset int64, limit int) (sealedOffset, sealedLen, first int64) {
+	first = offset / SegmentSize
+	last := (offset + int64(max(limit, 1)) - 1) / SegmentSize
+	return first * sealedSize, (last - first + 1) * sealedSize, first
+}
+
+// PlainSize возвращает размер открытых данных по размеру зашифрованных
+func PlainSize(sealed int64) int64 {
+	segments := (sealed + sealedSize - 1) / sealedSize
+	return sealed - segments*overhead
+}
+
+// SealString шифрует строку, например метаинформацию записи, и кодирует ее в base64
+func SealString(dek []byte, s string) (string, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, nonce(domainMeta, 0), []byte(s), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenString расшифровывает строку, зашифрованную SealString
+func OpenString(dek []byte, s string) (string, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", errSealed
+	}
+	data, err := aead.Open(nil, nonce(domainMeta, 0), sealed, nil)
+	if err != nil {
+		return "", errSealed
+	}
+	return string(data), nil
+}
+
+func segmentNonce(index int64, last bool) []byte {
+	if last {
+		return nonce(domainLastSegment, index)
+	}
+	return nonce(domainSegment, index)
+}
+
+func nonce(domain uint32, index int64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint32(n, domain)
+	binary.BigEndian.PutUint64(n[4:], uint64(index))
+	return n
+}
@@ -0,0 +1,107 @@
+package envelope
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// SealedSize возвращает размер зашифрованных данных по размеру открытых
+func SealedSize(size int64) int64 {
+	segments := max((size+SegmentSize-1)/SegmentSize, 1)
+	return size + segments*overhead
+}
+
+// SealReader шифрует поток r из size байт так же, как Seal, не читая его
+// целиком. Если в потоке меньше size байт, чтение вернет io.ErrUnexpectedEOF
+func SealReader(dek []byte, r io.Reader, size int64) (io.Reader, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	segments := max((size+SegmentSize-1)/SegmentSize, 1)
+	return &sealReader{aead: aead, src: r, size: size, segments: segments, plain: make([]byte, SegmentSize)}, nil
+}
+
+type sealReader struct {
+	aead     cipher.AEAD
+	src      io.Reader
+	size     int64
+	segments int64
+	next     int64
+	plain    []byte
+	out      []byte
+	buf      []byte
+}
+
+func (s *sealReader) Read(p []byte) (int, error) {
+	if len(s.buf) == 0 {
+		if s.next == s.segments {
+			return 0, io.EOF
+		}
+		last := s.next == s.segments-1
+		// все сегменты, кроме последнего, полные
+		want := min(s.size-s.next*SegmentSize, SegmentSize)
+		n, err := io.ReadFull(s.src, s.plain[:want])
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.out = s.aead.Seal(s.out[:0], segmentNonce(s.next, last), s.plain[:n], nil)
+		s.buf = s.out
+		s.next++
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// OpenReader расшифровывает поток r, прочитанный из зашифрованных данных с
+// начала сегмента first. total полный размер зашифрованных данных, по нему
+// определяется последний сегмент
+func OpenReader(dek []byte, r io.Reader, first, total int64) (io.Reader, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	last := (total+sealedSize-1)/sealedSize - 1
+	return &openReader{aead: aead, src: r, next: first, last: last, sealed: make([]byte, sealedSize)}, nil
+}
+
+type openReader struct {
+	aead   cipher.AEAD
+	src    io.Reader
+	next   int64
+	last   int64
+	sealed []byte
+	out    []byte
+	buf    []byte
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	if len(o.buf) == 0 {
+		if o.next > o.last {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(o.src, o.sealed)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		if n < overhead || (o.next != o.last && n != sealedSize) {
+			return 0, errSealed
+		}
+		o.out, err = o.aead.Open(o.out[:0], segmentNonce(o.next, o.next == o.last), o.sealed[:n], nil)
+		if err != nil {
+			return 0, errSealed
+		}
+		o.buf = o.out
+		o.next++
+	}
+
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return n, nil
+}
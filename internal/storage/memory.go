@@ -0,0 +1,1023 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// MemoryDB хранилище в памяти процесса для тестов и dev запусков
+type MemoryDB struct {
+	mu           sync.RWMutex
+	users        map[string]memoryUser
+	records      map[string]memoryRecord
+	uploads      map[string]memoryUpload
+	sessions     map[string]models.Session
+	tombstones   []memoryTombstone
+	seq          int64
+	historyLimit int
+	quota        models.Quota
+}
+
+type memoryUser struct {
+	password string
+	bytes    int64
+	records  int64
+	changes  int64
+	kdf      models.KDFParams
+	vaultKey []byte
+	totp     *memoryTOTP
+}
+
+// memoryTOTP второй фактор пользователя и хеши его неиспользованных кодов
+// восстановления
+type memoryTOTP struct {
+	totp     models.TOTP
+	recovery map[string]struct{}
+}
+
+type memoryRecord struct {
+	seq       int64
+	record    models.Record
+	username  string
+	revision  int
+	change    int64
+	size      int64
+	createdAt time.Time
+	updatedAt time.Time
+	history   []memoryRevision
+}
+
+// memoryTombstone след окончательно удаленной записи в ленте изменений
+type memoryTombstone struct {
+	username string
+	id       string
+	change   int64
+}
+
+type memoryUpload struct {
+	upload models.Upload
+	data   []byte
+}
+
+type memoryRevision struct {
+	revision  int
+	data      []byte
+	meta      string
+	blob      models.BlobRef
+	createdAt time.Time
+}
+
+// NewMemoryDB конструктор для структуры
+func NewMemoryDB(config config.Config) *MemoryDB {
+	return &MemoryDB{
+		users:        make(map[string]memoryUser),
+		records:      make(map[string]memoryRecord),
+		uploads:      make(map[string]memoryUpload),
+		sessions:     make(map[string]models.Session),
+		historyLimit: config.HistoryLimit,
+		quota:        config.Quota(),
+	}
+}
+
+func (m *MemoryDB) CheckUsernameExists(ctx context.Context, username string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.users[username]
+	return ok, nil
+}
+
+func (m *MemoryDB) AddUserToDB(ctx context.Context, username, password string, kdf models.KDFParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[username]; !ok {
+		m.users[username] = memoryUser{password: password, kdf: kdf}
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetUserPassword(ctx context.Context, username string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return "", models.ErrNotFound
+	}
+	return user.password, nil
+}
+
+func (m *MemoryDB) StoreDataToDB(ctx context.Context, record models.Record, username string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	size := recordSize(record)
+	if err := m.addUsage(username, size, 1, size); err != nil {
+		return "", err
+	}
+
+	m.seq++
+	record.Id = uuid.NewString()
+	record.Version = 1
+	record.Data = cloneBytes(record.Data)
+	now := time.Now()
+	m.records[record.Id] = memoryRecord{seq: m.seq, record: record, username: username, revision: 1,
+		change: m.nextChange(username), size: size, createdAt: now, updatedAt: now}
+	return record.Id, nil
+}
+
+func (m *MemoryDB) GetUserByDataID(ctx context.Context, id string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	if !ok {
+		return "", models.ErrNotFound
+	}
+	return stored.username, nil
+}
+
+func (m *MemoryDB) RetrieveDataFromDB(ctx context.Context, id string) (models.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	if !ok || stored.trashed() {
+		return models.Record{}, models.ErrNotFound
+	}
+	record := stored.record
+	record.Data = cloneBytes(record.Data)
+	return record, nil
+}
+
+// UpdateDataInDB переносит текущую версию записи в историю и сохраняет новую.
+// Если record.Version не 0, он должен совпадать с текущей версией записи,
+// иначе возвращается ErrVersionMismatch
+func (m *MemoryDB) UpdateDataInDB(ctx context.Context, record models.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.records[record.Id]
+	if !ok || stored.trashed() {
+		return models.ErrNotFound
+	}
+	if record.Version != 0 && record.Version != stored.revision {
+		return models.ErrVersionMismatch
+	}
+
+	size := recordSize(record)
+	if err := m.addUsage(stored.username, size-stored.size, 0, size); err != nil {
+		return err
+	}
+
+	if m.historyLimit > 0 {
+		stored.history = append(stored.history, memoryRevision{
+			revision:  stored.revision,
+			data:      stored.record.Data,
+			meta:      stored.record.Meta,
+			blob:      stored.record.Blob,
+			createdAt: stored.updatedAt,
+		})
+	}
+	if len(stored.history) > m.historyLimit {
+		stored.history = append([]memoryRevision{}, stored.history[len(stored.history)-m.historyLimit:]...)
+	}
+
+	stored.record.Meta = record.Meta
+	stored.record.Data = cloneBytes(record.Data)
+	stored.record.Blob = record.Blob
+	stored.size = size
+	stored.revision++
+	stored.record.Version = stored.revision
+	stored.change = m.nextChange(stored.username)
+	stored.updatedAt = time.Now()
+	m.records[record.Id] = stored
+	return nil
+}
+
+// GetRevisions возвращает текущую и сохраненные версии записи, начиная с новой
+func (m *MemoryDB) GetRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	revisions := []models.Revision{{
+		Revision:  stored.revision,
+		Meta:      stored.record.Meta,
+		CreatedAt: stored.updatedAt,
+		Current:   true,
+	}}
+	for i := len(stored.history) - 1; i >= 0; i-- {
+		revisions = append(revisions, models.Revision{
+			Revision:  stored.history[i].revision,
+			Meta:      stored.history[i].meta,
+			CreatedAt: stored.history[i].createdAt,
+		})
+	}
+	return revisions, nil
+}
+
+// RetrieveRevisionFromDB возвращает содержимое записи в указанной версии
+func (m *MemoryDB) RetrieveRevisionFromDB(ctx context.Context, id string, revision int) (models.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	if !ok {
+		return models.Record{}, models.ErrNotFound
+	}
+
+	record := stored.record
+	if stored.revision == revision {
+		record.Data = cloneBytes(record.Data)
+		return record, nil
+	}
+	for _, h := range stored.history {
+		if h.revision == revision {
+			record.Version = h.revision
+			record.Data = cloneBytes(h.data)
+			record.Meta = h.meta
+			record.Blob = h.blob
+			return record, nil
+		}
+	}
+	return models.Record{}, models.ErrNotFound
+}
+
+// GetListData возвращает страницу записей пользователя по фильтру и курсор
+// следующей страницы, пустой на последней странице
+func (m *MemoryDB) GetListData(ctx context.Context, username string, filter models.ListFilter) ([]models.Record, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stored []memoryRecord
+	for _, r := range m.records {
+		if r.username == username && !r.trashed() && (filter.Type == "" || r.record.TypeRecord == filter.Type) {
+			stored = append(stored, r)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		if filter.NewestFirst {
+			return stored[i].seq > stored[j].seq
+		}
+		return stored[i].seq < stored[j].seq
+	})
+
+	return paginate(filter, func(after int64, limit int) ([]listedRecord, error) {
+		var batch []listedRecord
+		for _, r := range stored {
+			if len(batch) == limit {
+				break
+			}
+			if after > 0 && (filter.NewestFirst && r.seq >= after || !filter.NewestFirst && r.seq <= after) {
+				continue
+			}
+			record := r.record
+			record.Data = cloneBytes(record.Data)
+			if filter.MetadataOnly {
+				record.Data = nil
+			}
+			record.Size, record.CreatedAt, record.UpdatedAt = r.size, r.createdAt, r.updatedAt
+			batch = append(batch, listedRecord{seq: r.seq, record: record})
+		}
+		return batch, nil
+	})
+}
+
+func (m *MemoryDB) CheckRecordExist(ctx context.Context, id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	return ok && !stored.trashed(), nil
+}
+
+// DeleteDataFromDB перемещает запись в корзину. Если version не 0, запись
+// удаляется, только когда ее текущая версия совпадает с version
+func (m *MemoryDB) DeleteDataFromDB(ctx context.Context, id string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.records[id]
+	if !ok || stored.trashed() {
+		return models.ErrNotFound
+	}
+	if version != 0 && version != stored.revision {
+		return models.ErrVersionMismatch
+	}
+	stored.record.DeletedAt = time.Now()
+	stored.change = m.nextChange(stored.username)
+	m.records[id] = stored
+	return nil
+}
+
+// GetTrashList возвращает записи пользователя, находящиеся в корзине, без
+// их данных
+func (m *MemoryDB) GetTrashList(ctx context.Context, username string) ([]models.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var records []models.Record
+	for _, r := range m.records {
+		if r.username == username && r.trashed() {
+			record := r.record
+			record.Data, record.Blob = nil, models.BlobRef{}
+			record.Size = r.size
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].DeletedAt.Before(records[j].DeletedAt) })
+	return records, nil
+}
+
+// RestoreDataInDB возвращает запись из корзины
+func (m *MemoryDB) RestoreDataInDB(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.records[id]
+	if !ok || !stored.trashed() {
+		return models.ErrNotFound
+	}
+	stored.record.DeletedAt = time.Time{}
+	stored.change = m.nextChange(stored.username)
+	m.records[id] = stored
+	return nil
+}
+
+// PurgeDataFromDB окончательно удаляет запись из корзины
+func (m *MemoryDB) PurgeDataFromDB(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.records[id]
+	if !ok || !stored.trashed() {
+		return models.ErrNotFound
+	}
+	delete(m.records, id)
+	m.addTombstone(stored.username, id)
+	return m.addUsage(stored.username, -stored.size, -1, 0)
+}
+
+// PurgeExpiredTrash окончательно удаляет записи, попавшие в корзину раньше before
+func (m *MemoryDB) PurgeExpiredTrash(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, r := range m.records {
+		if r.trashed() && r.record.DeletedAt.Before(before) {
+			delete(m.records, id)
+			m.addTombstone(r.username, id)
+			if err := m.addUsage(r.username, -r.size, -1, 0); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CreateUpload регистрирует новую потоковую загрузку
+func (m *MemoryDB) CreateUpload(ctx context.Context, upload models.Upload) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload.ID = uuid.NewString()
+	upload.Received = 0
+	upload.HashState = nil
+	upload.Checksum = cloneBytes(upload.Checksum)
+	upload.CreatedAt = time.Now()
+	m.uploads[upload.ID] = memoryUpload{upload: upload}
+	return upload.ID, nil
+}
+
+func (m *MemoryDB) GetUpload(ctx context.Context, id string) (models.Upload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.uploads[id]
+	if !ok {
+		return models.Upload{}, models.ErrNotFound
+	}
+	upload := stored.upload
+	upload.Checksum = cloneBytes(upload.Checksum)
+	upload.HashState = cloneBytes(upload.HashState)
+	return upload, nil
+}
+
+// AppendUploadChunk дописывает часть данных, если offset совпадает с уже принятым объемом
+func (m *MemoryDB) AppendUploadChunk(ctx context.Context, id string, offset int64, data, hashState []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.uploads[id]
+	if !ok || stored.upload.Received != offset {
+		return models.ErrInvalidOffset
+	}
+	stored.data = append(stored.data, data...)
+	stored.upload.Received += int64(len(data))
+	stored.upload.HashState = cloneBytes(hashState)
+	m.uploads[id] = stored
+	return nil
+}
+
+// CompleteUpload переносит полностью принятую загрузку в новую BINARY запись.
+// Если данные уже сохранены во внешнем хранилище, запись получает ссылку blob
+func (m *MemoryDB) CompleteUpload(ctx context.Context, id string, blob models.BlobRef) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.uploads[id]
+	if !ok || stored.upload.Received != stored.upload.Size {
+		return "", models.ErrNotFound
+	}
+
+	record := models.Record{Id: uuid.NewString(), TypeRecord: models.Binary, Version: 1, Data: []byte{}, Meta: stored.upload.Meta, Blob: blob}
+	if blob.Key == "" {
+		record.Data = append(record.Data, stored.data...)
+	}
+	size := recordSize(record)
+	if err := m.addUsage(stored.upload.Username, size, 1, size); err != nil {
+		return "", err
+	}
+	delete(m.uploads, id)
+
+	m.seq++
+	now := time.Now()
+	m.records[record.Id] = memoryRecord{seq: m.seq, record: record, username: stored.upload.Username, revision: 1,
+		change: m.nextChange(stored.upload.Username), size: size, createdAt: now, updatedAt: now}
+	return record.Id, nil
+}
+
+// PurgeStaleUploads удаляет незавершенные загрузки, начатые раньше before
+func (m *MemoryDB) PurgeStaleUploads(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, u := range m.uploads {
+		if u.upload.CreatedAt.Before(before) {
+			delete(m.uploads, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ReadUploadChunk возвращает принятые данные загрузки, начиная с offset
+func (m *MemoryDB) ReadUploadChunk(ctx context.Context, id string, offset int64) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.uploads[id]
+	if !ok || offset < 0 || offset >= int64(len(stored.data)) {
+		return nil, models.ErrNotFound
+	}
+	return cloneBytes(stored.data[offset:]), nil
+}
+
+// GetBlobRef возвращает ссылку на данные записи. Для данных, лежащих в самой
+// записи, Key пустой, а Size равен их размеру
+func (m *MemoryDB) GetBlobRef(ctx context.Context, id string) (models.BlobRef, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	if !ok || stored.trashed() {
+		return models.BlobRef{}, models.ErrNotFound
+	}
+	if stored.record.Blob.Key == "" {
+		return models.BlobRef{Size: int64(len(stored.record.Data))}, nil
+	}
+	return stored.record.Blob, nil
+}
+
+// ReadDataChunk читает не больше limit байт данных записи, начиная с offset
+func (m *MemoryDB) ReadDataChunk(ctx context.Context, id string, offset int64, limit int) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.records[id]
+	if !ok || stored.trashed() {
+		return nil, models.ErrNotFound
+	}
+
+	data := stored.record.Data
+	if offset >= int64(len(data)) {
+		return []byte{}, nil
+	}
+	end := offset + int64(limit)
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return cloneBytes(data[offset:end]), nil
+}
+
+// GetBlobKeys возвращает ключи всех blob, на которые ссылаются записи и их версии
+func (m *MemoryDB) GetBlobKeys(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, r := range m.records {
+		add(r.record.Blob.Key)
+		for _, h := range r.history {
+			add(h.blob.Key)
+		}
+	}
+	return keys, nil
+}
+
+// GetUsage возвращает занятое пользователем место и действующие для него ограничения
+func (m *MemoryDB) GetUsage(ctx context.Context, username string) (models.Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return models.Usage{}, models.ErrNotFound
+	}
+	return models.Usage{Bytes: user.bytes, Records: user.records, Quota: m.quota}, nil
+}
+
+// GetKDFParams возвращает параметры, с которыми клиент выводит ключи аккаунта
+// из мастер-пароля. У аккаунта, созданного до сквозного шифрования, они пустые
+func (m *MemoryDB) GetKDFParams(ctx context.Context, username string) (models.KDFParams, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return models.KDFParams{}, models.ErrNotFound
+	}
+	return user.kdf, nil
+}
+
+// MigrateUser переводит аккаунт, созданный до сквозного шифрования, на ключ
+// входа password, выведенный с параметрами kdf, и завершает все его сессии.
+// Если аккаунт уже переведен, возвращается ErrConflict
+func (m *MemoryDB) MigrateUser(ctx context.Context, username, password string, kdf models.KDFParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if user.kdf.Valid() {
+		return models.ErrConflict
+	}
+	user.password, user.kdf = password, kdf
+	m.users[username] = user
+	for id, session := range m.sessions {
+		if session.Username == username {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// GetVaultKey возвращает обернутый ключ шифрования записей пользователя. Если
+// ключ еще не задан, возвращается ErrNotFound
+func (m *MemoryDB) GetVaultKey(ctx context.Context, username string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok || user.vaultKey == nil {
+		return nil, models.ErrNotFound
+	}
+	return cloneBytes(user.vaultKey), nil
+}
+
+// SetVaultKey задает обернутый ключ шифрования записей пользователя. Ключ
+// задается один раз: если он уже есть, возвращается ErrConflict
+func (m *MemoryDB) SetVaultKey(ctx context.Context, username string, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if user.vaultKey != nil {
+		return models.ErrConflict
+	}
+	user.vaultKey = cloneBytes(key)
+	m.users[username] = user
+	return nil
+}
+
+// ChangePassword заменяет хеш пароля oldHash на newHash, сохраняет параметры
+// kdf нового ключа входа и завершает все сессии пользователя, кроме
+// keepSession. Если передан key, вместе с паролем сохраняется ключ записей,
+// обернутый ключом из нового пароля; без key ключ у пользователя должен
+// отсутствовать. Если пароль успели сменить раньше, возвращается ErrConflict
+func (m *MemoryDB) ChangePassword(ctx context.Context, username, oldHash, newHash string, kdf models.KDFParams, key []byte, keepSession string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if user.password != oldHash || key == nil && user.vaultKey != nil {
+		return models.ErrConflict
+	}
+	user.password, user.kdf = newHash, kdf
+	if key != nil {
+		user.vaultKey = cloneBytes(key)
+	}
+	m.users[username] = user
+	for id, session := range m.sessions {
+		if session.Username == username && id != keepSession {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// CreateSession создает сессию пользователя и возвращает ее id
+func (m *MemoryDB) CreateSession(ctx context.Context, session models.Session) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[session.Username]; !ok {
+		return "", models.ErrNotFound
+	}
+	session.ID = uuid.NewString()
+	session.RefreshHash = cloneBytes(session.RefreshHash)
+	session.CreatedAt = time.Now()
+	m.sessions[session.ID] = session
+	return session.ID, nil
+}
+
+// GetSession возвращает сессию по id. Если сессии нет, возвращается ErrNotFound
+func (m *MemoryDB) GetSession(ctx context.Context, id string) (models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return models.Session{}, models.ErrNotFound
+	}
+	session.RefreshHash = cloneBytes(session.RefreshHash)
+	return session, nil
+}
+
+// RotateSession заменяет хеш refresh-токена oldHash на newHash и продлевает
+// сессию до expiresAt. Если хеш успели заменить раньше, возвращается ErrConflict
+func (m *MemoryDB) RotateSession(ctx context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if !bytes.Equal(session.RefreshHash, oldHash) {
+		return models.ErrConflict
+	}
+	session.RefreshHash = cloneBytes(newHash)
+	session.ExpiresAt = expiresAt
+	m.sessions[id] = session
+	return nil
+}
+
+// DeleteSession завершает сессию. Удаление отсутствующей сессии не ошибка
+func (m *MemoryDB) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// PurgeExpiredSessions удаляет сессии, срок которых истек раньше before
+func (m *MemoryDB) PurgeExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, session := range m.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(m.sessions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// SetTOTPSecret сохраняет секрет TOTP, который ждет подтверждения. Прежний
+// неподтвержденный секрет заменяется, а если второй фактор уже включен,
+// возвращается ErrConflict
+func (m *MemoryDB) SetTOTPSecret(ctx context.Context, username, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if user.totp != nil && user.totp.totp.Enabled {
+		return models.ErrConflict
+	}
+	user.totp = &memoryTOTP{totp: models.TOTP{Secret: secret}}
+	m.users[username] = user
+	return nil
+}
+
+// GetTOTP возвращает второй фактор пользователя. Если секрет не задан,
+// возвращается ErrNotFound
+func (m *MemoryDB) GetTOTP(ctx context.Context, username string) (models.TOTP, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok || user.totp == nil {
+		return models.TOTP{}, models.ErrNotFound
+	}
+	totp := user.totp.totp
+	totp.RecoveryLeft = len(user.totp.recovery)
+	return totp, nil
+}
+
+// EnableTOTP включает второй фактор, подтвержденный кодом шага step, и
+// заменяет коды восстановления хешами recoveryCodes. Если секрета нет,
+// возвращается ErrNotFound, если второй фактор уже включен, ErrConflict
+func (m *MemoryDB) EnableTOTP(ctx context.Context, username string, step int64, recoveryCodes [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok || user.totp == nil {
+		return models.ErrNotFound
+	}
+	if user.totp.totp.Enabled {
+		return models.ErrConflict
+	}
+	recovery := make(map[string]struct{}, len(recoveryCodes))
+	for _, hash := range recoveryCodes {
+		recovery[string(hash)] = struct{}{}
+	}
+	user.totp.totp = models.TOTP{Secret: user.totp.totp.Secret, Enabled: true, LastStep: step}
+	user.totp.recovery = recovery
+	return nil
+}
+
+// UseTOTPStep принимает код шага step и сбрасывает счетчик неверных кодов.
+// Если код этого или более позднего шага уже принят, возвращается ErrConflict,
+// если второй фактор не включен, ErrNotFound
+func (m *MemoryDB) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok || user.totp == nil || !user.totp.totp.Enabled {
+		return models.ErrNotFound
+	}
+	if user.totp.totp.LastStep >= step {
+		return models.ErrConflict
+	}
+	user.totp.totp.LastStep = step
+	user.totp.totp.Failures, user.totp.totp.FailedAt = 0, time.Time{}
+	return nil
+}
+
+// UseRecoveryCode удаляет использованный код восстановления с хешем hash и
+// сбрасывает счетчик неверных кодов. Если такого кода нет, возвращается
+// ErrNotFound
+func (m *MemoryDB) UseRecoveryCode(ctx context.Context, username string, hash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok || user.totp == nil {
+		return models.ErrNotFound
+	}
+	if _, ok := user.totp.recovery[string(hash)]; !ok {
+		return models.ErrNotFound
+	}
+	delete(user.totp.recovery, string(hash))
+	user.totp.totp.Failures, user.totp.totp.FailedAt = 0, time.Time{}
+	return nil
+}
+
+// AddTOTPAttempt учитывает код, введенный в момент at, и возвращает число
+// попыток после последнего принятого кода. Если предыдущая попытка была
+// раньше since, счет начинается заново
+func (m *MemoryDB) AddTOTPAttempt(ctx context.Context, username string, at, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok || user.totp == nil || !user.totp.totp.Enabled {
+		return 0, models.ErrNotFound
+	}
+	second := &user.totp.totp
+	if second.FailedAt.Before(since) {
+		second.Failures = 0
+	}
+	second.Failures++
+	second.FailedAt = at
+	return second.Failures, nil
+}
+
+// DeleteTOTP отключает второй фактор вместе с кодами восстановления.
+// Отключение отсутствующего второго фактора не ошибка
+func (m *MemoryDB) DeleteTOTP(ctx context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[username]; ok {
+		user.totp = nil
+		m.users[username] = user
+	}
+	return nil
+}
+
+// addUsage меняет занятое пользователем место и число его записей, проверяя
+// рост по квоте. Вызывается под блокировкой на запись
+func (m *MemoryDB) addUsage(username string, bytes, records, size int64) error {
+	user, ok := m.users[username]
+	if !ok {
+		return models.ErrQuotaExceeded
+	}
+	if bytes > 0 && m.quota.Bytes > 0 && user.bytes+bytes > m.quota.Bytes ||
+		records > 0 && m.quota.Records > 0 && user.records+records > m.quota.Records ||
+		m.quota.MaxRecordSize > 0 && size > m.quota.MaxRecordSize {
+		return models.ErrQuotaExceeded
+	}
+
+	user.bytes += bytes
+	user.records += records
+	m.users[username] = user
+	return nil
+}
+
+// nextChange увеличивает счетчик изменений пользователя и возвращает его новое значение
+func (m *MemoryDB) nextChange(username string) int64 {
+	user := m.users[username]
+	user.changes++
+	m.users[username] = user
+	return user.changes
+}
+
+// addTombstone оставляет в ленте изменений след окончательно удаленной записи
+func (m *MemoryDB) addTombstone(username, id string) {
+	m.tombstones = append(m.tombstones, memoryTombstone{username: username, id: id, change: m.nextChange(username)})
+}
+
+// GetLastChange возвращает номер последнего изменения записей пользователя
+func (m *MemoryDB) GetLastChange(ctx context.Context, username string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return 0, models.ErrNotFound
+	}
+	return user.changes, nil
+}
+
+// GetChanges возвращает до limit изменений записей пользователя с номером
+// больше since в порядке номеров
+func (m *MemoryDB) GetChanges(ctx context.Context, username string, since int64, limit int) ([]models.Change, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var changes []models.Change
+	for _, r := range m.records {
+		if r.username != username || r.change <= since {
+			continue
+		}
+		change := models.Change{Revision: r.change, Deleted: r.trashed(), Record: models.Record{Id: r.record.Id}}
+		if !change.Deleted {
+			change.Record = r.record
+			change.Record.Data = cloneBytes(r.record.Data)
+			change.Record.Size, change.Record.CreatedAt, change.Record.UpdatedAt = r.size, r.createdAt, r.updatedAt
+		}
+		changes = append(changes, change)
+	}
+	for _, t := range m.tombstones {
+		if t.username == username && t.change > since {
+			changes = append(changes, models.Change{Revision: t.change, Deleted: true, Record: models.Record{Id: t.id}})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Revision < changes[j].Revision })
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+// RotateKeys ничего не делает: память не хранит данные на диске, поэтому
+// шифрование на хранении к ней не применяется
+func (m *MemoryDB) RotateKeys(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// MoveDataToBlobs выносит данные BINARY записей и их версий во внешнее
+// хранилище через put и оставляет в записи только ссылку
+func (m *MemoryDB) MoveDataToBlobs(ctx context.Context, put func(ctx context.Context, data []byte) (models.BlobRef, error)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	moved := 0
+	for id, r := range m.records {
+		if r.record.TypeRecord != models.Binary {
+			continue
+		}
+		if r.record.Blob.Key == "" {
+			ref, err := put(ctx, r.record.Data)
+			if err != nil {
+				return moved, err
+			}
+			r.record.Data, r.record.Blob = []byte{}, ref
+			m.records[id] = r
+			moved++
+		}
+		for i, h := range r.history {
+			if h.blob.Key != "" {
+				continue
+			}
+			ref, err := put(ctx, h.data)
+			if err != nil {
+				return moved, err
+			}
+			r.history[i].data, r.history[i].blob = []byte{}, ref
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// SealBlobs заменяет незашифрованные blob зашифрованными копиями, которые
+// создает seal. Прежние blob остаются без ссылок и удаляются PurgeOrphanBlobs
+func (m *MemoryDB) SealBlobs(ctx context.Context, seal func(ctx context.Context, ref models.BlobRef) (models.BlobRef, error)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sealed := make(map[string]models.BlobRef)
+	replace := func(ref models.BlobRef) (models.BlobRef, error) {
+		if ref.Key == "" || ref.KeyID != "" {
+			return ref, nil
+		}
+		if done, ok := sealed[ref.Key]; ok {
+			return done, nil
+		}
+		done, err := seal(ctx, ref)
+		if err != nil {
+			return models.BlobRef{}, err
+		}
+		sealed[ref.Key] = done
+		return done, nil
+	}
+
+	for id, r := range m.records {
+		ref, err := replace(r.record.Blob)
+		if err != nil {
+			return len(sealed), err
+		}
+		r.record.Blob = ref
+		for i, h := range r.history {
+			if r.history[i].blob, err = replace(h.blob); err != nil {
+				return len(sealed), err
+			}
+		}
+		m.records[id] = r
+	}
+	return len(sealed), nil
+}
+
+func (r memoryRecord) trashed() bool {
+	return !r.record.DeletedAt.IsZero()
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ALTER COLUMN id TYPE BIGINT;
+ALTER TABLE records ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('records', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM records;
+
+ALTER TABLE records ADD COLUMN public_id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE records ADD CONSTRAINT records_public_id_key UNIQUE (public_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE records DROP CONSTRAINT IF EXISTS records_public_id_key;
+ALTER TABLE records DROP COLUMN IF EXISTS public_id;
+ALTER TABLE records ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE records ALTER COLUMN id TYPE INT;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN revision INT NOT NULL DEFAULT 1;
+ALTER TABLE records ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS record_revisions (
+    record_id BIGINT NOT NULL REFERENCES records(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    user_data BYTEA NOT NULL,
+    meta TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (record_id, revision)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS record_revisions;
+ALTER TABLE records DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE records DROP COLUMN IF EXISTS revision;
+-- +goose StatementEnd
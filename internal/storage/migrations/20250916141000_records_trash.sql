@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS records_deleted_at_idx ON records (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM records WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS records_deleted_at_idx;
+ALTER TABLE records DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS uploads (
+    upload_id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    meta TEXT,
+    size BIGINT NOT NULL,
+    checksum BYTEA NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    hash_state BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id UUID NOT NULL REFERENCES uploads(upload_id) ON DELETE CASCADE,
+    chunk_offset BIGINT NOT NULL,
+    chunk_data BYTEA NOT NULL,
+    PRIMARY KEY (upload_id, chunk_offset)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS uploads;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN blob_key TEXT;
+ALTER TABLE records ADD COLUMN blob_size BIGINT;
+ALTER TABLE records ADD COLUMN blob_hash BYTEA;
+
+ALTER TABLE record_revisions ADD COLUMN blob_key TEXT;
+ALTER TABLE record_revisions ADD COLUMN blob_size BIGINT;
+ALTER TABLE record_revisions ADD COLUMN blob_hash BYTEA;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS blob_hash;
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS blob_size;
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS blob_key;
+
+ALTER TABLE records DROP COLUMN IF EXISTS blob_hash;
+ALTER TABLE records DROP COLUMN IF EXISTS blob_size;
+ALTER TABLE records DROP COLUMN IF EXISTS blob_key;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN key_id TEXT;
+ALTER TABLE records ADD COLUMN data_key BYTEA;
+ALTER TABLE records ADD COLUMN blob_key_id TEXT;
+ALTER TABLE records ADD COLUMN blob_data_key BYTEA;
+
+ALTER TABLE record_revisions ADD COLUMN key_id TEXT;
+ALTER TABLE record_revisions ADD COLUMN data_key BYTEA;
+ALTER TABLE record_revisions ADD COLUMN blob_key_id TEXT;
+ALTER TABLE record_revisions ADD COLUMN blob_data_key BYTEA;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS blob_data_key;
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS blob_key_id;
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS data_key;
+ALTER TABLE record_revisions DROP COLUMN IF EXISTS key_id;
+
+ALTER TABLE records DROP COLUMN IF EXISTS blob_data_key;
+ALTER TABLE records DROP COLUMN IF EXISTS blob_key_id;
+ALTER TABLE records DROP COLUMN IF EXISTS data_key;
+ALTER TABLE records DROP COLUMN IF EXISTS key_id;
+-- +goose StatementEnd
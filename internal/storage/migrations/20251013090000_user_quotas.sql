@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN used_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN record_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN quota_bytes BIGINT;
+ALTER TABLE users ADD COLUMN quota_records BIGINT;
+ALTER TABLE users ADD COLUMN max_record_size BIGINT;
+
+ALTER TABLE records ADD COLUMN record_size BIGINT NOT NULL DEFAULT 0;
+
+-- у зашифрованных записей размер считается по зашифрованным данным, то есть с небольшим запасом
+UPDATE records SET record_size = COALESCE(blob_size, octet_length(user_data)) + COALESCE(octet_length(meta), 0);
+
+UPDATE users SET
+    used_bytes = (SELECT COALESCE(SUM(record_size), 0) FROM records WHERE records.username = users.username),
+    record_count = (SELECT COUNT(*) FROM records WHERE records.username = users.username);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE records DROP COLUMN IF EXISTS record_size;
+
+ALTER TABLE users DROP COLUMN IF EXISTS max_record_size;
+ALTER TABLE users DROP COLUMN IF EXISTS quota_records;
+ALTER TABLE users DROP COLUMN IF EXISTS quota_bytes;
+ALTER TABLE users DROP COLUMN IF EXISTS record_count;
+ALTER TABLE users DROP COLUMN IF EXISTS used_bytes;
+-- +goose StatementEnd
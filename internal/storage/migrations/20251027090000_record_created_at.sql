@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+UPDATE records r SET created_at = COALESCE(
+    (SELECT MIN(h.created_at) FROM record_revisions h WHERE h.record_id = r.id), r.updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE records DROP COLUMN IF EXISTS created_at;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE records ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+
+UPDATE records r SET change_seq = n.seq
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY username ORDER BY id) AS seq FROM records) n
+WHERE r.id = n.id;
+UPDATE users u SET change_seq = COALESCE((SELECT MAX(r.change_seq) FROM records r WHERE r.username = u.username), 0);
+
+CREATE INDEX IF NOT EXISTS records_changes_idx ON records (username, change_seq);
+
+CREATE TABLE IF NOT EXISTS record_tombstones (
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    change_seq BIGINT NOT NULL,
+    public_id UUID NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (username, change_seq)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS record_tombstones;
+DROP INDEX IF EXISTS records_changes_idx;
+ALTER TABLE records DROP COLUMN IF EXISTS change_seq;
+ALTER TABLE users DROP COLUMN IF EXISTS change_seq;
+-- +goose StatementEnd
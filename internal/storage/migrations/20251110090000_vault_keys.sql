@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN kdf_salt BYTEA;
+ALTER TABLE users ADD COLUMN kdf_time INTEGER;
+ALTER TABLE users ADD COLUMN kdf_memory INTEGER;
+ALTER TABLE users ADD COLUMN kdf_threads SMALLINT;
+ALTER TABLE users ADD COLUMN wrapped_key BYTEA;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS wrapped_key;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_threads;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_memory;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_time;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_salt;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- ALTER TYPE ... ADD VALUE до PostgreSQL 12 нельзя выполнять в транзакции.
+-- Шаги отката отправляются одним запросом и выполняются атомарно и без нее
+-- +goose NO TRANSACTION
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE record_type ADD VALUE IF NOT EXISTS 'OTP';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- значение из enum удалить нельзя, поэтому тип пересоздается без OTP вместе с
+-- записями этого типа
+DELETE FROM records WHERE type_record = 'OTP';
+
+UPDATE users SET
+    used_bytes = (SELECT COALESCE(SUM(record_size), 0) FROM records WHERE records.username = users.username),
+    record_count = (SELECT COUNT(*) FROM records WHERE records.username = users.username);
+
+ALTER TYPE record_type RENAME TO record_type_old;
+CREATE TYPE record_type AS ENUM (
+    'LOGIN',
+    'TEXT',
+    'CARD',
+    'BINARY'
+);
+ALTER TABLE records ALTER COLUMN type_record TYPE record_type USING type_record::text::record_type;
+DROP TYPE record_type_old;
+-- +goose StatementEnd
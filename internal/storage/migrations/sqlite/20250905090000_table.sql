@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS users (
+    username TEXT NOT NULL PRIMARY KEY,
+    user_password TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS records (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_id TEXT NOT NULL UNIQUE,
+    type_record TEXT NOT NULL CHECK (type_record IN ('LOGIN', 'TEXT', 'CARD', 'BINARY')),
+    user_data BLOB NOT NULL,
+    meta TEXT,
+    username TEXT REFERENCES users(username) ON DELETE SET NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS records;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
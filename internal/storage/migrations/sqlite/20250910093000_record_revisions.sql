@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE records ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE records SET updated_at = CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS record_revisions (
+    record_id INTEGER NOT NULL REFERENCES records(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    user_data BLOB NOT NULL,
+    meta TEXT,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (record_id, revision)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS record_revisions;
+ALTER TABLE records DROP COLUMN updated_at;
+ALTER TABLE records DROP COLUMN revision;
+-- +goose StatementEnd
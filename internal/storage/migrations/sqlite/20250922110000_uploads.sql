@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS uploads (
+    upload_id TEXT NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    meta TEXT,
+    size INTEGER NOT NULL,
+    checksum BLOB NOT NULL,
+    received INTEGER NOT NULL DEFAULT 0,
+    hash_state BLOB,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id TEXT NOT NULL REFERENCES uploads(upload_id) ON DELETE CASCADE,
+    chunk_offset INTEGER NOT NULL,
+    chunk_data BLOB NOT NULL,
+    PRIMARY KEY (upload_id, chunk_offset)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS uploads;
+-- +goose StatementEnd
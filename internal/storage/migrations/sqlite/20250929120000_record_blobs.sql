@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN blob_key TEXT;
+ALTER TABLE records ADD COLUMN blob_size INTEGER;
+ALTER TABLE records ADD COLUMN blob_hash BLOB;
+
+ALTER TABLE record_revisions ADD COLUMN blob_key TEXT;
+ALTER TABLE record_revisions ADD COLUMN blob_size INTEGER;
+ALTER TABLE record_revisions ADD COLUMN blob_hash BLOB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE record_revisions DROP COLUMN blob_hash;
+ALTER TABLE record_revisions DROP COLUMN blob_size;
+ALTER TABLE record_revisions DROP COLUMN blob_key;
+
+ALTER TABLE records DROP COLUMN blob_hash;
+ALTER TABLE records DROP COLUMN blob_size;
+ALTER TABLE records DROP COLUMN blob_key;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN key_id TEXT;
+ALTER TABLE records ADD COLUMN data_key BLOB;
+ALTER TABLE records ADD COLUMN blob_key_id TEXT;
+ALTER TABLE records ADD COLUMN blob_data_key BLOB;
+
+ALTER TABLE record_revisions ADD COLUMN key_id TEXT;
+ALTER TABLE record_revisions ADD COLUMN data_key BLOB;
+ALTER TABLE record_revisions ADD COLUMN blob_key_id TEXT;
+ALTER TABLE record_revisions ADD COLUMN blob_data_key BLOB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE record_revisions DROP COLUMN blob_data_key;
+ALTER TABLE record_revisions DROP COLUMN blob_key_id;
+ALTER TABLE record_revisions DROP COLUMN data_key;
+ALTER TABLE record_revisions DROP COLUMN key_id;
+
+ALTER TABLE records DROP COLUMN blob_data_key;
+ALTER TABLE records DROP COLUMN blob_key_id;
+ALTER TABLE records DROP COLUMN data_key;
+ALTER TABLE records DROP COLUMN key_id;
+-- +goose StatementEnd
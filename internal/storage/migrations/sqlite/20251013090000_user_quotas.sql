@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN used_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN record_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN quota_bytes INTEGER;
+ALTER TABLE users ADD COLUMN quota_records INTEGER;
+ALTER TABLE users ADD COLUMN max_record_size INTEGER;
+
+ALTER TABLE records ADD COLUMN record_size INTEGER NOT NULL DEFAULT 0;
+
+-- у зашифрованных записей размер считается по зашифрованным данным, то есть с небольшим запасом
+UPDATE records SET record_size = COALESCE(blob_size, length(user_data)) + COALESCE(length(CAST(meta AS BLOB)), 0);
+
+UPDATE users SET
+    used_bytes = (SELECT COALESCE(SUM(record_size), 0) FROM records WHERE records.username = users.username),
+    record_count = (SELECT COUNT(*) FROM records WHERE records.username = users.username);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE records DROP COLUMN record_size;
+
+ALTER TABLE users DROP COLUMN max_record_size;
+ALTER TABLE users DROP COLUMN quota_records;
+ALTER TABLE users DROP COLUMN quota_bytes;
+ALTER TABLE users DROP COLUMN record_count;
+ALTER TABLE users DROP COLUMN used_bytes;
+-- +goose StatementEnd
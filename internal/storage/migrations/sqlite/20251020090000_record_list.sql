@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS records_list_idx ON records (username, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS records_list_type_idx ON records (username, type_record, id) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS records_list_type_idx;
+DROP INDEX IF EXISTS records_list_idx;
+-- +goose StatementEnd
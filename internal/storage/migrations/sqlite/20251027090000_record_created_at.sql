@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE records ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE records SET created_at = COALESCE(
+    (SELECT MIN(h.created_at) FROM record_revisions h WHERE h.record_id = records.id), updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE records DROP COLUMN created_at;
+-- +goose StatementEnd
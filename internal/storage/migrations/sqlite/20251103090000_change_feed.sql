@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE records ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE records SET change_seq = (SELECT COUNT(*) FROM records r
+    WHERE r.username = records.username AND r.id <= records.id);
+UPDATE users SET change_seq = COALESCE((SELECT MAX(r.change_seq) FROM records r WHERE r.username = users.username), 0);
+
+CREATE INDEX IF NOT EXISTS records_changes_idx ON records (username, change_seq);
+
+CREATE TABLE IF NOT EXISTS record_tombstones (
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    change_seq INTEGER NOT NULL,
+    public_id TEXT NOT NULL,
+    deleted_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (username, change_seq)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS record_tombstones;
+DROP INDEX IF EXISTS records_changes_idx;
+ALTER TABLE records DROP COLUMN change_seq;
+ALTER TABLE users DROP COLUMN change_seq;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN kdf_salt BLOB;
+ALTER TABLE users ADD COLUMN kdf_time INTEGER;
+ALTER TABLE users ADD COLUMN kdf_memory INTEGER;
+ALTER TABLE users ADD COLUMN kdf_threads INTEGER;
+ALTER TABLE users ADD COLUMN wrapped_key BLOB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN wrapped_key;
+ALTER TABLE users DROP COLUMN kdf_threads;
+ALTER TABLE users DROP COLUMN kdf_memory;
+ALTER TABLE users DROP COLUMN kdf_time;
+ALTER TABLE users DROP COLUMN kdf_salt;
+-- +goose StatementEnd
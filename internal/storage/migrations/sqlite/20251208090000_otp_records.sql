@@ -0,0 +1,137 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SQLite не умеет менять CHECK, поэтому records пересоздается. Вместе с ней
+-- пересоздается record_revisions: иначе удаление старой records каскадно
+-- удалило бы историю версий
+CREATE TABLE records_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_id TEXT NOT NULL UNIQUE,
+    type_record TEXT NOT NULL CHECK (type_record IN ('LOGIN', 'TEXT', 'CARD', 'BINARY', 'OTP')),
+    user_data BLOB NOT NULL,
+    meta TEXT,
+    username TEXT REFERENCES users(username) ON DELETE SET NULL,
+    revision INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    deleted_at TIMESTAMP,
+    blob_key TEXT,
+    blob_size INTEGER,
+    blob_hash BLOB,
+    key_id TEXT,
+    data_key BLOB,
+    blob_key_id TEXT,
+    blob_data_key BLOB,
+    record_size INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    change_seq INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO records_new (id, public_id, type_record, user_data, meta, username, revision, updated_at, deleted_at,
+        blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key, record_size, created_at, change_seq)
+    SELECT id, public_id, type_record, user_data, meta, username, revision, updated_at, deleted_at,
+        blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key, record_size, created_at, change_seq
+    FROM records;
+
+-- id удаленных записей не должны выдаваться повторно
+UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'records')
+    WHERE name = 'records_new' AND EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'records');
+
+CREATE TABLE record_revisions_new (
+    record_id INTEGER NOT NULL REFERENCES records_new(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    user_data BLOB NOT NULL,
+    meta TEXT,
+    created_at TIMESTAMP NOT NULL,
+    blob_key TEXT,
+    blob_size INTEGER,
+    blob_hash BLOB,
+    key_id TEXT,
+    data_key BLOB,
+    blob_key_id TEXT,
+    blob_data_key BLOB,
+    PRIMARY KEY (record_id, revision)
+);
+
+INSERT INTO record_revisions_new (record_id, revision, user_data, meta, created_at, blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key)
+    SELECT record_id, revision, user_data, meta, created_at, blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key
+    FROM record_revisions;
+
+DROP TABLE record_revisions;
+DROP TABLE records;
+ALTER TABLE records_new RENAME TO records;
+ALTER TABLE record_revisions_new RENAME TO record_revisions;
+
+CREATE INDEX IF NOT EXISTS records_deleted_at_idx ON records (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS records_list_idx ON records (username, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS records_list_type_idx ON records (username, type_record, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS records_changes_idx ON records (username, change_seq);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM records WHERE type_record = 'OTP';
+
+UPDATE users SET
+    used_bytes = (SELECT COALESCE(SUM(record_size), 0) FROM records WHERE records.username = users.username),
+    record_count = (SELECT COUNT(*) FROM records WHERE records.username = users.username);
+
+CREATE TABLE records_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_id TEXT NOT NULL UNIQUE,
+    type_record TEXT NOT NULL CHECK (type_record IN ('LOGIN', 'TEXT', 'CARD', 'BINARY')),
+    user_data BLOB NOT NULL,
+    meta TEXT,
+    username TEXT REFERENCES users(username) ON DELETE SET NULL,
+    revision INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    deleted_at TIMESTAMP,
+    blob_key TEXT,
+    blob_size INTEGER,
+    blob_hash BLOB,
+    key_id TEXT,
+    data_key BLOB,
+    blob_key_id TEXT,
+    blob_data_key BLOB,
+    record_size INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    change_seq INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO records_old (id, public_id, type_record, user_data, meta, username, revision, updated_at, deleted_at,
+        blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key, record_size, created_at, change_seq)
+    SELECT id, public_id, type_record, user_data, meta, username, revision, updated_at, deleted_at,
+        blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key, record_size, created_at, change_seq
+    FROM records;
+
+UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'records')
+    WHERE name = 'records_old' AND EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'records');
+
+CREATE TABLE record_revisions_old (
+    record_id INTEGER NOT NULL REFERENCES records_old(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    user_data BLOB NOT NULL,
+    meta TEXT,
+    created_at TIMESTAMP NOT NULL,
+    blob_key TEXT,
+    blob_size INTEGER,
+    blob_hash BLOB,
+    key_id TEXT,
+    data_key BLOB,
+    blob_key_id TEXT,
+    blob_data_key BLOB,
+    PRIMARY KEY (record_id, revision)
+);
+
+INSERT INTO record_revisions_old (record_id, revision, user_data, meta, created_at, blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key)
+    SELECT record_id, revision, user_data, meta, created_at, blob_key, blob_size, blob_hash, key_id, data_key, blob_key_id, blob_data_key
+    FROM record_revisions;
+
+DROP TABLE record_revisions;
+DROP TABLE records;
+ALTER TABLE records_old RENAME TO records;
+ALTER TABLE record_revisions_old RENAME TO record_revisions;
+
+CREATE INDEX IF NOT EXISTS records_deleted_at_idx ON records (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS records_list_idx ON records (username, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS records_list_type_idx ON records (username, type_record, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS records_changes_idx ON records (username, change_seq);
+-- +goose StatementEnd
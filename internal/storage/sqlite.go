@@ -0,0 +1,1511 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
+	"go.uber.org/zap"
+)
+
+// SQLiteDB хранилище на основе файла SQLite для однонодовых и dev установок
+type SQLiteDB struct {
+	logger       zap.SugaredLogger
+	db           *sql.DB
+	historyLimit int
+	keys         *envelope.Keyring
+	quota        models.Quota
+}
+
+// NewSQLiteDB конструктор для структуры. Если keys не nil, данные записей
+// шифруются ключами, обернутыми мастер-ключом
+func NewSQLiteDB(config config.Config, keys *envelope.Keyring, logger zap.SugaredLogger) *SQLiteDB {
+	db, err := sql.Open("sqlite3", sqliteDSN(config.DatabaseDsn))
+	if err != nil {
+		logger.Errorw("Problem with opening sqlite db ", err)
+		return nil
+	}
+	// SQLite допускает только одного писателя, поэтому держим одно соединение
+	db.SetMaxOpenConns(1)
+
+	return &SQLiteDB{logger: logger, db: db, historyLimit: config.HistoryLimit, keys: keys, quota: config.Quota()}
+}
+
+func (s *SQLiteDB) CheckUsernameExists(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE username = ?
+		)
+	`, username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("checking user existence: %w", err)
+	}
+	return exists, nil
+}
+
+func (s *SQLiteDB) AddUserToDB(ctx context.Context, username, password string, kdf models.KDFParams) error {
+	query := `
+		INSERT INTO users (username, user_password, kdf_salt, kdf_time, kdf_memory, kdf_threads)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, query, username, password, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads)
+	return err
+}
+
+func (s *SQLiteDB) GetUserPassword(ctx context.Context, username string) (string, error) {
+	var password string
+
+	query := `SELECT user_password FROM users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&password)
+	if err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+func (s *SQLiteDB) StoreDataToDB(ctx context.Context, record models.Record, username string) (string, error) {
+	sealed, err := sealRecord(s.keys, record.Data, record.Meta)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	size := recordSize(record)
+	if err := s.addUsage(ctx, tx, username, size, 1, size); err != nil {
+		return "", err
+	}
+
+	change, err := s.nextChange(ctx, tx, username)
+	if err != nil {
+		return "", err
+	}
+
+	id := uuid.NewString()
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(record.Blob)
+	now := time.Now().UTC()
+	query := `INSERT INTO records (public_id, type_record, user_data, meta, username, created_at, updated_at,
+					blob_key, blob_size, blob_hash, blob_key_id, blob_data_key, key_id, data_key, record_size, change_seq)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, id, record.TypeRecord, sealed.data, sealed.meta, username, now, now,
+		blobKey, blobSize, blobHash, blobKeyID, blobDataKey, sealed.keyID, sealed.dataKey, size, change)
+	if err != nil {
+		return "", err
+	}
+	return id, tx.Commit()
+}
+
+func (s *SQLiteDB) GetUserByDataID(ctx context.Context, id string) (string, error) {
+	var username string
+	query := `SELECT username FROM records WHERE public_id = ?`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNotFound
+		}
+		return "", err
+	}
+	return username, nil
+}
+
+func (s *SQLiteDB) RetrieveDataFromDB(ctx context.Context, id string) (models.Record, error) {
+	var record models.Record
+	var keyID string
+	var dataKey []byte
+
+	query := `SELECT public_id, type_record, revision, user_data, meta,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE public_id = ? AND deleted_at IS NULL`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&record.Id, &record.TypeRecord, &record.Version, &record.Data, &record.Meta,
+		&record.Blob.Key, &record.Blob.Size, &record.Blob.Hash, &record.Blob.KeyID, &record.Blob.DataKey, &keyID, &dataKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Record{}, models.ErrNotFound
+		}
+		return models.Record{}, err
+	}
+	return record, openRecord(s.keys, &record, keyID, dataKey)
+}
+
+// UpdateDataInDB переносит текущую версию записи в историю и сохраняет новую.
+// Если record.Version не 0, он должен совпадать с текущей версией записи,
+// иначе возвращается ErrVersionMismatch
+func (s *SQLiteDB) UpdateDataInDB(ctx context.Context, record models.Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var recordID, oldSize int64
+	var revision int
+	var username string
+	query := `SELECT id, revision, username, record_size FROM records
+			WHERE public_id = ? AND deleted_at IS NULL`
+	err = tx.QueryRowContext(ctx, query, record.Id).Scan(&recordID, &revision, &username, &oldSize)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+	if record.Version != 0 && record.Version != revision {
+		return models.ErrVersionMismatch
+	}
+
+	size := recordSize(record)
+	if err := s.addUsage(ctx, tx, username, size-oldSize, 0, size); err != nil {
+		return err
+	}
+
+	if s.historyLimit > 0 {
+		query = `INSERT INTO record_revisions (record_id, revision, user_data, meta, created_at,
+					blob_key, blob_size, blob_hash, blob_key_id, blob_data_key, key_id, data_key)
+				SELECT id, revision, user_data, meta, updated_at, blob_key, blob_size, blob_hash,
+					blob_key_id, blob_data_key, key_id, data_key
+				FROM records WHERE id = ?`
+		_, err = tx.ExecContext(ctx, query, recordID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `DELETE FROM record_revisions WHERE record_id = ? AND revision <= ?`
+	_, err = tx.ExecContext(ctx, query, recordID, revision-s.historyLimit)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := sealRecord(s.keys, record.Data, record.Meta)
+	if err != nil {
+		return err
+	}
+
+	change, err := s.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(record.Blob)
+	query = `UPDATE records SET user_data = ?, meta = ?, blob_key = ?, blob_size = ?, blob_hash = ?,
+				blob_key_id = ?, blob_data_key = ?, key_id = ?, data_key = ?, record_size = ?,
+				revision = revision + 1, updated_at = ?, change_seq = ?
+			WHERE id = ?`
+	_, err = tx.ExecContext(ctx, query, sealed.data, sealed.meta, blobKey, blobSize, blobHash, blobKeyID, blobDataKey,
+		sealed.keyID, sealed.dataKey, size, time.Now().UTC(), change, recordID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRevisions возвращает текущую и сохраненные версии записи, начиная с новой
+func (s *SQLiteDB) GetRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	var revisions []models.Revision
+	query := `SELECT revision, meta, updated_at, 1, COALESCE(key_id, ''), data_key
+			FROM records WHERE public_id = ?
+			UNION ALL
+			SELECT h.revision, h.meta, h.created_at, 0, COALESCE(h.key_id, ''), h.data_key
+			FROM record_revisions h JOIN records r ON r.id = h.record_id
+			WHERE r.public_id = ?
+			ORDER BY 1 DESC`
+	rows, err := s.db.QueryContext(ctx, query, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision models.Revision
+		var keyID string
+		var dataKey []byte
+
+		err := rows.Scan(&revision.Revision, &revision.Meta, &revision.CreatedAt, &revision.Current, &keyID, &dataKey)
+		if err != nil {
+			return nil, err
+		}
+		revision.Meta, err = openMeta(s.keys, revision.Meta, keyID, dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, models.ErrNotFound
+	}
+	return revisions, nil
+}
+
+// RetrieveRevisionFromDB возвращает содержимое записи в указанной версии
+func (s *SQLiteDB) RetrieveRevisionFromDB(ctx context.Context, id string, revision int) (models.Record, error) {
+	var record models.Record
+	var keyID string
+	var dataKey []byte
+
+	query := `SELECT public_id, type_record, revision, user_data, meta,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE public_id = ? AND revision = ?
+			UNION ALL
+			SELECT r.public_id, r.type_record, h.revision, h.user_data, h.meta,
+				COALESCE(h.blob_key, ''), COALESCE(h.blob_size, 0), h.blob_hash, COALESCE(h.blob_key_id, ''), h.blob_data_key, COALESCE(h.key_id, ''), h.data_key
+			FROM record_revisions h JOIN records r ON r.id = h.record_id
+			WHERE r.public_id = ? AND h.revision = ?`
+	err := s.db.QueryRowContext(ctx, query, id, revision, id, revision).Scan(&record.Id, &record.TypeRecord, &record.Version, &record.Data, &record.Meta,
+		&record.Blob.Key, &record.Blob.Size, &record.Blob.Hash, &record.Blob.KeyID, &record.Blob.DataKey, &keyID, &dataKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Record{}, models.ErrNotFound
+		}
+		return models.Record{}, err
+	}
+	return record, openRecord(s.keys, &record, keyID, dataKey)
+}
+
+// GetListData возвращает страницу записей пользователя по фильтру и курсор
+// следующей страницы, пустой на последней странице
+func (s *SQLiteDB) GetListData(ctx context.Context, username string, filter models.ListFilter) ([]models.Record, string, error) {
+	return paginate(filter, func(after int64, limit int) ([]listedRecord, error) {
+		query, args := listQuery(username, filter, after, limit, func(int) string { return "?" })
+		rows, err := s.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var batch []listedRecord
+		for rows.Next() {
+			var r listedRecord
+			var keyID string
+			var dataKey []byte
+
+			err := rows.Scan(&r.seq, &r.record.Id, &r.record.TypeRecord, &r.record.Version, &r.record.Data, &r.record.Meta,
+				&r.record.Size, &r.record.CreatedAt, &r.record.UpdatedAt,
+				&r.record.Blob.Key, &r.record.Blob.Size, &r.record.Blob.Hash, &r.record.Blob.KeyID, &r.record.Blob.DataKey, &keyID, &dataKey)
+			if err != nil {
+				return nil, err
+			}
+			if filter.MetadataOnly {
+				r.record.Meta, err = openMeta(s.keys, r.record.Meta, keyID, dataKey)
+			} else {
+				err = openRecord(s.keys, &r.record, keyID, dataKey)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			batch = append(batch, r)
+		}
+		return batch, rows.Err()
+	})
+}
+
+func (s *SQLiteDB) CheckRecordExist(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM records WHERE public_id = ? AND deleted_at IS NULL
+		)`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("checking existence: %w", err)
+	}
+	return exists, nil
+}
+
+// DeleteDataFromDB перемещает запись в корзину. Если version не 0, запись
+// удаляется, только когда ее текущая версия совпадает с version
+func (s *SQLiteDB) DeleteDataFromDB(ctx context.Context, id string, version int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var revision int
+	var username string
+	query := `SELECT revision, username FROM records WHERE public_id = ? AND deleted_at IS NULL`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&revision, &username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+	if version != 0 && revision != version {
+		return models.ErrVersionMismatch
+	}
+
+	change, err := s.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE records SET deleted_at = ?, change_seq = ? WHERE public_id = ?`
+	_, err = tx.ExecContext(ctx, query, time.Now().UTC(), change, id)
+	if err != nil {
+		s.logger.Errorw("Problem with deleting from db: ", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTrashList возвращает записи пользователя, находящиеся в корзине, без
+// их данных
+func (s *SQLiteDB) GetTrashList(ctx context.Context, username string) ([]models.Record, error) {
+	var records []models.Record
+	query := `SELECT public_id, type_record, revision, meta, record_size, deleted_at, COALESCE(key_id, ''), data_key
+			FROM records WHERE username = ? AND deleted_at IS NOT NULL ORDER BY deleted_at`
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.Record
+		var keyID string
+		var dataKey []byte
+
+		err := rows.Scan(&record.Id, &record.TypeRecord, &record.Version, &record.Meta, &record.Size, &record.DeletedAt, &keyID, &dataKey)
+		if err != nil {
+			return nil, err
+		}
+		if record.Meta, err = openMeta(s.keys, record.Meta, keyID, dataKey); err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// RestoreDataInDB возвращает запись из корзины
+func (s *SQLiteDB) RestoreDataInDB(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	query := `SELECT username FROM records WHERE public_id = ? AND deleted_at IS NOT NULL`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+
+	change, err := s.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE records SET deleted_at = NULL, change_seq = ? WHERE public_id = ?`
+	_, err = tx.ExecContext(ctx, query, change, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeDataFromDB окончательно удаляет запись из корзины и освобождает занятое ей место
+func (s *SQLiteDB) PurgeDataFromDB(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	var size int64
+	query := `DELETE FROM records
+				WHERE public_id = ? AND deleted_at IS NOT NULL
+				RETURNING username, record_size`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&username, &size)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		s.logger.Errorw("Problem with purging from db: ", err)
+		return err
+	}
+
+	if err := s.addUsage(ctx, tx, username, -size, -1, 0); err != nil {
+		return err
+	}
+	if err := s.addTombstone(ctx, tx, username, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeExpiredTrash окончательно удаляет записи, попавшие в корзину раньше before
+func (s *SQLiteDB) PurgeExpiredTrash(ctx context.Context, before time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var expired []struct{ username, id string }
+	query := `SELECT username, public_id FROM records
+				WHERE deleted_at IS NOT NULL AND deleted_at < ? AND username IS NOT NULL`
+	rows, err := tx.QueryContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var r struct{ username, id string }
+		if err := rows.Scan(&r.username, &r.id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, r := range expired {
+		if err := s.addTombstone(ctx, tx, r.username, r.id); err != nil {
+			return 0, err
+		}
+	}
+
+	query = `UPDATE users SET
+				used_bytes = used_bytes - (SELECT COALESCE(SUM(record_size), 0) FROM records
+					WHERE records.username = users.username AND deleted_at IS NOT NULL AND deleted_at < ?1),
+				record_count = record_count - (SELECT COUNT(*) FROM records
+					WHERE records.username = users.username AND deleted_at IS NOT NULL AND deleted_at < ?1)`
+	_, err = tx.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	query = `DELETE FROM records
+				WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	result, err := tx.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), tx.Commit()
+}
+
+// CreateUpload регистрирует новую потоковую загрузку
+func (s *SQLiteDB) CreateUpload(ctx context.Context, upload models.Upload) (string, error) {
+	id := uuid.NewString()
+	query := `INSERT INTO uploads (upload_id, username, meta, size, checksum, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, id, upload.Username, upload.Meta, upload.Size, upload.Checksum, time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *SQLiteDB) GetUpload(ctx context.Context, id string) (models.Upload, error) {
+	var upload models.Upload
+
+	query := `SELECT upload_id, username, meta, size, received, checksum, hash_state, created_at
+			FROM uploads WHERE upload_id = ?`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&upload.ID, &upload.Username, &upload.Meta, &upload.Size,
+		&upload.Received, &upload.Checksum, &upload.HashState, &upload.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Upload{}, models.ErrNotFound
+		}
+		return models.Upload{}, err
+	}
+	return upload, nil
+}
+
+// AppendUploadChunk дописывает часть данных, если offset совпадает с уже принятым объемом
+func (s *SQLiteDB) AppendUploadChunk(ctx context.Context, id string, offset int64, data, hashState []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE uploads SET received = received + ?, hash_state = ?
+				WHERE upload_id = ? AND received = ?`
+	result, err := tx.ExecContext(ctx, query, len(data), hashState, id, offset)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); err != nil {
+		return models.ErrInvalidOffset
+	}
+
+	query = `INSERT INTO upload_chunks (upload_id, chunk_offset, chunk_data)
+				VALUES (?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, id, offset, data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CompleteUpload переносит полностью принятую загрузку в новую BINARY запись.
+// Если данные уже сохранены во внешнем хранилище, запись получает ссылку blob
+func (s *SQLiteDB) CompleteUpload(ctx context.Context, id string, blob models.BlobRef) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var username, meta string
+	query := `SELECT username, meta FROM uploads WHERE upload_id = ? AND received = size`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&username, &meta)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNotFound
+		}
+		return "", err
+	}
+
+	data := []byte{}
+	if blob.Key == "" {
+		data, err = readUploadData(ctx, tx, id)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	size := recordSize(models.Record{Data: data, Meta: meta, Blob: blob})
+	if err := s.addUsage(ctx, tx, username, size, 1, size); err != nil {
+		return "", err
+	}
+
+	sealed, err := sealRecord(s.keys, data, meta)
+	if err != nil {
+		return "", err
+	}
+
+	change, err := s.nextChange(ctx, tx, username)
+	if err != nil {
+		return "", err
+	}
+
+	recordID := uuid.NewString()
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(blob)
+	now := time.Now().UTC()
+	query = `INSERT INTO records (public_id, type_record, user_data, meta, username, created_at, updated_at,
+					blob_key, blob_size, blob_hash, blob_key_id, blob_data_key, key_id, data_key, record_size, change_seq)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, recordID, models.Binary, sealed.data, sealed.meta, username, now, now,
+		blobKey, blobSize, blobHash, blobKeyID, blobDataKey, sealed.keyID, sealed.dataKey, size, change)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM uploads WHERE upload_id = ?`, id)
+	if err != nil {
+		return "", err
+	}
+
+	return recordID, tx.Commit()
+}
+
+// readUploadData собирает данные загрузки из всех ее частей
+func readUploadData(ctx context.Context, tx *sql.Tx, id string) ([]byte, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT chunk_data FROM upload_chunks WHERE upload_id = ? ORDER BY chunk_offset`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []byte{}
+	for rows.Next() {
+		var chunk []byte
+		if err := rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	return data, rows.Err()
+}
+
+// PurgeStaleUploads удаляет незавершенные загрузки, начатые раньше before
+func (s *SQLiteDB) PurgeStaleUploads(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM uploads WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+// ReadUploadChunk возвращает часть загрузки, начинающуюся с offset
+func (s *SQLiteDB) ReadUploadChunk(ctx context.Context, id string, offset int64) ([]byte, error) {
+	var chunk []byte
+
+	query := `SELECT chunk_data FROM upload_chunks WHERE upload_id = ? AND chunk_offset = ?`
+	err := s.db.QueryRowContext(ctx, query, id, offset).Scan(&chunk)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// GetBlobRef возвращает ссылку на данные записи. Для данных, лежащих в самой
+// записи, Key пустой, а Size равен их размеру
+func (s *SQLiteDB) GetBlobRef(ctx context.Context, id string) (models.BlobRef, error) {
+	var ref models.BlobRef
+	var keyID string
+	var dataSize int64
+
+	query := `SELECT COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash,
+				COALESCE(blob_key_id, ''), blob_data_key, length(user_data), COALESCE(key_id, '')
+			FROM records WHERE public_id = ? AND deleted_at IS NULL`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&ref.Key, &ref.Size, &ref.Hash, &ref.KeyID, &ref.DataKey,
+		&dataSize, &keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.BlobRef{}, models.ErrNotFound
+		}
+		return models.BlobRef{}, err
+	}
+	if ref.Key == "" {
+		ref.Size = plainSize(dataSize, keyID)
+	}
+	return ref, nil
+}
+
+// ReadDataChunk читает не больше limit байт данных записи, начиная с offset.
+// Из зашифрованной записи читаются и расшифровываются только нужные сегменты
+func (s *SQLiteDB) ReadDataChunk(ctx context.Context, id string, offset int64, limit int) ([]byte, error) {
+	var chunk, dataKey []byte
+	var keyID string
+	var total int64
+
+	sealedFrom, sealedLen, first := envelope.SealedRange(offset, limit)
+	query := `SELECT COALESCE(key_id, ''), data_key, length(user_data),
+				CASE WHEN key_id IS NULL THEN substr(user_data, ?, ?) ELSE substr(user_data, ?, ?) END
+			FROM records WHERE public_id = ? AND deleted_at IS NULL`
+	err := s.db.QueryRowContext(ctx, query, offset+1, limit, sealedFrom+1, sealedLen, id).
+		Scan(&keyID, &dataKey, &total, &chunk)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	return openDataRange(s.keys, chunk, offset, limit, first, total, keyID, dataKey)
+}
+
+// GetBlobKeys возвращает ключи всех blob, на которые ссылаются записи и их версии
+func (s *SQLiteDB) GetBlobKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	query := `SELECT blob_key FROM records WHERE blob_key IS NOT NULL
+			UNION
+			SELECT blob_key FROM record_revisions WHERE blob_key IS NOT NULL`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// MoveDataToBlobs по одной выносит данные BINARY записей и их версий во внешнее
+// хранилище через put и оставляет в базе только ссылку
+func (s *SQLiteDB) MoveDataToBlobs(ctx context.Context, put func(ctx context.Context, data []byte) (models.BlobRef, error)) (int, error) {
+	queries := []struct{ selectRow, update string }{
+		{
+			selectRow: `SELECT id, revision, user_data, meta, COALESCE(key_id, ''), data_key FROM records
+					WHERE type_record = 'BINARY' AND blob_key IS NULL LIMIT 1`,
+			update: `UPDATE records SET user_data = ?, meta = ?, key_id = ?, data_key = ?,
+						blob_key = ?, blob_size = ?, blob_hash = ?, blob_key_id = ?, blob_data_key = ?
+					WHERE id = ? AND revision = ?`,
+		},
+		{
+			selectRow: `SELECT h.record_id, h.revision, h.user_data, h.meta, COALESCE(h.key_id, ''), h.data_key
+					FROM record_revisions h JOIN records r ON r.id = h.record_id
+					WHERE r.type_record = 'BINARY' AND h.blob_key IS NULL LIMIT 1`,
+			update: `UPDATE record_revisions SET user_data = ?, meta = ?, key_id = ?, data_key = ?,
+						blob_key = ?, blob_size = ?, blob_hash = ?, blob_key_id = ?, blob_data_key = ?
+					WHERE record_id = ? AND revision = ?`,
+		},
+	}
+
+	moved := 0
+	for _, q := range queries {
+		for {
+			done, err := s.moveOneToBlob(ctx, q.selectRow, q.update, put)
+			if err != nil {
+				return moved, err
+			}
+			if done {
+				break
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (s *SQLiteDB) moveOneToBlob(ctx context.Context, selectRow, update string, put func(ctx context.Context, data []byte) (models.BlobRef, error)) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var recordID int64
+	var revision int
+	var data, dataKey []byte
+	var meta, keyID string
+	err = tx.QueryRowContext(ctx, selectRow).Scan(&recordID, &revision, &data, &meta, &keyID, &dataKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	data, rest, err := moveDataOut(s.keys, data, meta, keyID, dataKey)
+	if err != nil {
+		return false, err
+	}
+	ref, err := put(ctx, data)
+	if err != nil {
+		return false, err
+	}
+
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(ref)
+	_, err = tx.ExecContext(ctx, update, rest.data, rest.meta, rest.keyID, rest.dataKey,
+		blobKey, blobSize, blobHash, blobKeyID, blobDataKey, recordID, revision)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+// GetUsage возвращает занятое пользователем место и действующие для него ограничения
+func (s *SQLiteDB) GetUsage(ctx context.Context, username string) (models.Usage, error) {
+	var usage models.Usage
+	query := `SELECT used_bytes, record_count, COALESCE(quota_bytes, ?), COALESCE(quota_records, ?),
+				COALESCE(max_record_size, ?)
+			FROM users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, query, s.quota.Bytes, s.quota.Records, s.quota.MaxRecordSize, username).
+		Scan(&usage.Bytes, &usage.Records, &usage.Quota.Bytes, &usage.Quota.Records, &usage.Quota.MaxRecordSize)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Usage{}, models.ErrNotFound
+		}
+		return models.Usage{}, err
+	}
+	return usage, nil
+}
+
+// GetKDFParams возвращает параметры, с которыми клиент выводит ключи аккаунта
+// из мастер-пароля. У аккаунта, созданного до сквозного шифрования, они пустые
+func (s *SQLiteDB) GetKDFParams(ctx context.Context, username string) (models.KDFParams, error) {
+	var kdf models.KDFParams
+	var time, memory, threads sql.NullInt64
+	query := `SELECT kdf_salt, kdf_time, kdf_memory, kdf_threads FROM users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&kdf.Salt, &time, &memory, &threads)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.KDFParams{}, models.ErrNotFound
+		}
+		return models.KDFParams{}, err
+	}
+	kdf.Time, kdf.Memory, kdf.Threads = uint32(time.Int64), uint32(memory.Int64), uint8(threads.Int64)
+	return kdf, nil
+}
+
+// MigrateUser переводит аккаунт, созданный до сквозного шифрования, на ключ
+// входа password, выведенный с параметрами kdf, и завершает все его сессии.
+// Если аккаунт уже переведен, возвращается ErrConflict
+func (s *SQLiteDB) MigrateUser(ctx context.Context, username, password string, kdf models.KDFParams) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET user_password = ?, kdf_salt = ?, kdf_time = ?, kdf_memory = ?, kdf_threads = ?
+			WHERE username = ? AND kdf_salt IS NULL`
+	result, err := tx.ExecContext(ctx, query, password, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, username)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err != nil {
+			return err
+		}
+		var exist bool
+		query = `SELECT EXISTS (SELECT 1 FROM users WHERE username = ?)`
+		if err := tx.QueryRowContext(ctx, query, username).Scan(&exist); err != nil {
+			return err
+		}
+		if !exist {
+			return models.ErrNotFound
+		}
+		return models.ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE username = ?`, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetVaultKey возвращает обернутый ключ шифрования записей пользователя. Если
+// ключ еще не задан, возвращается ErrNotFound
+func (s *SQLiteDB) GetVaultKey(ctx context.Context, username string) ([]byte, error) {
+	var key []byte
+	query := `SELECT wrapped_key FROM users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	if key == nil {
+		return nil, models.ErrNotFound
+	}
+	return key, nil
+}
+
+// SetVaultKey задает обернутый ключ шифрования записей пользователя. Ключ
+// задается один раз: если он уже есть, возвращается ErrConflict
+func (s *SQLiteDB) SetVaultKey(ctx context.Context, username string, key []byte) error {
+	query := `UPDATE users SET wrapped_key = ? WHERE username = ? AND wrapped_key IS NULL`
+	result, err := s.db.ExecContext(ctx, query, key, username)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err != nil {
+			return err
+		}
+		if _, err := s.GetKDFParams(ctx, username); err != nil {
+			return err
+		}
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// ChangePassword заменяет хеш пароля oldHash на newHash, сохраняет параметры
+// kdf нового ключа входа и завершает все сессии пользователя, кроме
+// keepSession. Если передан key, вместе с паролем сохраняется ключ записей,
+// обернутый ключом из нового пароля; без key ключ у пользователя должен
+// отсутствовать. Если пароль успели сменить раньше, возвращается ErrConflict
+func (s *SQLiteDB) ChangePassword(ctx context.Context, username, oldHash, newHash string, kdf models.KDFParams, key []byte, keepSession string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET user_password = ?3,
+				kdf_salt = ?4, kdf_time = ?5, kdf_memory = ?6, kdf_threads = ?7,
+				wrapped_key = COALESCE(?8, wrapped_key)
+			WHERE username = ?1 AND user_password = ?2 AND (?8 IS NOT NULL OR wrapped_key IS NULL)`
+	result, err := tx.ExecContext(ctx, query, username, oldHash, newHash,
+		kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, key)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var exist bool
+		query = `SELECT EXISTS (SELECT 1 FROM users WHERE username = ?)`
+		if err := tx.QueryRowContext(ctx, query, username).Scan(&exist); err != nil {
+			return err
+		}
+		if !exist {
+			return models.ErrNotFound
+		}
+		return models.ErrConflict
+	}
+
+	query = `DELETE FROM sessions WHERE username = ? AND session_id <> ?`
+	if _, err := tx.ExecContext(ctx, query, username, keepSession); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateSession создает сессию пользователя и возвращает ее id
+func (s *SQLiteDB) CreateSession(ctx context.Context, session models.Session) (string, error) {
+	id := uuid.NewString()
+	query := `INSERT INTO sessions (session_id, username, refresh_hash, created_at, expires_at)
+				VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, id, session.Username, session.RefreshHash, time.Now().UTC(), session.ExpiresAt.UTC())
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetSession возвращает сессию по id. Если сессии нет, возвращается ErrNotFound
+func (s *SQLiteDB) GetSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	query := `SELECT session_id, username, refresh_hash, created_at, expires_at
+			FROM sessions WHERE session_id = ?`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.Username, &session.RefreshHash,
+		&session.CreatedAt, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, models.ErrNotFound
+		}
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+// RotateSession заменяет хеш refresh-токена oldHash на newHash и продлевает
+// сессию до expiresAt. Если хеш успели заменить раньше, возвращается ErrConflict
+func (s *SQLiteDB) RotateSession(ctx context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error {
+	query := `UPDATE sessions SET refresh_hash = ?, expires_at = ?
+			WHERE session_id = ? AND refresh_hash = ?`
+	result, err := s.db.ExecContext(ctx, query, newHash, expiresAt.UTC(), id, oldHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := s.GetSession(ctx, id); err != nil {
+			return err
+		}
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// DeleteSession завершает сессию. Удаление отсутствующей сессии не ошибка
+func (s *SQLiteDB) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE session_id = ?`, id)
+	return err
+}
+
+// PurgeExpiredSessions удаляет сессии, срок которых истек раньше before
+func (s *SQLiteDB) PurgeExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+// SetTOTPSecret сохраняет секрет TOTP, который ждет подтверждения. Прежний
+// неподтвержденный секрет заменяется, а если второй фактор уже включен,
+// возвращается ErrConflict
+func (s *SQLiteDB) SetTOTPSecret(ctx context.Context, username, secret string) error {
+	query := `INSERT INTO user_totp (username, secret) VALUES (?, ?)
+			ON CONFLICT (username) DO UPDATE SET secret = excluded.secret, last_step = 0, failures = 0, failed_at = NULL
+			WHERE NOT user_totp.enabled`
+	result, err := s.db.ExecContext(ctx, query, username, secret)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// GetTOTP возвращает второй фактор пользователя. Если секрет не задан,
+// возвращается ErrNotFound
+func (s *SQLiteDB) GetTOTP(ctx context.Context, username string) (models.TOTP, error) {
+	var totp models.TOTP
+	var failedAt sql.NullTime
+	query := `SELECT secret, enabled, last_step, failures, failed_at,
+				(SELECT count(*) FROM recovery_codes WHERE recovery_codes.username = user_totp.username)
+			FROM user_totp WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep,
+		&totp.Failures, &failedAt, &totp.RecoveryLeft)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, models.ErrNotFound
+		}
+		return models.TOTP{}, err
+	}
+	totp.FailedAt = failedAt.Time
+	return totp, nil
+}
+
+// EnableTOTP включает второй фактор, подтвержденный кодом шага step, и
+// заменяет коды восстановления хешами recoveryCodes. Если секрета нет,
+// возвращается ErrNotFound, если второй фактор уже включен, ErrConflict
+func (s *SQLiteDB) EnableTOTP(ctx context.Context, username string, step int64, recoveryCodes [][]byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+	query := `SELECT enabled FROM user_totp WHERE username = ?`
+	if err := tx.QueryRowContext(ctx, query, username).Scan(&enabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+	if enabled {
+		return models.ErrConflict
+	}
+
+	query = `UPDATE user_totp SET enabled = 1, last_step = ?, failures = 0, failed_at = NULL WHERE username = ?`
+	if _, err := tx.ExecContext(ctx, query, step, username); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = ?`, username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodes {
+		query = `INSERT INTO recovery_codes (username, code_hash) VALUES (?, ?) ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, username, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep принимает код шага step и сбрасывает счетчик неверных кодов.
+// Если код этого или более позднего шага уже принят, возвращается ErrConflict,
+// если второй фактор не включен, ErrNotFound
+func (s *SQLiteDB) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	query := `UPDATE user_totp SET last_step = ?2, failures = 0, failed_at = NULL
+			WHERE username = ?1 AND enabled AND last_step < ?2`
+	result, err := s.db.ExecContext(ctx, query, username, step)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		totp, err := s.GetTOTP(ctx, username)
+		if err != nil {
+			return err
+		}
+		if !totp.Enabled {
+			return models.ErrNotFound
+		}
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// UseRecoveryCode удаляет использованный код восстановления с хешем hash и
+// сбрасывает счетчик неверных кодов. Если такого кода нет, возвращается
+// ErrNotFound
+func (s *SQLiteDB) UseRecoveryCode(ctx context.Context, username string, hash []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM recovery_codes WHERE username = ? AND code_hash = ?`
+	result, err := tx.ExecContext(ctx, query, username, hash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrNotFound
+	}
+	query = `UPDATE user_totp SET failures = 0, failed_at = NULL WHERE username = ?`
+	if _, err := tx.ExecContext(ctx, query, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddTOTPAttempt учитывает код, введенный в момент at, и возвращает число
+// попыток после последнего принятого кода. Если предыдущая попытка была
+// раньше since, счет начинается заново
+func (s *SQLiteDB) AddTOTPAttempt(ctx context.Context, username string, at, since time.Time) (int, error) {
+	query := `UPDATE user_totp SET
+			failures = CASE WHEN failed_at IS NULL OR failed_at < ?3 THEN 1 ELSE failures + 1 END,
+			failed_at = ?2
+		WHERE username = ?1 AND enabled
+		RETURNING failures`
+	var attempts int
+	err := s.db.QueryRowContext(ctx, query, username, at.UTC(), since.UTC()).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrNotFound
+	}
+	return attempts, err
+}
+
+// DeleteTOTP отключает второй фактор вместе с кодами восстановления.
+// Отключение отсутствующего второго фактора не ошибка
+func (s *SQLiteDB) DeleteTOTP(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM user_totp WHERE username = ?`, username)
+	return err
+}
+
+// addUsage меняет занятое пользователем место на bytes и число его записей на
+// records. Рост проверяется по квоте пользователя, а size по допустимому
+// размеру записи; при превышении возвращается ErrQuotaExceeded
+func (s *SQLiteDB) addUsage(ctx context.Context, tx *sql.Tx, username string, bytes, records, size int64) error {
+	query := `UPDATE users SET used_bytes = used_bytes + ?2, record_count = record_count + ?3
+			WHERE username = ?1
+				AND (?2 <= 0 OR COALESCE(quota_bytes, ?4) = 0 OR used_bytes + ?2 <= COALESCE(quota_bytes, ?4))
+				AND (?3 <= 0 OR COALESCE(quota_records, ?5) = 0 OR record_count + ?3 <= COALESCE(quota_records, ?5))
+				AND (COALESCE(max_record_size, ?6) = 0 OR ?7 <= COALESCE(max_record_size, ?6))`
+	result, err := tx.ExecContext(ctx, query, username, bytes, records,
+		s.quota.Bytes, s.quota.Records, s.quota.MaxRecordSize, size)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// nextChange увеличивает счетчик изменений пользователя и возвращает его
+// новое значение, которым помечается измененная запись
+func (s *SQLiteDB) nextChange(ctx context.Context, tx *sql.Tx, username string) (int64, error) {
+	var change int64
+	query := `UPDATE users SET change_seq = change_seq + 1 WHERE username = ? RETURNING change_seq`
+	err := tx.QueryRowContext(ctx, query, username).Scan(&change)
+	return change, err
+}
+
+// addTombstone оставляет в ленте изменений след окончательно удаленной записи
+func (s *SQLiteDB) addTombstone(ctx context.Context, tx *sql.Tx, username, id string) error {
+	change, err := s.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO record_tombstones (username, change_seq, public_id, deleted_at) VALUES (?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, username, change, id, time.Now().UTC())
+	return err
+}
+
+// GetLastChange возвращает номер последнего изменения записей пользователя
+func (s *SQLiteDB) GetLastChange(ctx context.Context, username string) (int64, error) {
+	var change int64
+	err := s.db.QueryRowContext(ctx, `SELECT change_seq FROM users WHERE username = ?`, username).Scan(&change)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNotFound
+		}
+		return 0, err
+	}
+	return change, nil
+}
+
+// GetChanges возвращает до limit изменений записей пользователя с номером
+// больше since в порядке номеров
+func (s *SQLiteDB) GetChanges(ctx context.Context, username string, since int64, limit int) ([]models.Change, error) {
+	query := `SELECT change_seq, deleted_at IS NOT NULL, public_id, type_record, revision,
+				CASE WHEN deleted_at IS NULL THEN user_data END, meta, record_size, created_at, updated_at,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE username = ?1 AND change_seq > ?2
+			UNION ALL
+			SELECT change_seq, 1, public_id, '', 0, NULL, '', 0, deleted_at, deleted_at, '', 0, NULL, '', NULL, '', NULL
+			FROM record_tombstones WHERE username = ?1 AND change_seq > ?2
+			ORDER BY 1 LIMIT ?3`
+	rows, err := s.db.QueryContext(ctx, query, username, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []models.Change
+	for rows.Next() {
+		var change models.Change
+		var record models.Record
+		var keyID string
+		var dataKey []byte
+
+		err := rows.Scan(&change.Revision, &change.Deleted, &record.Id, &record.TypeRecord, &record.Version,
+			&record.Data, &record.Meta, &record.Size, &record.CreatedAt, &record.UpdatedAt,
+			&record.Blob.Key, &record.Blob.Size, &record.Blob.Hash, &record.Blob.KeyID, &record.Blob.DataKey, &keyID, &dataKey)
+		if err != nil {
+			return nil, err
+		}
+		change.Record = models.Record{Id: record.Id}
+		if !change.Deleted {
+			if err := openRecord(s.keys, &record, keyID, dataKey); err != nil {
+				return nil, err
+			}
+			change.Record = record
+		}
+
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// RotateKeys переоборачивает активным мастер-ключом ключи данных записей и их
+// версий, а также ключи blob во внешнем хранилище, а строки, сохраненные без
+// шифрования, шифрует. Каждая строка обрабатывается в своей транзакции,
+// поэтому ротацию можно проводить на работающем сервере. Возвращает количество
+// обработанных строк
+func (s *SQLiteDB) RotateKeys(ctx context.Context) (int, error) {
+	if s.keys == nil {
+		return 0, errNoMasterKey
+	}
+
+	rotated := 0
+	for _, rotate := range []func(ctx context.Context, table, idColumn string, lastID *int64, lastRevision *int) (bool, error){
+		s.rotateOneKey, s.rotateOneBlobKey,
+	} {
+		for _, t := range []struct{ table, idColumn string }{{"records", "id"}, {"record_revisions", "record_id"}} {
+			var lastID int64
+			lastRevision := -1
+			for {
+				found, err := rotate(ctx, t.table, t.idColumn, &lastID, &lastRevision)
+				if err != nil {
+					return rotated, err
+				}
+				if !found {
+					break
+				}
+				rotated++
+			}
+		}
+	}
+	return rotated, nil
+}
+
+func (s *SQLiteDB) rotateOneKey(ctx context.Context, table, idColumn string, lastID *int64, lastRevision *int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var keyID string
+	var wrapped []byte
+	query := fmt.Sprintf(`SELECT %[2]s, revision, COALESCE(key_id, ''), data_key FROM %[1]s
+			WHERE (%[2]s, revision) > (?, ?) AND key_id IS NOT ?
+			ORDER BY %[2]s, revision LIMIT 1`, table, idColumn)
+	err = tx.QueryRowContext(ctx, query, *lastID, *lastRevision, s.keys.Primary()).
+		Scan(lastID, lastRevision, &keyID, &wrapped)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var sealed sealedRecord
+	if keyID == "" {
+		var data []byte
+		var meta string
+		query = fmt.Sprintf(`SELECT user_data, meta FROM %s WHERE %s = ? AND revision = ?`, table, idColumn)
+		if err := tx.QueryRowContext(ctx, query, *lastID, *lastRevision).Scan(&data, &meta); err != nil {
+			return false, err
+		}
+		sealed, err = sealRecord(s.keys, data, meta)
+	} else {
+		sealed.keyID, sealed.dataKey, err = rewrapKey(s.keys, keyID, wrapped)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var meta any
+	if sealed.data != nil {
+		meta = sealed.meta
+	}
+	query = fmt.Sprintf(`UPDATE %s SET user_data = COALESCE(?, user_data), meta = COALESCE(?, meta),
+				key_id = ?, data_key = ?
+			WHERE %s = ? AND revision = ?`, table, idColumn)
+	_, err = tx.ExecContext(ctx, query, sealed.data, meta, sealed.keyID, sealed.dataKey, *lastID, *lastRevision)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// rotateOneBlobKey переоборачивает активным мастер-ключом ключ blob строки
+func (s *SQLiteDB) rotateOneBlobKey(ctx context.Context, table, idColumn string, lastID *int64, lastRevision *int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var keyID string
+	var wrapped []byte
+	query := fmt.Sprintf(`SELECT %[2]s, revision, blob_key_id, blob_data_key FROM %[1]s
+			WHERE (%[2]s, revision) > (?, ?) AND blob_key_id IS NOT NULL AND blob_key_id <> ?
+			ORDER BY %[2]s, revision LIMIT 1`, table, idColumn)
+	err = tx.QueryRowContext(ctx, query, *lastID, *lastRevision, s.keys.Primary()).
+		Scan(lastID, lastRevision, &keyID, &wrapped)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	keyID, wrapped, err = rewrapKey(s.keys, keyID, wrapped)
+	if err != nil {
+		return false, err
+	}
+	query = fmt.Sprintf(`UPDATE %s SET blob_key_id = ?, blob_data_key = ?
+			WHERE %s = ? AND revision = ?`, table, idColumn)
+	if _, err := tx.ExecContext(ctx, query, keyID, wrapped, *lastID, *lastRevision); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// SealBlobs по одному заменяет незашифрованные blob зашифрованными копиями,
+// которые создает seal, и переводит на копию все ссылающиеся строки. Прежние
+// blob остаются без ссылок и удаляются PurgeOrphanBlobs. Возвращает
+// количество замененных blob
+func (s *SQLiteDB) SealBlobs(ctx context.Context, seal func(ctx context.Context, ref models.BlobRef) (models.BlobRef, error)) (int, error) {
+	sealed := 0
+	for {
+		var ref models.BlobRef
+		query := `SELECT blob_key, blob_size, blob_hash FROM records
+					WHERE blob_key IS NOT NULL AND blob_key_id IS NULL
+				UNION ALL
+				SELECT blob_key, blob_size, blob_hash FROM record_revisions
+					WHERE blob_key IS NOT NULL AND blob_key_id IS NULL
+				LIMIT 1`
+		err := s.db.QueryRowContext(ctx, query).Scan(&ref.Key, &ref.Size, &ref.Hash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return sealed, nil
+			}
+			return sealed, err
+		}
+
+		sealedRef, err := seal(ctx, ref)
+		if err != nil {
+			return sealed, err
+		}
+		if sealedRef.KeyID == "" {
+			return sealed, errNoMasterKey
+		}
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return sealed, err
+		}
+		for _, table := range []string{"records", "record_revisions"} {
+			query = fmt.Sprintf(`UPDATE %s SET blob_key = ?, blob_key_id = ?, blob_data_key = ?
+					WHERE blob_key = ? AND blob_key_id IS NULL`, table)
+			_, err = tx.ExecContext(ctx, query, sealedRef.Key, sealedRef.KeyID, sealedRef.DataKey, ref.Key)
+			if err != nil {
+				tx.Rollback()
+				return sealed, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return sealed, err
+		}
+		sealed++
+	}
+}
+
+// requireAffected возвращает ErrNotFound, если запрос не затронул ни одной строки
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// sqliteDSN переводит DSN вида sqlite://path?params в строку подключения
+// драйвера. Параметры из DSN сохраняются, внешние ключи включаются всегда, а
+// время ожидания блокировки задается, если его нет в DSN
+func sqliteDSN(dsn string) string {
+	path := dsn
+	for _, prefix := range []string{"sqlite3://", "sqlite://", "sqlite3:", "sqlite:"} {
+		if strings.HasPrefix(dsn, prefix) {
+			path = strings.TrimPrefix(dsn, prefix)
+			break
+		}
+	}
+	path, rawQuery, _ := strings.Cut(path, "?")
+	// ParseQuery пропускает только некорректные пары, остальные параметры остаются
+	query, _ := url.ParseQuery(rawQuery)
+	query.Set("_foreign_keys", "on")
+	if query.Get("_busy_timeout") == "" && query.Get("_timeout") == "" {
+		query.Set("_busy_timeout", "5000")
+	}
+	return "file:" + path + "?" + query.Encode()
+}
@@ -0,0 +1,20 @@
+package storage
+
+import "testing"
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"sqlite:///var/lib/gk.db", "file:/var/lib/gk.db?_busy_timeout=5000&_foreign_keys=on"},
+		{"sqlite3:gk.db", "file:gk.db?_busy_timeout=5000&_foreign_keys=on"},
+		{"sqlite://gk.db?cache=shared&_busy_timeout=100", "file:gk.db?_busy_timeout=100&_foreign_keys=on&cache=shared"},
+		{"sqlite://gk.db?_foreign_keys=off", "file:gk.db?_busy_timeout=5000&_foreign_keys=on"},
+	}
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.dsn); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -3,10 +3,14 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"embed"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"path/filepath"
-	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,25 +18,29 @@ import (
 	"github.com/pressly/goose/v3"
 	"github.com/sinfirst/GophKeeper/internal/config"
 	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
 	"go.uber.org/zap"
 )
 
 // PGDB структура для хранения переменных
 type PGDB struct {
-	logger zap.SugaredLogger
-	db     *pgxpool.Pool
-	idData int
+	logger       zap.SugaredLogger
+	db           *pgxpool.Pool
+	historyLimit int
+	keys         *envelope.Keyring
+	quota        models.Quota
 }
 
-// NewPGDB конструктор для структуры
-func NewPGDB(config config.Config, logger zap.SugaredLogger) *PGDB {
+// NewPGDB конструктор для структуры. Если keys не nil, данные записей
+// шифруются ключами, обернутыми мастер-ключом
+func NewPGDB(config config.Config, keys *envelope.Keyring, logger zap.SugaredLogger) *PGDB {
 	db, err := pgxpool.New(context.Background(), config.DatabaseDsn)
 
 	if err != nil {
 		logger.Errorw("Problem with connecting to db ", err)
 		return nil
 	}
-	return &PGDB{logger: logger, db: db, idData: 1}
+	return &PGDB{logger: logger, db: db, historyLimit: config.HistoryLimit, keys: keys, quota: config.Quota()}
 }
 
 func (p *PGDB) CheckUsernameExists(ctx context.Context, username string) (bool, error) {
@@ -48,16 +56,17 @@ func (p *PGDB) CheckUsernameExists(ctx context.Context, username string) (bool,
 	return exists, nil
 }
 
-func (p *PGDB) AddUserToDB(ctx context.Context, username, password string) error {
+func (p *PGDB) AddUserToDB(ctx context.Context, username, password string, kdf models.KDFParams) error {
 	var insertedUser string
 
 	query := `
-		INSERT INTO users (username, user_password)
-		VALUES ($1, $2)
+		INSERT INTO users (username, user_password, kdf_salt, kdf_time, kdf_memory, kdf_threads)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		ON CONFLICT (username) DO UPDATE SET username = EXCLUDED.username
 		RETURNING username
 	`
-	err := p.db.QueryRow(ctx, query, username, password).Scan(&insertedUser)
+	err := p.db.QueryRow(ctx, query, username, password,
+		kdf.Salt, int64(kdf.Time), int64(kdf.Memory), int64(kdf.Threads)).Scan(&insertedUser)
 
 	if err != nil {
 		return err
@@ -78,91 +87,260 @@ func (p *PGDB) GetUserPassword(ctx context.Context, username string) (string, er
 	return password, nil
 }
 
-func (p *PGDB) StoreDataToDB(ctx context.Context, record models.Record, username string) (int, error) {
-	query := `INSERT INTO records (id, type_record, user_data, meta, username)
-				VALUES ($1, $2, $3, $4, $5)`
-	_, err := p.db.Exec(ctx, query, p.idData, record.TypeRecord, record.Data, record.Meta, username)
+func (p *PGDB) StoreDataToDB(ctx context.Context, record models.Record, username string) (string, error) {
+	sealed, err := sealRecord(p.keys, record.Data, record.Meta)
 	if err != nil {
-		return p.idData, err
+		return "", err
+	}
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	size := recordSize(record)
+	if err := p.addUsage(ctx, tx, username, size, 1, size); err != nil {
+		return "", err
+	}
+
+	change, err := p.nextChange(ctx, tx, username)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(record.Blob)
+	query := `INSERT INTO records (type_record, user_data, meta, username, blob_key, blob_size, blob_hash,
+					blob_key_id, blob_data_key, key_id, data_key, record_size, change_seq)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+				RETURNING public_id`
+	err = tx.QueryRow(ctx, query, record.TypeRecord, sealed.data, sealed.meta, username,
+		blobKey, blobSize, blobHash, blobKeyID, blobDataKey, sealed.keyID, sealed.dataKey, size, change).Scan(&id)
+	if err != nil {
+		return "", err
 	}
-	p.idData++
-	return p.idData - 1, nil
+	return id, tx.Commit(ctx)
 }
 
-func (p *PGDB) GetUserByDataID(ctx context.Context, id int) (string, error) {
+func (p *PGDB) GetUserByDataID(ctx context.Context, id string) (string, error) {
 	var username string
-	query := `SELECT username FROM records WHERE id = $1`
+	query := `SELECT username FROM records WHERE public_id = $1`
 	row := p.db.QueryRow(ctx, query, id)
 	err := row.Scan(&username)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", fmt.Errorf("not found")
+			return "", models.ErrNotFound
 		}
 		return "", err
 	}
 	return username, nil
 
 }
-func (p *PGDB) RetrieveDataFromDB(ctx context.Context, id int) (models.Record, error) {
+func (p *PGDB) RetrieveDataFromDB(ctx context.Context, id string) (models.Record, error) {
 	var record models.Record
+	var keyID string
+	var dataKey []byte
 
-	query := `SELECT type_record, user_data, meta FROM records WHERE id = $1`
+	query := `SELECT public_id, type_record, revision, user_data, meta,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE public_id = $1 AND deleted_at IS NULL`
 	row := p.db.QueryRow(ctx, query, id)
-	err := row.Scan(&record.TypeRecord, &record.Data, &record.Meta)
+	err := row.Scan(&record.Id, &record.TypeRecord, &record.Version, &record.Data, &record.Meta,
+		&record.Blob.Key, &record.Blob.Size, &record.Blob.Hash, &record.Blob.KeyID, &record.Blob.DataKey, &keyID, &dataKey)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return models.Record{}, fmt.Errorf("not found")
+			return models.Record{}, models.ErrNotFound
 		}
 		return models.Record{}, err
 	}
-	return record, nil
+	return record, openRecord(p.keys, &record, keyID, dataKey)
 }
 
-func (p *PGDB) UpdateDataInDB(ctx context.Context, id int, meta string, data []byte) error {
-	query := `UPDATE records SET user_data = $1, meta = $2 
-			WHERE id = $3`
-	result, err := p.db.Exec(ctx, query, data, meta, id)
+// UpdateDataInDB переносит текущую версию записи в историю и сохраняет новую.
+// Если record.Version не 0, он должен совпадать с текущей версией записи,
+// иначе возвращается ErrVersionMismatch
+func (p *PGDB) UpdateDataInDB(ctx context.Context, record models.Record) error {
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("not found")
+	var recordID, oldSize int64
+	var revision int
+	var username string
+	query := `SELECT id, revision, username, record_size FROM records
+			WHERE public_id = $1 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRow(ctx, query, record.Id).Scan(&recordID, &revision, &username, &oldSize)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+	if record.Version != 0 && record.Version != revision {
+		return models.ErrVersionMismatch
 	}
 
-	return nil
-}
+	size := recordSize(record)
+	if err := p.addUsage(ctx, tx, username, size-oldSize, 0, size); err != nil {
+		return err
+	}
 
-func (p *PGDB) GetListData(ctx context.Context, username string) ([]models.Record, error) {
-	var records []models.Record
-	query := `SELECT id, type_record, user_data, meta 
-			FROM records WHERE username = $1`
-	rows, err := p.db.Query(ctx, query, username)
+	if p.historyLimit > 0 {
+		query = `INSERT INTO record_revisions (record_id, revision, user_data, meta, created_at,
+					blob_key, blob_size, blob_hash, blob_key_id, blob_data_key, key_id, data_key)
+				SELECT id, revision, user_data, meta, updated_at, blob_key, blob_size, blob_hash,
+					blob_key_id, blob_data_key, key_id, data_key
+				FROM records WHERE id = $1`
+		_, err = tx.Exec(ctx, query, recordID)
+		if err != nil {
+			return err
+		}
+	}
 
+	query = `DELETE FROM record_revisions WHERE record_id = $1 AND revision <= $2`
+	_, err = tx.Exec(ctx, query, recordID, revision-p.historyLimit)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := sealRecord(p.keys, record.Data, record.Meta)
+	if err != nil {
+		return err
+	}
+
+	change, err := p.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(record.Blob)
+	query = `UPDATE records SET user_data = $1, meta = $2, blob_key = $3, blob_size = $4, blob_hash = $5,
+				blob_key_id = $6, blob_data_key = $7, key_id = $8, data_key = $9, record_size = $10,
+				revision = revision + 1, updated_at = now(), change_seq = $11
+			WHERE id = $12`
+	_, err = tx.Exec(ctx, query, sealed.data, sealed.meta, blobKey, blobSize, blobHash, blobKeyID, blobDataKey,
+		sealed.keyID, sealed.dataKey, size, change, recordID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetRevisions возвращает текущую и сохраненные версии записи, начиная с новой
+func (p *PGDB) GetRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	var revisions []models.Revision
+	query := `SELECT revision, meta, updated_at, true, COALESCE(key_id, ''), data_key
+			FROM records WHERE public_id = $1
+			UNION ALL
+			SELECT h.revision, h.meta, h.created_at, false, COALESCE(h.key_id, ''), h.data_key
+			FROM record_revisions h JOIN records r ON r.id = h.record_id
+			WHERE r.public_id = $1
+			ORDER BY 1 DESC`
+	rows, err := p.db.Query(ctx, query, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var record models.Record
+		var revision models.Revision
+		var keyID string
+		var dataKey []byte
 
-		err := rows.Scan(&record.Id, &record.TypeRecord, &record.Data, &record.Meta)
+		err := rows.Scan(&revision.Revision, &revision.Meta, &revision.CreatedAt, &revision.Current, &keyID, &dataKey)
+		if err != nil {
+			return nil, err
+		}
+		revision.Meta, err = openMeta(p.keys, revision.Meta, keyID, dataKey)
 		if err != nil {
 			return nil, err
 		}
 
-		records = append(records, record)
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, models.ErrNotFound
+	}
+	return revisions, nil
+}
+
+// RetrieveRevisionFromDB возвращает содержимое записи в указанной версии
+func (p *PGDB) RetrieveRevisionFromDB(ctx context.Context, id string, revision int) (models.Record, error) {
+	var record models.Record
+	var keyID string
+	var dataKey []byte
+
+	query := `SELECT public_id, type_record, revision, user_data, meta,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE public_id = $1 AND revision = $2
+			UNION ALL
+			SELECT r.public_id, r.type_record, h.revision, h.user_data, h.meta,
+				COALESCE(h.blob_key, ''), COALESCE(h.blob_size, 0), h.blob_hash, COALESCE(h.blob_key_id, ''), h.blob_data_key, COALESCE(h.key_id, ''), h.data_key
+			FROM record_revisions h JOIN records r ON r.id = h.record_id
+			WHERE r.public_id = $1 AND h.revision = $2`
+	row := p.db.QueryRow(ctx, query, id, revision)
+	err := row.Scan(&record.Id, &record.TypeRecord, &record.Version, &record.Data, &record.Meta,
+		&record.Blob.Key, &record.Blob.Size, &record.Blob.Hash, &record.Blob.KeyID, &record.Blob.DataKey, &keyID, &dataKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Record{}, models.ErrNotFound
+		}
+		return models.Record{}, err
 	}
+	return record, openRecord(p.keys, &record, keyID, dataKey)
+}
+
+// GetListData возвращает страницу записей пользователя по фильтру и курсор
+// следующей страницы, пустой на последней странице
+func (p *PGDB) GetListData(ctx context.Context, username string, filter models.ListFilter) ([]models.Record, string, error) {
+	return paginate(filter, func(after int64, limit int) ([]listedRecord, error) {
+		query, args := listQuery(username, filter, after, limit, func(n int) string { return "$" + strconv.Itoa(n) })
+		rows, err := p.db.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var batch []listedRecord
+		for rows.Next() {
+			var r listedRecord
+			var keyID string
+			var dataKey []byte
 
-	return records, nil
+			err := rows.Scan(&r.seq, &r.record.Id, &r.record.TypeRecord, &r.record.Version, &r.record.Data, &r.record.Meta,
+				&r.record.Size, &r.record.CreatedAt, &r.record.UpdatedAt,
+				&r.record.Blob.Key, &r.record.Blob.Size, &r.record.Blob.Hash, &r.record.Blob.KeyID, &r.record.Blob.DataKey, &keyID, &dataKey)
+			if err != nil {
+				return nil, err
+			}
+			if filter.MetadataOnly {
+				r.record.Meta, err = openMeta(p.keys, r.record.Meta, keyID, dataKey)
+			} else {
+				err = openRecord(p.keys, &r.record, keyID, dataKey)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			batch = append(batch, r)
+		}
+		return batch, rows.Err()
+	})
 }
 
-func (p *PGDB) CheckRecordExist(ctx context.Context, id int) (bool, error) {
+func (p *PGDB) CheckRecordExist(ctx context.Context, id string) (bool, error) {
 	var exists bool
 	query := `
 		SELECT EXISTS (
-			SELECT 1 FROM records WHERE id = $1
+			SELECT 1 FROM records WHERE public_id = $1 AND deleted_at IS NULL
 		)`
 	err := p.db.QueryRow(ctx, query, id).Scan(&exists)
 	if err != nil {
@@ -170,35 +348,1270 @@ func (p *PGDB) CheckRecordExist(ctx context.Context, id int) (bool, error) {
 	}
 	return exists, nil
 }
-func (p *PGDB) DeleteDataFromDB(ctx context.Context, id int) error {
-	query := `DELETE FROM records
-				WHERE id = $1`
 
-	_, err := p.db.Exec(ctx, query, id)
+// DeleteDataFromDB перемещает запись в корзину. Если version не 0, запись
+// удаляется, только когда ее текущая версия совпадает с version
+func (p *PGDB) DeleteDataFromDB(ctx context.Context, id string, version int) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var revision int
+	var username string
+	query := `SELECT revision, username FROM records WHERE public_id = $1 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRow(ctx, query, id).Scan(&revision, &username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+	if version != 0 && revision != version {
+		return models.ErrVersionMismatch
+	}
+
+	change, err := p.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
 
+	query = `UPDATE records SET deleted_at = now(), change_seq = $2 WHERE public_id = $1`
+	_, err = tx.Exec(ctx, query, id, change)
 	if err != nil {
 		p.logger.Errorw("Problem with deleting from db: ", err)
 		return err
 	}
-	return nil
+	return tx.Commit(ctx)
 }
 
-// InitMigrations инициализация миграций
-func InitMigrations(conf config.Config, logger zap.SugaredLogger) error {
-	logger.Infow("Start migrations")
-	db, err := sql.Open("pgx", conf.DatabaseDsn)
+// GetTrashList возвращает записи пользователя, находящиеся в корзине, без
+// их данных
+func (p *PGDB) GetTrashList(ctx context.Context, username string) ([]models.Record, error) {
+	var records []models.Record
+	query := `SELECT public_id, type_record, revision, meta, record_size, deleted_at, COALESCE(key_id, ''), data_key
+			FROM records WHERE username = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at`
+	rows, err := p.db.Query(ctx, query, username)
 
 	if err != nil {
-		logger.Errorw("Error with connection to DB: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.Record
+		var keyID string
+		var dataKey []byte
+
+		err := rows.Scan(&record.Id, &record.TypeRecord, &record.Version, &record.Meta, &record.Size, &record.DeletedAt, &keyID, &dataKey)
+		if err != nil {
+			return nil, err
+		}
+		if record.Meta, err = openMeta(p.keys, record.Meta, keyID, dataKey); err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// RestoreDataInDB возвращает запись из корзины
+func (p *PGDB) RestoreDataInDB(ctx context.Context, id string) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	defer db.Close()
+	var username string
+	query := `SELECT username FROM records WHERE public_id = $1 AND deleted_at IS NOT NULL FOR UPDATE`
+	err = tx.QueryRow(ctx, query, id).Scan(&username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+
+	change, err := p.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE records SET deleted_at = NULL, change_seq = $2 WHERE public_id = $1`
+	_, err = tx.Exec(ctx, query, id, change)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgeDataFromDB окончательно удаляет запись из корзины и освобождает занятое ей место
+func (p *PGDB) PurgeDataFromDB(ctx context.Context, id string) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var username string
+	var size int64
+	query := `DELETE FROM records
+				WHERE public_id = $1 AND deleted_at IS NOT NULL
+				RETURNING username, record_size`
+	err = tx.QueryRow(ctx, query, id).Scan(&username, &size)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		p.logger.Errorw("Problem with purging from db: ", err)
+		return err
+	}
+
+	if err := p.addUsage(ctx, tx, username, -size, -1, 0); err != nil {
+		return err
+	}
+	if err := p.addTombstone(ctx, tx, username, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgeExpiredTrash окончательно удаляет записи, попавшие в корзину раньше
+// before, и оставляет для них следы в ленте изменений
+func (p *PGDB) PurgeExpiredTrash(ctx context.Context, before time.Time) (int, error) {
+	var purged int
+	query := `WITH deleted AS (
+				DELETE FROM records
+				WHERE deleted_at IS NOT NULL AND deleted_at < $1
+				RETURNING username, public_id, record_size
+			), usage AS (
+				SELECT username, SUM(record_size) AS bytes, COUNT(*) AS records
+				FROM deleted GROUP BY username
+			), released AS (
+				UPDATE users u SET used_bytes = u.used_bytes - usage.bytes, record_count = u.record_count - usage.records,
+					change_seq = u.change_seq + usage.records
+				FROM usage WHERE u.username = usage.username
+				RETURNING u.username, u.change_seq - usage.records AS last_seq
+			), tombstones AS (
+				INSERT INTO record_tombstones (username, change_seq, public_id)
+				SELECT d.username, r.last_seq + ROW_NUMBER() OVER (PARTITION BY d.username ORDER BY d.public_id), d.public_id
+				FROM deleted d JOIN released r ON r.username = d.username
+			)
+			SELECT COALESCE(SUM(records), 0)::int FROM usage`
+
+	err := p.db.QueryRow(ctx, query, before).Scan(&purged)
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// CreateUpload регистрирует новую потоковую загрузку
+func (p *PGDB) CreateUpload(ctx context.Context, upload models.Upload) (string, error) {
+	var id string
+	query := `INSERT INTO uploads (username, meta, size, checksum)
+				VALUES ($1, $2, $3, $4)
+				RETURNING upload_id`
+	err := p.db.QueryRow(ctx, query, upload.Username, upload.Meta, upload.Size, upload.Checksum).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (p *PGDB) GetUpload(ctx context.Context, id string) (models.Upload, error) {
+	var upload models.Upload
+
+	query := `SELECT upload_id, username, meta, size, received, checksum, hash_state, created_at
+			FROM uploads WHERE upload_id = $1`
+	row := p.db.QueryRow(ctx, query, id)
+	err := row.Scan(&upload.ID, &upload.Username, &upload.Meta, &upload.Size, &upload.Received,
+		&upload.Checksum, &upload.HashState, &upload.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Upload{}, models.ErrNotFound
+		}
+		return models.Upload{}, err
+	}
+	return upload, nil
+}
+
+// AppendUploadChunk дописывает часть данных, если offset совпадает с уже принятым объемом
+func (p *PGDB) AppendUploadChunk(ctx context.Context, id string, offset int64, data, hashState []byte) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE uploads SET received = received + $1, hash_state = $2
+				WHERE upload_id = $3 AND received = $4`
+	result, err := tx.Exec(ctx, query, len(data), hashState, id, offset)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return models.ErrInvalidOffset
+	}
+
+	query = `INSERT INTO upload_chunks (upload_id, chunk_offset, chunk_data)
+				VALUES ($1, $2, $3)`
+	_, err = tx.Exec(ctx, query, id, offset, data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CompleteUpload переносит полностью принятую загрузку в новую BINARY запись.
+// Если данные уже сохранены во внешнем хранилище, запись получает ссылку blob
+func (p *PGDB) CompleteUpload(ctx context.Context, id string, blob models.BlobRef) (string, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var username, meta string
+	query := `SELECT username, meta FROM uploads WHERE upload_id = $1 AND received = size FOR UPDATE`
+	err = tx.QueryRow(ctx, query, id).Scan(&username, &meta)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", models.ErrNotFound
+		}
+		return "", err
+	}
+
+	data := []byte{}
+	if blob.Key == "" {
+		rows, err := tx.Query(ctx, `SELECT chunk_data FROM upload_chunks WHERE upload_id = $1 ORDER BY chunk_offset`, id)
+		if err != nil {
+			return "", err
+		}
+		for rows.Next() {
+			var chunk []byte
+			if err := rows.Scan(&chunk); err != nil {
+				rows.Close()
+				return "", err
+			}
+			data = append(data, chunk...)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+	}
+
+	size := recordSize(models.Record{Data: data, Meta: meta, Blob: blob})
+	if err := p.addUsage(ctx, tx, username, size, 1, size); err != nil {
+		return "", err
+	}
+
+	sealed, err := sealRecord(p.keys, data, meta)
+	if err != nil {
+		return "", err
+	}
+
+	change, err := p.nextChange(ctx, tx, username)
+	if err != nil {
+		return "", err
+	}
+
+	var recordID string
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(blob)
+	query = `INSERT INTO records (type_record, user_data, meta, username, blob_key, blob_size, blob_hash,
+				blob_key_id, blob_data_key, key_id, data_key, record_size, change_seq)
+			VALUES ('BINARY', $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING public_id`
+	err = tx.QueryRow(ctx, query, sealed.data, sealed.meta, username, blobKey, blobSize, blobHash, blobKeyID, blobDataKey,
+		sealed.keyID, sealed.dataKey, size, change).Scan(&recordID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM uploads WHERE upload_id = $1`, id)
+	if err != nil {
+		return "", err
+	}
+
+	return recordID, tx.Commit(ctx)
+}
+
+// PurgeStaleUploads удаляет незавершенные загрузки, начатые раньше before
+func (p *PGDB) PurgeStaleUploads(ctx context.Context, before time.Time) (int, error) {
+	result, err := p.db.Exec(ctx, `DELETE FROM uploads WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// ReadUploadChunk возвращает часть загрузки, начинающуюся с offset
+func (p *PGDB) ReadUploadChunk(ctx context.Context, id string, offset int64) ([]byte, error) {
+	var chunk []byte
+
+	query := `SELECT chunk_data FROM upload_chunks WHERE upload_id = $1 AND chunk_offset = $2`
+	err := p.db.QueryRow(ctx, query, id, offset).Scan(&chunk)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// GetBlobRef возвращает ссылку на данные записи. Для данных, лежащих в самой
+// записи, Key пустой, а Size равен их размеру
+func (p *PGDB) GetBlobRef(ctx context.Context, id string) (models.BlobRef, error) {
+	var ref models.BlobRef
+	var keyID string
+	var dataSize int64
+
+	query := `SELECT COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash,
+				COALESCE(blob_key_id, ''), blob_data_key, octet_length(user_data), COALESCE(key_id, '')
+			FROM records WHERE public_id = $1 AND deleted_at IS NULL`
+	err := p.db.QueryRow(ctx, query, id).Scan(&ref.Key, &ref.Size, &ref.Hash, &ref.KeyID, &ref.DataKey,
+		&dataSize, &keyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.BlobRef{}, models.ErrNotFound
+		}
+		return models.BlobRef{}, err
+	}
+	if ref.Key == "" {
+		ref.Size = plainSize(dataSize, keyID)
+	}
+	return ref, nil
+}
+
+// ReadDataChunk читает не больше limit байт данных записи, начиная с offset.
+// Из зашифрованной записи читаются и расшифровываются только нужные сегменты
+func (p *PGDB) ReadDataChunk(ctx context.Context, id string, offset int64, limit int) ([]byte, error) {
+	var chunk, dataKey []byte
+	var keyID string
+	var total int64
+
+	sealedFrom, sealedLen, first := envelope.SealedRange(offset, limit)
+	query := `SELECT COALESCE(key_id, ''), data_key, octet_length(user_data),
+				CASE WHEN key_id IS NULL THEN substring(user_data FROM $2 FOR $3)
+					ELSE substring(user_data FROM $4 FOR $5) END
+			FROM records WHERE public_id = $1 AND deleted_at IS NULL`
+	err := p.db.QueryRow(ctx, query, id, offset+1, limit, sealedFrom+1, sealedLen).
+		Scan(&keyID, &dataKey, &total, &chunk)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	return openDataRange(p.keys, chunk, offset, limit, first, total, keyID, dataKey)
+}
+
+// GetUsage возвращает занятое пользователем место и действующие для него ограничения
+func (p *PGDB) GetUsage(ctx context.Context, username string) (models.Usage, error) {
+	var usage models.Usage
+	query := `SELECT used_bytes, record_count, COALESCE(quota_bytes, $2), COALESCE(quota_records, $3),
+				COALESCE(max_record_size, $4)
+			FROM users WHERE username = $1`
+	err := p.db.QueryRow(ctx, query, username, p.quota.Bytes, p.quota.Records, p.quota.MaxRecordSize).
+		Scan(&usage.Bytes, &usage.Records, &usage.Quota.Bytes, &usage.Quota.Records, &usage.Quota.MaxRecordSize)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Usage{}, models.ErrNotFound
+		}
+		return models.Usage{}, err
+	}
+	return usage, nil
+}
 
-	_, filename, _, _ := runtime.Caller(0)
-	migrationsPath := filepath.Join(filepath.Dir(filename), "migrations")
+// GetKDFParams возвращает параметры, с которыми клиент выводит ключи аккаунта
+// из мастер-пароля. У аккаунта, созданного до сквозного шифрования, они пустые
+func (p *PGDB) GetKDFParams(ctx context.Context, username string) (models.KDFParams, error) {
+	var kdf models.KDFParams
+	var time, memory, threads *int64
+	query := `SELECT kdf_salt, kdf_time, kdf_memory, kdf_threads FROM users WHERE username = $1`
+	err := p.db.QueryRow(ctx, query, username).Scan(&kdf.Salt, &time, &memory, &threads)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.KDFParams{}, models.ErrNotFound
+		}
+		return models.KDFParams{}, err
+	}
+	if kdf.Salt == nil {
+		return models.KDFParams{}, nil
+	}
+	kdf.Time, kdf.Memory, kdf.Threads = uint32(*time), uint32(*memory), uint8(*threads)
+	return kdf, nil
+}
+
+// MigrateUser переводит аккаунт, созданный до сквозного шифрования, на ключ
+// входа password, выведенный с параметрами kdf, и завершает все его сессии.
+// Если аккаунт уже переведен, возвращается ErrConflict
+func (p *PGDB) MigrateUser(ctx context.Context, username, password string, kdf models.KDFParams) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET user_password = $2, kdf_salt = $3, kdf_time = $4, kdf_memory = $5, kdf_threads = $6
+			WHERE username = $1 AND kdf_salt IS NULL`
+	result, err := tx.Exec(ctx, query, username, password,
+		kdf.Salt, int64(kdf.Time), int64(kdf.Memory), int64(kdf.Threads))
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		if _, err := p.GetKDFParams(ctx, username); err != nil {
+			return err
+		}
+		return models.ErrConflict
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE username = $1`, username); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetVaultKey возвращает обернутый ключ шифрования записей пользователя. Если
+// ключ еще не задан, возвращается ErrNotFound
+func (p *PGDB) GetVaultKey(ctx context.Context, username string) ([]byte, error) {
+	var key []byte
+	query := `SELECT wrapped_key FROM users WHERE username = $1`
+	err := p.db.QueryRow(ctx, query, username).Scan(&key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	if key == nil {
+		return nil, models.ErrNotFound
+	}
+	return key, nil
+}
+
+// SetVaultKey задает обернутый ключ шифрования записей пользователя. Ключ
+// задается один раз: если он уже есть, возвращается ErrConflict
+func (p *PGDB) SetVaultKey(ctx context.Context, username string, key []byte) error {
+	query := `UPDATE users SET wrapped_key = $2 WHERE username = $1 AND wrapped_key IS NULL`
+	result, err := p.db.Exec(ctx, query, username, key)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		if _, err := p.GetKDFParams(ctx, username); err != nil {
+			return err
+		}
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// ChangePassword заменяет хеш пароля oldHash на newHash, сохраняет параметры
+// kdf нового ключа входа и завершает все сессии пользователя, кроме
+// keepSession. Если передан key, вместе с паролем сохраняется ключ записей,
+// обернутый ключом из нового пароля; без key ключ у пользователя должен
+// отсутствовать. Если пароль успели сменить раньше, возвращается ErrConflict
+func (p *PGDB) ChangePassword(ctx context.Context, username, oldHash, newHash string, kdf models.KDFParams, key []byte, keepSession string) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET user_password = $3,
+				kdf_salt = $4, kdf_time = $5, kdf_memory = $6, kdf_threads = $7,
+				wrapped_key = COALESCE($8, wrapped_key)
+			WHERE username = $1 AND user_password = $2 AND ($8::bytea IS NOT NULL OR wrapped_key IS NULL)`
+	result, err := tx.Exec(ctx, query, username, oldHash, newHash,
+		kdf.Salt, int64(kdf.Time), int64(kdf.Memory), int64(kdf.Threads), key)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		var exist bool
+		query = `SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`
+		if err := tx.QueryRow(ctx, query, username).Scan(&exist); err != nil {
+			return err
+		}
+		if !exist {
+			return models.ErrNotFound
+		}
+		return models.ErrConflict
+	}
+
+	query = `DELETE FROM sessions WHERE username = $1 AND session_id::text <> $2`
+	if _, err := tx.Exec(ctx, query, username, keepSession); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateSession создает сессию пользователя и возвращает ее id
+func (p *PGDB) CreateSession(ctx context.Context, session models.Session) (string, error) {
+	var id string
+	query := `INSERT INTO sessions (username, refresh_hash, expires_at)
+				VALUES ($1, $2, $3)
+				RETURNING session_id`
+	err := p.db.QueryRow(ctx, query, session.Username, session.RefreshHash, session.ExpiresAt).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetSession возвращает сессию по id. Если сессии нет, возвращается ErrNotFound
+func (p *PGDB) GetSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	query := `SELECT session_id, username, refresh_hash, created_at, expires_at
+			FROM sessions WHERE session_id = $1`
+	err := p.db.QueryRow(ctx, query, id).Scan(&session.ID, &session.Username, &session.RefreshHash,
+		&session.CreatedAt, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Session{}, models.ErrNotFound
+		}
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+// RotateSession заменяет хеш refresh-токена oldHash на newHash и продлевает
+// сессию до expiresAt. Если хеш успели заменить раньше, возвращается ErrConflict
+func (p *PGDB) RotateSession(ctx context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error {
+	query := `UPDATE sessions SET refresh_hash = $3, expires_at = $4
+			WHERE session_id = $1 AND refresh_hash = $2`
+	result, err := p.db.Exec(ctx, query, id, oldHash, newHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		if _, err := p.GetSession(ctx, id); err != nil {
+			return err
+		}
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// DeleteSession завершает сессию. Удаление отсутствующей сессии не ошибка
+func (p *PGDB) DeleteSession(ctx context.Context, id string) error {
+	_, err := p.db.Exec(ctx, `DELETE FROM sessions WHERE session_id = $1`, id)
+	return err
+}
+
+// PurgeExpiredSessions удаляет сессии, срок которых истек раньше before
+func (p *PGDB) PurgeExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	result, err := p.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// SetTOTPSecret сохраняет секрет TOTP, который ждет подтверждения. Прежний
+// неподтвержденный секрет заменяется, а если второй фактор уже включен,
+// возвращается ErrConflict
+func (p *PGDB) SetTOTPSecret(ctx context.Context, username, secret string) error {
+	query := `INSERT INTO user_totp (username, secret) VALUES ($1, $2)
+			ON CONFLICT (username) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, failures = 0, failed_at = NULL
+			WHERE NOT user_totp.enabled`
+	result, err := p.db.Exec(ctx, query, username, secret)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// GetTOTP возвращает второй фактор пользователя. Если секрет не задан,
+// возвращается ErrNotFound
+func (p *PGDB) GetTOTP(ctx context.Context, username string) (models.TOTP, error) {
+	var totp models.TOTP
+	var failedAt *time.Time
+	query := `SELECT secret, enabled, last_step, failures, failed_at,
+				(SELECT count(*) FROM recovery_codes WHERE recovery_codes.username = user_totp.username)
+			FROM user_totp WHERE username = $1`
+	err := p.db.QueryRow(ctx, query, username).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep,
+		&totp.Failures, &failedAt, &totp.RecoveryLeft)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.TOTP{}, models.ErrNotFound
+		}
+		return models.TOTP{}, err
+	}
+	if failedAt != nil {
+		totp.FailedAt = *failedAt
+	}
+	return totp, nil
+}
+
+// EnableTOTP включает второй фактор, подтвержденный кодом шага step, и
+// заменяет коды восстановления хешами recoveryCodes. Если секрета нет,
+// возвращается ErrNotFound, если второй фактор уже включен, ErrConflict
+func (p *PGDB) EnableTOTP(ctx context.Context, username string, step int64, recoveryCodes [][]byte) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var enabled bool
+	query := `SELECT enabled FROM user_totp WHERE username = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, username).Scan(&enabled); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+	if enabled {
+		return models.ErrConflict
+	}
+
+	query = `UPDATE user_totp SET enabled = true, last_step = $2, failures = 0, failed_at = NULL WHERE username = $1`
+	if _, err := tx.Exec(ctx, query, username, step); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE username = $1`, username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodes {
+		query = `INSERT INTO recovery_codes (username, code_hash) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, query, username, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep принимает код шага step и сбрасывает счетчик неверных кодов.
+// Если код этого или более позднего шага уже принят, возвращается ErrConflict,
+// если второй фактор не включен, ErrNotFound
+func (p *PGDB) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	query := `UPDATE user_totp SET last_step = $2, failures = 0, failed_at = NULL
+			WHERE username = $1 AND enabled AND last_step < $2`
+	result, err := p.db.Exec(ctx, query, username, step)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		totp, err := p.GetTOTP(ctx, username)
+		if err != nil {
+			return err
+		}
+		if !totp.Enabled {
+			return models.ErrNotFound
+		}
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// UseRecoveryCode удаляет использованный код восстановления с хешем hash и
+// сбрасывает счетчик неверных кодов. Если такого кода нет, возвращается
+// ErrNotFound
+func (p *PGDB) UseRecoveryCode(ctx context.Context, username string, hash []byte) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM recovery_codes WHERE username = $1 AND code_hash = $2`
+	result, err := tx.Exec(ctx, query, username, hash)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+	query = `UPDATE user_totp SET failures = 0, failed_at = NULL WHERE username = $1`
+	if _, err := tx.Exec(ctx, query, username); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AddTOTPAttempt учитывает код, введенный в момент at, и возвращает число
+// попыток после последнего принятого кода. Если предыдущая попытка была
+// раньше since, счет начинается заново
+func (p *PGDB) AddTOTPAttempt(ctx context.Context, username string, at, since time.Time) (int, error) {
+	query := `UPDATE user_totp SET
+			failures = CASE WHEN failed_at IS NULL OR failed_at < $3 THEN 1 ELSE failures + 1 END,
+			failed_at = $2
+		WHERE username = $1 AND enabled
+		RETURNING failures`
+	var attempts int
+	err := p.db.QueryRow(ctx, query, username, at, since).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.ErrNotFound
+	}
+	return attempts, err
+}
+
+// DeleteTOTP отключает второй фактор вместе с кодами восстановления.
+// Отключение отсутствующего второго фактора не ошибка
+func (p *PGDB) DeleteTOTP(ctx context.Context, username string) error {
+	_, err := p.db.Exec(ctx, `DELETE FROM user_totp WHERE username = $1`, username)
+	return err
+}
+
+// addUsage меняет занятое пользователем место на bytes и число его записей на
+// records. Рост проверяется по квоте пользователя, а size по допустимому
+// размеру записи; при превышении возвращается ErrQuotaExceeded
+func (p *PGDB) addUsage(ctx context.Context, tx pgx.Tx, username string, bytes, records, size int64) error {
+	query := `UPDATE users SET used_bytes = used_bytes + $2::bigint, record_count = record_count + $3::bigint
+			WHERE username = $1
+				AND ($2::bigint <= 0 OR COALESCE(quota_bytes, $4::bigint) = 0
+					OR used_bytes + $2::bigint <= COALESCE(quota_bytes, $4::bigint))
+				AND ($3::bigint <= 0 OR COALESCE(quota_records, $5::bigint) = 0
+					OR record_count + $3::bigint <= COALESCE(quota_records, $5::bigint))
+				AND (COALESCE(max_record_size, $6::bigint) = 0 OR $7::bigint <= COALESCE(max_record_size, $6::bigint))`
+	result, err := tx.Exec(ctx, query, username, bytes, records,
+		p.quota.Bytes, p.quota.Records, p.quota.MaxRecordSize, size)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return models.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// nextChange увеличивает счетчик изменений пользователя и возвращает его
+// новое значение, которым помечается измененная запись. Строка пользователя
+// остается заблокированной до конца транзакции, поэтому изменения одного
+// пользователя фиксируются в порядке номеров
+func (p *PGDB) nextChange(ctx context.Context, tx pgx.Tx, username string) (int64, error) {
+	var change int64
+	query := `UPDATE users SET change_seq = change_seq + 1 WHERE username = $1 RETURNING change_seq`
+	err := tx.QueryRow(ctx, query, username).Scan(&change)
+	return change, err
+}
+
+// addTombstone оставляет в ленте изменений след окончательно удаленной записи
+func (p *PGDB) addTombstone(ctx context.Context, tx pgx.Tx, username, id string) error {
+	change, err := p.nextChange(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO record_tombstones (username, change_seq, public_id) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(ctx, query, username, change, id)
+	return err
+}
+
+// GetLastChange возвращает номер последнего изменения записей пользователя
+func (p *PGDB) GetLastChange(ctx context.Context, username string) (int64, error) {
+	var change int64
+	err := p.db.QueryRow(ctx, `SELECT change_seq FROM users WHERE username = $1`, username).Scan(&change)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, models.ErrNotFound
+		}
+		return 0, err
+	}
+	return change, nil
+}
+
+// GetChanges возвращает до limit изменений записей пользователя с номером
+// больше since в порядке номеров
+func (p *PGDB) GetChanges(ctx context.Context, username string, since int64, limit int) ([]models.Change, error) {
+	query := `SELECT change_seq, deleted_at IS NOT NULL, public_id, type_record::text, revision,
+				CASE WHEN deleted_at IS NULL THEN user_data END, meta, record_size, created_at, updated_at,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE username = $1 AND change_seq > $2
+			UNION ALL
+			SELECT change_seq, true, public_id, '', 0, NULL::bytea, '', 0, deleted_at, deleted_at,
+				'', 0, NULL::bytea, '', NULL::bytea, '', NULL::bytea
+			FROM record_tombstones WHERE username = $1 AND change_seq > $2
+			ORDER BY 1 LIMIT $3`
+	rows, err := p.db.Query(ctx, query, username, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []models.Change
+	for rows.Next() {
+		var change models.Change
+		var record models.Record
+		var keyID string
+		var dataKey []byte
+
+		err := rows.Scan(&change.Revision, &change.Deleted, &record.Id, &record.TypeRecord, &record.Version,
+			&record.Data, &record.Meta, &record.Size, &record.CreatedAt, &record.UpdatedAt,
+			&record.Blob.Key, &record.Blob.Size, &record.Blob.Hash, &record.Blob.KeyID, &record.Blob.DataKey, &keyID, &dataKey)
+		if err != nil {
+			return nil, err
+		}
+		change.Record = models.Record{Id: record.Id}
+		if !change.Deleted {
+			if err := openRecord(p.keys, &record, keyID, dataKey); err != nil {
+				return nil, err
+			}
+			change.Record = record
+		}
+
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// RotateKeys переоборачивает активным мастер-ключом ключи данных записей и их
+// версий, а также ключи blob во внешнем хранилище, а строки, сохраненные без
+// шифрования, шифрует. Каждая строка обрабатывается в своей транзакции,
+// поэтому ротацию можно проводить на работающем сервере. Возвращает количество
+// обработанных строк
+func (p *PGDB) RotateKeys(ctx context.Context) (int, error) {
+	if p.keys == nil {
+		return 0, errNoMasterKey
+	}
+
+	rotated := 0
+	for _, rotate := range []func(ctx context.Context, table, idColumn string, lastID *int64, lastRevision *int) (bool, error){
+		p.rotateOneKey, p.rotateOneBlobKey,
+	} {
+		for _, t := range []struct{ table, idColumn string }{{"records", "id"}, {"record_revisions", "record_id"}} {
+			var lastID int64
+			lastRevision := -1
+			for {
+				found, err := rotate(ctx, t.table, t.idColumn, &lastID, &lastRevision)
+				if err != nil {
+					return rotated, err
+				}
+				if !found {
+					break
+				}
+				rotated++
+			}
+		}
+	}
+	return rotated, nil
+}
+
+func (p *PGDB) rotateOneKey(ctx context.Context, table, idColumn string, lastID *int64, lastRevision *int) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var keyID string
+	var wrapped []byte
+	query := fmt.Sprintf(`SELECT %[2]s, revision, COALESCE(key_id, ''), data_key FROM %[1]s
+			WHERE (%[2]s, revision) > ($1, $2) AND key_id IS DISTINCT FROM $3
+			ORDER BY %[2]s, revision LIMIT 1 FOR UPDATE`, table, idColumn)
+	err = tx.QueryRow(ctx, query, *lastID, *lastRevision, p.keys.Primary()).
+		Scan(lastID, lastRevision, &keyID, &wrapped)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var sealed sealedRecord
+	if keyID == "" {
+		var data []byte
+		var meta string
+		query = fmt.Sprintf(`SELECT user_data, meta FROM %s WHERE %s = $1 AND revision = $2`, table, idColumn)
+		if err := tx.QueryRow(ctx, query, *lastID, *lastRevision).Scan(&data, &meta); err != nil {
+			return false, err
+		}
+		sealed, err = sealRecord(p.keys, data, meta)
+	} else {
+		sealed.keyID, sealed.dataKey, err = rewrapKey(p.keys, keyID, wrapped)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var meta any
+	if sealed.data != nil {
+		meta = sealed.meta
+	}
+	query = fmt.Sprintf(`UPDATE %s SET user_data = COALESCE($3::bytea, user_data), meta = COALESCE($4::text, meta),
+				key_id = $5, data_key = $6
+			WHERE %s = $1 AND revision = $2`, table, idColumn)
+	_, err = tx.Exec(ctx, query, *lastID, *lastRevision, sealed.data, meta, sealed.keyID, sealed.dataKey)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// rotateOneBlobKey переоборачивает активным мастер-ключом ключ blob строки
+func (p *PGDB) rotateOneBlobKey(ctx context.Context, table, idColumn string, lastID *int64, lastRevision *int) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var keyID string
+	var wrapped []byte
+	query := fmt.Sprintf(`SELECT %[2]s, revision, blob_key_id, blob_data_key FROM %[1]s
+			WHERE (%[2]s, revision) > ($1, $2) AND blob_key_id IS NOT NULL AND blob_key_id <> $3
+			ORDER BY %[2]s, revision LIMIT 1 FOR UPDATE`, table, idColumn)
+	err = tx.QueryRow(ctx, query, *lastID, *lastRevision, p.keys.Primary()).
+		Scan(lastID, lastRevision, &keyID, &wrapped)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	keyID, wrapped, err = rewrapKey(p.keys, keyID, wrapped)
+	if err != nil {
+		return false, err
+	}
+	query = fmt.Sprintf(`UPDATE %s SET blob_key_id = $3, blob_data_key = $4
+			WHERE %s = $1 AND revision = $2`, table, idColumn)
+	if _, err := tx.Exec(ctx, query, *lastID, *lastRevision, keyID, wrapped); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// SealBlobs по одному заменяет незашифрованные blob зашифрованными копиями,
+// которые создает seal, и переводит на копию все ссылающиеся строки. Прежние
+// blob остаются без ссылок и удаляются PurgeOrphanBlobs. Возвращает
+// количество замененных blob
+func (p *PGDB) SealBlobs(ctx context.Context, seal func(ctx context.Context, ref models.BlobRef) (models.BlobRef, error)) (int, error) {
+	sealed := 0
+	for {
+		var ref models.BlobRef
+		query := `SELECT blob_key, blob_size, blob_hash FROM records
+					WHERE blob_key IS NOT NULL AND blob_key_id IS NULL
+				UNION ALL
+				SELECT blob_key, blob_size, blob_hash FROM record_revisions
+					WHERE blob_key IS NOT NULL AND blob_key_id IS NULL
+				LIMIT 1`
+		err := p.db.QueryRow(ctx, query).Scan(&ref.Key, &ref.Size, &ref.Hash)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return sealed, nil
+			}
+			return sealed, err
+		}
+
+		sealedRef, err := seal(ctx, ref)
+		if err != nil {
+			return sealed, err
+		}
+		if sealedRef.KeyID == "" {
+			return sealed, errNoMasterKey
+		}
+
+		tx, err := p.db.Begin(ctx)
+		if err != nil {
+			return sealed, err
+		}
+		for _, table := range []string{"records", "record_revisions"} {
+			query = fmt.Sprintf(`UPDATE %s SET blob_key = $2, blob_key_id = $3, blob_data_key = $4
+					WHERE blob_key = $1 AND blob_key_id IS NULL`, table)
+			_, err = tx.Exec(ctx, query, ref.Key, sealedRef.Key, sealedRef.KeyID, sealedRef.DataKey)
+			if err != nil {
+				tx.Rollback(ctx)
+				return sealed, err
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return sealed, err
+		}
+		sealed++
+	}
+}
+
+// GetBlobKeys возвращает ключи всех blob, на которые ссылаются записи и их версии
+func (p *PGDB) GetBlobKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	query := `SELECT blob_key FROM records WHERE blob_key IS NOT NULL
+			UNION
+			SELECT blob_key FROM record_revisions WHERE blob_key IS NOT NULL`
+	rows, err := p.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// MoveDataToBlobs по одной выносит данные BINARY записей и их версий во внешнее
+// хранилище через put и оставляет в базе только ссылку
+func (p *PGDB) MoveDataToBlobs(ctx context.Context, put func(ctx context.Context, data []byte) (models.BlobRef, error)) (int, error) {
+	queries := []struct{ selectRow, update string }{
+		{
+			selectRow: `SELECT id, revision, user_data, meta, COALESCE(key_id, ''), data_key FROM records
+					WHERE type_record = 'BINARY' AND blob_key IS NULL
+					LIMIT 1 FOR UPDATE`,
+			update: `UPDATE records SET user_data = $8, meta = $9, key_id = $10, data_key = $11,
+						blob_key = $3, blob_size = $4, blob_hash = $5, blob_key_id = $6, blob_data_key = $7
+					WHERE id = $1 AND revision = $2`,
+		},
+		{
+			selectRow: `SELECT h.record_id, h.revision, h.user_data, h.meta, COALESCE(h.key_id, ''), h.data_key
+					FROM record_revisions h JOIN records r ON r.id = h.record_id
+					WHERE r.type_record = 'BINARY' AND h.blob_key IS NULL
+					LIMIT 1 FOR UPDATE OF h`,
+			update: `UPDATE record_revisions SET user_data = $8, meta = $9, key_id = $10, data_key = $11,
+						blob_key = $3, blob_size = $4, blob_hash = $5, blob_key_id = $6, blob_data_key = $7
+					WHERE record_id = $1 AND revision = $2`,
+		},
+	}
+
+	moved := 0
+	for _, q := range queries {
+		for {
+			done, err := p.moveOneToBlob(ctx, q.selectRow, q.update, put)
+			if err != nil {
+				return moved, err
+			}
+			if done {
+				break
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (p *PGDB) moveOneToBlob(ctx context.Context, selectRow, update string, put func(ctx context.Context, data []byte) (models.BlobRef, error)) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var recordID int64
+	var revision int
+	var data, dataKey []byte
+	var meta, keyID string
+	err = tx.QueryRow(ctx, selectRow).Scan(&recordID, &revision, &data, &meta, &keyID, &dataKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	data, rest, err := moveDataOut(p.keys, data, meta, keyID, dataKey)
+	if err != nil {
+		return false, err
+	}
+	ref, err := put(ctx, data)
+	if err != nil {
+		return false, err
+	}
+
+	blobKey, blobSize, blobHash, blobKeyID, blobDataKey := blobArgs(ref)
+	_, err = tx.Exec(ctx, update, recordID, revision, blobKey, blobSize, blobHash, blobKeyID, blobDataKey,
+		rest.data, rest.meta, rest.keyID, rest.dataKey)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit(ctx)
+}
+
+// recordSize размер записи, который учитывается в квоте: данные, в том числе
+// вынесенные во внешнее хранилище, и метаинформация
+func recordSize(record models.Record) int64 {
+	return int64(len(record.Data)) + record.Blob.Size + int64(len(record.Meta))
+}
+
+// listedRecord запись вместе с внутренним номером, из которого строится курсор
+type listedRecord struct {
+	seq    int64
+	record models.Record
+}
+
+// maxListScan наибольшее число записей, просматриваемых paginate за один
+// запрос страницы
+const maxListScan = 2000
+
+// paginate собирает страницу записей по фильтру. fetch возвращает до limit
+// записей после курсора в порядке выдачи. Метаинформация хранится в БД
+// зашифрованной, поэтому фильтр по ней нельзя выразить в SQL и он
+// применяется здесь к расшифрованным записям. Недостающие после фильтрации
+// записи дочитываются следующими порциями, но не более maxListScan за
+// страницу: дойдя до предела, paginate возвращает неполную (возможно, пустую)
+// страницу с курсором на последнюю просмотренную запись
+func paginate(filter models.ListFilter, fetch func(after int64, limit int) ([]listedRecord, error)) ([]models.Record, string, error) {
+	after, err := decodeCursor(filter.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records []models.Record
+	var last int64
+	scanned := 0
+	for {
+		batch, err := fetch(after, filter.Limit+1)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, r := range batch {
+			if scanned == maxListScan {
+				return records, encodeCursor(after), nil
+			}
+			scanned++
+			after = r.seq
+			if !matchMeta(r.record.Meta, filter.Meta) {
+				continue
+			}
+			if len(records) == filter.Limit {
+				return records, encodeCursor(last), nil
+			}
+			records = append(records, r.record)
+			last = r.seq
+		}
+		if len(batch) <= filter.Limit {
+			return records, "", nil
+		}
+	}
+}
+
+// listQuery строит запрос порции записей пользователя для paginate. placeholder
+// возвращает параметр запроса с номером n в синтаксисе драйвера
+func listQuery(username string, filter models.ListFilter, after int64, limit int, placeholder func(n int) string) (string, []any) {
+	data := "user_data"
+	if filter.MetadataOnly {
+		data = "NULL"
+	}
+
+	args := []any{username}
+	query := `SELECT id, public_id, type_record, revision, ` + data + `, meta, record_size, created_at, updated_at,
+				COALESCE(blob_key, ''), COALESCE(blob_size, 0), blob_hash, COALESCE(blob_key_id, ''), blob_data_key, COALESCE(key_id, ''), data_key
+			FROM records WHERE username = ` + placeholder(1) + ` AND deleted_at IS NULL`
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		query += ` AND type_record = ` + placeholder(len(args))
+	}
+
+	order := "ASC"
+	if after > 0 {
+		args = append(args, after)
+		if filter.NewestFirst {
+			query += ` AND id < ` + placeholder(len(args))
+		} else {
+			query += ` AND id > ` + placeholder(len(args))
+		}
+	}
+	if filter.NewestFirst {
+		order = "DESC"
+	}
+
+	args = append(args, limit)
+	query += ` ORDER BY id ` + order + ` LIMIT ` + placeholder(len(args))
+	return query, args
+}
+
+// encodeCursor переводит внутренний номер записи в непрозрачный курсор страницы
+func encodeCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString(strconv.AppendInt(nil, seq, 10))
+}
+
+// decodeCursor разбирает курсор, полученный от encodeCursor. Пустой курсор
+// означает начало списка
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, models.ErrInvalidArgument
+	}
+	seq, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || seq <= 0 {
+		return 0, models.ErrInvalidArgument
+	}
+	return seq, nil
+}
+
+// matchMeta проверяет, что метаинформация содержит подстроку без учета регистра
+func matchMeta(meta, substr string) bool {
+	return substr == "" || strings.Contains(strings.ToLower(meta), strings.ToLower(substr))
+}
+
+// blobArgs значения колонок blob_key, blob_size, blob_hash, blob_key_id и
+// blob_data_key. Для данных, лежащих в самой записи, все колонки NULL, для
+// незашифрованного объекта NULL две последние
+func blobArgs(ref models.BlobRef) (any, any, any, any, any) {
+	if ref.Key == "" {
+		return nil, nil, nil, nil, nil
+	}
+	if ref.KeyID == "" {
+		return ref.Key, ref.Size, ref.Hash, nil, nil
+	}
+	return ref.Key, ref.Size, ref.Hash, ref.KeyID, ref.DataKey
+}
+
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationsFS embed.FS
+
+// MigrateCommands команды, которые принимает Migrate
+var MigrateCommands = []string{"up", "down", "status", "redo"}
+
+// InitMigrations применяет новые миграции при старте сервера
+func InitMigrations(conf config.Config, logger zap.SugaredLogger) error {
+	if conf.DatabaseDriver() == config.DriverMemory {
+		return nil
+	}
+	return Migrate(context.Background(), conf, "up", logger)
+}
+
+// Migrate выполняет команду миграций: up, down, status или redo. Файлы
+// миграций встроены в бинарник сервера
+func Migrate(ctx context.Context, conf config.Config, command string, logger zap.SugaredLogger) error {
+	if !slices.Contains(MigrateCommands, command) {
+		return fmt.Errorf("unknown migrate command %q, want one of %v", command, MigrateCommands)
+	}
+	if conf.DatabaseDriver() == config.DriverMemory {
+		return errors.New("memory storage has no migrations")
+	}
+
+	logger.Infow("Start migrations", "command", command)
+	driver, dsn, dialect, dir := "pgx", conf.DatabaseDsn, goose.DialectPostgres, "migrations"
+	if conf.DatabaseDriver() == config.DriverSQLite {
+		driver, dsn, dialect, dir = "sqlite3", sqliteDSN(conf.DatabaseDsn), goose.DialectSQLite3, "migrations/sqlite"
+	}
+
+	db, err := sql.Open(driver, dsn)
+
+	if err != nil {
+		logger.Errorw("Error with connection to DB: ", err)
+		return err
+	}
+
+	defer db.Close()
+
+	err = goose.SetDialect(string(dialect))
+	if err != nil {
+		logger.Errorw("Error with migrations dialect: ", err)
+		return err
+	}
 
-	err = goose.Up(db, migrationsPath)
+	goose.SetBaseFS(migrationsFS)
+	err = goose.RunContext(ctx, command, db, dir)
 	if err != nil {
 		logger.Errorw("Error with migrations: ", err)
 		return err
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sinfirst/GophKeeper/internal/config"
+	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"github.com/sinfirst/GophKeeper/internal/middleware/logging"
+	"github.com/sinfirst/GophKeeper/internal/models"
+	"github.com/sinfirst/GophKeeper/internal/storage/envelope"
+	"github.com/sinfirst/GophKeeper/internal/storage/storagetest"
+)
+
+// testDSNEnv переменная окружения с DSN отдельной базы PostgreSQL для
+// проверок PGDB. Без нее проверки PGDB пропускаются
+const testDSNEnv = "GOPHKEEPER_TEST_DSN"
+
+func testConfig(dsn string) config.Config {
+	return config.Config{
+		DatabaseDsn:   dsn,
+		HistoryLimit:  storagetest.HistoryLimit,
+		QuotaBytes:    storagetest.Quota.Bytes,
+		QuotaRecords:  storagetest.Quota.Records,
+		MaxRecordSize: storagetest.Quota.MaxRecordSize,
+	}
+}
+
+// testKeyring создает файл мастер-ключей с ключами ids, первый активный
+func testKeyring(t *testing.T, ids ...string) (*envelope.Keyring, string) {
+	t.Helper()
+	var content string
+	for _, id := range ids {
+		content += keyLine(t, id)
+	}
+	path := filepath.Join(t.TempDir(), "master.keys")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	keys, err := envelope.LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return keys, path
+}
+
+// keyLine строка файла мастер-ключей с новым случайным ключом id
+func keyLine(t *testing.T, id string) string {
+	t.Helper()
+	key := make([]byte, envelope.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key) + "\n"
+}
+
+// newTestSQLite создает базу SQLite во временном каталоге и применяет миграции
+func newTestSQLite(t *testing.T, conf config.Config, keys *envelope.Keyring) *SQLiteDB {
+	t.Helper()
+	conf.DatabaseDsn = "sqlite://" + filepath.Join(t.TempDir(), "gophkeeper.db")
+	logger := logging.NewLogger()
+	if err := InitMigrations(conf, logger); err != nil {
+		t.Fatalf("InitMigrations: %v", err)
+	}
+	db := NewSQLiteDB(conf, keys, logger)
+	if db == nil {
+		t.Fatalf("NewSQLiteDB returned nil")
+	}
+	t.Cleanup(func() { db.db.Close() })
+	return db
+}
+
+func TestMemoryDB(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) handlers.Storage {
+		return NewMemoryDB(testConfig(""))
+	})
+}
+
+func TestSQLiteDB(t *testing.T) {
+	db := newTestSQLite(t, testConfig(""), nil)
+	storagetest.Run(t, func(t *testing.T) handlers.Storage { return db })
+}
+
+func TestSQLiteDBEncrypted(t *testing.T) {
+	keys, _ := testKeyring(t, "k1")
+	db := newTestSQLite(t, testConfig(""), keys)
+	storagetest.Run(t, func(t *testing.T) handlers.Storage { return db })
+}
+
+func TestPGDB(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	conf := testConfig(dsn)
+	logger := logging.NewLogger()
+	if err := InitMigrations(conf, logger); err != nil {
+		t.Fatalf("InitMigrations: %v", err)
+	}
+	// набор проверок переносит и чужие записи, а база остается между
+	// запусками, поэтому хранилище создается без мастер-ключа: ключ нового
+	// запуска не откроет строки, зашифрованные в прошлом
+	db := NewPGDB(conf, nil, logger)
+	if db == nil {
+		t.Fatalf("NewPGDB returned nil")
+	}
+	t.Cleanup(db.db.Close)
+	storagetest.Run(t, func(t *testing.T) handlers.Storage { return db })
+}
+
+func TestPaginateScanLimit(t *testing.T) {
+	const total = 3*maxListScan + 10
+	fetched := 0
+	fetch := func(after int64, limit int) ([]listedRecord, error) {
+		var batch []listedRecord
+		for seq := after + 1; seq <= total && len(batch) < limit; seq++ {
+			meta := "skip"
+			if seq == total {
+				meta = "match"
+			}
+			batch = append(batch, listedRecord{seq: seq, record: models.Record{Id: strconv.FormatInt(seq, 10), Meta: meta}})
+		}
+		fetched += len(batch)
+		return batch, nil
+	}
+
+	filter := models.ListFilter{Limit: 10, Meta: "match"}
+	var found []models.Record
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatalf("paginate did not reach the end after %d pages", pages)
+		}
+		fetched = 0
+		records, next, err := paginate(filter, fetch)
+		if err != nil {
+			t.Fatalf("paginate: %v", err)
+		}
+		if fetched > maxListScan+filter.Limit+1 {
+			t.Errorf("page fetched %d rows; want at most %d", fetched, maxListScan+filter.Limit+1)
+		}
+		found = append(found, records...)
+		if next == "" {
+			break
+		}
+		filter.Cursor = next
+	}
+	if len(found) != 1 || found[0].Id != strconv.Itoa(total) {
+		t.Errorf("found %+v; want only record %d", found, total)
+	}
+}
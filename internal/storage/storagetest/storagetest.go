@@ -0,0 +1,1338 @@
+// Package storagetest содержит общий набор проверок поведения,
+// который должна проходить любая реализация handlers.Storage.
+//
+// Использование в тестах бэкенда:
+//
+//	func TestMemoryDB(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) handlers.Storage {
+//			return storage.NewMemoryDB(config.Config{
+//				HistoryLimit:  storagetest.HistoryLimit,
+//				QuotaBytes:    storagetest.Quota.Bytes,
+//				QuotaRecords:  storagetest.Quota.Records,
+//				MaxRecordSize: storagetest.Quota.MaxRecordSize,
+//			})
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sinfirst/GophKeeper/internal/handlers"
+	"github.com/sinfirst/GophKeeper/internal/models"
+)
+
+// HistoryLimit лимит истории, с которым Factory должна создавать хранилище
+const HistoryLimit = 3
+
+// Quota ограничения по умолчанию, с которыми Factory должна создавать хранилище
+var Quota = models.Quota{Bytes: 200, Records: 4, MaxRecordSize: 100}
+
+// Factory создает хранилище для одной подпроверки. Хранилище может быть общим
+// между подпроверками: все имена пользователей уникальны.
+type Factory func(t *testing.T) handlers.Storage
+
+// Run запускает весь набор проверок для хранилища
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s handlers.Storage)
+	}{
+		{"Users", testUsers},
+		{"StoreAndRetrieve", testStoreAndRetrieve},
+		{"Ownership", testOwnership},
+		{"NotFound", testNotFound},
+		{"UpdateMissing", testUpdateMissing},
+		{"DeleteMissing", testDeleteMissing},
+		{"UpdateAndDelete", testUpdateAndDelete},
+		{"ListIsolation", testListIsolation},
+		{"ListPages", testListPages},
+		{"ListMetadataOnly", testListMetadataOnly},
+		{"Revisions", testRevisions},
+		{"RevisionsRetention", testRevisionsRetention},
+		{"RevisionsMissing", testRevisionsMissing},
+		{"Trash", testTrash},
+		{"TrashMissing", testTrashMissing},
+		{"PurgeExpiredTrash", testPurgeExpiredTrash},
+		{"Uploads", testUploads},
+		{"UploadsMissing", testUploadsMissing},
+		{"ReadDataChunk", testReadDataChunk},
+		{"Blobs", testBlobs},
+		{"MoveDataToBlobs", testMoveDataToBlobs},
+		{"SealBlobs", testSealBlobs},
+		{"Quota", testQuota},
+		{"Versions", testVersions},
+		{"Changes", testChanges},
+		{"KDFParams", testKDFParams},
+		{"VaultKey", testVaultKey},
+		{"ChangePassword", testChangePassword},
+		{"Sessions", testSessions},
+		{"PurgeExpiredSessions", testPurgeExpiredSessions},
+		{"TOTP", testTOTP},
+		{"RecoveryCodes", testRecoveryCodes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := newUsername()
+
+	exist, err := s.CheckUsernameExists(ctx, username)
+	if err != nil || exist {
+		t.Fatalf("CheckUsernameExists before add = %v, %v; want false, nil", exist, err)
+	}
+
+	if err := s.AddUserToDB(ctx, username, "hash", models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+	exist, err = s.CheckUsernameExists(ctx, username)
+	if err != nil || !exist {
+		t.Fatalf("CheckUsernameExists after add = %v, %v; want true, nil", exist, err)
+	}
+
+	if err := s.AddUserToDB(ctx, username, "other", models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB for existing user: %v", err)
+	}
+	password, err := s.GetUserPassword(ctx, username)
+	if err != nil || password != "hash" {
+		t.Fatalf("GetUserPassword = %q, %v; want %q, nil", password, err, "hash")
+	}
+}
+
+func testStoreAndRetrieve(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	want := models.Record{TypeRecord: models.Login, Data: []byte(`{"login":"a"}`), Meta: "meta"}
+
+	id, err := s.StoreDataToDB(ctx, want, username)
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		t.Fatalf("StoreDataToDB returned non uuid id %q", id)
+	}
+
+	got, err := s.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	want.Id = id
+	assertRecord(t, got, want)
+
+	exist, err := s.CheckRecordExist(ctx, id)
+	if err != nil || !exist {
+		t.Fatalf("CheckRecordExist = %v, %v; want true, nil", exist, err)
+	}
+}
+
+func testOwnership(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	alice, bob := addUser(t, s), addUser(t, s)
+
+	aliceID := storeRecord(t, s, alice, "alice")
+	bobID := storeRecord(t, s, bob, "bob")
+
+	for id, want := range map[string]string{aliceID: alice, bobID: bob} {
+		owner, err := s.GetUserByDataID(ctx, id)
+		if err != nil || owner != want {
+			t.Fatalf("GetUserByDataID(%s) = %q, %v; want %q, nil", id, owner, err, want)
+		}
+	}
+}
+
+func testNotFound(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	if _, err := s.RetrieveDataFromDB(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("RetrieveDataFromDB on missing id = %v; want ErrNotFound", err)
+	}
+	if _, err := s.GetUserByDataID(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUserByDataID on missing id = %v; want ErrNotFound", err)
+	}
+	exist, err := s.CheckRecordExist(ctx, id)
+	if err != nil || exist {
+		t.Fatalf("CheckRecordExist on missing id = %v, %v; want false, nil", exist, err)
+	}
+}
+
+func testUpdateMissing(t *testing.T, s handlers.Storage) {
+	err := s.UpdateDataInDB(context.Background(), models.Record{Id: uuid.NewString(), Meta: "meta", Data: []byte("data")})
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("UpdateDataInDB on missing id = %v; want ErrNotFound", err)
+	}
+}
+
+func testDeleteMissing(t *testing.T, s handlers.Storage) {
+	err := s.DeleteDataFromDB(context.Background(), uuid.NewString(), 0)
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("DeleteDataFromDB on missing id = %v; want ErrNotFound", err)
+	}
+}
+
+func testUpdateAndDelete(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	id := storeRecord(t, s, username, "before")
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "after", Data: []byte("updated")}); err != nil {
+		t.Fatalf("UpdateDataInDB: %v", err)
+	}
+	got, err := s.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB after update: %v", err)
+	}
+	assertRecord(t, got, models.Record{Id: id, TypeRecord: models.Text, Data: []byte("updated"), Meta: "after"})
+
+	if err := s.DeleteDataFromDB(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	if _, err := s.RetrieveDataFromDB(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("RetrieveDataFromDB after delete = %v; want ErrNotFound", err)
+	}
+	if err := s.DeleteDataFromDB(ctx, id, 0); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("second DeleteDataFromDB = %v; want ErrNotFound", err)
+	}
+}
+
+func testListIsolation(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	alice, bob := addUser(t, s), addUser(t, s)
+
+	first := storeRecord(t, s, alice, "first")
+	second := storeRecord(t, s, alice, "second")
+	storeRecord(t, s, bob, "bob")
+
+	records, _, err := s.GetListData(ctx, alice, models.ListFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetListData: %v", err)
+	}
+	if len(records) != 2 || records[0].Id != first || records[1].Id != second {
+		t.Fatalf("GetListData(alice) = %+v; want records %s, %s in insertion order", records, first, second)
+	}
+
+	records, _, err = s.GetListData(ctx, newUsername(), models.ListFilter{Limit: 10})
+	if err != nil || len(records) != 0 {
+		t.Fatalf("GetListData for user without records = %+v, %v; want empty", records, err)
+	}
+}
+
+func testListPages(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	a1 := storeRecord(t, s, username, "alpha 1")
+	b := storeRecord(t, s, username, "beta")
+	a2, err := s.StoreDataToDB(ctx, models.Record{TypeRecord: models.Login, Data: []byte("{}"), Meta: "alpha 2"}, username)
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	a3 := storeRecord(t, s, username, "Alpha 3")
+
+	listAll := func(filter models.ListFilter) []string {
+		t.Helper()
+		var ids []string
+		for page := 0; ; page++ {
+			records, next, err := s.GetListData(ctx, username, filter)
+			if err != nil {
+				t.Fatalf("GetListData(%+v): %v", filter, err)
+			}
+			if len(records) > filter.Limit || next != "" && len(records) != filter.Limit {
+				t.Fatalf("GetListData(%+v) = %d records, next %q; want full pages", filter, len(records), next)
+			}
+			for _, r := range records {
+				ids = append(ids, r.Id)
+			}
+			if next == "" {
+				return ids
+			}
+			if page > 10 {
+				t.Fatalf("GetListData(%+v) does not reach the last page", filter)
+			}
+			filter.Cursor = next
+		}
+	}
+
+	tests := []struct {
+		filter models.ListFilter
+		want   []string
+	}{
+		{models.ListFilter{Limit: 1}, []string{a1, b, a2, a3}},
+		{models.ListFilter{Limit: 4}, []string{a1, b, a2, a3}},
+		{models.ListFilter{Limit: 3, NewestFirst: true}, []string{a3, a2, b, a1}},
+		{models.ListFilter{Limit: 1, Type: models.Text, Meta: "ALPHA"}, []string{a1, a3}},
+		{models.ListFilter{Limit: 1, Meta: "alpha", NewestFirst: true}, []string{a3, a2, a1}},
+		{models.ListFilter{Limit: 2, Type: models.Card}, nil},
+	}
+	for _, tt := range tests {
+		if got := listAll(tt.filter); !slices.Equal(got, tt.want) {
+			t.Fatalf("GetListData(%+v) = %v; want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	if _, _, err := s.GetListData(ctx, username, models.ListFilter{Limit: 1, Cursor: "not a cursor"}); !errors.Is(err, models.ErrInvalidArgument) {
+		t.Fatalf("GetListData with bad cursor = %v; want ErrInvalidArgument", err)
+	}
+}
+
+func testListMetadataOnly(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	before := time.Now().Add(-time.Minute)
+	id := storeRecord(t, s, username, "meta")
+
+	for _, metadataOnly := range []bool{false, true} {
+		records, _, err := s.GetListData(ctx, username, models.ListFilter{Limit: 10, MetadataOnly: metadataOnly})
+		if err != nil || len(records) != 1 {
+			t.Fatalf("GetListData(MetadataOnly: %t) = %+v, %v; want one record", metadataOnly, records, err)
+		}
+		got := records[0]
+		if got.Id != id || got.TypeRecord != models.Text || got.Meta != "meta" || got.Version != 1 {
+			t.Fatalf("GetListData(MetadataOnly: %t) = %+v; want record %s with its meta", metadataOnly, got, id)
+		}
+		if wantSize := int64(len("data meta") + len("meta")); got.Size != wantSize {
+			t.Fatalf("GetListData(MetadataOnly: %t) size = %d; want %d", metadataOnly, got.Size, wantSize)
+		}
+		if got.CreatedAt.Before(before) || got.UpdatedAt.Before(got.CreatedAt) {
+			t.Fatalf("GetListData(MetadataOnly: %t) created %v, updated %v; want recent timestamps", metadataOnly, got.CreatedAt, got.UpdatedAt)
+		}
+		if wantData := !metadataOnly; (len(got.Data) > 0) != wantData {
+			t.Fatalf("GetListData(MetadataOnly: %t) data = %q", metadataOnly, got.Data)
+		}
+	}
+}
+
+func testRevisions(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	id := storeRecord(t, s, username, "v1")
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "v2", Data: []byte("data v2")}); err != nil {
+		t.Fatalf("UpdateDataInDB: %v", err)
+	}
+
+	revisions, err := s.GetRevisions(ctx, id)
+	if err != nil {
+		t.Fatalf("GetRevisions: %v", err)
+	}
+	if len(revisions) != 2 ||
+		revisions[0].Revision != 2 || !revisions[0].Current || revisions[0].Meta != "v2" ||
+		revisions[1].Revision != 1 || revisions[1].Current || revisions[1].Meta != "v1" {
+		t.Fatalf("GetRevisions = %+v; want current revision 2 followed by revision 1", revisions)
+	}
+
+	old, err := s.RetrieveRevisionFromDB(ctx, id, 1)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB(1): %v", err)
+	}
+	assertRecord(t, old, models.Record{Id: id, TypeRecord: models.Text, Data: []byte("data v1"), Meta: "v1"})
+
+	current, err := s.RetrieveRevisionFromDB(ctx, id, 2)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB(2): %v", err)
+	}
+	assertRecord(t, current, models.Record{Id: id, TypeRecord: models.Text, Data: []byte("data v2"), Meta: "v2"})
+}
+
+func testRevisionsRetention(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	id := storeRecord(t, s, username, "v1")
+
+	updates := HistoryLimit + 2
+	for i := 0; i < updates; i++ {
+		if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "next", Data: []byte("next")}); err != nil {
+			t.Fatalf("UpdateDataInDB: %v", err)
+		}
+	}
+
+	revisions, err := s.GetRevisions(ctx, id)
+	if err != nil {
+		t.Fatalf("GetRevisions: %v", err)
+	}
+	if len(revisions) != HistoryLimit+1 {
+		t.Fatalf("GetRevisions returned %d revisions; want current plus %d kept", len(revisions), HistoryLimit)
+	}
+	if oldest := revisions[len(revisions)-1].Revision; oldest != updates+1-HistoryLimit {
+		t.Fatalf("oldest kept revision = %d; want %d", oldest, updates+1-HistoryLimit)
+	}
+	if _, err := s.RetrieveRevisionFromDB(ctx, id, 1); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("RetrieveRevisionFromDB for trimmed revision = %v; want ErrNotFound", err)
+	}
+}
+
+func testRevisionsMissing(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	if _, err := s.GetRevisions(ctx, uuid.NewString()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetRevisions on missing id = %v; want ErrNotFound", err)
+	}
+
+	id := storeRecord(t, s, addUser(t, s), "v1")
+	if _, err := s.RetrieveRevisionFromDB(ctx, id, 42); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("RetrieveRevisionFromDB on missing revision = %v; want ErrNotFound", err)
+	}
+}
+
+func testTrash(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	id := storeRecord(t, s, username, "trash")
+
+	if err := s.DeleteDataFromDB(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	if records, _, err := s.GetListData(ctx, username, models.ListFilter{Limit: 10}); err != nil || len(records) != 0 {
+		t.Fatalf("GetListData after delete = %+v, %v; want empty", records, err)
+	}
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "meta", Data: []byte("data")}); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("UpdateDataInDB for trashed record = %v; want ErrNotFound", err)
+	}
+	if owner, err := s.GetUserByDataID(ctx, id); err != nil || owner != username {
+		t.Fatalf("GetUserByDataID for trashed record = %q, %v; want %q, nil", owner, err, username)
+	}
+
+	trash, err := s.GetTrashList(ctx, username)
+	if err != nil {
+		t.Fatalf("GetTrashList: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Id != id || trash[0].Meta != "trash" || trash[0].DeletedAt.IsZero() {
+		t.Fatalf("GetTrashList = %+v; want record %s with meta and DeletedAt", trash, id)
+	}
+	if trash[0].Data != nil || trash[0].Size != int64(len("data trash")+len("trash")) {
+		t.Fatalf("GetTrashList data = %q, size %d; want metadata only", trash[0].Data, trash[0].Size)
+	}
+
+	if err := s.RestoreDataInDB(ctx, id); err != nil {
+		t.Fatalf("RestoreDataInDB: %v", err)
+	}
+	if _, err := s.RetrieveDataFromDB(ctx, id); err != nil {
+		t.Fatalf("RetrieveDataFromDB after restore: %v", err)
+	}
+	if trash, err := s.GetTrashList(ctx, username); err != nil || len(trash) != 0 {
+		t.Fatalf("GetTrashList after restore = %+v, %v; want empty", trash, err)
+	}
+
+	if err := s.DeleteDataFromDB(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	if err := s.PurgeDataFromDB(ctx, id); err != nil {
+		t.Fatalf("PurgeDataFromDB: %v", err)
+	}
+	if _, err := s.GetUserByDataID(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUserByDataID after purge = %v; want ErrNotFound", err)
+	}
+	if trash, err := s.GetTrashList(ctx, username); err != nil || len(trash) != 0 {
+		t.Fatalf("GetTrashList after purge = %+v, %v; want empty", trash, err)
+	}
+}
+
+func testTrashMissing(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	id := storeRecord(t, s, addUser(t, s), "alive")
+
+	if err := s.RestoreDataInDB(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("RestoreDataInDB for record outside trash = %v; want ErrNotFound", err)
+	}
+	if err := s.PurgeDataFromDB(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("PurgeDataFromDB for record outside trash = %v; want ErrNotFound", err)
+	}
+	if err := s.PurgeDataFromDB(ctx, uuid.NewString()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("PurgeDataFromDB on missing id = %v; want ErrNotFound", err)
+	}
+}
+
+func testPurgeExpiredTrash(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	trashed := storeRecord(t, s, username, "trashed")
+	alive := storeRecord(t, s, username, "alive")
+
+	if err := s.DeleteDataFromDB(ctx, trashed, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+
+	if _, err := s.PurgeExpiredTrash(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("PurgeExpiredTrash: %v", err)
+	}
+	if trash, err := s.GetTrashList(ctx, username); err != nil || len(trash) != 1 {
+		t.Fatalf("GetTrashList after purging older records = %+v, %v; want fresh record kept", trash, err)
+	}
+
+	purged, err := s.PurgeExpiredTrash(ctx, time.Now().Add(time.Hour))
+	if err != nil || purged < 1 {
+		t.Fatalf("PurgeExpiredTrash = %d, %v; want at least 1 purged", purged, err)
+	}
+	if _, err := s.GetUserByDataID(ctx, trashed); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUserByDataID for purged record = %v; want ErrNotFound", err)
+	}
+	if _, err := s.RetrieveDataFromDB(ctx, alive); err != nil {
+		t.Fatalf("RetrieveDataFromDB for record outside trash: %v", err)
+	}
+}
+
+func testUploads(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	checksum := bytes.Repeat([]byte{1}, 32)
+
+	id, err := s.CreateUpload(ctx, models.Upload{Username: username, Meta: "file", Size: 6, Checksum: checksum})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+
+	upload, err := s.GetUpload(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUpload: %v", err)
+	}
+	if upload.ID != id || upload.Username != username || upload.Meta != "file" || upload.Size != 6 ||
+		upload.Received != 0 || !bytes.Equal(upload.Checksum, checksum) || len(upload.HashState) != 0 {
+		t.Fatalf("GetUpload = %+v; want fresh upload %s", upload, id)
+	}
+
+	if err := s.AppendUploadChunk(ctx, id, 0, []byte("abc"), []byte("state1")); err != nil {
+		t.Fatalf("AppendUploadChunk: %v", err)
+	}
+	if err := s.AppendUploadChunk(ctx, id, 0, []byte("abc"), []byte("state1")); !errors.Is(err, models.ErrInvalidOffset) {
+		t.Fatalf("AppendUploadChunk with stale offset = %v; want ErrInvalidOffset", err)
+	}
+	if _, err := s.CompleteUpload(ctx, id, models.BlobRef{}); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("CompleteUpload for incomplete upload = %v; want ErrNotFound", err)
+	}
+	if err := s.AppendUploadChunk(ctx, id, 3, []byte("def"), []byte("state2")); err != nil {
+		t.Fatalf("AppendUploadChunk: %v", err)
+	}
+
+	upload, err = s.GetUpload(ctx, id)
+	if err != nil || upload.Received != 6 || string(upload.HashState) != "state2" {
+		t.Fatalf("GetUpload after chunks = %+v, %v; want 6 bytes received and last hash state", upload, err)
+	}
+	if chunk, err := s.ReadUploadChunk(ctx, id, 3); err != nil || string(chunk) != "def" {
+		t.Fatalf("ReadUploadChunk(3) = %q, %v; want \"def\"", chunk, err)
+	}
+
+	recordID, err := s.CompleteUpload(ctx, id, models.BlobRef{})
+	if err != nil {
+		t.Fatalf("CompleteUpload: %v", err)
+	}
+	record, err := s.RetrieveDataFromDB(ctx, recordID)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB for uploaded record: %v", err)
+	}
+	assertRecord(t, record, models.Record{Id: recordID, TypeRecord: models.Binary, Data: []byte("abcdef"), Meta: "file"})
+	if owner, err := s.GetUserByDataID(ctx, recordID); err != nil || owner != username {
+		t.Fatalf("GetUserByDataID for uploaded record = %q, %v; want %q", owner, err, username)
+	}
+	if _, err := s.GetUpload(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUpload after completion = %v; want ErrNotFound", err)
+	}
+}
+
+func testUploadsMissing(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	if _, err := s.GetUpload(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUpload on missing id = %v; want ErrNotFound", err)
+	}
+	if err := s.AppendUploadChunk(ctx, id, 0, []byte("a"), nil); !errors.Is(err, models.ErrInvalidOffset) {
+		t.Fatalf("AppendUploadChunk on missing id = %v; want ErrInvalidOffset", err)
+	}
+	if _, err := s.CompleteUpload(ctx, id, models.BlobRef{}); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("CompleteUpload on missing id = %v; want ErrNotFound", err)
+	}
+
+	username := addUser(t, s)
+	stale, err := s.CreateUpload(ctx, models.Upload{Username: username, Size: 1, Checksum: make([]byte, 32)})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	if _, err := s.PurgeStaleUploads(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeStaleUploads: %v", err)
+	}
+	if _, err := s.GetUpload(ctx, stale); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUpload after purge = %v; want ErrNotFound", err)
+	}
+}
+
+func testReadDataChunk(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	id, err := s.StoreDataToDB(ctx, models.Record{TypeRecord: models.Binary, Data: []byte("0123456789")}, addUser(t, s))
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+
+	ref, err := s.GetBlobRef(ctx, id)
+	if err != nil || ref.Key != "" || ref.Size != 10 {
+		t.Fatalf("GetBlobRef = %+v, %v; want inline data of 10 bytes", ref, err)
+	}
+
+	for _, tt := range []struct {
+		offset int64
+		limit  int
+		want   string
+	}{
+		{0, 4, "0123"},
+		{4, 4, "4567"},
+		{8, 4, "89"},
+		{10, 4, ""},
+	} {
+		chunk, err := s.ReadDataChunk(ctx, id, tt.offset, tt.limit)
+		if err != nil || string(chunk) != tt.want {
+			t.Fatalf("ReadDataChunk(%d, %d) = %q, %v; want %q", tt.offset, tt.limit, chunk, err, tt.want)
+		}
+	}
+
+	if _, err := s.GetBlobRef(ctx, uuid.NewString()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetBlobRef on missing id = %v; want ErrNotFound", err)
+	}
+}
+
+func testBlobs(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	first := models.BlobRef{Key: uuid.NewString(), Size: 3, Hash: []byte("hash1")}
+	second := models.BlobRef{Key: uuid.NewString(), Size: 5, Hash: []byte("hash2"), KeyID: "k1", DataKey: []byte("wrapped")}
+
+	id, err := s.StoreDataToDB(ctx, models.Record{TypeRecord: models.Binary, Data: []byte{}, Meta: "v1", Blob: first}, username)
+	if err != nil {
+		t.Fatalf("StoreDataToDB with blob: %v", err)
+	}
+	record, err := s.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	assertBlob(t, record.Blob, first)
+	if ref, err := s.GetBlobRef(ctx, id); err != nil {
+		t.Fatalf("GetBlobRef: %v", err)
+	} else {
+		assertBlob(t, ref, first)
+	}
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "v2", Data: []byte{}, Blob: second}); err != nil {
+		t.Fatalf("UpdateDataInDB with blob: %v", err)
+	}
+	old, err := s.RetrieveRevisionFromDB(ctx, id, 1)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB: %v", err)
+	}
+	assertBlob(t, old.Blob, first)
+
+	keys, err := s.GetBlobKeys(ctx)
+	if err != nil {
+		t.Fatalf("GetBlobKeys: %v", err)
+	}
+	if !slices.Contains(keys, first.Key) || !slices.Contains(keys, second.Key) {
+		t.Fatalf("GetBlobKeys = %v; want both %s and %s", keys, first.Key, second.Key)
+	}
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "v3", Data: []byte("inline")}); err != nil {
+		t.Fatalf("UpdateDataInDB with inline data: %v", err)
+	}
+	ref, err := s.GetBlobRef(ctx, id)
+	if err != nil || ref.Key != "" || ref.Size != 6 {
+		t.Fatalf("GetBlobRef after inline update = %+v, %v; want inline data of 6 bytes", ref, err)
+	}
+}
+
+func testMoveDataToBlobs(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	binary, err := s.StoreDataToDB(ctx, models.Record{TypeRecord: models.Binary, Data: []byte("v1"), Meta: "file"}, username)
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: binary, Meta: "file", Data: []byte("v2")}); err != nil {
+		t.Fatalf("UpdateDataInDB: %v", err)
+	}
+	text := storeRecord(t, s, username, "text")
+
+	moved := make(map[string]models.BlobRef)
+	put := func(ctx context.Context, data []byte) (models.BlobRef, error) {
+		ref := models.BlobRef{Key: uuid.NewString(), Size: int64(len(data)), Hash: []byte("h"), KeyID: "k1", DataKey: []byte("wrapped")}
+		moved[string(data)] = ref
+		return ref, nil
+	}
+	// хранилище может быть общим для подпроверок, поэтому переносятся и чужие записи
+	if _, err := s.MoveDataToBlobs(ctx, put); err != nil {
+		t.Fatalf("MoveDataToBlobs: %v", err)
+	}
+	if _, ok := moved["v1"]; !ok {
+		t.Fatalf("MoveDataToBlobs did not move revision data")
+	}
+
+	record, err := s.RetrieveDataFromDB(ctx, binary)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	if len(record.Data) != 0 {
+		t.Fatalf("RetrieveDataFromDB after move = %q; want data moved to blob", record.Data)
+	}
+	assertBlob(t, record.Blob, moved["v2"])
+
+	old, err := s.RetrieveRevisionFromDB(ctx, binary, 1)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB: %v", err)
+	}
+	assertBlob(t, old.Blob, moved["v1"])
+
+	record, err = s.RetrieveDataFromDB(ctx, text)
+	if err != nil || record.Blob.Key != "" || string(record.Data) != "data text" {
+		t.Fatalf("RetrieveDataFromDB for TEXT record = %+v, %v; want data kept in place", record, err)
+	}
+
+	count, err := s.MoveDataToBlobs(ctx, put)
+	if err != nil || count != 0 {
+		t.Fatalf("second MoveDataToBlobs = %d, %v; want 0", count, err)
+	}
+}
+
+func testSealBlobs(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	plain := models.BlobRef{Key: uuid.NewString(), Size: 4, Hash: []byte("hash")}
+	id, err := s.StoreDataToDB(ctx, models.Record{TypeRecord: models.Binary, Data: []byte{}, Meta: "v1", Blob: plain}, username)
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	// новая версия ссылается на тот же blob, что и прежняя
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "v2", Data: []byte{}, Blob: plain}); err != nil {
+		t.Fatalf("UpdateDataInDB: %v", err)
+	}
+
+	sealed := make(map[string]models.BlobRef)
+	seal := func(ctx context.Context, ref models.BlobRef) (models.BlobRef, error) {
+		if _, ok := sealed[ref.Key]; ok {
+			t.Fatalf("SealBlobs sealed blob %s twice", ref.Key)
+		}
+		copied := ref
+		copied.Key, copied.KeyID, copied.DataKey = uuid.NewString(), "k1", []byte("wrapped")
+		sealed[ref.Key] = copied
+		return copied, nil
+	}
+	// хранилище может быть общим для подпроверок, поэтому шифруются и чужие blob
+	if _, err := s.SealBlobs(ctx, seal); err != nil {
+		t.Fatalf("SealBlobs: %v", err)
+	}
+	want, ok := sealed[plain.Key]
+	if !ok {
+		t.Fatalf("SealBlobs did not seal blob %s", plain.Key)
+	}
+
+	record, err := s.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	assertBlob(t, record.Blob, want)
+	old, err := s.RetrieveRevisionFromDB(ctx, id, 1)
+	if err != nil {
+		t.Fatalf("RetrieveRevisionFromDB: %v", err)
+	}
+	assertBlob(t, old.Blob, want)
+
+	count, err := s.SealBlobs(ctx, seal)
+	if err != nil || count != 0 {
+		t.Fatalf("second SealBlobs = %d, %v; want 0", count, err)
+	}
+}
+
+func testQuota(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	sized := func(size int64) models.Record {
+		return models.Record{TypeRecord: models.Binary, Data: make([]byte, size-1), Meta: "m"}
+	}
+	assertUsage := func(bytes, records int64) {
+		t.Helper()
+		usage, err := s.GetUsage(ctx, username)
+		if err != nil || usage != (models.Usage{Bytes: bytes, Records: records, Quota: Quota}) {
+			t.Fatalf("GetUsage = %+v, %v; want %d bytes in %d records with quota %+v", usage, err, bytes, records, Quota)
+		}
+	}
+
+	assertUsage(0, 0)
+	if _, err := s.StoreDataToDB(ctx, sized(Quota.MaxRecordSize+1), username); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Fatalf("StoreDataToDB over max record size = %v; want ErrQuotaExceeded", err)
+	}
+
+	var ids []string
+	for range Quota.Records {
+		id, err := s.StoreDataToDB(ctx, sized(40), username)
+		if err != nil {
+			t.Fatalf("StoreDataToDB: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	assertUsage(160, 4)
+	if _, err := s.StoreDataToDB(ctx, sized(1), username); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Fatalf("StoreDataToDB over record count = %v; want ErrQuotaExceeded", err)
+	}
+
+	update := sized(80)
+	update.Id = ids[0]
+	if err := s.UpdateDataInDB(ctx, update); err != nil {
+		t.Fatalf("UpdateDataInDB up to quota: %v", err)
+	}
+	assertUsage(200, 4)
+
+	update = sized(41)
+	update.Id = ids[1]
+	if err := s.UpdateDataInDB(ctx, update); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Fatalf("UpdateDataInDB over quota = %v; want ErrQuotaExceeded", err)
+	}
+	if record, err := s.RetrieveDataFromDB(ctx, ids[1]); err != nil || len(record.Data) != 39 {
+		t.Fatalf("RetrieveDataFromDB after rejected update = %d bytes, %v; want record unchanged", len(record.Data), err)
+	}
+	assertUsage(200, 4)
+
+	update = sized(10)
+	update.Id = ids[1]
+	if err := s.UpdateDataInDB(ctx, update); err != nil {
+		t.Fatalf("UpdateDataInDB shrinking record: %v", err)
+	}
+	assertUsage(170, 4)
+
+	if err := s.DeleteDataFromDB(ctx, ids[2], 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	assertUsage(170, 4)
+	if err := s.PurgeDataFromDB(ctx, ids[2]); err != nil {
+		t.Fatalf("PurgeDataFromDB: %v", err)
+	}
+	assertUsage(130, 3)
+
+	upload, err := s.CreateUpload(ctx, models.Upload{Username: username, Meta: "m", Size: 70, Checksum: make([]byte, 32)})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	if err := s.AppendUploadChunk(ctx, upload, 0, make([]byte, 70), nil); err != nil {
+		t.Fatalf("AppendUploadChunk: %v", err)
+	}
+	if _, err := s.CompleteUpload(ctx, upload, models.BlobRef{}); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Fatalf("CompleteUpload over quota = %v; want ErrQuotaExceeded", err)
+	}
+	if _, err := s.GetUpload(ctx, upload); err != nil {
+		t.Fatalf("GetUpload after rejected completion: %v", err)
+	}
+
+	if err := s.DeleteDataFromDB(ctx, ids[0], 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	if _, err := s.PurgeExpiredTrash(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeExpiredTrash: %v", err)
+	}
+	assertUsage(50, 2)
+	if _, err := s.CompleteUpload(ctx, upload, models.BlobRef{}); err != nil {
+		t.Fatalf("CompleteUpload after freeing space: %v", err)
+	}
+	assertUsage(121, 3)
+
+	if _, err := s.GetUsage(ctx, newUsername()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetUsage for unknown user = %v; want ErrNotFound", err)
+	}
+}
+
+func testVersions(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	id := storeRecord(t, s, username, "v1")
+	assertVersion := func(want int) {
+		t.Helper()
+		record, err := s.RetrieveDataFromDB(ctx, id)
+		if err != nil || record.Version != want {
+			t.Fatalf("RetrieveDataFromDB version = %d, %v; want %d", record.Version, err, want)
+		}
+	}
+
+	assertVersion(1)
+	if list, _, err := s.GetListData(ctx, username, models.ListFilter{Limit: 10}); err != nil || len(list) != 1 || list[0].Version != 1 {
+		t.Fatalf("GetListData = %+v, %v; want one record with version 1", list, err)
+	}
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "v2", Data: []byte("v2"), Version: 1}); err != nil {
+		t.Fatalf("UpdateDataInDB with current version: %v", err)
+	}
+	assertVersion(2)
+
+	err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "stale", Data: []byte("stale"), Version: 1})
+	if !errors.Is(err, models.ErrVersionMismatch) {
+		t.Fatalf("UpdateDataInDB with stale version = %v; want ErrVersionMismatch", err)
+	}
+	record, err := s.RetrieveDataFromDB(ctx, id)
+	if err != nil {
+		t.Fatalf("RetrieveDataFromDB: %v", err)
+	}
+	assertRecord(t, record, models.Record{Id: id, TypeRecord: models.Text, Data: []byte("v2"), Meta: "v2"})
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: id, Meta: "v3", Data: []byte("v3")}); err != nil {
+		t.Fatalf("UpdateDataInDB without version: %v", err)
+	}
+	assertVersion(3)
+	if revision, err := s.RetrieveRevisionFromDB(ctx, id, 2); err != nil || revision.Version != 2 {
+		t.Fatalf("RetrieveRevisionFromDB(2) version = %d, %v; want 2", revision.Version, err)
+	}
+
+	if err := s.DeleteDataFromDB(ctx, id, 2); !errors.Is(err, models.ErrVersionMismatch) {
+		t.Fatalf("DeleteDataFromDB with stale version = %v; want ErrVersionMismatch", err)
+	}
+	if err := s.DeleteDataFromDB(ctx, id, 3); err != nil {
+		t.Fatalf("DeleteDataFromDB with current version: %v", err)
+	}
+	if trash, err := s.GetTrashList(ctx, username); err != nil || len(trash) != 1 || trash[0].Version != 3 {
+		t.Fatalf("GetTrashList = %+v, %v; want one record with version 3", trash, err)
+	}
+}
+
+func newUsername() string {
+	return "user-" + uuid.NewString()
+}
+
+func testChanges(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	type change struct {
+		id      string
+		deleted bool
+		meta    string
+	}
+	var last int64
+	assertChanges := func(since int64, limit int, want ...change) {
+		t.Helper()
+		changes, err := s.GetChanges(ctx, username, since, limit)
+		if err != nil {
+			t.Fatalf("GetChanges(%d): %v", since, err)
+		}
+		var got []change
+		for i, c := range changes {
+			if c.Revision <= since || i > 0 && c.Revision <= changes[i-1].Revision {
+				t.Fatalf("GetChanges(%d) revisions are not increasing after since: %+v", since, changes)
+			}
+			last = c.Revision
+			got = append(got, change{id: c.Record.Id, deleted: c.Deleted, meta: c.Record.Meta})
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("GetChanges(%d) = %+v; want %+v", since, got, want)
+		}
+	}
+
+	a := storeRecord(t, s, username, "a")
+	b := storeRecord(t, s, username, "b")
+	assertChanges(0, 10, change{id: a, meta: "a"}, change{id: b, meta: "b"})
+	afterStore := last
+	if current, err := s.GetLastChange(ctx, username); err != nil || current != afterStore {
+		t.Fatalf("GetLastChange = %d, %v; want %d", current, err, afterStore)
+	}
+
+	if err := s.UpdateDataInDB(ctx, models.Record{Id: a, Data: []byte("a2"), Meta: "a2"}); err != nil {
+		t.Fatalf("UpdateDataInDB: %v", err)
+	}
+	if err := s.DeleteDataFromDB(ctx, b, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	assertChanges(0, 1, change{id: a, meta: "a2"})
+	assertChanges(afterStore, 10, change{id: a, meta: "a2"}, change{id: b, deleted: true})
+	afterDelete := last
+	assertChanges(afterDelete, 10)
+
+	if err := s.RestoreDataInDB(ctx, b); err != nil {
+		t.Fatalf("RestoreDataInDB: %v", err)
+	}
+	assertChanges(afterDelete, 10, change{id: b, meta: "b"})
+
+	if err := s.DeleteDataFromDB(ctx, b, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	if err := s.PurgeDataFromDB(ctx, b); err != nil {
+		t.Fatalf("PurgeDataFromDB: %v", err)
+	}
+	if err := s.DeleteDataFromDB(ctx, a, 0); err != nil {
+		t.Fatalf("DeleteDataFromDB: %v", err)
+	}
+	if _, err := s.PurgeExpiredTrash(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeExpiredTrash: %v", err)
+	}
+	assertChanges(afterDelete, 10, change{id: b, deleted: true}, change{id: a, deleted: true})
+
+	if changes, err := s.GetChanges(ctx, addUser(t, s), 0, 10); err != nil || len(changes) != 0 {
+		t.Fatalf("GetChanges for user without records = %+v, %v; want empty", changes, err)
+	}
+	if _, err := s.GetLastChange(ctx, newUsername()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetLastChange for unknown user = %v; want ErrNotFound", err)
+	}
+}
+
+func testKDFParams(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	kdf := models.KDFParams{Salt: []byte("0123456789abcdef"), Time: 3, Memory: 64 * 1024, Threads: 4}
+	username := newUsername()
+	if err := s.AddUserToDB(ctx, username, "hash", kdf); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+	got, err := s.GetKDFParams(ctx, username)
+	if err != nil || !bytes.Equal(got.Salt, kdf.Salt) || got.Time != kdf.Time || got.Memory != kdf.Memory || got.Threads != kdf.Threads {
+		t.Fatalf("GetKDFParams = %+v, %v; want %+v", got, err, kdf)
+	}
+	if err := s.MigrateUser(ctx, username, "new", kdf); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("MigrateUser of a new account = %v; want ErrConflict", err)
+	}
+
+	// аккаунт без параметров создан до сквозного шифрования и переводится
+	// на ключ входа один раз
+	legacy := addUser(t, s)
+	if got, err := s.GetKDFParams(ctx, legacy); err != nil || got.Valid() {
+		t.Fatalf("GetKDFParams of a legacy account = %+v, %v; want empty", got, err)
+	}
+	if err := s.MigrateUser(ctx, legacy, "new", kdf); err != nil {
+		t.Fatalf("MigrateUser: %v", err)
+	}
+	if password, err := s.GetUserPassword(ctx, legacy); err != nil || password != "new" {
+		t.Fatalf("GetUserPassword after MigrateUser = %q, %v; want new", password, err)
+	}
+	if got, err := s.GetKDFParams(ctx, legacy); err != nil || !bytes.Equal(got.Salt, kdf.Salt) {
+		t.Fatalf("GetKDFParams after MigrateUser = %+v, %v; want %+v", got, err, kdf)
+	}
+	if err := s.MigrateUser(ctx, legacy, "again", kdf); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("second MigrateUser = %v; want ErrConflict", err)
+	}
+
+	if _, err := s.GetKDFParams(ctx, newUsername()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetKDFParams for unknown user = %v; want ErrNotFound", err)
+	}
+	if err := s.MigrateUser(ctx, newUsername(), "new", kdf); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("MigrateUser for unknown user = %v; want ErrNotFound", err)
+	}
+}
+
+func testVaultKey(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	if _, err := s.GetVaultKey(ctx, username); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetVaultKey before SetVaultKey = %v; want ErrNotFound", err)
+	}
+	key := []byte("wrapped")
+	if err := s.SetVaultKey(ctx, username, key); err != nil {
+		t.Fatalf("SetVaultKey: %v", err)
+	}
+	got, err := s.GetVaultKey(ctx, username)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("GetVaultKey = %q, %v; want %q", got, err, key)
+	}
+
+	if err := s.SetVaultKey(ctx, username, []byte("other")); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("second SetVaultKey = %v; want ErrConflict", err)
+	}
+	if err := s.SetVaultKey(ctx, newUsername(), key); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("SetVaultKey for unknown user = %v; want ErrNotFound", err)
+	}
+}
+
+func testChangePassword(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	kdf := models.KDFParams{Salt: []byte("0123456789abcdef"), Time: 3, Memory: 64 * 1024, Threads: 4}
+
+	// перенос аккаунта, как и смена пароля, завершает выданные сессии
+	migrated := addSession(t, s, username, []byte("migrated"))
+	if err := s.MigrateUser(ctx, username, "hash", kdf); err != nil {
+		t.Fatalf("MigrateUser: %v", err)
+	}
+	if _, err := s.GetSession(ctx, migrated); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetSession after MigrateUser = %v; want ErrNotFound", err)
+	}
+
+	current := addSession(t, s, username, []byte("current"))
+	other := addSession(t, s, username, []byte("other"))
+
+	if err := s.ChangePassword(ctx, username, "hash", "hash2", kdf, nil, current); err != nil {
+		t.Fatalf("ChangePassword without key: %v", err)
+	}
+	if hash, err := s.GetUserPassword(ctx, username); err != nil || hash != "hash2" {
+		t.Fatalf("GetUserPassword = %q, %v; want hash2", hash, err)
+	}
+	if _, err := s.GetSession(ctx, current); err != nil {
+		t.Fatalf("GetSession for kept session: %v", err)
+	}
+	if _, err := s.GetSession(ctx, other); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetSession for other session = %v; want ErrNotFound", err)
+	}
+	if err := s.ChangePassword(ctx, username, "hash", "hash3", kdf, nil, current); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("ChangePassword with stale hash = %v; want ErrConflict", err)
+	}
+
+	if err := s.SetVaultKey(ctx, username, []byte("wrapped")); err != nil {
+		t.Fatalf("SetVaultKey: %v", err)
+	}
+	other = addSession(t, s, username, []byte("other"))
+	if err := s.ChangePassword(ctx, username, "hash2", "hash3", kdf, nil, current); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("ChangePassword without key when key is set = %v; want ErrConflict", err)
+	}
+	if hash, _ := s.GetUserPassword(ctx, username); hash != "hash2" {
+		t.Fatalf("password changed by rejected ChangePassword: %q", hash)
+	}
+	if _, err := s.GetSession(ctx, other); err != nil {
+		t.Fatalf("session deleted by rejected ChangePassword: %v", err)
+	}
+
+	next := models.KDFParams{Salt: []byte("fedcba9876543210"), Time: 4, Memory: 32 * 1024, Threads: 2}
+	if err := s.ChangePassword(ctx, username, "hash2", "hash3", next, []byte("rewrapped"), ""); err != nil {
+		t.Fatalf("ChangePassword with key: %v", err)
+	}
+	if got, err := s.GetVaultKey(ctx, username); err != nil || string(got) != "rewrapped" {
+		t.Fatalf("GetVaultKey after ChangePassword = %q, %v; want rewrapped", got, err)
+	}
+	got, err := s.GetKDFParams(ctx, username)
+	if err != nil || !bytes.Equal(got.Salt, next.Salt) || got.Time != next.Time || got.Memory != next.Memory || got.Threads != next.Threads {
+		t.Fatalf("GetKDFParams after ChangePassword = %+v, %v; want %+v", got, err, next)
+	}
+	for _, id := range []string{current, other} {
+		if _, err := s.GetSession(ctx, id); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("GetSession after ChangePassword without kept session = %v; want ErrNotFound", err)
+		}
+	}
+
+	if err := s.ChangePassword(ctx, newUsername(), "hash", "hash2", kdf, nil, ""); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("ChangePassword for unknown user = %v; want ErrNotFound", err)
+	}
+}
+
+func testSessions(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	id, err := s.CreateSession(ctx, models.Session{Username: username, RefreshHash: []byte("hash1"), ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	session, err := s.GetSession(ctx, id)
+	if err != nil || session.ID != id || session.Username != username || !bytes.Equal(session.RefreshHash, []byte("hash1")) ||
+		!session.ExpiresAt.Equal(expiresAt) || session.CreatedAt.IsZero() {
+		t.Fatalf("GetSession = %+v, %v", session, err)
+	}
+
+	extended := expiresAt.Add(time.Hour)
+	if err := s.RotateSession(ctx, id, []byte("hash1"), []byte("hash2"), extended); err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+	if err := s.RotateSession(ctx, id, []byte("hash1"), []byte("hash3"), extended); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("RotateSession with stale hash = %v; want ErrConflict", err)
+	}
+	session, err = s.GetSession(ctx, id)
+	if err != nil || !bytes.Equal(session.RefreshHash, []byte("hash2")) || !session.ExpiresAt.Equal(extended) {
+		t.Fatalf("GetSession after RotateSession = %+v, %v", session, err)
+	}
+
+	if err := s.DeleteSession(ctx, id); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if err := s.DeleteSession(ctx, id); err != nil {
+		t.Fatalf("DeleteSession twice: %v", err)
+	}
+	if _, err := s.GetSession(ctx, id); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetSession after DeleteSession = %v; want ErrNotFound", err)
+	}
+	if err := s.RotateSession(ctx, id, []byte("hash2"), []byte("hash3"), extended); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("RotateSession after DeleteSession = %v; want ErrNotFound", err)
+	}
+}
+
+func testPurgeExpiredSessions(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	expired, err := s.CreateSession(ctx, models.Session{Username: username, RefreshHash: []byte("old"), ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	active := addSession(t, s, username, []byte("new"))
+
+	if _, err := s.PurgeExpiredSessions(ctx, time.Now()); err != nil {
+		t.Fatalf("PurgeExpiredSessions: %v", err)
+	}
+	if _, err := s.GetSession(ctx, expired); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetSession for expired session = %v; want ErrNotFound", err)
+	}
+	if _, err := s.GetSession(ctx, active); err != nil {
+		t.Fatalf("GetSession for active session: %v", err)
+	}
+}
+
+func testTOTP(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+
+	if _, err := s.GetTOTP(ctx, username); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetTOTP without secret = %v; want ErrNotFound", err)
+	}
+	if err := s.EnableTOTP(ctx, username, 1, nil); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("EnableTOTP without secret = %v; want ErrNotFound", err)
+	}
+	if err := s.SetTOTPSecret(ctx, username, "FIRST"); err != nil {
+		t.Fatalf("SetTOTPSecret: %v", err)
+	}
+	if err := s.SetTOTPSecret(ctx, username, "SECOND"); err != nil {
+		t.Fatalf("SetTOTPSecret over pending secret: %v", err)
+	}
+	totp, err := s.GetTOTP(ctx, username)
+	if err != nil || totp.Secret != "SECOND" || totp.Enabled {
+		t.Fatalf("GetTOTP = %+v, %v", totp, err)
+	}
+	if err := s.UseTOTPStep(ctx, username, 10); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("UseTOTPStep before EnableTOTP = %v; want ErrNotFound", err)
+	}
+	if _, err := s.AddTOTPAttempt(ctx, username, time.Now(), time.Now()); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("AddTOTPAttempt before EnableTOTP = %v; want ErrNotFound", err)
+	}
+
+	if err := s.EnableTOTP(ctx, username, 10, nil); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+	if err := s.EnableTOTP(ctx, username, 11, nil); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("EnableTOTP twice = %v; want ErrConflict", err)
+	}
+	if err := s.SetTOTPSecret(ctx, username, "THIRD"); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("SetTOTPSecret after EnableTOTP = %v; want ErrConflict", err)
+	}
+	if err := s.UseTOTPStep(ctx, username, 10); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("UseTOTPStep with used step = %v; want ErrConflict", err)
+	}
+
+	failedAt := time.Now().Truncate(time.Second)
+	for want := 1; want <= 2; want++ {
+		attempts, err := s.AddTOTPAttempt(ctx, username, failedAt, failedAt.Add(-time.Minute))
+		if err != nil || attempts != want {
+			t.Fatalf("AddTOTPAttempt = %d, %v; want %d", attempts, err, want)
+		}
+	}
+	totp, err = s.GetTOTP(ctx, username)
+	if err != nil || !totp.Enabled || totp.Secret != "SECOND" || totp.LastStep != 10 || totp.Failures != 2 || !totp.FailedAt.Equal(failedAt) {
+		t.Fatalf("GetTOTP after failures = %+v, %v", totp, err)
+	}
+	// после паузы дольше since счет попыток начинается заново
+	later := failedAt.Add(time.Hour)
+	if attempts, err := s.AddTOTPAttempt(ctx, username, later, later.Add(-time.Minute)); err != nil || attempts != 1 {
+		t.Fatalf("AddTOTPAttempt after pause = %d, %v; want 1", attempts, err)
+	}
+	if err := s.UseTOTPStep(ctx, username, 11); err != nil {
+		t.Fatalf("UseTOTPStep: %v", err)
+	}
+	totp, err = s.GetTOTP(ctx, username)
+	if err != nil || totp.LastStep != 11 || totp.Failures != 0 || !totp.FailedAt.IsZero() {
+		t.Fatalf("GetTOTP after UseTOTPStep = %+v, %v", totp, err)
+	}
+
+	if err := s.DeleteTOTP(ctx, username); err != nil {
+		t.Fatalf("DeleteTOTP: %v", err)
+	}
+	if err := s.DeleteTOTP(ctx, username); err != nil {
+		t.Fatalf("DeleteTOTP twice: %v", err)
+	}
+	if _, err := s.GetTOTP(ctx, username); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("GetTOTP after DeleteTOTP = %v; want ErrNotFound", err)
+	}
+	if err := s.SetTOTPSecret(ctx, username, "FOURTH"); err != nil {
+		t.Fatalf("SetTOTPSecret after DeleteTOTP: %v", err)
+	}
+}
+
+func testRecoveryCodes(t *testing.T, s handlers.Storage) {
+	ctx := context.Background()
+	username := addUser(t, s)
+	other := addUser(t, s)
+
+	for _, name := range []string{username, other} {
+		if err := s.SetTOTPSecret(ctx, name, "SECRET"); err != nil {
+			t.Fatalf("SetTOTPSecret: %v", err)
+		}
+		if err := s.EnableTOTP(ctx, name, 1, [][]byte{[]byte("code1"), []byte("code2")}); err != nil {
+			t.Fatalf("EnableTOTP: %v", err)
+		}
+	}
+	if _, err := s.AddTOTPAttempt(ctx, username, time.Now(), time.Now()); err != nil {
+		t.Fatalf("AddTOTPAttempt: %v", err)
+	}
+
+	if err := s.UseRecoveryCode(ctx, username, []byte("code1")); err != nil {
+		t.Fatalf("UseRecoveryCode: %v", err)
+	}
+	if err := s.UseRecoveryCode(ctx, username, []byte("code1")); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("UseRecoveryCode twice = %v; want ErrNotFound", err)
+	}
+	if err := s.UseRecoveryCode(ctx, username, []byte("unknown")); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("UseRecoveryCode with unknown code = %v; want ErrNotFound", err)
+	}
+	totp, err := s.GetTOTP(ctx, username)
+	if err != nil || totp.RecoveryLeft != 1 || totp.Failures != 0 {
+		t.Fatalf("GetTOTP after UseRecoveryCode = %+v, %v", totp, err)
+	}
+	if totp, err := s.GetTOTP(ctx, other); err != nil || totp.RecoveryLeft != 2 {
+		t.Fatalf("GetTOTP for other user = %+v, %v", totp, err)
+	}
+
+	if err := s.DeleteTOTP(ctx, username); err != nil {
+		t.Fatalf("DeleteTOTP: %v", err)
+	}
+	if err := s.SetTOTPSecret(ctx, username, "SECRET"); err != nil {
+		t.Fatalf("SetTOTPSecret: %v", err)
+	}
+	if err := s.UseRecoveryCode(ctx, username, []byte("code2")); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("UseRecoveryCode after DeleteTOTP = %v; want ErrNotFound", err)
+	}
+}
+
+func addUser(t *testing.T, s handlers.Storage) string {
+	t.Helper()
+	username := newUsername()
+	if err := s.AddUserToDB(context.Background(), username, "hash", models.KDFParams{}); err != nil {
+		t.Fatalf("AddUserToDB: %v", err)
+	}
+	return username
+}
+
+func addSession(t *testing.T, s handlers.Storage, username string, hash []byte) string {
+	t.Helper()
+	id, err := s.CreateSession(context.Background(), models.Session{Username: username, RefreshHash: hash, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return id
+}
+
+func storeRecord(t *testing.T, s handlers.Storage, username, meta string) string {
+	t.Helper()
+	record := models.Record{TypeRecord: models.Text, Data: []byte("data " + meta), Meta: meta}
+	id, err := s.StoreDataToDB(context.Background(), record, username)
+	if err != nil {
+		t.Fatalf("StoreDataToDB: %v", err)
+	}
+	return id
+}
+
+func assertBlob(t *testing.T, got, want models.BlobRef) {
+	t.Helper()
+	if got.Key != want.Key || got.Size != want.Size || !bytes.Equal(got.Hash, want.Hash) ||
+		got.KeyID != want.KeyID || !bytes.Equal(got.DataKey, want.DataKey) {
+		t.Fatalf("blob = %+v; want %+v", got, want)
+	}
+}
+
+func assertRecord(t *testing.T, got, want models.Record) {
+	t.Helper()
+	if got.Id != want.Id || got.TypeRecord != want.TypeRecord || got.Meta != want.Meta || !bytes.Equal(got.Data, want.Data) {
+		t.Fatalf("record = %+v; want %+v", got, want)
+	}
+}
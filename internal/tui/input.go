@@ -0,0 +1,62 @@
+package tui
+
+import (
+	"bufio"
+	"os"
+	"time"
+)
+
+// input читает слова из стандартного ввода в отдельной горутине, чтобы
+// ожидание ввода можно было прервать блокировкой по бездействию
+type input struct {
+	words   chan string
+	timeout time.Duration
+	// onIdle вызывается, если ввода не было timeout, и сообщает, что
+	// хранилище заблокировано и текущий ввод нужно прервать
+	onIdle func() bool
+}
+
+// stdin ввод пользователя, создается при запуске TUI
+var stdin *input
+
+func newInput(file *os.File) *input {
+	in := &input{words: make(chan string)}
+	go func() {
+		defer close(in.words)
+		scanner := bufio.NewScanner(file)
+		scanner.Split(bufio.ScanWords)
+		for scanner.Scan() {
+			in.words <- scanner.Text()
+		}
+	}()
+	return in
+}
+
+// next возвращает следующее слово. Если за время ожидания хранилище
+// заблокировано или ввод закончился, возвращается false
+func (in *input) next() (string, bool) {
+	var idle <-chan time.Time
+	if in.timeout > 0 && in.onIdle != nil {
+		timer := time.NewTimer(in.timeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	for {
+		select {
+		case word, ok := <-in.words:
+			return word, ok
+		case <-idle:
+			if in.onIdle() {
+				return "", false
+			}
+			idle = nil
+		}
+	}
+}
+
+// scan читает слово в dst, как fmt.Scan. Если ввод прерван блокировкой, dst
+// становится пустым
+func scan(dst *string) {
+	word, _ := stdin.next()
+	*dst = word
+}
@@ -3,28 +3,71 @@ package tui
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mdp/qrterminal/v3"
 	"github.com/sinfirst/GophKeeper/internal/client"
 	"github.com/sinfirst/GophKeeper/internal/models"
 )
 
 const (
-	menu     string = "1. Регистрация \n2. Вход в аккаунт \n3. Сохранение данных \n4. Извлечение данных \n5. Лист данных \n6. Обновление данных \n7. Удаление данных \n8. Получение версии программы \n0. Выход из программы\n"
-	typeData string = "1. Пара логин-пароль \n2. Текстовые данные \n3. Банковская карта \n4. Бинарные данные \n0. Назад \n"
+	menu        string = "1. Регистрация \n2. Вход в аккаунт \n3. Сохранение данных \n4. Извлечение данных \n5. Лист данных \n6. Обновление данных \n7. Удаление данных \n8. Получение версии программы \n9. История изменений \n10. Корзина \n11. Скачивание файла \n12. Продолжение загрузки файла \n13. Использование хранилища \n14. Синхронизация \n15. Блокировка хранилища \n16. Смена пароля \n17. Выход из аккаунта \n18. Двухфакторная аутентификация \n0. Выход из программы\n"
+	typeData    string = "1. Пара логин-пароль \n2. Текстовые данные \n3. Банковская карта \n4. Бинарные данные \n5. Одноразовые пароли (OTP) \n0. Назад \n"
+	history     string = "1. Просмотр версии \n2. Восстановление версии \n0. Назад \n"
+	trash       string = "1. Восстановление данных \n2. Окончательное удаление данных \n0. Назад \n"
+	enableTOTP  string = "Двухфакторная аутентификация выключена \n1. Включение \n0. Назад \n"
+	disableTOTP string = "1. Отключение \n0. Назад \n"
+	locked      string = "Хранилище заблокировано \n1. Разблокировка \n2. Вход в другой аккаунт \n3. Выход из аккаунта \n0. Выход из программы\n"
 )
 
+// listPageSize сколько записей показывается на одной странице списка
+const listPageSize = 10
+
+// secondFactorAttempts сколько раз можно ввести код второго фактора при входе
+const secondFactorAttempts = 3
+
+// fieldNames названия полей записей при разрешении конфликтов
+var fieldNames = map[string]string{
+	client.FieldMeta:     "Заметка",
+	client.FieldData:     "Данные",
+	client.FieldLogin:    "Логин",
+	client.FieldPassword: "Пароль",
+	client.FieldNumber:   "Номер карты",
+	client.FieldDate:     "Срок действия",
+	client.FieldCVV:      "CVV",
+}
+
 type TUI struct {
 	Client *client.Client
+	// IdleTimeout время без ввода, после которого хранилище блокируется, 0 отключает блокировку
+	IdleTimeout time.Duration
+	// stopWatch останавливает вывод уведомлений об изменениях для прошлого входа
+	stopWatch context.CancelFunc
 }
 
 func StartTUI(tui TUI) {
+	stdin = newInput(os.Stdin)
+	stdin.timeout, stdin.onIdle = tui.IdleTimeout, tui.idleLock
+
 	var choose string
 	for {
+		if tui.Client.Locked() {
+			if tui.lockedMenu() {
+				return
+			}
+			continue
+		}
 		fmt.Print(menu)
 		fmt.Print("Введите число: ")
-		fmt.Scan(&choose)
+		scan(&choose)
+		if tui.Client.Locked() {
+			continue
+		}
 		chooseInt, err := strconv.Atoi(choose)
 		if err != nil {
 			fmt.Println("Введите число, а не строку!")
@@ -48,9 +91,28 @@ func StartTUI(tui TUI) {
 			tui.deleteData()
 		case 8:
 			tui.getVersion()
+		case 9:
+			tui.history()
+		case 10:
+			tui.trash()
+		case 11:
+			tui.download()
+		case 12:
+			tui.resumeUpload()
+		case 13:
+			tui.usage()
+		case 14:
+			tui.sync()
+		case 15:
+			tui.lock()
+		case 16:
+			tui.changePassword()
+		case 17:
+			tui.logout()
+		case 18:
+			tui.twoFactor()
 		case 0:
-			fmt.Println("До новых встреч!")
-			tui.Client.Close()
+			tui.exit()
 			return
 		default:
 			fmt.Println("Число не входит в пункты меню!")
@@ -59,18 +121,224 @@ func StartTUI(tui TUI) {
 
 }
 
+// lockedMenu предлагает разблокировать хранилище паролем или войти в другой
+// аккаунт. Возвращает true, если пользователь выходит из программы
+func (t *TUI) lockedMenu() bool {
+	var choose string
+	fmt.Print(locked)
+	fmt.Print("Введите число: ")
+	scan(&choose)
+	switch choose {
+	case "1":
+		t.unlock()
+	case "2":
+		t.auth(2)
+	case "3":
+		t.logout()
+	case "0":
+		t.exit()
+		return true
+	default:
+		fmt.Println("Число не входит в пункты меню!")
+	}
+	return false
+}
+
+// lock блокирует хранилище и останавливает уведомления об изменениях: в них
+// тоже приходят расшифрованные записи
+func (t *TUI) lock() {
+	if t.stopWatch != nil {
+		t.stopWatch()
+		t.stopWatch = nil
+	}
+	t.Client.Lock()
+	if !t.Client.Locked() {
+		fmt.Println("Войдите в аккаунт перед выполнением запроса")
+	}
+}
+
+// idleLock блокирует хранилище по бездействию. Вызывается из ожидания ввода
+func (t *TUI) idleLock() bool {
+	if t.Client.Locked() {
+		return false
+	}
+	t.lock()
+	if !t.Client.Locked() {
+		return false
+	}
+	fmt.Printf("\nВвода не было %s\n", t.IdleTimeout)
+	return true
+}
+
+// unlock запрашивает пароль и разблокирует хранилище
+func (t *TUI) unlock() {
+	var password string
+	fmt.Print("Введите пароль:")
+	scan(&password)
+	err := t.Client.Unlock(context.Background(), password)
+	if errors.Is(err, client.ErrSecondFactor) {
+		err = t.secondFactor()
+	}
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешно!")
+	if t.Client.Offline() {
+		fmt.Println("Нет связи с сервером, работа с локальной копией")
+		return
+	}
+	t.sync()
+	t.watch()
+}
+
+// secondFactor запрашивает код второго фактора, пока вход не завершится или
+// не кончатся попытки
+func (t *TUI) secondFactor() error {
+	var code string
+	for attempt := 1; ; attempt++ {
+		fmt.Print("Введите код из приложения-аутентификатора или код восстановления:")
+		scan(&code)
+		err := t.Client.LoginTOTP(context.Background(), code)
+		if err == nil || attempt == secondFactorAttempts {
+			if err != nil {
+				t.Client.CancelLogin()
+			}
+			return err
+		}
+		fmt.Println("Ошибка: ", err)
+	}
+}
+
+// twoFactor включает или отключает двухфакторную аутентификацию
+func (t *TUI) twoFactor() {
+	enabled, left, err := t.Client.TOTPStatus(context.Background())
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	var choose string
+	if enabled {
+		fmt.Printf("Двухфакторная аутентификация включена, осталось кодов восстановления: %d\n", left)
+		fmt.Print(disableTOTP)
+	} else {
+		fmt.Print(enableTOTP)
+	}
+	fmt.Print("Введите число: ")
+	scan(&choose)
+	switch {
+	case choose == "1" && enabled:
+		t.disableTwoFactor()
+	case choose == "1":
+		t.enableTwoFactor()
+	case choose == "0":
+	default:
+		fmt.Println("Число не входит в пункты меню!")
+	}
+}
+
+// enableTwoFactor показывает секрет для приложения-аутентификатора QR-кодом,
+// подтверждает его первым кодом и выводит коды восстановления
+func (t *TUI) enableTwoFactor() {
+	secret, uri, err := t.Client.EnrollTOTP(context.Background())
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Отсканируйте QR-код приложением-аутентификатором:")
+	qrterminal.GenerateHalfBlock(uri, qrterminal.L, os.Stdout)
+	fmt.Println("или введите секрет вручную:", secret)
+
+	var code string
+	fmt.Print("Введите код из приложения:")
+	scan(&code)
+	codes, err := t.Client.ConfirmTOTP(context.Background(), code)
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешно! Сохраните коды восстановления, каждый из них заменяет код из приложения один раз:")
+	for _, code := range codes {
+		fmt.Println(code)
+	}
+	fmt.Println("Показать их повторно нельзя")
+}
+
+// disableTwoFactor отключает двухфакторную аутентификацию
+func (t *TUI) disableTwoFactor() {
+	var code string
+	fmt.Print("Введите код из приложения-аутентификатора или код восстановления:")
+	scan(&code)
+	if err := t.Client.DisableTOTP(context.Background(), code); err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешно!")
+}
+
+// changePassword меняет пароль аккаунта
+func (t *TUI) changePassword() {
+	var oldPassword, newPassword, repeat string
+	fmt.Print("Введите текущий пароль:")
+	scan(&oldPassword)
+	fmt.Print("Введите новый пароль:")
+	scan(&newPassword)
+	fmt.Print("Повторите новый пароль:")
+	scan(&repeat)
+	if newPassword != repeat {
+		fmt.Println("Пароли не совпадают")
+		return
+	}
+	if err := t.Client.ChangePassword(context.Background(), oldPassword, newPassword); err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешно! На остальных устройствах нужно войти с новым паролем")
+}
+
+// logout завершает сессию и останавливает уведомления об изменениях
+func (t *TUI) logout() {
+	if t.stopWatch != nil {
+		t.stopWatch()
+		t.stopWatch = nil
+	}
+	if err := t.Client.Logout(context.Background()); err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешно!")
+}
+
+func (t *TUI) exit() {
+	fmt.Println("До новых встреч!")
+	if t.stopWatch != nil {
+		t.stopWatch()
+	}
+	t.Client.Close()
+}
+
 func (t *TUI) auth(typeAuth int) {
 	var username, password string
 	var err error
 	fmt.Print("Введите логин:")
-	fmt.Scan(&username)
+	scan(&username)
 	fmt.Print("Введите пароль:")
-	fmt.Scan(&password)
+	scan(&password)
 
 	if typeAuth == 1 {
 		err = t.Client.Register(context.Background(), username, password)
 	} else {
 		err = t.Client.Login(context.Background(), username, password)
+		if errors.Is(err, client.ErrLegacyAccount) {
+			fmt.Println("Аккаунт создан до сквозного шифрования. При переносе пароль один раз уйдет на сервер, дальше вход выполняется ключом из пароля")
+			if !confirm("Перенести аккаунт?") {
+				return
+			}
+			err = t.Client.MigrateAccount(context.Background(), username, password)
+		}
+	}
+	if errors.Is(err, client.ErrSecondFactor) {
+		err = t.secondFactor()
 	}
 
 	if err != nil {
@@ -79,6 +347,145 @@ func (t *TUI) auth(typeAuth int) {
 	}
 
 	fmt.Println("Успешно!")
+	if t.Client.Offline() {
+		fmt.Println("Нет связи с сервером, работа с локальной копией. Изменения будут отправлены, когда связь восстановится")
+		return
+	}
+	t.sync()
+	t.watch()
+}
+
+// sync отправляет изменения, сделанные без связи, обновляет локальную копию и
+// предлагает разрешить конфликты
+func (t *TUI) sync() {
+	result, err := t.Client.Sync(context.Background())
+	if err != nil {
+		fmt.Println("Ошибка синхронизации: ", err)
+		if pending := t.Client.Pending(); pending > 0 {
+			fmt.Printf("Не отправлено изменений: %d\n", pending)
+		}
+		return
+	}
+	if result.Pushed > 0 || result.Pulled > 0 {
+		fmt.Printf("Синхронизация: отправлено изменений %d (из них объединено с изменениями с других устройств %d), получено %d\n",
+			result.Pushed, result.Merged, result.Pulled)
+	}
+
+	for _, conflict := range t.Client.Conflicts() {
+		if err := t.resolveConflict(conflict); err != nil {
+			fmt.Println("Ошибка: ", err)
+			continue
+		}
+	}
+}
+
+// resolveConflict показывает обе версии записи и спрашивает, какую оставить
+func (t *TUI) resolveConflict(conflict client.Conflict) error {
+	fmt.Printf("Конфликт: изменение записи %s от %s не применено: %s\n",
+		conflict.Record.Id, conflict.At.Local().Format("02.01.2006 15:04:05"), conflict.Reason)
+
+	byFields := len(conflict.Fields) > 0
+	if byFields {
+		_, local, err := client.RecordFields(conflict.Record)
+		if err != nil {
+			return err
+		}
+		_, remote, err := client.RecordFields(conflict.Remote)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Остальные изменения объединяются автоматически, по-разному изменены поля:")
+		for _, field := range conflict.Fields {
+			fmt.Printf("%s: локально %q, на сервере %q\n", fieldNames[field], local[field], remote[field])
+		}
+	} else {
+		fmt.Println("Локальная версия:")
+		if conflict.Op == client.OpDelete {
+			fmt.Println("Запись удалена")
+		} else if err := separateDataByTypeToOutput(conflict.Record); err != nil {
+			return err
+		}
+		if conflict.Op != client.OpCreate {
+			fmt.Println("Версия на сервере:")
+			if conflict.Remote.Id == "" {
+				fmt.Println("Запись удалена")
+			} else if err := separateDataByTypeToOutput(conflict.Remote); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Println("1. Оставить версию с сервера \n2. Записать локальную версию")
+	if conflict.Op != client.OpDelete {
+		fmt.Println("3. Сохранить обе версии")
+	}
+	if byFields {
+		fmt.Println("4. Выбрать значения по полям")
+	}
+	fmt.Println("0. Решить позже")
+	fmt.Print("Введите число: ")
+	var choose string
+	scan(&choose)
+
+	var err error
+	switch choose {
+	case "1":
+		if !confirm("Отбросить локальное изменение?") {
+			return nil
+		}
+		err = t.Client.ResolveConflict(context.Background(), conflict.ID, client.KeepRemote)
+	case "2":
+		err = t.Client.ResolveConflict(context.Background(), conflict.ID, client.KeepLocal)
+	case "3":
+		err = t.Client.ResolveConflict(context.Background(), conflict.ID, client.KeepBoth)
+	case "4":
+		if !byFields {
+			fmt.Println("Число не входит в пункты меню!")
+			return nil
+		}
+		useLocal := make(map[string]bool)
+		for _, field := range conflict.Fields {
+			useLocal[field] = askYesNo(fmt.Sprintf("%s: взять локальное значение?", fieldNames[field]))
+		}
+		err = t.Client.ResolveFields(context.Background(), conflict.ID, useLocal)
+	case "0":
+		return nil
+	default:
+		fmt.Println("Число не входит в пункты меню!")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Успешно!")
+	return nil
+}
+
+// watch в фоне выводит уведомления об изменениях записей
+func (t *TUI) watch() {
+	if t.stopWatch != nil {
+		t.stopWatch()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stopWatch = cancel
+
+	changes, err := t.Client.WatchChanges(ctx, -1)
+	if err != nil {
+		fmt.Println("Уведомления об изменениях недоступны: ", err)
+		return
+	}
+	go func() {
+		for change := range changes {
+			switch change.Kind() {
+			case models.ChangeCreated:
+				fmt.Printf("\nУведомление: создана запись %s\n", change.Record.Id)
+			case models.ChangeUpdated:
+				fmt.Printf("\nУведомление: запись %s изменена\n", change.Record.Id)
+			case models.ChangeDeleted:
+				fmt.Printf("\nУведомление: запись %s удалена\n", change.Record.Id)
+			}
+		}
+	}()
 }
 
 func (t *TUI) store() {
@@ -86,7 +493,10 @@ func (t *TUI) store() {
 	for {
 		fmt.Print(typeData)
 		fmt.Print("Введите число: ")
-		fmt.Scan(&choose)
+		scan(&choose)
+		if t.Client.Locked() {
+			return
+		}
 		chooseInt, err := strconv.Atoi(choose)
 		if err != nil {
 			fmt.Println("Введите число, а не строку!")
@@ -102,25 +512,32 @@ func (t *TUI) store() {
 				fmt.Println("Ошибка: ", err)
 				continue
 			}
-			fmt.Println("Успешено ID сохраненных данных: ", id)
+			t.printStored(id)
 			return
-		case 2, 4:
-			var id int
-			var err error
+		case 2:
 			req, meta, err := separateDataByTypeToInput(models.Text)
 			if err != nil {
 				continue
 			}
-			if chooseInt == 2 {
-				id, err = t.Client.StoreData(context.Background(), models.Text, meta, req)
-			} else {
-				id, err = t.Client.StoreData(context.Background(), models.Binary, meta, req)
+			id, err := t.Client.StoreData(context.Background(), models.Text, meta, req)
+			if err != nil {
+				fmt.Println("Ошибка: ", err)
+				continue
 			}
+			t.printStored(id)
+			return
+		case 4:
+			var path, meta string
+			fmt.Print("Введите путь к файлу:")
+			scan(&path)
+			fmt.Print("Введите заметку к данным:")
+			scan(&meta)
+			id, err := t.Client.UploadFile(context.Background(), path, meta)
 			if err != nil {
 				fmt.Println("Ошибка: ", err)
 				continue
 			}
-			fmt.Println("Успешено ID сохраненных данных: ", id)
+			t.printStored(id)
 			return
 		case 3:
 			jsonReq, meta, err := separateDataByTypeToInput(models.Card)
@@ -132,7 +549,19 @@ func (t *TUI) store() {
 				fmt.Println("Ошибка: ", err)
 				continue
 			}
-			fmt.Println("Успешено ID сохраненных данных: ", id)
+			t.printStored(id)
+			return
+		case 5:
+			jsonReq, meta, err := separateDataByTypeToInput(models.OTP)
+			if err != nil {
+				continue
+			}
+			id, err := t.Client.StoreData(context.Background(), models.OTP, meta, jsonReq)
+			if err != nil {
+				fmt.Println("Ошибка: ", err)
+				continue
+			}
+			t.printStored(id)
 			return
 		case 0:
 			return
@@ -142,10 +571,18 @@ func (t *TUI) store() {
 	}
 }
 
+// printStored выводит id сохраненной записи
+func (t *TUI) printStored(id string) {
+	fmt.Println("Успешено ID сохраненных данных: ", id)
+	if t.Client.Offline() {
+		fmt.Println("Нет связи с сервером: запись сохранена локально, после отправки на сервер она получит новый id")
+	}
+}
+
 func (t *TUI) retrieve() {
 	var id string
 	fmt.Print("Введите id данных: ")
-	fmt.Scan(&id)
+	scan(&id)
 	record, err := t.Client.RetrieveData(context.Background(), id)
 	if err != nil {
 		fmt.Println("Ошибка: ", err)
@@ -156,30 +593,65 @@ func (t *TUI) retrieve() {
 		fmt.Println("Ошибка, попробуйте еще раз")
 		return
 	}
+	if record.TypeRecord != models.OTP {
+		return
+	}
+	// код hotp выдается только по запросу: каждый показ увеличивает счетчик
+	var entry models.OTPJSON
+	if json.Unmarshal(record.Data, &entry) == nil && entry.Type == client.OTPTypeHOTP && askYesNo("Выдать следующий код?") {
+		code, err := t.Client.NextHOTP(context.Background(), record)
+		if err != nil {
+			fmt.Println("Ошибка: ", err)
+			return
+		}
+		fmt.Println("Код: ", code)
+	}
 }
 
 func (t *TUI) listData() {
-	records, err := t.Client.ListData(context.Background())
-	if err != nil {
-		fmt.Println("Ошибка: ", err)
-		return
+	var filter models.ListFilter
+	fmt.Print("Тип данных (LOGIN, TEXT, CARD, BINARY, OTP или - для всех): ")
+	scan(&filter.Type)
+	fmt.Print("Поиск по заметке (- без поиска): ")
+	scan(&filter.Meta)
+	if filter.Type == "-" {
+		filter.Type = ""
 	}
+	filter.Type = strings.ToUpper(filter.Type)
+	if filter.Meta == "-" {
+		filter.Meta = ""
+	}
+	filter.Limit = listPageSize
+	filter.NewestFirst = askYesNo("Сначала новые?")
+	// содержимое записей не запрашиваем, чтобы пароли и данные карт не попадали на экран
+	filter.MetadataOnly = true
 
-	for index, value := range records {
-		fmt.Printf("Номер: %d\n", index+1)
-		err = separateDataByTypeToOutput(value)
+	for number := 1; ; {
+		records, next, err := t.Client.ListData(context.Background(), filter)
 		if err != nil {
-			fmt.Println("Ошибка, попробуйте еще раз")
+			fmt.Println("Ошибка: ", err)
+			return
+		}
+
+		for _, value := range records {
+			fmt.Printf("Номер: %d\nID: %s\nТип: %s\nЗаметка: %s\nРазмер: %d байт\nСоздано: %s\nИзменено: %s\nВерсия: %d\n\n",
+				number, value.Id, value.TypeRecord, value.Meta, value.Size,
+				value.CreatedAt.Local().Format("02.01.2006 15:04:05"), value.UpdatedAt.Local().Format("02.01.2006 15:04:05"), value.Version)
+			number++
+		}
+		fmt.Println("Содержимое записи можно посмотреть в пункте \"Извлечение данных\"")
+
+		if next == "" || !askYesNo("Показать следующую страницу?") {
 			return
 		}
-		fmt.Print("\n")
+		filter.Cursor = next
 	}
 }
 
 func (t *TUI) updateData() {
 	var id string
 	fmt.Print("Введите id данных: ")
-	fmt.Scan(&id)
+	scan(&id)
 	record, err := t.Client.RetrieveData(context.Background(), id)
 	if err != nil {
 		fmt.Println("Ошибка: ", err)
@@ -192,7 +664,7 @@ func (t *TUI) updateData() {
 		return
 	}
 
-	err = t.Client.UpdateData(context.Background(), id, meta, req)
+	_, err = t.Client.UpdateData(context.Background(), id, meta, req, record.Version)
 	if err != nil {
 		fmt.Println("Ошибка: ", err)
 		return
@@ -203,8 +675,16 @@ func (t *TUI) updateData() {
 func (t *TUI) deleteData() {
 	var id string
 	fmt.Print("Введите id данных: ")
-	fmt.Scan(&id)
-	err := t.Client.DeleteData(context.Background(), id)
+	scan(&id)
+	record, err := t.Client.RetrieveData(context.Background(), id)
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	if !confirm("Переместить данные в корзину?") {
+		return
+	}
+	err = t.Client.DeleteData(context.Background(), id, record.Version)
 	if err != nil {
 		fmt.Println("Ошибка: ", err)
 		return
@@ -222,6 +702,198 @@ func (t *TUI) getVersion() {
 	fmt.Printf("Версия сборки: %s\nДата: %s\n", ver.Version, ver.Date)
 }
 
+func (t *TUI) download() {
+	var id, path string
+	fmt.Print("Введите id данных: ")
+	scan(&id)
+	fmt.Print("Введите путь для сохранения файла: ")
+	scan(&path)
+
+	if err := t.Client.DownloadFile(context.Background(), id, path); err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешно!")
+}
+
+func (t *TUI) resumeUpload() {
+	var uploadID, path string
+	fmt.Print("Введите id загрузки: ")
+	scan(&uploadID)
+	fmt.Print("Введите путь к файлу:")
+	scan(&path)
+
+	id, err := t.Client.ResumeUpload(context.Background(), uploadID, path)
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	fmt.Println("Успешено ID сохраненных данных: ", id)
+}
+
+func (t *TUI) usage() {
+	usage, err := t.Client.GetUsage(context.Background())
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+
+	limit := func(used, quota int64) string {
+		if quota == 0 {
+			return fmt.Sprintf("%d (без ограничений)", used)
+		}
+		return fmt.Sprintf("%d из %d, осталось %d", used, quota, max(quota-used, 0))
+	}
+	fmt.Printf("Занято байт: %s\n", limit(usage.Bytes, usage.Quota.Bytes))
+	fmt.Printf("Записей: %s\n", limit(usage.Records, usage.Quota.Records))
+	if usage.Quota.MaxRecordSize > 0 {
+		fmt.Printf("Максимальный размер записи: %d байт\n", usage.Quota.MaxRecordSize)
+	}
+}
+
+func (t *TUI) history() {
+	var id string
+	fmt.Print("Введите id данных: ")
+	scan(&id)
+	revisions, err := t.Client.ListRevisions(context.Background(), id)
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+
+	for _, value := range revisions {
+		current := ""
+		if value.Current {
+			current = " (текущая)"
+		}
+		fmt.Printf("Версия: %d%s\nДата: %s\nЗаметка: %s\n\n", value.Revision, current, value.CreatedAt.Local().Format("02.01.2006 15:04:05"), value.Meta)
+	}
+
+	var choose, revision string
+	for {
+		fmt.Print(history)
+		fmt.Print("Введите число: ")
+		scan(&choose)
+		if t.Client.Locked() {
+			return
+		}
+		chooseInt, err := strconv.Atoi(choose)
+		if err != nil {
+			fmt.Println("Введите число, а не строку!")
+			continue
+		}
+		switch chooseInt {
+		case 1:
+			fmt.Print("Введите номер версии: ")
+			scan(&revision)
+			record, err := t.Client.GetRevision(context.Background(), id, revision)
+			if err != nil {
+				fmt.Println("Ошибка: ", err)
+				continue
+			}
+			err = separateDataByTypeToOutput(record)
+			if err != nil {
+				fmt.Println("Ошибка, попробуйте еще раз")
+			}
+		case 2:
+			fmt.Print("Введите номер версии: ")
+			scan(&revision)
+			err := t.Client.RestoreRevision(context.Background(), id, revision)
+			if err != nil {
+				fmt.Println("Ошибка: ", err)
+				continue
+			}
+			fmt.Println("Успешно!")
+			return
+		case 0:
+			return
+		default:
+			fmt.Println("Число не входит в пункты меню!")
+		}
+	}
+}
+
+func (t *TUI) trash() {
+	records, err := t.Client.ListTrash(context.Background())
+	if err != nil {
+		fmt.Println("Ошибка: ", err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("Корзина пуста")
+		return
+	}
+
+	for _, value := range records {
+		fmt.Printf("ID: %s\nТип: %s\nЗаметка: %s\nУдалено: %s\n\n", value.Id, value.TypeRecord, value.Meta, value.DeletedAt.Local().Format("02.01.2006 15:04:05"))
+	}
+
+	var choose, id string
+	for {
+		fmt.Print(trash)
+		fmt.Print("Введите число: ")
+		scan(&choose)
+		if t.Client.Locked() {
+			return
+		}
+		chooseInt, err := strconv.Atoi(choose)
+		if err != nil {
+			fmt.Println("Введите число, а не строку!")
+			continue
+		}
+		switch chooseInt {
+		case 1:
+			fmt.Print("Введите id данных: ")
+			scan(&id)
+			err := t.Client.RestoreData(context.Background(), id)
+			if err != nil {
+				fmt.Println("Ошибка: ", err)
+				continue
+			}
+			fmt.Println("Успешно!")
+			return
+		case 2:
+			fmt.Print("Введите id данных: ")
+			scan(&id)
+			if !confirm("Данные будут удалены без возможности восстановления. Продолжить?") {
+				continue
+			}
+			err := t.Client.PurgeData(context.Background(), id)
+			if err != nil {
+				fmt.Println("Ошибка: ", err)
+				continue
+			}
+			fmt.Println("Успешно!")
+			return
+		case 0:
+			return
+		default:
+			fmt.Println("Число не входит в пункты меню!")
+		}
+	}
+}
+
+// confirm спрашивает у пользователя подтверждение действия
+func confirm(question string) bool {
+	if askYesNo(question) {
+		return true
+	}
+	fmt.Println("Отменено")
+	return false
+}
+
+// askYesNo задает вопрос с ответом да/нет
+func askYesNo(question string) bool {
+	var answer string
+	fmt.Printf("%s (y/n): ", question)
+	scan(&answer)
+	switch strings.ToLower(answer) {
+	case "y", "yes", "д", "да":
+		return true
+	}
+	return false
+}
+
 func separateDataByTypeToOutput(record models.Record) error {
 	switch record.TypeRecord {
 	case models.Login:
@@ -230,10 +902,10 @@ func separateDataByTypeToOutput(record models.Record) error {
 		if err != nil {
 			return err
 		}
-		fmt.Printf("ID: %d\nЛогин: %s\nПароль: %s\nЗаметка: %s\n", record.Id, jsonResp.Login, jsonResp.Password, record.Meta)
+		fmt.Printf("ID: %s\nЛогин: %s\nПароль: %s\nЗаметка: %s\n", record.Id, jsonResp.Login, jsonResp.Password, record.Meta)
 
 	case models.Text, models.Binary:
-		fmt.Printf("ID: %d\nДанные: %s\nЗаметка: %s\n", record.Id, string(record.Data), record.Meta)
+		fmt.Printf("ID: %s\nДанные: %s\nЗаметка: %s\n", record.Id, string(record.Data), record.Meta)
 
 	case models.Card:
 		var jsonResp models.CardJSON
@@ -241,8 +913,27 @@ func separateDataByTypeToOutput(record models.Record) error {
 		if err != nil {
 			return err
 		}
-		fmt.Printf("ID: %d\nНомер карты: %s\nСрок действия: %s\nCVV: %s\nЗаметка: %s\n", record.Id, jsonResp.Number, jsonResp.Date, jsonResp.CVV, record.Meta)
+		fmt.Printf("ID: %s\nНомер карты: %s\nСрок действия: %s\nCVV: %s\nЗаметка: %s\n", record.Id, jsonResp.Number, jsonResp.Date, jsonResp.CVV, record.Meta)
+
+	case models.OTP:
+		var jsonResp models.OTPJSON
+		err := json.Unmarshal(record.Data, &jsonResp)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ID: %s\nСервис: %s\nАккаунт: %s\nЗаметка: %s\n", record.Id, jsonResp.Issuer, jsonResp.Account, record.Meta)
+		if jsonResp.Type == client.OTPTypeHOTP {
+			fmt.Printf("Параметры: HOTP, %s, %d цифр\nСчетчик: %d\n", jsonResp.Algorithm, jsonResp.Digits, jsonResp.Counter)
+			break
+		}
+		code, left, err := client.OTPCode(jsonResp, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Параметры: TOTP, %s, %d цифр, период %d с\nКод: %s (действует еще %d с)\n",
+			jsonResp.Algorithm, jsonResp.Digits, jsonResp.Period, code, int(left.Round(time.Second)/time.Second))
 	}
+	fmt.Printf("Версия: %d\n", record.Version)
 	return nil
 }
 
@@ -251,11 +942,11 @@ func separateDataByTypeToInput(dataType string) ([]byte, string, error) {
 	case models.Login:
 		var username, password, meta string
 		fmt.Print("Введите логин:")
-		fmt.Scan(&username)
+		scan(&username)
 		fmt.Print("Введите пароль:")
-		fmt.Scan(&password)
+		scan(&password)
 		fmt.Print("Введите заметку к данным:")
-		fmt.Scan(&meta)
+		scan(&meta)
 		jsonReq, err := json.Marshal(models.LoginJSON{Login: username, Password: password})
 		if err != nil {
 			fmt.Println("Ошибка, попробуйте еще раз")
@@ -266,26 +957,43 @@ func separateDataByTypeToInput(dataType string) ([]byte, string, error) {
 	case models.Text, models.Binary:
 		var text, meta string
 		fmt.Print("Введите данные:")
-		fmt.Scan(&text)
+		scan(&text)
 		fmt.Print("Введите заметку к данным:")
-		fmt.Scan(&meta)
+		scan(&meta)
 		return []byte(text), meta, nil
 	case models.Card:
 		var number, date, cvv, meta string
 		fmt.Print("Введите номер карты:")
-		fmt.Scan(&number)
+		scan(&number)
 		fmt.Print("Введите срок действия карты:")
-		fmt.Scan(&date)
+		scan(&date)
 		fmt.Print("Введите cvv:")
-		fmt.Scan(&cvv)
+		scan(&cvv)
 		fmt.Print("Введите заметку к данным:")
-		fmt.Scan(&meta)
+		scan(&meta)
 		jsonReq, err := json.Marshal(models.CardJSON{Number: number, Date: date, CVV: cvv})
 		if err != nil {
 			fmt.Println("Ошибка, попробуйте еще раз")
 			return nil, "", err
 		}
 		return jsonReq, meta, err
+	case models.OTP:
+		var uri, meta string
+		fmt.Print("Введите ссылку otpauth:// или секрет в base32 без пробелов:")
+		scan(&uri)
+		fmt.Print("Введите заметку к данным:")
+		scan(&meta)
+		entry, err := client.ParseOTP(uri)
+		if err != nil {
+			fmt.Println("Ошибка: ", err)
+			return nil, "", err
+		}
+		jsonReq, err := json.Marshal(entry)
+		if err != nil {
+			fmt.Println("Ошибка, попробуйте еще раз")
+			return nil, "", err
+		}
+		return jsonReq, meta, err
 	}
 	return nil, "", fmt.Errorf("not found data type")
 }